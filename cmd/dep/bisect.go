@@ -0,0 +1,295 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/fs"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const bisectShortHelp = `Find the first version of a dependency that breaks a command`
+const bisectLongHelp = `
+Bisect searches the released versions of a dependency between a good and a bad
+version for the first one with which the given command fails, such as the
+build or the tests of the project.
+
+  dep bisect github.com/pkg/foo v1.2.0..v1.8.0 -- go test ./...
+
+Both bounds must be semver releases of the dependency, which must be in
+Gopkg.lock. The good version is assumed to pass and the bad one to fail. Each
+version tried is vendored in turn, and the command is run from the project
+root; it is taken to pass if it exits with status 0.
+
+When it's done, bisect restores Gopkg.lock and the vendor folder to what they
+were before it started.
+`
+
+func (cmd *bisectCommand) Name() string      { return "bisect" }
+func (cmd *bisectCommand) Args() string      { return "<project> <good>..<bad> -- <command...>" }
+func (cmd *bisectCommand) ShortHelp() string { return bisectShortHelp }
+func (cmd *bisectCommand) LongHelp() string  { return bisectLongHelp }
+func (cmd *bisectCommand) Hidden() bool      { return false }
+
+func (cmd *bisectCommand) Register(fs *flag.FlagSet) {
+	cmd.sourceFlags.register(fs)
+}
+
+type bisectCommand struct {
+	sourceFlags
+}
+
+func (cmd *bisectCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) < 4 || args[2] != "--" {
+		return errors.Errorf("usage: dep bisect %s", cmd.Args())
+	}
+	pr := gps.ProjectRoot(args[0])
+	good, bad, err := parseBisectRange(args[1])
+	if err != nil {
+		return err
+	}
+	command := args[3:]
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+	if p.Lock == nil {
+		return errors.Errorf("no %s found in project root %s", dep.LockName, p.AbsRoot)
+	}
+
+	var locked gps.LockedProject
+	var found bool
+	for _, lp := range p.Lock.Projects() {
+		if lp.Ident().ProjectRoot == pr {
+			locked, found = lp, true
+			break
+		}
+	}
+	if !found {
+		return errors.Errorf("%s is not in %s", pr, dep.LockName)
+	}
+
+	sm, err := ctx.SourceManager(p)
+	if err != nil {
+		return err
+	}
+	sm.UseDefaultSignalHandling()
+	defer sm.Release()
+
+	pvl, err := sm.ListVersions(locked.Ident())
+	if err != nil {
+		return errors.Wrapf(err, "unable to list the versions of %s", pr)
+	}
+	candidates, err := bisectCandidates(pvl, good, bad)
+	if err != nil {
+		return err
+	}
+
+	restore, err := saveVendorState(p.AbsRoot)
+	if err != nil {
+		return err
+	}
+
+	first, err := bisect(candidates, func(v gps.PairedVersion) (bool, error) {
+		if err := vendorVersion(p, locked, v, sm); err != nil {
+			return false, err
+		}
+		out, ok, err := runBisectCommand(p.AbsRoot, command)
+		if ctx.Loggers.Verbose {
+			ctx.Loggers.Err.Print(string(out))
+		}
+		if err == nil {
+			status := "good"
+			if !ok {
+				status = "bad"
+			}
+			ctx.Loggers.Err.Printf("dep: %s@%s is %s\n", pr, v, status)
+		}
+		return ok, err
+	})
+	if rerr := restore(); rerr != nil {
+		if err == nil {
+			err = rerr
+		} else {
+			ctx.Loggers.Err.Println(rerr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx.Loggers.Out.Printf("%s@%s is the first bad version\n", pr, first)
+	return nil
+}
+
+// parseBisectRange splits a range of the form good..bad.
+func parseBisectRange(s string) (good, bad string, err error) {
+	parts := strings.Split(s, "..")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.Errorf("invalid range %q; must be of the form good..bad", s)
+	}
+	return parts[0], parts[1], nil
+}
+
+// bisectCandidates returns the semver releases in pvl from good to bad,
+// inclusive, in ascending order.
+func bisectCandidates(pvl []gps.PairedVersion, good, bad string) ([]gps.PairedVersion, error) {
+	var releases byRelease
+	for _, pv := range pvl {
+		if pv.Type() != gps.IsSemver {
+			continue
+		}
+		sv, err := semver.NewVersion(pv.String())
+		if err != nil {
+			continue
+		}
+		releases = append(releases, release{sv, pv})
+	}
+	sort.Sort(releases)
+
+	start, end := -1, -1
+	for i, r := range releases {
+		switch r.pv.String() {
+		case good:
+			start = i
+		case bad:
+			end = i
+		}
+	}
+	switch {
+	case start == -1:
+		return nil, errors.Errorf("good version %s is not a release", good)
+	case end == -1:
+		return nil, errors.Errorf("bad version %s is not a release", bad)
+	case start >= end:
+		return nil, errors.Errorf("good version %s must come before bad version %s", good, bad)
+	}
+
+	candidates := make([]gps.PairedVersion, 0, end-start+1)
+	for _, r := range releases[start : end+1] {
+		candidates = append(candidates, r.pv)
+	}
+	return candidates, nil
+}
+
+type release struct {
+	sv semver.Version
+	pv gps.PairedVersion
+}
+
+type byRelease []release
+
+func (s byRelease) Len() int           { return len(s) }
+func (s byRelease) Less(i, j int) bool { return s[i].sv.LessThan(s[j].sv) }
+func (s byRelease) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// bisect returns the first of the ascending candidates for which try reports
+// failure. The first candidate is assumed to pass, and the last to fail, so
+// neither is tried.
+func bisect(candidates []gps.PairedVersion, try func(gps.PairedVersion) (bool, error)) (gps.PairedVersion, error) {
+	lo, hi := 0, len(candidates)-1
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		ok, err := try(candidates[mid])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return candidates[hi], nil
+}
+
+// vendorVersion writes the lock and vendor folder of p with the dependency in
+// locked switched to v.
+func vendorVersion(p *dep.Project, locked gps.LockedProject, v gps.PairedVersion, sm gps.SourceManager) error {
+	l := &dep.Lock{SolveMeta: p.Lock.SolveMeta}
+	for _, lp := range p.Lock.Projects() {
+		if lp.Ident() == locked.Ident() {
+			lp = gps.NewLockedProject(lp.Ident(), v, lp.Packages())
+		}
+		l.P = append(l.P, lp)
+	}
+
+	sw, err := dep.NewSafeWriter(nil, p.Lock, l, dep.VendorAlways, p.Manifest.VendorPruning())
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(sw.Write(p.AbsRoot, sm, false), "unable to vendor %s@%s", locked.Ident().ProjectRoot, v)
+}
+
+// runBisectCommand runs command from dir, and reports whether it succeeded.
+// An error is only returned if the command could not be run at all.
+func runBisectCommand(dir string, command []string) ([]byte, bool, error) {
+	c := exec.Command(command[0], command[1:]...)
+	c.Dir = dir
+	out, err := c.CombinedOutput()
+	if _, ok := err.(*exec.ExitError); ok {
+		return out, false, nil
+	}
+	if err != nil {
+		return out, false, errors.Wrapf(err, "unable to run %s", command[0])
+	}
+	return out, true, nil
+}
+
+// saveVendorState moves the vendor folder of the project at root aside and
+// keeps a copy of its lock. The returned function puts both back as they
+// were.
+func saveVendorState(root string) (func() error, error) {
+	lockPath := filepath.Join(root, dep.LockName)
+	lock, err := ioutil.ReadFile(lockPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the lock")
+	}
+
+	tmp, err := ioutil.TempDir("", "dep-bisect")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create a backup directory")
+	}
+
+	vendor := filepath.Join(root, "vendor")
+	backup := filepath.Join(tmp, "vendor")
+	hasVendor, err := fs.IsDir(vendor)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	if hasVendor {
+		if err := fs.RenameWithFallback(vendor, backup); err != nil {
+			os.RemoveAll(tmp)
+			return nil, errors.Wrap(err, "unable to back up the vendor folder")
+		}
+	}
+
+	return func() error {
+		if err := os.RemoveAll(vendor); err != nil {
+			return errors.Wrap(err, "unable to remove the bisected vendor folder")
+		}
+		if hasVendor {
+			if err := fs.RenameWithFallback(backup, vendor); err != nil {
+				return errors.Wrapf(err, "unable to restore the vendor folder, which was kept in %s", tmp)
+			}
+		}
+		if err := ioutil.WriteFile(lockPath, lock, 0666); err != nil {
+			return errors.Wrap(err, "unable to restore the lock")
+		}
+		return os.RemoveAll(tmp)
+	}, nil
+}
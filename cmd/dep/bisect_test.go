@@ -0,0 +1,121 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestBisectCandidates(t *testing.T) {
+	pvl := []gps.PairedVersion{
+		gps.NewVersion("v1.10.0").Is("a0196baa11ea047dd65037287451d36b861b00ea"),
+		gps.NewVersion("v1.2.0").Is("5c607206be5decd28e6263ffffdcee067266015e"),
+		gps.NewBranch("master").Is("645ef00459ed84a119197bfb8d8205042c6df63d"),
+		gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+		gps.NewVersion("v1.3.0-rc1").Is("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"),
+		gps.NewVersion("v2.0.0").Is("f1c4d5e2d0b8a2bd2d4bbbc5a6e3d6c8b0a0c0f0"),
+	}
+
+	got, err := bisectCandidates(pvl, "v1.0.0", "v1.10.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, v := range got {
+		names = append(names, v.String())
+	}
+	want := []string{"v1.0.0", "v1.2.0", "v1.3.0-rc1", "v1.10.0"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("expected candidates %v, got %v", want, names)
+	}
+
+	for _, bounds := range [][2]string{{"v0.9.0", "v1.2.0"}, {"v1.2.0", "master"}, {"v1.2.0", "v1.0.0"}} {
+		if _, err := bisectCandidates(pvl, bounds[0], bounds[1]); err == nil {
+			t.Errorf("%s..%s: expected an error", bounds[0], bounds[1])
+		}
+	}
+}
+
+func TestBisect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake build is a shell script")
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("proj")
+	root := h.Path("proj")
+
+	var candidates []gps.PairedVersion
+	for _, v := range []string{"v1.0.0", "v1.1.0", "v1.2.0", "v1.3.0", "v1.4.0", "v1.5.0", "v1.6.0", "v1.7.0"} {
+		candidates = append(candidates, gps.NewVersion(v).Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"))
+	}
+
+	// The build breaks from v1.5.0 onward.
+	build := []string{"sh", "-c", `case "$(cat VERSION)" in v1.[0-4].*) exit 0 ;; *) echo broken; exit 1 ;; esac`}
+	var tried []string
+	first, err := bisect(candidates, func(v gps.PairedVersion) (bool, error) {
+		tried = append(tried, v.String())
+		h.TempFile(filepath.Join("proj", "VERSION"), v.String())
+		_, ok, err := runBisectCommand(root, build)
+		return ok, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != "v1.5.0" {
+		t.Errorf("expected v1.5.0 to be the first bad version, got %s (tried %v)", first, tried)
+	}
+	if len(tried) > 3 {
+		t.Errorf("expected at most 3 versions to be tried, got %v", tried)
+	}
+
+	if _, _, err := runBisectCommand(root, []string{"dep-bisect-no-such-command"}); err == nil {
+		t.Error("expected an error for a command that can't be run")
+	}
+}
+
+func TestSaveVendorState(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile(filepath.Join("proj", dep.LockName), "memo = \"original\"\n")
+	h.TempFile(filepath.Join("proj", "vendor", "github.com", "sdboyer", "deptest", "deptest.go"), "package deptest\n")
+	root := h.Path("proj")
+
+	restore, err := saveVendorState(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.TempFile(filepath.Join("proj", dep.LockName), "memo = \"bisected\"\n")
+	h.TempFile(filepath.Join("proj", "vendor", "github.com", "sdboyer", "deptest", "other.go"), "package deptest\n")
+	if err := restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := ioutil.ReadFile(filepath.Join(root, dep.LockName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(lock) != "memo = \"original\"\n" {
+		t.Errorf("expected the lock to be restored, got %q", lock)
+	}
+	vendored := filepath.Join(root, "vendor", "github.com", "sdboyer", "deptest")
+	if _, err := os.Stat(filepath.Join(vendored, "deptest.go")); err != nil {
+		t.Errorf("expected the vendor folder to be restored: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(vendored, "other.go")); !os.IsNotExist(err) {
+		t.Errorf("expected the bisected vendor folder to be removed, got %v", err)
+	}
+}
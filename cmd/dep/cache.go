@@ -0,0 +1,264 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/fs"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const cacheShortHelp = `Manage the dependency source cache`
+const cacheLongHelp = `
+Cache operates on the cache of dependency sources that dep keeps under
+$GOPATH/pkg/dep, or in the directory given by -cachedir.
+
+Subcommands:
+
+  warm            Fetch every revision in Gopkg.lock into the cache
+  path <project>  Print the path of a checkout of the project at its locked
+                  revision, creating it from the cache if necessary
+  index           Print the sources in the cache, with the revisions at the
+                  tips of their branches and tags, as JSON
+
+Warming the cache ahead of time lets later dep invocations that share it,
+such as a fan-out of CI jobs, find everything they need without going to the
+network. Up to -parallel projects are fetched at once.
+
+The checkouts printed by path live in the checkouts directory of the cache,
+and are meant for reading while debugging a dependency; changes made to them
+are not picked up by dep.
+
+The index lists the project root, source URL, VCS type and revisions of each
+repository in the cache. It can be kept alongside a copy of the cache, so that
+the copy can be checked for completeness where it is used. index does not
+need to be run from a project.
+`
+
+func (cmd *cacheCommand) Name() string      { return "cache" }
+func (cmd *cacheCommand) Args() string      { return "[-parallel n] warm | path <project> | index" }
+func (cmd *cacheCommand) ShortHelp() string { return cacheShortHelp }
+func (cmd *cacheCommand) LongHelp() string  { return cacheLongHelp }
+func (cmd *cacheCommand) Hidden() bool      { return false }
+
+func (cmd *cacheCommand) Register(fs *flag.FlagSet) {
+	cmd.sourceFlags.register(fs)
+	fs.IntVar(&cmd.parallel, "parallel", defaultParallel(), "fetch up to this many projects at once when warming")
+}
+
+type cacheCommand struct {
+	sourceFlags
+
+	parallel int
+}
+
+func (cmd *cacheCommand) Run(ctx *dep.Ctx, args []string) error {
+	switch {
+	case len(args) == 1 && args[0] == "warm":
+	case len(args) == 2 && args[0] == "path":
+	case len(args) == 1 && args[0] == "index":
+		return cmd.runIndex(ctx)
+	default:
+		return errors.New("cache requires a subcommand: warm, path <project>, or index")
+	}
+	if cmd.parallel < 1 {
+		return errors.Errorf("invalid -parallel %d; must be at least 1", cmd.parallel)
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+	if p.Lock == nil {
+		return errors.Errorf("no %s found in project root %s", dep.LockName, p.AbsRoot)
+	}
+
+	sm, err := ctx.SourceManager(p)
+	if err != nil {
+		return err
+	}
+	sm.UseDefaultSignalHandling()
+	defer sm.Release()
+
+	if args[0] == "path" {
+		path, err := checkoutPath(ctx, p.Lock, args[1], sm)
+		if err != nil {
+			return err
+		}
+		ctx.Loggers.Out.Println(path)
+		return nil
+	}
+	return warmCache(ctx, p.Lock, sm, cmd.parallel)
+}
+
+func (cmd *cacheCommand) runIndex(ctx *dep.Ctx) error {
+	sm, err := ctx.SourceManager(nil)
+	if err != nil {
+		return err
+	}
+	sm.UseDefaultSignalHandling()
+	defer sm.Release()
+
+	sources, err := sm.CachedSources()
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(newCacheIndex(sources), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to encode the cache index")
+	}
+	ctx.Loggers.Out.Println(string(b))
+	return nil
+}
+
+// cacheIndexEntry is the JSON form of a gps.CachedSource.
+type cacheIndexEntry struct {
+	Root      string   `json:"root"`
+	Source    string   `json:"source"`
+	VCS       string   `json:"vcs"`
+	Revisions []string `json:"revisions"`
+}
+
+func newCacheIndex(sources []gps.CachedSource) []cacheIndexEntry {
+	index := make([]cacheIndexEntry, 0, len(sources))
+	for _, cs := range sources {
+		e := cacheIndexEntry{
+			Root:      string(cs.ProjectRoot),
+			Source:    cs.Source,
+			VCS:       cs.VCS,
+			Revisions: make([]string, 0, len(cs.Revisions)),
+		}
+		for _, r := range cs.Revisions {
+			e.Revisions = append(e.Revisions, string(r))
+		}
+		index = append(index, e)
+	}
+	return index
+}
+
+// warmCache fetches the sources of all the projects in l into sm's cache, up
+// to n at once, and checks that the locked revision of each is present.
+func warmCache(ctx *dep.Ctx, l gps.Lock, sm gps.SourceManager, n int) error {
+	projects := l.Projects()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, n)
+	errs := make([]error, len(projects))
+	for i, lp := range projects {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, lp gps.LockedProject) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = warmProject(lp, sm)
+			if errs[i] == nil && ctx.Loggers.Verbose {
+				ctx.Loggers.Err.Printf("dep: Cached %s at %s\n", lp.Ident().ProjectRoot, lockedRevision(lp))
+			}
+		}(i, lp)
+	}
+	wg.Wait()
+
+	var buf bytes.Buffer
+	for _, err := range errs {
+		if err != nil {
+			fmt.Fprintln(&buf, err)
+		}
+	}
+	if buf.Len() > 0 {
+		return errors.New(buf.String())
+	}
+	return nil
+}
+
+func warmProject(lp gps.LockedProject, sm gps.SourceManager) error {
+	id := lp.Ident()
+	if err := sm.SyncSourceFor(id); err != nil {
+		return errors.Wrapf(err, "unable to fetch %s", id.ProjectRoot)
+	}
+
+	rev := lockedRevision(lp)
+	if rev == "" {
+		return errors.Errorf("no revision locked for %s", id.ProjectRoot)
+	}
+	present, err := sm.RevisionPresentIn(id, rev)
+	if err != nil {
+		return errors.Wrapf(err, "unable to check for revision %s of %s", rev, id.ProjectRoot)
+	}
+	if !present {
+		return errors.Errorf("revision %s of %s not found in its source", rev, id.ProjectRoot)
+	}
+	return nil
+}
+
+// checkoutPath returns the path of a checkout of the locked revision of the
+// project in l that contains the package ip, exporting it from sm first if
+// there isn't one already.
+func checkoutPath(ctx *dep.Ctx, l gps.Lock, ip string, sm gps.SourceManager) (string, error) {
+	var lp gps.LockedProject
+	var found bool
+	for _, candidate := range l.Projects() {
+		pr := string(candidate.Ident().ProjectRoot)
+		if ip == pr || strings.HasPrefix(ip, pr+"/") {
+			lp, found = candidate, true
+			break
+		}
+	}
+	if !found {
+		return "", errors.Errorf("%s is not in %s", ip, dep.LockName)
+	}
+
+	id := lp.Ident()
+	rev := lockedRevision(lp)
+	if rev == "" {
+		return "", errors.Errorf("no revision locked for %s", id.ProjectRoot)
+	}
+
+	path := filepath.Join(ctx.Cachedir(), "checkouts", filepath.FromSlash(string(id.ProjectRoot))+"@"+string(rev))
+	if exists, err := fs.IsDir(path); err == nil && exists {
+		return path, nil
+	}
+
+	// Export next to the final location first, so that an interrupted export
+	// is never mistaken for a complete checkout.
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return "", errors.Wrap(err, "unable to create checkout directory")
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(path), ".export")
+	if err != nil {
+		return "", errors.Wrap(err, "unable to create checkout directory")
+	}
+	defer os.RemoveAll(tmp)
+
+	export := filepath.Join(tmp, "src")
+	if err := sm.ExportProject(id, rev, export); err != nil {
+		return "", errors.Wrapf(err, "unable to check out revision %s of %s", rev, id.ProjectRoot)
+	}
+	if err := fs.RenameWithFallback(export, path); err != nil {
+		return "", errors.Wrap(err, "unable to move checkout into place")
+	}
+	return path, nil
+}
+
+// lockedRevision returns the revision of lp, if it has one.
+func lockedRevision(lp gps.LockedProject) gps.Revision {
+	switch v := lp.Version().(type) {
+	case gps.Revision:
+		return v
+	case gps.PairedVersion:
+		return v.Underlying()
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestCacheWarm(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("src/warm")
+	for _, name := range []string{dep.ManifestName, dep.LockName} {
+		h.TempCopy(filepath.Join("src/warm", name), filepath.Join("cache", name))
+	}
+
+	ctx := &dep.Ctx{
+		GOPATH:     h.Path("."),
+		WorkingDir: h.Path("src/warm"),
+		Loggers: &dep.Loggers{
+			Out: log.New(ioutil.Discard, "", 0),
+			Err: log.New(ioutil.Discard, "", 0),
+		},
+	}
+	p, err := ctx.LoadProject()
+	h.Must(err)
+
+	sm := &fakeSourceManager{syncDelay: 10 * time.Millisecond}
+	h.Must(warmCache(ctx, p.Lock, sm, 2))
+
+	want := map[gps.ProjectRoot]gps.Revision{
+		"github.com/sdboyer/deptest":    "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+		"github.com/sdboyer/deptestdos": "5c607206be5decd28e6263ffffdcee067266015e",
+		"github.com/pkg/errors":         "645ef00459ed84a119197bfb8d8205042c6df63d",
+	}
+	if len(sm.present) != len(want) {
+		t.Errorf("expected %d revisions to be fetched, got %d: %v", len(want), len(sm.present), sm.present)
+	}
+	for pr, rev := range want {
+		if !sm.synced[pr] {
+			t.Errorf("expected %s to be fetched", pr)
+		}
+		if sm.present[pr] != rev {
+			t.Errorf("expected revision %s of %s to be fetched, got %q", rev, pr, sm.present[pr])
+		}
+	}
+	if max := sm.syncing.Max(); max != 2 {
+		t.Errorf("expected 2 projects to be fetched at once, got %d", max)
+	}
+}
+
+func TestCachePath(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("src/cached")
+	for _, name := range []string{dep.ManifestName, dep.LockName} {
+		h.TempCopy(filepath.Join("src/cached", name), filepath.Join("cache", name))
+	}
+
+	ctx := &dep.Ctx{
+		GOPATH:     h.Path("."),
+		WorkingDir: h.Path("src/cached"),
+		Loggers: &dep.Loggers{
+			Out: log.New(ioutil.Discard, "", 0),
+			Err: log.New(ioutil.Discard, "", 0),
+		},
+	}
+	p, err := ctx.LoadProject()
+	h.Must(err)
+
+	sm := &fakeSourceManager{files: map[string]string{
+		"errors.go":       "package errors\n",
+		"sub/stack.go":    "package sub\n",
+		"vendor/x/x.go":   "package x\n",
+		"testdata/a.json": "{}\n",
+	}}
+
+	path, err := checkoutPath(ctx, p.Lock, "github.com/pkg/errors", sm)
+	h.Must(err)
+	want := filepath.Join(ctx.Cachedir(), "checkouts", "github.com", "pkg", "errors@645ef00459ed84a119197bfb8d8205042c6df63d")
+	if path != want {
+		t.Errorf("expected checkout path %s, got %s", want, path)
+	}
+	for name, body := range sm.files {
+		got, err := ioutil.ReadFile(filepath.Join(path, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("expected %s in the checkout: %s", name, err)
+			continue
+		}
+		if string(got) != body {
+			t.Errorf("expected %s to hold %q, got %q", name, body, got)
+		}
+	}
+
+	// Packages within the project resolve to the same checkout, which is
+	// reused rather than exported again.
+	again, err := checkoutPath(ctx, p.Lock, "github.com/pkg/errors/sub", sm)
+	h.Must(err)
+	if again != path {
+		t.Errorf("expected the same checkout path %s for a subpackage, got %s", path, again)
+	}
+	if sm.exports != 1 {
+		t.Errorf("expected a single export, got %d", sm.exports)
+	}
+
+	for _, ip := range []string{"github.com/not/locked", "github.com/pkg/errorsx"} {
+		if _, err := checkoutPath(ctx, p.Lock, ip, sm); err == nil || !strings.Contains(err.Error(), "is not in "+dep.LockName) {
+			t.Errorf("%s: expected an error saying it isn't locked, got %v", ip, err)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+// importRewrite records that the vendored copy of canonical imports its own
+// packages under the path alias, which names the same repository.
+type importRewrite struct {
+	alias, canonical gps.ProjectRoot
+}
+
+// canonicalizeSelfImports finds the projects in l that are duplicate copies of
+// another locked project, at the same revision of the same repository, and
+// are imported by nothing but that project itself; that is, by the project
+// importing its own packages under a different path, such as one differing
+// only in case. ptree is the package tree of the root project.
+//
+// It returns a lock without the duplicates, in which each project they
+// duplicate also holds their packages, along with the rewrites of import
+// paths needed in the vendored copies of those projects.
+func canonicalizeSelfImports(ptree pkgtree.PackageTree, l *dep.Lock, sm gps.SourceManager) (*dep.Lock, []importRewrite, error) {
+	projects := l.Projects()
+
+	// owner returns the root of the locked project that provides the package
+	// ip, if any.
+	owner := func(ip string) (gps.ProjectRoot, bool) {
+		for _, lp := range projects {
+			pr := lp.Ident().ProjectRoot
+			if ip == string(pr) || strings.HasPrefix(ip, string(pr)+"/") {
+				return pr, true
+			}
+		}
+		return "", false
+	}
+
+	// importers maps each locked project to the projects that import it. The
+	// root project is recorded under its own import root.
+	importers := make(map[gps.ProjectRoot]map[gps.ProjectRoot]bool)
+	addImports := func(from gps.ProjectRoot, imports []string) {
+		for _, ip := range imports {
+			if to, ok := owner(ip); ok {
+				if importers[to] == nil {
+					importers[to] = make(map[gps.ProjectRoot]bool)
+				}
+				importers[to][from] = true
+			}
+		}
+	}
+
+	rootName := gps.ProjectRoot(ptree.ImportRoot)
+	for _, poe := range ptree.Packages {
+		if poe.Err == nil {
+			addImports(rootName, poe.P.Imports)
+			addImports(rootName, poe.P.TestImports)
+		}
+	}
+
+	groups := make(map[string][]gps.LockedProject)
+	var keys []string
+	for _, lp := range projects {
+		id := lp.Ident()
+		tree, err := sm.ListPackages(id, lp.Version())
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "unable to list the packages of %s", id.ProjectRoot)
+		}
+		for _, pkg := range lp.Packages() {
+			ip := string(id.ProjectRoot)
+			if pkg != "." {
+				ip += "/" + pkg
+			}
+			if poe, has := tree.Packages[ip]; has && poe.Err == nil {
+				addImports(id.ProjectRoot, poe.P.Imports)
+			}
+		}
+
+		key := repositoryKey(id) + "@" + string(lockedRevision(lp))
+		if _, has := groups[key]; !has {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], lp)
+	}
+	sort.Strings(keys)
+
+	aliasOf := make(map[gps.ProjectRoot]gps.ProjectRoot)
+	var rewrites []importRewrite
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+
+		inGroup := make(map[gps.ProjectRoot]bool, len(group))
+		for _, lp := range group {
+			inGroup[lp.Ident().ProjectRoot] = true
+		}
+
+		// The canonical copy is the only one imported from outside the
+		// group; the others are only there for its own imports.
+		var canonical []gps.ProjectRoot
+		var aliases []gps.ProjectRoot
+		for _, lp := range group {
+			pr := lp.Ident().ProjectRoot
+			external := false
+			for from := range importers[pr] {
+				if !inGroup[from] {
+					external = true
+				}
+			}
+			if external {
+				canonical = append(canonical, pr)
+			} else {
+				aliases = append(aliases, pr)
+			}
+		}
+		if len(canonical) != 1 {
+			continue
+		}
+		for _, alias := range aliases {
+			aliasOf[alias] = canonical[0]
+			rewrites = append(rewrites, importRewrite{alias: alias, canonical: canonical[0]})
+		}
+	}
+	if len(rewrites) == 0 {
+		return l, nil, nil
+	}
+
+	// Fold the packages of each duplicate into the project it duplicates.
+	pkgs := make(map[gps.ProjectRoot][]string)
+	for _, lp := range projects {
+		pr := lp.Ident().ProjectRoot
+		if c, has := aliasOf[pr]; has {
+			pr = c
+		}
+		pkgs[pr] = append(pkgs[pr], lp.Packages()...)
+	}
+
+	nl := &dep.Lock{SolveMeta: l.SolveMeta}
+	for _, lp := range projects {
+		pr := lp.Ident().ProjectRoot
+		if _, has := aliasOf[pr]; has {
+			continue
+		}
+		nl.P = append(nl.P, gps.NewLockedProject(lp.Ident(), lp.Version(), dedupeStrings(pkgs[pr])))
+		if t, has := l.CommitTimes[pr]; has {
+			setCommitTime(nl, pr, t)
+		}
+	}
+	return nl, rewrites, nil
+}
+
+// repositoryKey identifies the repository of the project id, regardless of
+// the scheme of its source URL or the case of its path.
+func repositoryKey(id gps.ProjectIdentifier) string {
+	s := id.Source
+	if s == "" {
+		s = string(id.ProjectRoot)
+	}
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+len("://"):]
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "/"), ".git")
+	return strings.ToLower(s)
+}
+
+func dedupeStrings(s []string) []string {
+	seen := make(map[string]bool, len(s))
+	out := make([]string, 0, len(s))
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// rewriteVendoredImports rewrites the imports of the alias paths in the Go
+// files of the vendored copy of each canonical project in vendor, so that
+// they refer to the project's own packages. Only the project's own files are
+// changed.
+func rewriteVendoredImports(vendor string, rewrites []importRewrite) error {
+	for _, rw := range rewrites {
+		dir := filepath.Join(vendor, filepath.FromSlash(string(rw.canonical)))
+		err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() || !strings.HasSuffix(path, ".go") {
+				return nil
+			}
+			return rewriteFileImports(path, fi.Mode(), rw)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "unable to rewrite the imports of %s in %s", rw.alias, rw.canonical)
+		}
+	}
+	return nil
+}
+
+func rewriteFileImports(path string, mode os.FileMode, rw importRewrite) error {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+
+	alias := string(rw.alias)
+	var changed bool
+	for _, imp := range f.Imports {
+		ip, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		if ip == alias || strings.HasPrefix(ip, alias+"/") {
+			imp.Path.Value = strconv.Quote(string(rw.canonical) + ip[len(alias):])
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	ast.SortImports(fset, f)
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), mode)
+}
@@ -0,0 +1,397 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/paths"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+const checkShortHelp = `Check that Gopkg.toml, Gopkg.lock and vendor agree`
+const checkLongHelp = `
+Check verifies that Gopkg.lock is in sync with Gopkg.toml and the project's
+imports, and that the vendor tree holds what Gopkg.lock records, without
+solving, going to the network or modifying anything. It fails with a report of
+every disagreement it finds, by category, which makes it suitable for CI.
+
+With -inputs, the inputs-digest recorded in Gopkg.lock is compared to the
+digest of Gopkg.toml and the project's imports, which differ once either has
+changed since the lock was last solved.
+
+With -digests, the vendored copy of each locked project is checked against the
+content digest recorded for it in Gopkg.lock when ensure last wrote vendor, and
+against its pin-digest in Gopkg.toml, if it has one. This catches vendored code
+that has been edited by hand since.
+
+With -imports, each package that the project imports or requires, outside the
+standard library, must be provided by a project in Gopkg.lock.
+
+With -packages, the Go packages in the vendored copy of each locked project are
+compared to the packages listed for it in Gopkg.lock, which can drift apart
+when either is edited by hand. Packages that are vendored but not listed are
+reported with a +, and packages that are listed but not vendored with a -.
+
+With no flags, every check is run.
+
+With -policy, Gopkg.lock is also checked against the rules in a policy file,
+as dep ensure -policy checks solutions, and with -no-branches, no project may
+be locked to a branch. These add to the checks above, rather than select among
+them.
+`
+
+func (cmd *checkCommand) Name() string { return "check" }
+func (cmd *checkCommand) Args() string {
+	return "[-inputs] [-digests] [-imports] [-packages] [-policy file] [-no-branches]"
+}
+func (cmd *checkCommand) ShortHelp() string { return checkShortHelp }
+func (cmd *checkCommand) LongHelp() string  { return checkLongHelp }
+func (cmd *checkCommand) Hidden() bool      { return false }
+
+func (cmd *checkCommand) Register(fs *flag.FlagSet) {
+	cmd.sourceFlags.register(fs)
+	fs.BoolVar(&cmd.inputs, "inputs", false, "check that the inputs-digest in Gopkg.lock matches Gopkg.toml and the project's imports")
+	fs.BoolVar(&cmd.digests, "digests", false, "check that vendored projects match their digests in Gopkg.lock and their pin-digest in Gopkg.toml")
+	fs.BoolVar(&cmd.imports, "imports", false, "check that every imported package is provided by a project in Gopkg.lock")
+	fs.BoolVar(&cmd.packages, "packages", false, "check that the packages of each vendored project match those listed in Gopkg.lock")
+	fs.StringVar(&cmd.policy, "policy", "", "also check that Gopkg.lock satisfies the policy in this file")
+	fs.BoolVar(&cmd.noBranches, "no-branches", false, "also check that no project in Gopkg.lock is locked to a branch")
+}
+
+type checkCommand struct {
+	sourceFlags
+
+	inputs, digests, imports, packages bool
+	policy                             string
+	noBranches                         bool
+}
+
+func (cmd *checkCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) > 0 {
+		return errors.Errorf("too many args (%d)", len(args))
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+	if p.Lock == nil {
+		return errors.Errorf("no %s found in project root %s", dep.LockName, p.AbsRoot)
+	}
+
+	policy, err := loadPolicy(cmd.policy, cmd.noBranches)
+	if err != nil {
+		return err
+	}
+
+	// With no check selected, every check runs.
+	if !cmd.inputs && !cmd.digests && !cmd.imports && !cmd.packages {
+		cmd.inputs, cmd.digests, cmd.imports, cmd.packages = true, true, true, true
+	}
+
+	var ptree pkgtree.PackageTree
+	if cmd.inputs || cmd.imports {
+		ptree, err = ctx.ListPackages(p.AbsRoot, string(p.ImportRoot))
+		if err != nil {
+			return errors.Wrap(err, "analysis of local packages failed")
+		}
+	}
+	vendor := filepath.Join(p.AbsRoot, "vendor")
+	out := ctx.Loggers.Out
+
+	// Each check reports its failures under its own heading, and adds a
+	// summary of them to fails.
+	var fails []string
+	if cmd.inputs {
+		digest, err := inputsDigest(ctx, p, ptree)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(digest, p.Lock.SolveMeta.InputsDigest) {
+			out.Printf("%s is out of sync with %s or the project's imports:\n", dep.LockName, dep.ManifestName)
+			out.Printf("  %s has inputs-digest %x, but they hash to %x\n", dep.LockName, p.Lock.SolveMeta.InputsDigest, digest)
+			fails = append(fails, fmt.Sprintf("%s is out of sync with %s or the project's imports", dep.LockName, dep.ManifestName))
+		}
+	}
+
+	if cmd.digests {
+		drift, err := vendorDigestDrift(vendor, p.Manifest.PinDigest, p.Lock)
+		if err != nil {
+			return err
+		}
+		if len(drift) > 0 {
+			out.Println("Vendored projects that don't match their digest:")
+			projects := make(map[gps.ProjectRoot]bool)
+			for _, d := range drift {
+				projects[d.root] = true
+				switch {
+				case d.got == "":
+					out.Printf("  %s: not vendored\n", d.root)
+				case d.pinned:
+					out.Printf("  %s: pinned to %s, but vendored as %s\n", d.root, d.want, d.got)
+				default:
+					out.Printf("  %s: locked as %s, but vendored as %s\n", d.root, d.want, d.got)
+				}
+			}
+			fails = append(fails, fmt.Sprintf("the vendored copies of %d project(s) don't match their digest", len(projects)))
+		}
+	}
+
+	if cmd.imports {
+		missing := missingImports(ptree, p.Manifest, p.Lock)
+		if len(missing) > 0 {
+			out.Printf("Imported packages missing from %s:\n", dep.LockName)
+			for _, ip := range missing {
+				out.Printf("  %s\n", ip)
+			}
+			fails = append(fails, fmt.Sprintf("%d imported package(s) are missing from %s", len(missing), dep.LockName))
+		}
+	}
+
+	if cmd.packages {
+		drift, err := packageDrift(vendor, p.Lock)
+		if err != nil {
+			return err
+		}
+		if len(drift) > 0 {
+			out.Printf("Vendored packages that differ from %s:\n", dep.LockName)
+			for _, d := range drift {
+				out.Printf("  %s:\n", d.root)
+				if d.missing {
+					out.Println("    not vendored")
+					continue
+				}
+				for _, pkg := range d.added {
+					out.Printf("    + %s\n", pkg)
+				}
+				for _, pkg := range d.removed {
+					out.Printf("    - %s\n", pkg)
+				}
+			}
+			fails = append(fails, fmt.Sprintf("the vendored packages of %d project(s) differ from %s", len(drift), dep.LockName))
+		}
+	}
+
+	if policy != nil {
+		if err := policy.ValidateSolution(p.Lock); err != nil {
+			violations := strings.Split(strings.TrimSpace(err.Error()), "\n")
+			out.Printf("Locked projects that violate the policy:\n")
+			for _, v := range violations {
+				out.Printf("  %s\n", v)
+			}
+			fails = append(fails, fmt.Sprintf("%s violates the policy in %d way(s)", dep.LockName, len(violations)))
+		}
+	}
+
+	if len(fails) > 0 {
+		return errors.New(strings.Join(fails, "; "))
+	}
+	return nil
+}
+
+// inputsDigest returns the digest of the inputs to solving p, with its
+// packages ptree, as would be recorded in a new lock.
+func inputsDigest(ctx *dep.Ctx, p *dep.Project, ptree pkgtree.PackageTree) ([]byte, error) {
+	sm, err := ctx.SourceManager(p)
+	if err != nil {
+		return nil, err
+	}
+	defer sm.Release()
+
+	params := p.MakeParams()
+	params.RootPackageTree = ptree
+	s, err := gps.Prepare(params, sm)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not set up solver for input hashing")
+	}
+	return s.HashInputs(), nil
+}
+
+// digestDrift describes a locked project whose vendored copy doesn't have the
+// content digest recorded for it in the lock, or the one it is pinned to.
+type digestDrift struct {
+	root      gps.ProjectRoot
+	pinned    bool   // want is the project's pin-digest, not its digest in the lock
+	want, got string // got is empty if the project isn't vendored
+}
+
+// vendorDigestDrift digests the vendored copy of each project of l that has a
+// digest in l or a pin in pins, and returns a drift for each of those it
+// doesn't match, in the order of the lock.
+func vendorDigestDrift(vendor string, pins map[gps.ProjectRoot]string, l *dep.Lock) ([]digestDrift, error) {
+	var drift []digestDrift
+	for _, lp := range l.Projects() {
+		root := lp.Ident().ProjectRoot
+		var wants []digestDrift
+		if want, has := l.Digests[root]; has {
+			wants = append(wants, digestDrift{root: root, want: want})
+		}
+		if want, has := pins[root]; has {
+			wants = append(wants, digestDrift{root: root, pinned: true, want: want})
+		}
+		if len(wants) == 0 {
+			continue
+		}
+
+		dir := filepath.Join(vendor, filepath.FromSlash(string(root)))
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			drift = append(drift, digestDrift{root: root, want: wants[0].want})
+			continue
+		}
+		got, err := dep.DigestDir(dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to digest the vendored copy of %s", root)
+		}
+		for _, d := range wants {
+			if d.want != got {
+				d.got = got
+				drift = append(drift, d)
+			}
+		}
+	}
+	return drift, nil
+}
+
+// missingImports returns the packages, outside the standard library, that the
+// packages of ptree import or that m requires, but that no project in l lists,
+// sorted. Packages that m ignores are left out, as are their imports, and so
+// are the imports of test files if m skips them.
+func missingImports(ptree pkgtree.PackageTree, m *dep.Manifest, l *dep.Lock) []string {
+	rm, _ := ptree.ToReachMap(true, !m.SkipTestImports, false, m.IgnoredPackages())
+	projects := l.Projects()
+
+	seen := make(map[string]bool)
+	var missing []string
+	for _, ip := range append(rm.FlattenFn(paths.IsStandardImportPath), m.Required...) {
+		if seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		if !lockProvides(projects, ip) {
+			missing = append(missing, ip)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// lockProvides reports whether the package ip is among those listed for the
+// project of projects with the longest root containing it.
+func lockProvides(projects []gps.LockedProject, ip string) bool {
+	var found gps.LockedProject
+	var has bool
+	for _, lp := range projects {
+		root := string(lp.Ident().ProjectRoot)
+		if isPathPrefix(ip, root) && (!has || len(root) > len(found.Ident().ProjectRoot)) {
+			found, has = lp, true
+		}
+	}
+	if !has {
+		return false
+	}
+
+	pkg := strings.TrimPrefix(strings.TrimPrefix(ip, string(found.Ident().ProjectRoot)), "/")
+	if pkg == "" {
+		pkg = "."
+	}
+	for _, listed := range found.Packages() {
+		if listed == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// projectPackageDrift describes how the packages vendored for a locked project
+// differ from those listed for it in the lock.
+type projectPackageDrift struct {
+	root    gps.ProjectRoot
+	missing bool     // The project isn't vendored at all
+	added   []string // Vendored, but not listed in the lock
+	removed []string // Listed in the lock, but not vendored
+}
+
+// packageDrift compares the packages of each project in l, as vendored under
+// vendor, to those the lock lists for it, and returns the projects that
+// differ, in the order of the lock. Packages are named relative to their
+// project root, as in the lock, and those of a project vendored inside
+// another are left to that project.
+func packageDrift(vendor string, l *dep.Lock) ([]projectPackageDrift, error) {
+	projects := l.Projects()
+
+	var drift []projectPackageDrift
+	for _, lp := range projects {
+		root := lp.Ident().ProjectRoot
+		dir := filepath.Join(vendor, filepath.FromSlash(string(root)))
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			drift = append(drift, projectPackageDrift{root: root, missing: true})
+			continue
+		}
+
+		ptree, err := pkgtree.ListPackages(dir, string(root))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list the vendored packages of %s", root)
+		}
+
+		vendored := make(map[string]bool)
+		for ip, poe := range ptree.Packages {
+			if _, ok := poe.Err.(*build.NoGoError); ok {
+				continue
+			}
+			if nestedProject(projects, root, ip) {
+				continue
+			}
+			pkg := strings.TrimPrefix(strings.TrimPrefix(ip, string(root)), "/")
+			if pkg == "" {
+				pkg = "."
+			}
+			vendored[pkg] = true
+		}
+
+		d := projectPackageDrift{root: root}
+		listed := make(map[string]bool)
+		for _, pkg := range lp.Packages() {
+			listed[pkg] = true
+			if !vendored[pkg] {
+				d.removed = append(d.removed, pkg)
+			}
+		}
+		for pkg := range vendored {
+			if !listed[pkg] {
+				d.added = append(d.added, pkg)
+			}
+		}
+		if len(d.added) > 0 || len(d.removed) > 0 {
+			sort.Strings(d.added)
+			sort.Strings(d.removed)
+			drift = append(drift, d)
+		}
+	}
+	return drift, nil
+}
+
+// nestedProject reports whether the package ip, found under root, belongs to
+// another of the projects, whose root is below root.
+func nestedProject(projects []gps.LockedProject, root gps.ProjectRoot, ip string) bool {
+	for _, lp := range projects {
+		pr := string(lp.Ident().ProjectRoot)
+		if len(pr) > len(root) && strings.HasPrefix(pr, string(root)+"/") &&
+			(ip == pr || strings.HasPrefix(ip, pr+"/")) {
+			return true
+		}
+	}
+	return false
+}
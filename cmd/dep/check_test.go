@@ -0,0 +1,169 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestCheckPackages(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	proj := filepath.Join("src", "proj")
+	vendor := filepath.Join(proj, "vendor")
+	h.TempFile(filepath.Join(proj, dep.ManifestName), "")
+	h.TempFile(filepath.Join(proj, dep.LockName), `[[projects]]
+  name = "github.com/foo/bar"
+  packages = [".","old"]
+  revision = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+
+[[projects]]
+  name = "github.com/foo/baz"
+  packages = ["."]
+  revision = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+
+[[projects]]
+  name = "github.com/foo/gone"
+  packages = ["."]
+  revision = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+
+[solve-meta]
+  analyzer-name = "dep"
+  analyzer-version = 1
+  inputs-digest = "ab4fef131ee828e96ba67d31a7d690bd5f2f42040c6766b1b12fe856f87e0ff7"
+  solver-name = "gps-cdcl"
+  solver-version = 1
+`)
+	// bar has gained a package and lost one since the lock was written;
+	// baz matches it, though it holds a directory without Go files.
+	h.TempFile(filepath.Join(vendor, "github.com", "foo", "bar", "bar.go"), "package bar\n")
+	h.TempFile(filepath.Join(vendor, "github.com", "foo", "bar", "new", "new.go"), "package new\n")
+	h.TempFile(filepath.Join(vendor, "github.com", "foo", "baz", "baz.go"), "package baz\n")
+	h.TempFile(filepath.Join(vendor, "github.com", "foo", "baz", "docs", "README"), "")
+
+	env := []string{"GOPATH=" + h.Path("."), "HOME=" + h.Path(".")}
+	for _, args := range [][]string{{"check", "-packages"}, {"check"}} {
+		var stdout, stderr bytes.Buffer
+		if err := runMain("dep", args, &stdout, &stderr, h.Path(proj), env); err == nil {
+			t.Fatalf("%v: expected the drift to fail the check, got:\n%s", args, stdout.String())
+		}
+
+		want := "Vendored packages that differ from Gopkg.lock:\n  github.com/foo/bar:\n    + new\n    - old\n  github.com/foo/gone:\n    not vendored\n"
+		if stdout.String() != want {
+			t.Errorf("%v: unexpected report:\n\t(GOT) %q\n\t(WNT) %q", args, stdout.String(), want)
+		}
+		if !strings.Contains(stderr.String(), "the vendored packages of 2 project(s) differ") {
+			t.Errorf("%v: unexpected error: %s", args, stderr.String())
+		}
+	}
+
+	// Without -packages, selecting another check leaves the drift unreported.
+	var stdout, stderr bytes.Buffer
+	if err := runMain("dep", []string{"check", "-imports"}, &stdout, &stderr, h.Path(proj), env); err != nil {
+		t.Fatalf("expected the package check to be skipped, got:\n%s%s", stdout.String(), stderr.String())
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("expected no report, got %q", stdout.String())
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	proj := filepath.Join("src", "proj")
+	h.TempFile(filepath.Join(proj, dep.ManifestName), "")
+	h.TempFile(filepath.Join(proj, dep.LockName), `[[projects]]
+  branch = "master"
+  name = "github.com/foo/bar"
+  packages = ["."]
+  revision = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+
+[[projects]]
+  name = "github.com/foo/baz"
+  packages = ["."]
+  revision = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+  version = "v1.0.0"
+`)
+	h.TempFile(filepath.Join(proj, "vendor", "github.com", "foo", "bar", "bar.go"), "package bar\n")
+	h.TempFile(filepath.Join(proj, "vendor", "github.com", "foo", "baz", "baz.go"), "package baz\n")
+	h.TempFile("policy.toml", "forbidden = [\"github.com/foo/baz\"]\n")
+
+	env := []string{"GOPATH=" + h.Path("."), "HOME=" + h.Path(".")}
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"check", "-packages"}, ""},
+		{[]string{"check", "-packages", "-no-branches"}, "Locked projects that violate the policy:\n  github.com/foo/bar is locked to branch master, which is forbidden by policy\n"},
+		{[]string{"check", "-packages", "-policy", h.Path("policy.toml")}, "Locked projects that violate the policy:\n  github.com/foo/baz is forbidden by policy\n"},
+	} {
+		var stdout, stderr bytes.Buffer
+		err := runMain("dep", tc.args, &stdout, &stderr, h.Path(proj), env)
+		if tc.want == "" {
+			if err != nil {
+				t.Errorf("%v: unexpected error: %s\n%s", tc.args, err, stdout.String())
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%v: expected the policy to fail the check", tc.args)
+		}
+		if stdout.String() != tc.want {
+			t.Errorf("%v: unexpected report:\n\t(GOT) %q\n\t(WNT) %q", tc.args, stdout.String(), tc.want)
+		}
+		if !strings.Contains(stderr.String(), "Gopkg.lock violates the policy in 1 way(s)") {
+			t.Errorf("%v: unexpected error: %s", tc.args, stderr.String())
+		}
+	}
+}
+
+func TestMissingImports(t *testing.T) {
+	ptree := pkgtree.PackageTree{
+		ImportRoot: "example.com/proj",
+		Packages: map[string]pkgtree.PackageOrErr{
+			"example.com/proj": {P: pkgtree.Package{
+				ImportPath: "example.com/proj",
+				Imports: []string{
+					"fmt",
+					"example.com/proj/sub",
+					"github.com/foo/bar",
+					"github.com/foo/bar/unlisted",
+					"github.com/foo/bar/nested/pkg",
+					"github.com/foo/unlocked",
+					"github.com/foo/ignored",
+				},
+			}},
+			"example.com/proj/sub": {P: pkgtree.Package{ImportPath: "example.com/proj/sub"}},
+		},
+	}
+	m := &dep.Manifest{
+		Ignored:  []string{"github.com/foo/ignored"},
+		Required: []string{"github.com/foo/required"},
+	}
+	locked := func(pr string, pkgs ...string) gps.LockedProject {
+		return gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(pr)}, gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), pkgs)
+	}
+	l := &dep.Lock{P: []gps.LockedProject{
+		locked("github.com/foo/bar", "."),
+		locked("github.com/foo/bar/nested", "pkg"),
+	}}
+
+	got := missingImports(ptree, m, l)
+	want := []string{"github.com/foo/bar/unlisted", "github.com/foo/required", "github.com/foo/unlocked"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected missing imports:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+}
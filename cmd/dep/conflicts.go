@@ -0,0 +1,131 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const conflictsShortHelp = `Find dependencies that several locks pin differently`
+const conflictsLongHelp = `
+Conflicts reads two or more locks and reports each project that they lock to
+different revisions, with the version each lock pins it to. It fails if there
+are any, so that repositories that are built or deployed together can be
+checked for dependencies they disagree on before they are integrated.
+
+Each argument is the path of a lock, or of a directory holding Gopkg.lock.
+Projects that only one of the locks holds are not reported. Conflicts does not
+need to be run from a project.
+`
+
+func (cmd *conflictsCommand) Name() string      { return "conflicts" }
+func (cmd *conflictsCommand) Args() string      { return "<lock> <lock> [<lock>...]" }
+func (cmd *conflictsCommand) ShortHelp() string { return conflictsShortHelp }
+func (cmd *conflictsCommand) LongHelp() string  { return conflictsLongHelp }
+func (cmd *conflictsCommand) Hidden() bool      { return false }
+
+func (cmd *conflictsCommand) Register(fs *flag.FlagSet) {}
+
+type conflictsCommand struct{}
+
+// namedLock is a lock, and the path it was read from.
+type namedLock struct {
+	path string
+	lock *dep.Lock
+}
+
+// lockConflict is a project that several locks pin to different revisions.
+type lockConflict struct {
+	root gps.ProjectRoot
+	pins []lockPin // In the order of the locks
+}
+
+// lockPin is the version and revision a lock pins a project to.
+type lockPin struct {
+	path     string
+	version  gps.Version
+	revision gps.Revision
+}
+
+func (cmd *conflictsCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) < 2 {
+		return errors.New("conflicts requires the paths of at least two locks")
+	}
+
+	locks := make([]namedLock, 0, len(args))
+	for _, arg := range args {
+		path := arg
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(ctx.WorkingDir, path)
+		}
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			path = filepath.Join(path, dep.LockName)
+			arg = filepath.Join(arg, dep.LockName)
+		}
+
+		l, err := dep.LoadLock(path)
+		if err != nil {
+			return err
+		}
+		locks = append(locks, namedLock{path: arg, lock: l})
+	}
+
+	conflicts := findLockConflicts(locks)
+	for _, c := range conflicts {
+		ctx.Loggers.Out.Println(c.root)
+		for _, pin := range c.pins {
+			v := formatVersion(pin.version)
+			if pin.version.Type() != gps.IsRevision {
+				v += " (" + formatVersion(pin.revision) + ")"
+			}
+			ctx.Loggers.Out.Printf("  %s in %s\n", v, pin.path)
+		}
+	}
+	if len(conflicts) > 0 {
+		return errors.Errorf("%d project(s) are locked to different revisions", len(conflicts))
+	}
+	return nil
+}
+
+// findLockConflicts returns the projects that are locked to different
+// revisions by the locks, sorted by project root.
+func findLockConflicts(locks []namedLock) []lockConflict {
+	pins := make(map[gps.ProjectRoot][]lockPin)
+	for _, nl := range locks {
+		for _, lp := range nl.lock.Projects() {
+			root := lp.Ident().ProjectRoot
+			pins[root] = append(pins[root], lockPin{
+				path:     nl.path,
+				version:  lp.Version(),
+				revision: lockedRevision(lp),
+			})
+		}
+	}
+
+	var conflicts []lockConflict
+	for root, pp := range pins {
+		for _, pin := range pp[1:] {
+			if pin.revision != pp[0].revision {
+				conflicts = append(conflicts, lockConflict{root: root, pins: pp})
+				break
+			}
+		}
+	}
+	sort.Sort(byConflictRoot(conflicts))
+	return conflicts
+}
+
+type byConflictRoot []lockConflict
+
+func (s byConflictRoot) Len() int           { return len(s) }
+func (s byConflictRoot) Less(i, j int) bool { return s[i].root < s[j].root }
+func (s byConflictRoot) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
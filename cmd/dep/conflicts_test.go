@@ -0,0 +1,68 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestConflicts(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	const lock = `[[projects]]
+  name = "github.com/foo/shared"
+  packages = ["."]
+  revision = "%s"
+  version = "%s"
+
+[[projects]]
+  name = "github.com/foo/%s"
+  packages = ["."]
+  revision = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+
+[solve-meta]
+  analyzer-name = "dep"
+  analyzer-version = 1
+  inputs-digest = "ab4fef131ee828e96ba67d31a7d690bd5f2f42040c6766b1b12fe856f87e0ff7"
+  solver-name = "gps-cdcl"
+  solver-version = 1
+`
+	h.TempFile(filepath.Join("src", "a", dep.LockName), fmt.Sprintf(lock, "1111111111111111111111111111111111111111", "v1.0.0", "a"))
+	h.TempFile(filepath.Join("src", "b", dep.LockName), fmt.Sprintf(lock, "2222222222222222222222222222222222222222", "v1.2.0", "b"))
+	h.TempFile(filepath.Join("src", "c", dep.LockName), fmt.Sprintf(lock, "1111111111111111111111111111111111111111", "v1.0.0", "c"))
+
+	env := []string{"GOPATH=" + h.Path("."), "HOME=" + h.Path(".")}
+	var stdout, stderr bytes.Buffer
+	if err := runMain("dep", []string{"conflicts", "a", filepath.Join("b", dep.LockName)}, &stdout, &stderr, h.Path("src"), env); err == nil {
+		t.Fatalf("expected the conflict to fail the command, got:\n%s", stdout.String())
+	}
+	want := "github.com/foo/shared\n" +
+		"  v1.0.0 (1111111) in " + filepath.Join("a", dep.LockName) + "\n" +
+		"  v1.2.0 (2222222) in " + filepath.Join("b", dep.LockName) + "\n"
+	if stdout.String() != want {
+		t.Errorf("unexpected report:\n\t(GOT) %q\n\t(WNT) %q", stdout.String(), want)
+	}
+	if !strings.Contains(stderr.String(), "1 project(s) are locked to different revisions") {
+		t.Errorf("unexpected error: %s", stderr.String())
+	}
+
+	// Locks that agree on their shared projects have no conflicts.
+	stdout.Reset()
+	stderr.Reset()
+	if err := runMain("dep", []string{"conflicts", "a", "c"}, &stdout, &stderr, h.Path("src"), env); err != nil {
+		t.Fatalf("expected no conflicts, got: %s\n%s", err, stderr.String())
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("expected no report, got:\n%s", stdout.String())
+	}
+}
@@ -5,12 +5,18 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/golang/dep"
 	"github.com/golang/dep/internal/test"
 )
 
@@ -42,3 +48,73 @@ func TestMain(m *testing.M) {
 
 	os.Exit(r)
 }
+
+func TestSettingFlagsOverrideConfig(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile(filepath.Join("src", "proj", dep.ManifestName), "")
+	h.TempFile(filepath.Join("src", "proj", dep.ConfigName), "jobs = 4\n")
+	wd := h.Path(filepath.Join("src", "proj"))
+	env := []string{"GOPATH=" + h.Path(".")}
+
+	for _, tc := range []struct {
+		args []string
+		jobs int
+	}{
+		{nil, 4},
+		{[]string{"-offline"}, 4},
+		{[]string{"-jobs", "2"}, 2},
+		{[]string{"-jobs=0"}, 0},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		settings := new(sourceFlags)
+		settings.register(fs)
+		if err := fs.Parse(tc.args); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, err := dep.NewContext(wd, env, &dep.Loggers{
+			Out: log.New(ioutil.Discard, "", 0),
+			Err: log.New(ioutil.Discard, "", 0),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		settings.apply(fs, ctx)
+		if ctx.Jobs != tc.jobs {
+			t.Errorf("%v: expected %d jobs, got %d", tc.args, tc.jobs, ctx.Jobs)
+		}
+	}
+}
+
+func TestSourceFlagsOnlyOnSourceCommands(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile(filepath.Join("src", "proj", dep.ManifestName), "")
+	h.TempFile(filepath.Join("src", "proj", "main.go"), "package main\n")
+	wd := h.Path(filepath.Join("src", "proj"))
+	env := []string{"GOPATH=" + h.Path("."), "HOME=" + h.Path(".")}
+
+	for _, tc := range []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"ensure", "-n", "-offline", "-no-cache"}, true},
+		{[]string{"fmt", "-n", "-offline"}, false},
+		{[]string{"hash-inputs", "-cacert", "ca.pem"}, false},
+		{[]string{"fmt", "-n"}, true},
+		{[]string{"fmt", "-n", "-gopath", h.Path(".")}, true},
+		{[]string{"hash-inputs", "-gopath", h.Path(".")}, true},
+	} {
+		var stderr bytes.Buffer
+		err := runMain("dep", tc.args, ioutil.Discard, &stderr, wd, env)
+		if tc.ok && err != nil {
+			t.Errorf("%v: unexpected error: %v\n%s", tc.args, err, stderr.String())
+		}
+		if !tc.ok && !strings.Contains(stderr.String(), "flag provided but not defined") {
+			t.Errorf("%v: expected the flag to be rejected, got %v\n%s", tc.args, err, stderr.String())
+		}
+	}
+}
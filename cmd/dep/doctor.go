@@ -0,0 +1,76 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/golang/dep"
+	"github.com/pkg/errors"
+)
+
+const doctorShortHelp = `Diagnose common problems with dep's setup`
+const doctorLongHelp = `
+Doctor checks the setup dep runs in, and prints a report of what it found,
+with hints on how to fix each problem. It checks that:
+
+  - the current directory is under the src directory of a GOPATH
+  - the source cache, under $GOPATH/pkg/dep, is writable
+  - git is installed, as well as hg and bzr, which only dependencies hosted
+    in them need
+  - Gopkg.toml and Gopkg.lock parse
+
+Doctor runs even where other commands can't, such as outside of any GOPATH.
+It exits with a non-zero status if any check fails.
+`
+
+func (cmd *doctorCommand) Name() string      { return "doctor" }
+func (cmd *doctorCommand) Args() string      { return "" }
+func (cmd *doctorCommand) ShortHelp() string { return doctorShortHelp }
+func (cmd *doctorCommand) LongHelp() string  { return doctorLongHelp }
+func (cmd *doctorCommand) Hidden() bool      { return false }
+
+func (cmd *doctorCommand) Register(fs *flag.FlagSet) {}
+
+type doctorCommand struct{}
+
+// Run diagnoses the setup of a context that could be set up. dep doctor
+// itself goes through runWithoutContext, as its context may not be.
+func (cmd *doctorCommand) Run(ctx *dep.Ctx, args []string) error {
+	return cmd.runWithoutContext(ctx.WorkingDir, []string{"GOPATH=" + ctx.GOPATH}, ctx.Loggers, args)
+}
+
+// runWithoutContext prints the report of dep.Diagnose for the working
+// directory wd and environment env.
+func (cmd *doctorCommand) runWithoutContext(wd string, env []string, loggers *dep.Loggers, args []string) error {
+	if len(args) > 0 {
+		return errors.New("doctor takes no arguments")
+	}
+
+	failed := printDiagnoses(loggers.Out, dep.Diagnose(wd, env))
+	if failed > 0 {
+		return errors.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// printDiagnoses prints a line for each of ds, with a hint on how to fix those
+// that failed, and returns the number of failures.
+func printDiagnoses(logger *log.Logger, ds []dep.Diagnosis) int {
+	var failed int
+	for _, d := range ds {
+		status := "ok  "
+		if !d.OK {
+			status = "FAIL"
+			failed++
+		}
+		logger.Printf("[%s] %s: %s\n", status, d.Check, d.Detail)
+		if d.Hint != "" {
+			logger.Printf("       hint: %s\n", d.Hint)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestDoctor(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	// The project is outside of the GOPATH, and its lock is broken.
+	h.TempDir("gopath/src")
+	h.TempFile(filepath.Join("elsewhere", "proj", dep.ManifestName), "ignored = [\"github.com/foo/bar\"]\n")
+	h.TempFile(filepath.Join("elsewhere", "proj", dep.LockName), "[[projects]\n")
+	wd := h.Path(filepath.Join("elsewhere", "proj"))
+	env := []string{"GOPATH=" + h.Path("gopath")}
+
+	var stdout, stderr bytes.Buffer
+	if err := runMain("testdep", []string{"doctor"}, &stdout, &stderr, wd, env); err == nil {
+		t.Fatalf("expected doctor to fail, got:\n%s", stdout.String())
+	}
+
+	out := stdout.String()
+	for _, want := range []string{
+		"[FAIL] GOPATH: " + wd + " is not under the src directory of any GOPATH",
+		"hint: move the project to $GOPATH/src/<import path>",
+		"[ok  ] cache: ",
+		"[ok  ] " + dep.ManifestName + ": ",
+		"[FAIL] " + dep.LockName + ": ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected the report to contain %q, got:\n%s", want, out)
+		}
+	}
+	if !strings.Contains(stderr.String(), "2 check(s) failed") {
+		t.Errorf("expected two failed checks, got %q", stderr.String())
+	}
+
+	// Moved under the GOPATH, with its lock fixed, the project passes.
+	h.TempFile(filepath.Join("gopath", "src", "proj", dep.ManifestName), "")
+	stdout.Reset()
+	if err := runMain("testdep", []string{"doctor"}, &stdout, &stderr, h.Path(filepath.Join("gopath", "src", "proj")), env); err != nil {
+		t.Fatalf("expected doctor to pass, got:\n%s", stdout.String())
+	}
+	if strings.Contains(stdout.String(), "[FAIL]") {
+		t.Errorf("expected no failures, got:\n%s", stdout.String())
+	}
+}
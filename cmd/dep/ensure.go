@@ -10,10 +10,14 @@ import (
 	"flag"
 	"fmt"
 	"go/build"
+	"io/ioutil"
 	"log"
+	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang/dep"
 	"github.com/golang/dep/internal/fs"
@@ -29,6 +33,28 @@ to set version constraints for specific dependencies. It takes user input,
 solves the updated dependency graph of the project, writes any changes to the
 lock file, and places dependencies in the vendor folder.
 
+Releases that a project's upstream has retracted, by pushing a tag named after
+the release with a "retract/" prefix, are only chosen when no other version is
+acceptable. Ensure warns about the retracted releases it skipped, and about
+any dependency that it locks to one; dependencies whose locked versions are
+left unchanged aren't checked again.
+
+Ensure fails, before solving, if any of the project's files imports a package
+listed in forbidden-packages in the manifest, or a package below one, naming
+each offending file.
+
+With -canonical-imports, a dependency that imports its own packages under
+another path of the same repository, such as one differing only in case, is
+vendored once: the duplicate copy is dropped from the lock and vendor, and the
+imports in the dependency's own files are rewritten to its project root.
+
+Once it has written the lock and vendor folder, ensure runs the commands listed
+in post-ensure in the [hooks] table of the manifest from the project root, in
+order, such as "go generate ./...". Commands are run by the shell, sh, or
+cmd.exe on Windows, once dep has released its cache, so they may run dep
+themselves. If one fails, ensure stops and exits with its exit status.
+-skip-hooks leaves them to be run separately.
+
 Package spec:
 
   <path>[:alt location][@<version specifier>]
@@ -60,6 +86,16 @@ dep ensure -update github.com/pkg/foo github.com/pkg/bar
     ignoring any versions specified in the lock file. Update the lock file with
     any changes.
 
+dep ensure -update github.com/pkg/foo@v2.1.0
+
+    Update pkg/foo, and only pkg/foo, to exactly v2.1.0: set its constraint in
+    the manifest to allow that version, and write the manifest, lock and vendor
+    folder together. The version must exist in the project's source, and must
+    be allowed by any override on the project. Other projects only change as
+    far as v2.1.0 requires. If pkg/foo is only a transitive dependency, no
+    constraint is set, as it wouldn't apply; it is pinned in the lock alone,
+    and an [[override]] is needed to hold it there.
+
 dep ensure github.com/pkg/foo@^1.0.1
 
     Constrain pkg/foo to the latest release matching >= 1.0.1, < 2.0.0, and
@@ -75,11 +111,95 @@ dep ensure github.com/pkg/foo:git.internal.com/alt/foo
 
     Fetch the dependency from a different location.
 
+dep ensure -add github.com/pkg/foo@^1.0.1 github.com/pkg/bar@master
+
+    Add constraints for pkg/foo and pkg/bar to the manifest, and write the
+    manifest, lock and vendor folder together. The projects must already be
+    imported by the project. If any of the specs can't be added or solved,
+    nothing is written at all.
+
 dep ensure -override github.com/pkg/foo@^1.0.1
 
     Forcefully and transitively override any constraint for this dependency.
     Overrides are powerful, but harmful in the long term. They should be used as
     a last resort, especially if your project may be imported by others.
+
+dep ensure -update -patch > lock.patch
+
+    Solve as usual, but write nothing. Instead, print a unified diff that turns
+    the current lock file into the one that would have been written. Apply it
+    later with patch -p1 or git apply.
+
+dep ensure -lock-authoritative
+
+    Populate vendor with exactly the projects and versions in the lock file,
+    without analyzing the project's imports or solving. Projects the lock
+    records are vendored even if nothing imports them anymore. This suits CI
+    jobs that only need to restore a committed lock.
+
+dep ensure -only-lock
+
+    Like -lock-authoritative, but first check that the lock's inputs-digest
+    matches Gopkg.toml and the project's imports, and vendor nothing if it
+    doesn't. This suits CI jobs that should fail if the committed lock is
+    stale, rather than vendor it anyway.
+
+dep ensure -report
+
+    Ensure as usual, then write dep-report.json to the project root, recording
+    the inputs digest, every locked project's version, revision, commit time
+    and a digest of its vendored files, the versions of dep and Go, and when
+    the dependencies were resolved.
+
+dep ensure -update -strategy minimal
+
+    Experimental: update all dependencies to the lowest versions that satisfy
+    every constraint, rather than to the latest ones, as in minimal version
+    selection. Upgrades then only happen when a constraint requires them.
+
+dep ensure -commit-times
+
+    Record the time at which each locked revision was committed in the lock,
+    as commit-time, to help audit how old dependencies are. Recorded times are
+    kept for as long as the revision stays the same, even without this flag.
+
+dep ensure -reasons
+
+    Record in the lock, under solve-meta, why each dependency's version was
+    chosen: the constraint that bound it once every project's constraints on
+    it were combined, and the projects that imposed that constraint. The
+    reasons are informational only, and don't change the inputs digest.
+
+dep ensure -policy policy.toml
+
+    Check the solution against the rules in policy.toml before writing it, and
+    write nothing if any of them are violated. A policy file may contain:
+
+        # Projects that must not appear in the lock.
+        forbidden = ["github.com/pkg/foo"]
+        # Reject any semver prerelease versions in the lock.
+        no-prerelease = true
+        # Reject any projects locked to a branch, rather than a tag or revision.
+        no-branches = true
+
+dep ensure -no-branches
+
+    Write nothing, and list the offending projects, if any project would be
+    locked to the head of a branch. This is the same as the no-branches policy,
+    and ensures that release builds only use immutable versions.
+
+dep ensure -update -backup
+
+    Before writing anything, copy the vendor folder and lock file into a
+    timestamped _dep-backup-* directory in the project root, and print its
+    location. To roll back, pass that directory to dep restore.
+
+dep ensure -parallel 16
+
+    Fetch and export up to 16 dependencies at once, rather than one for each
+    CPU, up to 8. This helps most on high-latency connections, where fetches
+    and exports spend their time waiting on the network. A lower -jobs
+    setting still takes precedence.
 `
 
 func (cmd *ensureCommand) Name() string      { return "ensure" }
@@ -89,17 +209,66 @@ func (cmd *ensureCommand) LongHelp() string  { return ensureLongHelp }
 func (cmd *ensureCommand) Hidden() bool      { return false }
 
 func (cmd *ensureCommand) Register(fs *flag.FlagSet) {
+	cmd.sourceFlags.register(fs)
 	fs.BoolVar(&cmd.examples, "examples", false, "print detailed usage examples")
 	fs.BoolVar(&cmd.update, "update", false, "ensure dependencies are at the latest version allowed by the manifest")
 	fs.BoolVar(&cmd.dryRun, "n", false, "dry run, don't actually ensure anything")
+	fs.BoolVar(&cmd.patch, "patch", false, "print the changes to the lock as a unified diff, instead of writing anything")
+	fs.BoolVar(&cmd.add, "add", false, "add constraints for the specs to the manifest; all of them are written, or none")
+	fs.StringVar(&cmd.strategy, "strategy", "", "version selection strategy: latest (the default), or minimal to pick the lowest versions that satisfy all constraints (experimental)")
 	fs.Var(&cmd.overrides, "override", "specify an override constraint spec (repeatable)")
+	fs.BoolVar(&cmd.commitTimes, "commit-times", false, "record the commit time of each locked revision in the lock")
+	fs.BoolVar(&cmd.reasons, "reasons", false, "record in the lock why each dependency's version was chosen")
+	fs.StringVar(&cmd.policy, "policy", "", "reject, without writing anything, solutions that violate the policy in this file")
+	fs.BoolVar(&cmd.noBranches, "no-branches", false, "reject, without writing anything, solutions that lock any project to a branch")
+	fs.BoolVar(&cmd.backup, "backup", false, "back up vendor and Gopkg.lock before changing them, to be put back with dep restore")
+	fs.BoolVar(&cmd.lockAuthoritative, "lock-authoritative", false, "vendor exactly what Gopkg.lock records, without analyzing the project's imports or solving")
+	fs.BoolVar(&cmd.onlyLock, "only-lock", false, "like -lock-authoritative, but first check that Gopkg.lock is in sync with Gopkg.toml and the project's imports, and refuse to vendor it if not")
+	fs.BoolVar(&cmd.report, "report", false, "write a reproducibility report of the build inputs to "+reportName)
+	fs.IntVar(&cmd.parallel, "parallel", defaultParallel(), "fetch and export up to this many dependencies at once (a lower -jobs takes precedence)")
+	fs.BoolVar(&cmd.skipHooks, "skip-hooks", false, "don't run the post-ensure hooks of Gopkg.toml")
+	fs.BoolVar(&cmd.canonicalImports, "canonical-imports", false, "drop the vendored copies of dependencies that only exist because a dependency imports itself under another path, and rewrite those imports")
 }
 
 type ensureCommand struct {
-	examples  bool
-	update    bool
-	dryRun    bool
-	overrides stringSlice
+	sourceFlags
+
+	examples    bool
+	update      bool
+	add         bool
+	dryRun      bool
+	patch       bool
+	strategy    string
+	overrides   stringSlice
+	policy      string
+	noBranches  bool
+	commitTimes bool
+	reasons     bool
+	backup      bool
+	report      bool
+
+	lockAuthoritative bool
+	onlyLock          bool
+	canonicalImports  bool
+	skipHooks         bool
+	parallel          int
+}
+
+// defaultParallel is the number of dependencies ensure fetches and exports at
+// once by default: one for each CPU Go uses, but no more than 8.
+func defaultParallel() int {
+	if n := runtime.GOMAXPROCS(0); n < 8 {
+		return n
+	}
+	return 8
+}
+
+// limitJobs limits the operations run at once against sources, such as
+// fetches, to -parallel, unless -jobs already limits them further.
+func (cmd *ensureCommand) limitJobs(ctx *dep.Ctx) {
+	if ctx.Jobs == 0 || cmd.parallel < ctx.Jobs {
+		ctx.Jobs = cmd.parallel
+	}
 }
 
 func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
@@ -108,23 +277,79 @@ func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
 		return nil
 	}
 
+	if cmd.parallel < 1 {
+		return errors.Errorf("invalid -parallel %d; must be at least 1", cmd.parallel)
+	}
+
 	p, err := ctx.LoadProject()
 	if err != nil {
 		return err
 	}
 
-	sm, err := ctx.SourceManager()
+	if err := cmd.addPolicy(ctx); err != nil {
+		return err
+	}
+
+	// Updates and additions are after the newest versions upstream, which
+	// the version lists cached by earlier commands may be missing.
+	if cmd.update || cmd.add {
+		ctx.MetadataTTL = 0
+	}
+	cmd.limitJobs(ctx)
+
+	sm, err := ctx.SourceManager(p)
 	if err != nil {
 		return err
 	}
 	sm.UseDefaultSignalHandling()
 	defer sm.Release()
 
+	if err := cmd.ensure(ctx, args, p, sm); err != nil {
+		return err
+	}
+
+	// Nothing was written by dry runs, so there's nothing for hooks to
+	// follow up on.
+	if cmd.skipHooks || cmd.dryRun || cmd.patch {
+		return nil
+	}
+
+	// The hooks may run dep themselves, which can't get at the cache while
+	// sm holds it.
+	sm.Release()
+	return runHooks(ctx, p.AbsRoot, "post-ensure", p.Manifest.PostEnsure)
+}
+
+// ensure brings the lock and vendor of p in line with its manifest and
+// imports, as directed by args and the flags of cmd.
+func (cmd *ensureCommand) ensure(ctx *dep.Ctx, args []string, p *dep.Project, sm *gps.SourceMgr) error {
+	if cmd.lockAuthoritative || cmd.onlyLock {
+		flag := "-lock-authoritative"
+		if cmd.onlyLock {
+			flag = "-only-lock"
+		}
+		if cmd.add || cmd.update || len(args) > 0 || len(cmd.overrides) > 0 {
+			return errors.Errorf("%s only vendors the lock, and can't be combined with -add, -update, -override or specs", flag)
+		}
+		if cmd.onlyLock {
+			if err := checkLockInSync(ctx, p, sm); err != nil {
+				return err
+			}
+		}
+		return cmd.vendorLock(ctx, p, sm)
+	}
+
 	params := p.MakeParams()
 	if ctx.Loggers.Verbose {
 		params.TraceLogger = ctx.Loggers.Err
 	}
-	params.RootPackageTree, err = pkgtree.ListPackages(p.AbsRoot, string(p.ImportRoot))
+
+	// MakeParams only marks the floating projects whose locked version has
+	// gone stale, but ensure moves every one of them to its newest version.
+	params.ToChange = append(params.ToChange, p.LockedFloatingProjects()...)
+
+	var err error
+	params.RootPackageTree, err = ctx.ListPackages(p.AbsRoot, string(p.ImportRoot))
 	if err != nil {
 		return errors.Wrap(err, "ensure ListPackage for project")
 	}
@@ -132,8 +357,27 @@ func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
 	if err := checkErrors(params.RootPackageTree.Packages); err != nil {
 		return err
 	}
+	if err := p.CheckForbiddenImports(params.RootPackageTree); err != nil {
+		return err
+	}
+
+	if err := applyStrategy(cmd.strategy, &params); err != nil {
+		return err
+	}
+
+	if cmd.add {
+		if cmd.update {
+			return errors.New("-add and -update cannot be used together")
+		}
+		return cmd.runAdd(ctx, args, p, sm, params)
+	}
 
 	if cmd.update {
+		for _, arg := range args {
+			if strings.Contains(arg, "@") {
+				return cmd.runUpdateVersions(ctx, args, p, sm, params)
+			}
+		}
 		applyUpdateArgs(args, &params)
 	} else {
 		err := applyEnsureArgs(ctx.Loggers.Err, args, cmd.overrides, p, sm, &params)
@@ -152,6 +396,188 @@ func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
 		return errors.Wrap(err, "ensure Solve()")
 	}
 
+	newLock := dep.LockFromSolution(solution)
+	if cmd.reasons {
+		newLock.Reasons = dep.ReasonsFromSolution(solution)
+	}
+	if err := warnRetracted(ctx.Loggers.Err, sm, p.Manifest, p.Lock, newLock); err != nil {
+		return err
+	}
+	warnUnusedConstraints(ctx.Loggers.Err, p.Manifest, newLock)
+	return cmd.writeSolution(ctx, p, nil, newLock, sm)
+}
+
+// vendorLock writes the vendor folder with exactly the projects and versions
+// recorded in the project's lock, trusting it as the source of truth. The
+// project's imports aren't analyzed, and nothing is solved.
+func (cmd *ensureCommand) vendorLock(ctx *dep.Ctx, p *dep.Project, sm gps.SourceManager) error {
+	if p.Lock == nil {
+		return errors.Errorf("-lock-authoritative requires a %s in the project root", dep.LockName)
+	}
+
+	// The lock isn't solved again, but must still satisfy the policy.
+	if ctx.ValidateSolution != nil {
+		if err := ctx.ValidateSolution(p.Lock); err != nil {
+			return errors.Wrap(err, "lock rejected; nothing was written")
+		}
+	}
+
+	// The recorded commit times are kept, and with -commit-times, the missing
+	// ones looked up, as they would be after solving.
+	l := *p.Lock
+	l.CommitTimes = nil
+	if err := recordCommitTimes(&l, p.Lock, sm, cmd.commitTimes); err != nil {
+		return err
+	}
+
+	sw, err := dep.NewSafeWriter(nil, p.Lock, &l, dep.VendorAlways, p.Manifest.VendorPruning())
+	if err != nil {
+		return err
+	}
+	sw.VerifyVendor = verifyPinnedDigests(p.Manifest.PinDigest, &l)
+	sw.Parallel = cmd.parallel
+	if cmd.dryRun {
+		return sw.PrintPreparedActions(ctx.Loggers.Out)
+	}
+	return errors.Wrap(sw.Write(p.AbsRoot, sm, false), "grouped write of lock and vendor")
+}
+
+// checkLockInSync returns an error if the inputs digest recorded in the lock
+// of p isn't that of its manifest and imports as they are now, as happens when
+// either has changed since the lock was solved.
+func checkLockInSync(ctx *dep.Ctx, p *dep.Project, sm gps.SourceManager) error {
+	if p.Lock == nil {
+		return errors.Errorf("-only-lock requires a %s in the project root", dep.LockName)
+	}
+
+	params := p.MakeParams()
+	ptree, err := ctx.ListPackages(p.AbsRoot, string(p.ImportRoot))
+	if err != nil {
+		return errors.Wrap(err, "analysis of local packages failed")
+	}
+	params.RootPackageTree = ptree
+	s, err := gps.Prepare(params, sm)
+	if err != nil {
+		return errors.Wrap(err, "could not set up solver for input hashing")
+	}
+
+	if !bytes.Equal(s.HashInputs(), p.Lock.SolveMeta.InputsDigest) {
+		return errors.Errorf("%s is out of sync with %s or the project's imports, so nothing was vendored; run dep ensure to solve again, or use -lock-authoritative to vendor the lock as it is", dep.LockName, dep.ManifestName)
+	}
+	return nil
+}
+
+// applyStrategy sets up params to select versions according to the named
+// strategy.
+func applyStrategy(strategy string, params *gps.SolveParameters) error {
+	switch strategy {
+	case "", "latest":
+		params.Downgrade = false
+	case "minimal":
+		// Visiting versions in ascending order makes the solver settle on the
+		// lowest acceptable version of each project.
+		params.Downgrade = true
+	default:
+		return errors.Errorf("unknown strategy %q; must be latest or minimal", strategy)
+	}
+	return nil
+}
+
+// warnRetracted warns about every project in l that is locked to a version
+// its upstream has retracted, and about the retracted versions the solver
+// passed over in favor of the locked ones. Only the projects whose locked
+// versions differ from those in oldLock, if it isn't nil, are checked, so that
+// upstream is only asked about what the solve changed.
+func warnRetracted(logger *log.Logger, sm gps.SourceManager, m *dep.Manifest, oldLock, l *dep.Lock) error {
+	old := make(map[gps.ProjectRoot]gps.LockedProject)
+	if oldLock != nil {
+		for _, lp := range oldLock.Projects() {
+			old[lp.Ident().ProjectRoot] = lp
+		}
+	}
+
+	for _, lp := range l.Projects() {
+		if olp, has := old[lp.Ident().ProjectRoot]; has && olp.Eq(lp) {
+			continue
+		}
+		retracted, err := sm.ListRetracted(lp.Ident())
+		if err != nil {
+			return errors.Wrapf(err, "unable to list the retracted versions of %s", lp.Ident().ProjectRoot)
+		}
+
+		pr, v := lp.Ident().ProjectRoot, lp.Version()
+		if v == nil {
+			continue
+		}
+		c := gps.Any()
+		if pp, has := m.Ovr[pr]; has && pp.Constraint != nil {
+			c = pp.Constraint
+		} else if pp, has := m.Constraints[pr]; has && pp.Constraint != nil {
+			c = pp.Constraint
+		}
+
+		for _, rv := range retracted {
+			if rv.String() == v.String() && v.Type() != gps.IsBranch {
+				logger.Printf("WARNING: %s is locked to %s, which has been retracted upstream\n", pr, v)
+				continue
+			}
+
+			// Only mention the versions that would otherwise have been chosen.
+			vl := []gps.Version{v, rv}
+			gps.SortForUpgrade(vl)
+			if vl[0] == rv && c.Matches(rv) {
+				logger.Printf("Skipped %s of %s, which has been retracted upstream\n", rv, pr)
+			}
+		}
+	}
+	return nil
+}
+
+// warnUnusedConstraints warns about the projects that m constrains but that
+// aren't in the solution l. Such constraints have no effect, and are usually
+// left behind when the last import of a project is dropped.
+func warnUnusedConstraints(logger *log.Logger, m *dep.Manifest, l gps.Lock) {
+	unused := unusedConstraints(m, l)
+	if len(unused) == 0 {
+		return
+	}
+	logger.Println("WARNING: Gopkg.toml has constraints on projects that are not in the solution:")
+	for _, pr := range unused {
+		logger.Printf("  %s\n", pr)
+	}
+	logger.Printf("They have no effect; remove them with: dep remove %s\n", strings.Join(unused, " "))
+}
+
+// writeSolution checks newLock against ctx.ValidateSolution, then writes
+// it, the vendor folder and, if it isn't nil, the manifest m in a single
+// grouped write. If validation fails, nothing is written.
+func (cmd *ensureCommand) writeSolution(ctx *dep.Ctx, p *dep.Project, m *dep.Manifest, newLock *dep.Lock, sm gps.SourceManager) error {
+	var rewrites []importRewrite
+	if cmd.canonicalImports {
+		ptree, err := pkgtree.ListPackages(p.AbsRoot, string(p.ImportRoot))
+		if err != nil {
+			return errors.Wrap(err, "ensure ListPackage for project")
+		}
+		newLock, rewrites, err = canonicalizeSelfImports(ptree, newLock, sm)
+		if err != nil {
+			return err
+		}
+		for _, rw := range rewrites {
+			ctx.Loggers.Err.Printf("Dropping %s, which duplicates %s, and rewriting its imports there\n", rw.alias, rw.canonical)
+		}
+	}
+
+	if ctx.ValidateSolution != nil {
+		if err := ctx.ValidateSolution(newLock); err != nil {
+			return errors.Wrap(err, "solution rejected; nothing was written")
+		}
+	}
+	if err := recordCommitTimes(newLock, p.Lock, sm, cmd.commitTimes); err != nil {
+		return err
+	}
+	if cmd.patch {
+		return printLockPatch(ctx.Loggers.Out, p, newLock)
+	}
 	// check if vendor exists, because if the locks are the same but
 	// vendor does not exist we should write vendor
 	vendorExists, err := fs.IsNonEmptyDir(filepath.Join(p.AbsRoot, "vendor"))
@@ -159,20 +585,442 @@ func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
 		return errors.Wrap(err, "ensure vendor is a directory")
 	}
 	writeV := dep.VendorOnChanged
-	if !vendorExists && solution != nil {
+	if !vendorExists {
 		writeV = dep.VendorAlways
 	}
 
-	newLock := dep.LockFromSolution(solution)
-	sw, err := dep.NewSafeWriter(nil, p.Lock, newLock, writeV)
+	pm := p.Manifest
+	if m != nil {
+		pm = m
+	}
+	sw, err := dep.NewSafeWriter(m, p.Lock, newLock, writeV, pm.VendorPruning())
 	if err != nil {
 		return err
 	}
+	if len(rewrites) > 0 {
+		sw.RewriteVendor = func(vendor string) error {
+			return rewriteVendoredImports(vendor, rewrites)
+		}
+	}
+	sw.VerifyVendor = verifyPinnedDigests(pm.PinDigest, newLock)
+	sw.Parallel = cmd.parallel
 	if cmd.dryRun {
 		return sw.PrintPreparedActions(ctx.Loggers.Out)
 	}
 
-	return errors.Wrap(sw.Write(p.AbsRoot, sm, false), "grouped write of manifest, lock and vendor")
+	if cmd.backup {
+		backup, err := dep.SnapshotVendor(p.AbsRoot, time.Now().Format("20060102150405"))
+		if err != nil {
+			return errors.Wrap(err, "unable to back up vendor and lock; nothing was written")
+		}
+		ctx.Loggers.Err.Printf("Backed up vendor and %s to %s\n", dep.LockName, backup)
+	}
+
+	if err := sw.Write(p.AbsRoot, sm, false); err != nil {
+		return errors.Wrap(err, "grouped write of manifest, lock and vendor")
+	}
+
+	if cmd.report {
+		return writeReport(p.AbsRoot, newLock, sm, time.Now())
+	}
+	return nil
+}
+
+// recordCommitTimes carries the commit times recorded in oldLock over to
+// newLock, for the projects whose revisions haven't changed. If fetch is set,
+// the commit times of the remaining projects are looked up through sm.
+func recordCommitTimes(newLock, oldLock *dep.Lock, sm gps.SourceManager, fetch bool) error {
+	old := make(map[gps.ProjectRoot]gps.Revision)
+	var oldTimes map[gps.ProjectRoot]time.Time
+	if oldLock != nil {
+		oldTimes = oldLock.CommitTimes
+		for _, lp := range oldLock.Projects() {
+			old[lp.Ident().ProjectRoot] = lockedRevision(lp)
+		}
+	}
+
+	for _, lp := range newLock.Projects() {
+		pr, rev := lp.Ident().ProjectRoot, lockedRevision(lp)
+		if rev == "" {
+			continue
+		}
+
+		if t, has := oldTimes[pr]; has && old[pr] == rev {
+			setCommitTime(newLock, pr, t)
+			continue
+		}
+		if !fetch {
+			continue
+		}
+
+		t, err := sm.CommitTime(lp.Ident(), rev)
+		if err != nil {
+			return errors.Wrapf(err, "unable to get the commit time of %s at %s", pr, rev)
+		}
+		setCommitTime(newLock, pr, t)
+	}
+	return nil
+}
+
+func setCommitTime(l *dep.Lock, pr gps.ProjectRoot, t time.Time) {
+	if l.CommitTimes == nil {
+		l.CommitTimes = make(map[gps.ProjectRoot]time.Time)
+	}
+	l.CommitTimes[pr] = t
+}
+
+// printLockPatch prints a unified diff from the project's lock file, as it is
+// on disk, to newLock.
+func printLockPatch(out *log.Logger, p *dep.Project, newLock *dep.Lock) error {
+	cur, err := ioutil.ReadFile(filepath.Join(p.AbsRoot, dep.LockName))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "unable to read the current lock")
+	}
+	next, err := newLock.MarshalTOML()
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal the new lock")
+	}
+
+	if diff := unifiedDiff("a/"+dep.LockName, "b/"+dep.LockName, cur, next); diff != "" {
+		out.Print(diff)
+	}
+	return nil
+}
+
+// addPolicy adds the checks of the -policy file and -no-branches, if any, to
+// ctx.ValidateSolution.
+func (cmd *ensureCommand) addPolicy(ctx *dep.Ctx) error {
+	policy, err := loadPolicy(cmd.policy, cmd.noBranches)
+	if err != nil || policy == nil {
+		return err
+	}
+
+	validate := ctx.ValidateSolution
+	ctx.ValidateSolution = func(l *dep.Lock) error {
+		if validate != nil {
+			if err := validate(l); err != nil {
+				return err
+			}
+		}
+		return policy.ValidateSolution(l)
+	}
+	return nil
+}
+
+// loadPolicy returns the policy in the file at path, if it isn't empty, which
+// also forbids branches if noBranches is set. With neither, there is no
+// policy, and it returns nil.
+func loadPolicy(path string, noBranches bool) (*dep.Policy, error) {
+	if path == "" && !noBranches {
+		return nil, nil
+	}
+
+	policy := &dep.Policy{}
+	if path != "" {
+		var err error
+		policy, err = dep.LoadPolicy(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if noBranches {
+		policy.NoBranches = true
+	}
+	return policy, nil
+}
+
+// runAdd adds constraints for the specs in args to the manifest, then writes
+// the manifest, lock and vendor folder in a single grouped write.
+//
+// All changes are staged on a copy of the manifest, and nothing is written
+// unless every spec could be added and the solve that follows succeeded, so
+// that a failure leaves the manifest, lock and vendor exactly as they were.
+func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm gps.SourceManager, params gps.SolveParameters) error {
+	if len(args) == 0 {
+		return errors.New("must specify at least one project to add")
+	}
+
+	staged := *p
+	staged.Manifest = copyManifest(p.Manifest)
+	if err := applyEnsureArgs(ctx.Loggers.Err, args, cmd.overrides, &staged, sm, &params); err != nil {
+		return errors.Wrap(err, "nothing was added")
+	}
+	params.Manifest = staged.Manifest
+
+	solver, err := gps.Prepare(params, sm)
+	if err != nil {
+		return errors.Wrap(err, "ensure Prepare")
+	}
+	solution, err := solver.Solve()
+	if err != nil {
+		handleAllTheFailuresOfTheWorld(err)
+		return errors.Wrap(err, "ensure Solve(); nothing was added")
+	}
+
+	// A constraint on a project that isn't imported has no effect on the
+	// solution, so it would be written to the manifest without being vendored.
+	newLock := dep.LockFromSolution(solution)
+	if cmd.reasons {
+		newLock.Reasons = dep.ReasonsFromSolution(solution)
+	}
+	locked := make(map[gps.ProjectRoot]bool)
+	for _, lp := range newLock.Projects() {
+		locked[lp.Ident().ProjectRoot] = true
+	}
+	for pr, pp := range staged.Manifest.Constraints {
+		if old, has := p.Manifest.Constraints[pr]; has && old.Source == pp.Source && old.Constraint.String() == pp.Constraint.String() {
+			continue
+		}
+		if !locked[pr] {
+			return errors.Errorf("%s is not imported by the project; import it before adding it. Nothing was added", pr)
+		}
+	}
+
+	if err := warnRetracted(ctx.Loggers.Err, sm, staged.Manifest, p.Lock, newLock); err != nil {
+		return err
+	}
+	warnUnusedConstraints(ctx.Loggers.Err, staged.Manifest, newLock)
+	if err := cmd.writeSolution(ctx, p, staged.Manifest, newLock, sm); err != nil {
+		return err
+	}
+	if cmd.dryRun || cmd.patch {
+		return nil
+	}
+	p.Manifest, p.Lock = staged.Manifest, newLock
+	return nil
+}
+
+// runUpdateVersions updates the projects given as name@version in args to
+// exactly those versions, setting the constraints of the direct dependencies
+// among them in the manifest to allow them, and updates those given by name alone as -update does. The manifest,
+// lock and vendor folder are written together, and only if every version
+// could be found and the solve succeeded.
+func (cmd *ensureCommand) runUpdateVersions(ctx *dep.Ctx, args []string, p *dep.Project, sm gps.SourceManager, params gps.SolveParameters) error {
+	staged := copyManifest(p.Manifest)
+	lock := &dep.Lock{}
+	if p.Lock != nil {
+		lock.P = append(lock.P, p.Lock.P...)
+	}
+	wanted := make(map[gps.ProjectRoot]gps.LockedProject)
+	for _, arg := range args {
+		if !strings.Contains(arg, "@") {
+			params.ToChange = append(params.ToChange, gps.ProjectRoot(arg))
+			continue
+		}
+
+		pi, v, err := stageUpdateVersion(arg, p, staged, params.RootPackageTree, sm)
+		if err != nil {
+			return errors.Wrap(err, "nothing was updated")
+		}
+		if _, constrained := staged.Constraints[pi.ProjectRoot]; !constrained {
+			ctx.Loggers.Err.Printf("%s is only a transitive dependency, so it is pinned to %s in the lock alone; add an [[override]] to hold it there\n", pi.ProjectRoot, v)
+		}
+		// Locking the project to the version makes the solver keep it there,
+		// as the constraint now allows it, rather than pick the newest
+		// version that the constraint allows.
+		var pkgs []string
+		for i, lp := range lock.P {
+			if lp.Ident().ProjectRoot == pi.ProjectRoot {
+				pkgs = lp.Packages()
+				lock.P = append(lock.P[:i], lock.P[i+1:]...)
+				break
+			}
+		}
+		wanted[pi.ProjectRoot] = gps.NewLockedProject(pi, v, pkgs)
+		lock.P = append(lock.P, wanted[pi.ProjectRoot])
+	}
+	params.Manifest = staged
+	params.Lock = lock
+
+	solver, err := gps.Prepare(params, sm)
+	if err != nil {
+		return errors.Wrap(err, "ensure Prepare")
+	}
+	solution, err := solver.Solve()
+	if err != nil {
+		handleAllTheFailuresOfTheWorld(err)
+		return errors.Wrap(err, "ensure Solve(); nothing was updated")
+	}
+
+	newLock := dep.LockFromSolution(solution)
+	if cmd.reasons {
+		newLock.Reasons = dep.ReasonsFromSolution(solution)
+	}
+	for _, lp := range newLock.Projects() {
+		want, has := wanted[lp.Ident().ProjectRoot]
+		if has && lockedRevision(lp) != lockedRevision(want) {
+			return errors.Errorf("%s could not be kept at %s, as other dependencies require %s; nothing was updated", lp.Ident().ProjectRoot, want.Version(), lp.Version())
+		}
+	}
+
+	if err := warnRetracted(ctx.Loggers.Err, sm, staged, p.Lock, newLock); err != nil {
+		return err
+	}
+	warnUnusedConstraints(ctx.Loggers.Err, staged, newLock)
+	return cmd.writeSolution(ctx, p, staged, newLock, sm)
+}
+
+// stageUpdateVersion sets the constraint in m on the project named by spec,
+// in the form name@version, to allow that version, after checking that it is a
+// dependency of p, that the version exists in its source, and that no
+// override on it forbids the version. It returns the project, and the version
+// to lock it to. No constraint is set on a transitive dependency, one that
+// neither the root project's own packages, ptree, import nor m requires, as
+// it wouldn't apply; such a project is only pinned through the lock.
+func stageUpdateVersion(spec string, p *dep.Project, m *dep.Manifest, ptree pkgtree.PackageTree, sm gps.SourceManager) (gps.ProjectIdentifier, gps.Version, error) {
+	parts := strings.SplitN(spec, "@", 2)
+	name, version := parts[0], parts[1]
+	var pi gps.ProjectIdentifier
+	if version == "" {
+		return pi, nil, errors.Errorf("no version given in %s", spec)
+	}
+
+	pr, err := sm.DeduceProjectRoot(name)
+	if err != nil {
+		return pi, nil, errors.Wrapf(err, "could not infer project root from dependency path: %s", name)
+	}
+	if string(pr) != name {
+		return pi, nil, errors.Errorf("dependency path %s is not a project root, try %s instead", name, pr)
+	}
+	if !dependsOn(p, pr) {
+		return pi, nil, errors.Errorf("%s is not a dependency of the project", pr)
+	}
+
+	pi = gps.ProjectIdentifier{ProjectRoot: pr, Source: m.Constraints[pr].Source}
+	if ovr, has := m.Ovr[pr]; has && ovr.Source != "" {
+		pi.Source = ovr.Source
+	}
+	versions, err := sm.ListVersions(pi)
+	if err != nil {
+		return pi, nil, errors.Wrapf(err, "list versions for %s(%s)", pi.ProjectRoot, pi.Source)
+	}
+	var v gps.Version
+	for _, pv := range versions {
+		if pv.String() == version {
+			v = pv
+			break
+		}
+	}
+	if v == nil {
+		c, err := deduceConstraint(version, pi, sm)
+		if err != nil {
+			return pi, nil, errors.Errorf("%s is not a version of %s", version, pr)
+		}
+		rev, ok := c.(gps.Revision)
+		if !ok {
+			return pi, nil, errors.Errorf("%s is not a version of %s", version, pr)
+		}
+		if present, err := sm.RevisionPresentIn(pi, rev); err != nil || !present {
+			return pi, nil, errors.Errorf("%s is not a revision of %s", version, pr)
+		}
+		v = rev
+	}
+
+	if ovr, has := m.Ovr[pr]; has && ovr.Constraint != nil && !ovr.Constraint.Matches(v) {
+		return pi, nil, errors.Errorf("%s can't be updated to %s, as it is overridden to %s", pr, version, ovr.Constraint)
+	}
+
+	// The constraints of the root project only apply to its direct
+	// dependencies, so one on a transitive dependency would be ignored.
+	if _, constrained := m.Constraints[pr]; !constrained && !isDirectDependency(ptree, m, pr) {
+		return pi, v, nil
+	}
+
+	c, err := deduceConstraint(version, pi, sm)
+	if err != nil {
+		return pi, nil, err
+	}
+	m.Constraints[pr] = gps.ProjectProperties{Source: m.Constraints[pr].Source, Constraint: c}
+	return pi, v, nil
+}
+
+// isDirectDependency reports whether the project pr is imported by one of the
+// root project's own packages, ptree, or holds a package that m requires.
+func isDirectDependency(ptree pkgtree.PackageTree, m *dep.Manifest, pr gps.ProjectRoot) bool {
+	if importers, _ := importersOf(ptree, m.IgnoredPackages(), pr); len(importers) > 0 {
+		return true
+	}
+	for _, req := range m.Required {
+		if isPathPrefix(req, string(pr)) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyManifest returns a copy of m that can be modified without affecting m.
+func copyManifest(m *dep.Manifest) *dep.Manifest {
+	c := &dep.Manifest{
+		Constraints:  make(gps.ProjectConstraints, len(m.Constraints)),
+		Ovr:          make(gps.ProjectConstraints, len(m.Ovr)),
+		Ignored:      append([]string(nil), m.Ignored...),
+		Required:     append([]string(nil), m.Required...),
+		PruneOptions: m.PruneOptions,
+		PruneKeep:    append([]string(nil), m.PruneKeep...),
+		PruneProtect: append([]string(nil), m.PruneProtect...),
+
+		ForbiddenPackages: append([]string(nil), m.ForbiddenPackages...),
+		Keyring:           m.Keyring,
+		RequireSignedTags: m.RequireSignedTags,
+		Mirrors:           append([]gps.SourceMirror(nil), m.Mirrors...),
+		SkipTestImports:   m.SkipTestImports,
+		PostEnsure:        append([]string(nil), m.PostEnsure...),
+	}
+	for pr, pp := range m.Constraints {
+		c.Constraints[pr] = pp
+	}
+	for pr, pp := range m.Ovr {
+		c.Ovr[pr] = pp
+	}
+	if m.Floating != nil {
+		c.Floating = make(map[gps.ProjectRoot]bool, len(m.Floating))
+		for pr, f := range m.Floating {
+			c.Floating[pr] = f
+		}
+	}
+	if m.VCS != nil {
+		c.VCS = make(map[gps.ProjectRoot]string, len(m.VCS))
+		for pr, vcs := range m.VCS {
+			c.VCS[pr] = vcs
+		}
+	}
+	if m.CloneDepth != nil {
+		c.CloneDepth = make(map[gps.ProjectRoot]int, len(m.CloneDepth))
+		for pr, depth := range m.CloneDepth {
+			c.CloneDepth[pr] = depth
+		}
+	}
+	if m.RefNamespace != nil {
+		c.RefNamespace = make(map[gps.ProjectRoot]string, len(m.RefNamespace))
+		for pr, ns := range m.RefNamespace {
+			c.RefNamespace[pr] = ns
+		}
+	}
+	if m.Exclude != nil {
+		c.Exclude = make(map[gps.ProjectRoot][]string, len(m.Exclude))
+		for pr, versions := range m.Exclude {
+			c.Exclude[pr] = append([]string(nil), versions...)
+		}
+	}
+	if m.SignedTags != nil {
+		c.SignedTags = make(map[gps.ProjectRoot]bool, len(m.SignedTags))
+		for pr := range m.SignedTags {
+			c.SignedTags[pr] = true
+		}
+	}
+	if m.PinDigest != nil {
+		c.PinDigest = make(map[gps.ProjectRoot]string, len(m.PinDigest))
+		for pr, digest := range m.PinDigest {
+			c.PinDigest[pr] = digest
+		}
+	}
+	if m.ShortDigest != nil {
+		c.ShortDigest = make(map[gps.ProjectRoot]bool, len(m.ShortDigest))
+		for pr := range m.ShortDigest {
+			c.ShortDigest[pr] = true
+		}
+	}
+	return c
 }
 
 func applyUpdateArgs(args []string, params *gps.SolveParameters) {
@@ -396,3 +1244,32 @@ func checkErrors(m map[string]pkgtree.PackageOrErr) error {
 
 	return nil
 }
+
+// verifyPinnedDigests returns a function that checks that the projects of l
+// vendored in a vendor directory have the content digests they are pinned to,
+// for use as a SafeWriter's VerifyVendor. It returns nil if no project of l is
+// pinned.
+func verifyPinnedDigests(pins map[gps.ProjectRoot]string, l *dep.Lock) func(string) error {
+	var pinned []gps.ProjectRoot
+	for _, lp := range l.Projects() {
+		if _, has := pins[lp.Ident().ProjectRoot]; has {
+			pinned = append(pinned, lp.Ident().ProjectRoot)
+		}
+	}
+	if len(pinned) == 0 {
+		return nil
+	}
+
+	return func(vendor string) error {
+		for _, pr := range pinned {
+			digest, err := dep.DigestDir(filepath.Join(vendor, filepath.FromSlash(string(pr))))
+			if err != nil {
+				return errors.Wrapf(err, "unable to digest the vendored copy of %s", pr)
+			}
+			if digest != pins[pr] {
+				return errors.Errorf("the content of %s does not match its pin-digest: expected %s, got %s; its upstream may have been rewritten, so nothing was written", pr, pins[pr], digest)
+			}
+		}
+		return nil
+	}
+}
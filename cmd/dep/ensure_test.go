@@ -5,11 +5,26 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/golang/dep"
 	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
 	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
 )
 
 func TestDeduceConstraint(t *testing.T) {
@@ -17,7 +32,7 @@ func TestDeduceConstraint(t *testing.T) {
 	h := test.NewHelper(t)
 	cacheDir := "gps-repocache"
 	h.TempDir(cacheDir)
-	sm, err := gps.NewSourceManager(h.Path(cacheDir))
+	sm, err := gps.NewSourceManager(gps.SourceManagerConfig{Cachedir: h.Path(cacheDir)})
 	h.Must(err)
 
 	sv, err := gps.NewSemverConstraintIC("v0.8.1")
@@ -57,7 +72,7 @@ func TestDeduceConstraint_InvalidInput(t *testing.T) {
 
 	cacheDir := "gps-repocache"
 	h.TempDir(cacheDir)
-	sm, err := gps.NewSourceManager(h.Path(cacheDir))
+	sm, err := gps.NewSourceManager(gps.SourceManagerConfig{Cachedir: h.Path(cacheDir)})
 	h.Must(err)
 
 	constraints := []string{
@@ -74,3 +89,1218 @@ func TestDeduceConstraint_InvalidInput(t *testing.T) {
 		}
 	}
 }
+
+// failingDeduceSourceManager deduces every path as its own project root,
+// except for fail, which it fails to deduce.
+type failingDeduceSourceManager struct {
+	gps.SourceManager
+	fail string
+}
+
+func (sm failingDeduceSourceManager) DeduceProjectRoot(ip string) (gps.ProjectRoot, error) {
+	if ip == sm.fail {
+		return "", errors.Errorf("unable to deduce repository and source type for %q", ip)
+	}
+	return gps.ProjectRoot(ip), nil
+}
+
+func TestEnsureAddIsAtomic(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	manifest := "[[constraint]]\n  name = \"github.com/sdboyer/deptest\"\n  version = \"^1.0.0\"\n"
+	lock := "memo = \"\"\n"
+	h.TempFile(filepath.Join("proj", dep.ManifestName), manifest)
+	h.TempFile(filepath.Join("proj", dep.LockName), lock)
+	root := h.Path("proj")
+
+	c, err := gps.NewSemverConstraintIC("^1.0.0")
+	h.Must(err)
+	p := &dep.Project{
+		AbsRoot: root,
+		Manifest: &dep.Manifest{
+			Constraints: gps.ProjectConstraints{
+				"github.com/sdboyer/deptest": {Constraint: c},
+			},
+			Ovr: make(gps.ProjectConstraints),
+		},
+	}
+
+	ctx := &dep.Ctx{Loggers: &dep.Loggers{
+		Out: log.New(ioutil.Discard, "", 0),
+		Err: log.New(ioutil.Discard, "", 0),
+	}}
+	sm := failingDeduceSourceManager{fail: "github.com/sdboyer/deptestdos"}
+	args := []string{
+		"github.com/sdboyer/deptest@^2.0.0",
+		"github.com/pkg/errors@^0.8.0",
+		"github.com/sdboyer/deptestdos@^2.0.0",
+	}
+
+	cmd := &ensureCommand{add: true}
+	if err = cmd.runAdd(ctx, args, p, sm, p.MakeParams()); err == nil {
+		t.Fatal("expected adding an undeducible project to fail")
+	}
+
+	for name, want := range map[string]string{dep.ManifestName: manifest, dep.LockName: lock} {
+		got, err := ioutil.ReadFile(filepath.Join(root, name))
+		h.Must(err)
+		if string(got) != want {
+			t.Errorf("expected %s to be unchanged, got:\n%s", name, got)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(root, "vendor")); !os.IsNotExist(err) {
+		t.Errorf("expected no vendor folder to be written, got %v", err)
+	}
+
+	if len(p.Manifest.Constraints) != 1 {
+		t.Fatalf("expected the in-memory manifest to be unchanged, got %v", p.Manifest.Constraints)
+	}
+	if c := p.Manifest.Constraints["github.com/sdboyer/deptest"].Constraint.String(); c != "^1.0.0" {
+		t.Errorf("expected the in-memory constraint to be unchanged, got %s", c)
+	}
+}
+
+func TestEnsureValidateSolution(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	manifest := "[[constraint]]\n  name = \"github.com/sdboyer/deptest\"\n  version = \"^1.0.0\"\n"
+	lock := "memo = \"\"\n"
+	h.TempFile(filepath.Join("proj", dep.ManifestName), manifest)
+	h.TempFile(filepath.Join("proj", dep.LockName), lock)
+	root := h.Path("proj")
+	p := &dep.Project{AbsRoot: root, Manifest: &dep.Manifest{}}
+
+	rejected := gps.ProjectRoot("github.com/pkg/errors")
+	ctx := &dep.Ctx{
+		Loggers: &dep.Loggers{
+			Out: log.New(ioutil.Discard, "", 0),
+			Err: log.New(ioutil.Discard, "", 0),
+		},
+		ValidateSolution: func(l *dep.Lock) error {
+			for _, lp := range l.Projects() {
+				if lp.Ident().ProjectRoot == rejected {
+					return errors.Errorf("%s is not allowed", rejected)
+				}
+			}
+			return nil
+		},
+	}
+	newLock := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(
+				gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"},
+				gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				[]string{"."},
+			),
+			gps.NewLockedProject(
+				gps.ProjectIdentifier{ProjectRoot: rejected},
+				gps.NewVersion("v0.8.0").Is("645ef00459ed84a119197bfb8d8205042c6df63d"),
+				[]string{"."},
+			),
+		},
+	}
+
+	// The validator must run before the source manager is ever needed to
+	// write out vendor.
+	cmd := &ensureCommand{}
+	if err := cmd.writeSolution(ctx, p, p.Manifest, newLock, nil); err == nil {
+		t.Fatal("expected the rejected solution to fail")
+	}
+
+	for name, want := range map[string]string{dep.ManifestName: manifest, dep.LockName: lock} {
+		got, err := ioutil.ReadFile(filepath.Join(root, name))
+		h.Must(err)
+		if string(got) != want {
+			t.Errorf("expected %s to be unchanged, got:\n%s", name, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "vendor")); !os.IsNotExist(err) {
+		t.Errorf("expected no vendor folder to be written, got %v", err)
+	}
+}
+
+func TestEnsureNoBranches(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	lock := "memo = \"\"\n"
+	h.TempFile(filepath.Join("proj", dep.LockName), lock)
+	root := h.Path("proj")
+	p := &dep.Project{AbsRoot: root, Manifest: &dep.Manifest{}}
+
+	newLock := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(
+				gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"},
+				gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				[]string{"."},
+			),
+			gps.NewLockedProject(
+				gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"},
+				gps.NewBranch("master").Is("5c607206be5decd28e6263ffffdcee067266015e"),
+				[]string{"."},
+			),
+		},
+	}
+
+	ctx := &dep.Ctx{Loggers: &dep.Loggers{
+		Out: log.New(ioutil.Discard, "", 0),
+		Err: log.New(ioutil.Discard, "", 0),
+	}}
+	cmd := &ensureCommand{noBranches: true}
+	h.Must(cmd.addPolicy(ctx))
+
+	err := cmd.writeSolution(ctx, p, nil, newLock, nil)
+	if err == nil {
+		t.Fatal("expected a solution with a branch to be rejected under -no-branches")
+	}
+	if !strings.Contains(err.Error(), "github.com/sdboyer/deptestdos") {
+		t.Errorf("expected the error to list the project locked to a branch, got %q", err)
+	}
+	if strings.Contains(err.Error(), "github.com/sdboyer/deptest ") {
+		t.Errorf("expected the error to list only projects locked to a branch, got %q", err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(root, dep.LockName))
+	h.Must(err)
+	if string(got) != lock {
+		t.Errorf("expected the lock to be unchanged, got:\n%s", got)
+	}
+}
+
+func TestEnsurePatch(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	lockAt := func(v gps.PairedVersion) *dep.Lock {
+		return &dep.Lock{
+			P: []gps.LockedProject{
+				gps.NewLockedProject(
+					gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"},
+					v,
+					[]string{"."},
+				),
+			},
+		}
+	}
+	cur, err := lockAt(gps.NewVersion("v0.8.0").Is("3f4c3bea144e112a69bbe5d8d01c1b09a544253f")).MarshalTOML()
+	h.Must(err)
+	h.TempFile(filepath.Join("proj", dep.LockName), string(cur))
+	root := h.Path("proj")
+	p := &dep.Project{AbsRoot: root, Manifest: &dep.Manifest{}}
+
+	var out bytes.Buffer
+	ctx := &dep.Ctx{Loggers: &dep.Loggers{
+		Out: log.New(&out, "", 0),
+		Err: log.New(ioutil.Discard, "", 0),
+	}}
+	newLock := lockAt(gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"))
+
+	cmd := &ensureCommand{patch: true}
+	h.Must(cmd.writeSolution(ctx, p, nil, newLock, nil))
+
+	want := `--- a/Gopkg.lock
++++ b/Gopkg.lock
+@@ -2,8 +2,8 @@
+ [[projects]]
+   name = "github.com/sdboyer/deptest"
+   packages = ["."]
+-  revision = "3f4c3bea144e112a69bbe5d8d01c1b09a544253f"
+-  version = "v0.8.0"
++  revision = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
++  version = "v1.0.0"
+ 
+ [solve-meta]
+   analyzer-name = ""
+`
+	if out.String() != want {
+		t.Errorf("unexpected patch:\n(GOT):\n%s\n(WNT):\n%s", out.String(), want)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(root, dep.LockName))
+	h.Must(err)
+	if !bytes.Equal(got, cur) {
+		t.Errorf("expected %s to be unchanged, got:\n%s", dep.LockName, got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "vendor")); !os.IsNotExist(err) {
+		t.Errorf("expected no vendor folder to be written, got %v", err)
+	}
+}
+
+func TestEnsureBackupAndRestore(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	lockAt := func(v gps.PairedVersion) *dep.Lock {
+		return &dep.Lock{
+			P: []gps.LockedProject{
+				gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, v, []string{"."}),
+			},
+		}
+	}
+	oldLock := lockAt(gps.NewVersion("v0.8.0").Is("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"))
+	cur, err := oldLock.MarshalTOML()
+	h.Must(err)
+	vendored := filepath.Join("src", "proj", "vendor", "github.com", "sdboyer", "deptest", "deptest.go")
+	h.TempFile(filepath.Join("src", "proj", dep.ManifestName), "")
+	h.TempFile(filepath.Join("src", "proj", dep.LockName), string(cur))
+	h.TempFile(vendored, "package deptest // v0.8.0\n")
+	root := h.Path(filepath.Join("src", "proj"))
+
+	var errOut bytes.Buffer
+	ctx := &dep.Ctx{
+		GOPATH:     h.Path("."),
+		WorkingDir: root,
+		Loggers: &dep.Loggers{
+			Out: log.New(ioutil.Discard, "", 0),
+			Err: log.New(&errOut, "", 0),
+		},
+	}
+	p := &dep.Project{AbsRoot: root, Manifest: &dep.Manifest{}, Lock: oldLock}
+	sm := &fakeSourceManager{files: map[string]string{"deptest.go": "package deptest // v1.0.0\n"}}
+
+	cmd := &ensureCommand{backup: true}
+	newLock := lockAt(gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"))
+	h.Must(cmd.writeSolution(ctx, p, nil, newLock, sm))
+
+	backups, err := filepath.Glob(filepath.Join(root, "_dep-backup-*"))
+	h.Must(err)
+	if len(backups) != 1 {
+		t.Fatalf("expected one backup, got %v", backups)
+	}
+	backup := backups[0]
+	if !strings.Contains(errOut.String(), backup) {
+		t.Errorf("expected the backup location to be printed, got %q", errOut.String())
+	}
+
+	// The backup holds the lock and vendor from before ensure.
+	got, err := ioutil.ReadFile(filepath.Join(backup, dep.LockName))
+	h.Must(err)
+	if !bytes.Equal(got, cur) {
+		t.Errorf("expected the backed up lock to be the original, got:\n%s", got)
+	}
+	got, err = ioutil.ReadFile(filepath.Join(backup, "vendor", "github.com", "sdboyer", "deptest", "deptest.go"))
+	h.Must(err)
+	if string(got) != "package deptest // v0.8.0\n" {
+		t.Errorf("expected the backed up vendor to be the original, got %q", got)
+	}
+	got, err = ioutil.ReadFile(h.Path(vendored))
+	h.Must(err)
+	if string(got) != "package deptest // v1.0.0\n" {
+		t.Fatalf("expected ensure to update vendor, got %q", got)
+	}
+
+	// Restoring puts both back.
+	h.Must((&restoreCommand{}).Run(ctx, []string{filepath.Base(backup)}))
+	got, err = ioutil.ReadFile(filepath.Join(root, dep.LockName))
+	h.Must(err)
+	if !bytes.Equal(got, cur) {
+		t.Errorf("expected the lock to be restored, got:\n%s", got)
+	}
+	got, err = ioutil.ReadFile(h.Path(vendored))
+	h.Must(err)
+	if string(got) != "package deptest // v0.8.0\n" {
+		t.Errorf("expected vendor to be restored, got %q", got)
+	}
+}
+
+func TestEnsureExplicitGOPATH(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	// The two projects share an import path, but live in separate GOPATHs,
+	// neither of which is the one in the environment.
+	gopaths := []string{"a", "b"}
+	for _, gp := range gopaths {
+		h.TempFile(filepath.Join(gp, "src", "proj", dep.ManifestName), "")
+		h.TempFile(filepath.Join(gp, "src", "proj", "main.go"), "package main\n\nfunc main() {}\n")
+	}
+	h.TempDir("ambient")
+	env := []string{"GOPATH=" + h.Path("ambient"), "HOME=" + h.Path("ambient")}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(gopaths))
+	for i, gp := range gopaths {
+		wg.Add(1)
+		go func(i int, gp string) {
+			defer wg.Done()
+			var stderr bytes.Buffer
+			err := runMain("dep", []string{"ensure", "-gopath", h.Path(gp)}, ioutil.Discard, &stderr, h.Path(filepath.Join(gp, "src", "proj")), env)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %s", err, stderr.String())
+			}
+		}(i, gp)
+	}
+	wg.Wait()
+
+	for i, gp := range gopaths {
+		if errs[i] != nil {
+			t.Fatalf("ensure in GOPATH %s failed: %s", gp, errs[i])
+		}
+
+		// Each project is solved in its own GOPATH, with its own cache.
+		if _, err := os.Stat(h.Path(filepath.Join(gp, "src", "proj", dep.LockName))); err != nil {
+			t.Errorf("expected a lock to be written in GOPATH %s: %s", gp, err)
+		}
+		if _, err := os.Stat(h.Path(filepath.Join(gp, "pkg", "dep", "sources"))); err != nil {
+			t.Errorf("expected the cache to be in GOPATH %s: %s", gp, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(h.Path("ambient"), "pkg")); !os.IsNotExist(err) {
+		t.Errorf("expected the GOPATH in the environment to be left alone, got %v", err)
+	}
+}
+
+func TestEnsureForbiddenPackages(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile(filepath.Join("src", "proj", dep.ManifestName), `forbidden-packages = ["github.com/sdboyer/deptest/legacy"]
+`)
+	h.TempFile(filepath.Join("src", "proj", "main.go"), "package main\n\nimport _ \"github.com/sdboyer/deptest\"\n\nfunc main() {}\n")
+	h.TempFile(filepath.Join("src", "proj", "sub", "old.go"), "package sub\n\nimport _ \"github.com/sdboyer/deptest/legacy/api\"\n")
+	h.TempFile(filepath.Join("src", "proj", "sub", "new.go"), "package sub\n")
+
+	var stderr bytes.Buffer
+	env := []string{"GOPATH=" + h.Path("."), "HOME=" + h.Path(".")}
+	err := runMain("dep", []string{"ensure"}, ioutil.Discard, &stderr, h.Path(filepath.Join("src", "proj")), env)
+	if err == nil {
+		t.Fatal("expected ensure to fail on the forbidden import")
+	}
+
+	want := filepath.Join("sub", "old.go") + " imports github.com/sdboyer/deptest/legacy/api"
+	if !strings.Contains(stderr.String(), want) {
+		t.Errorf("expected the error to name the offending file with %q, got:\n%s", want, stderr.String())
+	}
+	if strings.Contains(stderr.String(), "main.go") || strings.Contains(stderr.String(), "new.go") {
+		t.Errorf("expected only the offending file to be named, got:\n%s", stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(h.Path(filepath.Join("src", "proj")), dep.LockName)); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written, got %v", err)
+	}
+}
+
+func TestEnsureUnusedConstraints(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	proj := filepath.Join("src", "proj")
+	h.TempFile(filepath.Join(proj, dep.ManifestName), `[[constraint]]
+  name = "github.com/foo/stale"
+  version = "1.0.0"
+`)
+	h.TempFile(filepath.Join(proj, "main.go"), "package main\n\nfunc main() {}\n")
+
+	var stdout, stderr bytes.Buffer
+	env := []string{"GOPATH=" + h.Path("."), "HOME=" + h.Path(".")}
+	if err := runMain("dep", []string{"ensure"}, ioutil.Discard, &stderr, h.Path(proj), env); err != nil {
+		t.Fatalf("unexpected error: %s\n%s", err, stderr.String())
+	}
+	for _, want := range []string{"not in the solution", "  github.com/foo/stale\n", "dep remove github.com/foo/stale"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("expected ensure to warn about the unused constraint with %q, got:\n%s", want, stderr.String())
+		}
+	}
+
+	stderr.Reset()
+	if err := runMain("dep", []string{"status", "-unused-constraints"}, &stdout, &stderr, h.Path(proj), env); err != nil {
+		t.Fatalf("unexpected error: %s\n%s", err, stderr.String())
+	}
+	if stdout.String() != "github.com/foo/stale\n" {
+		t.Errorf("expected status to list the unused constraint, got %q", stdout.String())
+	}
+}
+
+func TestEnsureUpdateSkipsMetadataCache(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	proj := filepath.Join("src", "proj")
+	h.TempFile(filepath.Join(proj, dep.ManifestName), "")
+	h.TempFile(filepath.Join(proj, "main.go"), "package main\n")
+
+	for _, cmd := range []*ensureCommand{{update: true}, {add: true}, {}} {
+		ctx := newTestContext(h)
+		ctx.GOPATHS = []string{ctx.GOPATH}
+		ctx.WorkingDir = h.Path(proj)
+		ctx.MetadataTTL = time.Hour
+
+		// Whether or not these succeed, the cache must be settled by then.
+		cmd.parallel = 1
+		cmd.Run(ctx, nil)
+
+		if bypass := cmd.update || cmd.add; bypass != (ctx.MetadataTTL == 0) {
+			t.Errorf("expected update=%t, add=%t to bypass the metadata cache: %t, got a TTL of %s", cmd.update, cmd.add, bypass, ctx.MetadataTTL)
+		}
+	}
+}
+
+func TestEnsureReport(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("proj")
+	root := h.Path("proj")
+	ctx := &dep.Ctx{
+		Loggers: &dep.Loggers{
+			Out: log.New(ioutil.Discard, "", 0),
+			Err: log.New(ioutil.Discard, "", 0),
+		},
+	}
+	p := &dep.Project{AbsRoot: root, Manifest: &dep.Manifest{}}
+	sm := &fakeSourceManager{files: map[string]string{"deptest.go": "package deptest\n"}}
+
+	pr := gps.ProjectRoot("github.com/sdboyer/deptest")
+	committed := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	newLock := &dep.Lock{
+		SolveMeta: dep.SolveMeta{InputsDigest: []byte{0xde, 0xad, 0xbe, 0xef}},
+		P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: pr}, gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}),
+		},
+		CommitTimes: map[gps.ProjectRoot]time.Time{pr: committed},
+	}
+
+	cmd := &ensureCommand{report: true}
+	before := time.Now().Add(-time.Second)
+	h.Must(cmd.writeSolution(ctx, p, nil, newLock, sm))
+
+	b, err := ioutil.ReadFile(filepath.Join(root, reportName))
+	h.Must(err)
+	var report ensureReport
+	h.Must(json.Unmarshal(b, &report))
+
+	if report.InputsDigest != "deadbeef" {
+		t.Errorf("expected the inputs digest deadbeef, got %q", report.InputsDigest)
+	}
+	if report.DepVersion == "" {
+		t.Error("expected the dep version to be recorded")
+	}
+	if report.GoVersion != runtime.Version() {
+		t.Errorf("expected the go version %s, got %q", runtime.Version(), report.GoVersion)
+	}
+	resolved, err := time.Parse(time.RFC3339, report.ResolvedAt)
+	if err != nil || resolved.Before(before.Truncate(time.Second)) {
+		t.Errorf("expected the resolution time to be now, got %q", report.ResolvedAt)
+	}
+
+	digest, err := dep.DigestDir(filepath.Join(root, "vendor", "github.com", "sdboyer", "deptest"))
+	h.Must(err)
+	want := []reportProject{{
+		Name:       string(pr),
+		Version:    "v1.0.0",
+		Revision:   "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+		Digest:     digest,
+		CommitTime: "2017-06-01T12:00:00Z",
+	}}
+	if !reflect.DeepEqual(report.Projects, want) {
+		t.Errorf("unexpected projects in the report:\n\t(GOT) %+v\n\t(WNT) %+v", report.Projects, want)
+	}
+	if !strings.HasPrefix(digest, "sha256:") {
+		t.Errorf("expected a sha256 digest of the vendored files, got %q", digest)
+	}
+}
+
+func TestEnsurePinDigest(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("proj")
+	root := h.Path("proj")
+	ctx := &dep.Ctx{
+		Loggers: &dep.Loggers{
+			Out: log.New(ioutil.Discard, "", 0),
+			Err: log.New(ioutil.Discard, "", 0),
+		},
+	}
+	pr := gps.ProjectRoot("github.com/sdboyer/deptest")
+	newLock := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: pr}, gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}),
+		},
+	}
+
+	// Find the digest of what the source manager serves.
+	sm := &fakeSourceManager{files: map[string]string{"deptest.go": "package deptest\n"}}
+	h.TempDir("expected")
+	h.Must(sm.ExportProject(gps.ProjectIdentifier{ProjectRoot: pr}, newLock.P[0].Version(), h.Path("expected")))
+	digest, err := dep.DigestDir(h.Path("expected"))
+	h.Must(err)
+
+	// The upstream has since been rewritten under the same revision.
+	sm = &fakeSourceManager{files: map[string]string{"deptest.go": "package deptest\n\nfunc init() { panic(1) }\n"}}
+	p := &dep.Project{AbsRoot: root, Manifest: &dep.Manifest{PinDigest: map[gps.ProjectRoot]string{pr: digest}}}
+	err = (&ensureCommand{}).writeSolution(ctx, p, nil, newLock, sm)
+	if err == nil {
+		t.Fatal("expected a mismatched pin-digest to fail ensure")
+	}
+	if !strings.Contains(err.Error(), "github.com/sdboyer/deptest does not match its pin-digest: expected "+digest) {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(root, "vendor")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be vendored, got %v", err)
+	}
+
+	sm = &fakeSourceManager{files: map[string]string{"deptest.go": "package deptest\n"}}
+	h.Must((&ensureCommand{}).writeSolution(ctx, p, nil, newLock, sm))
+	if _, err = os.Stat(filepath.Join(root, "vendor", "github.com", "sdboyer", "deptest", "deptest.go")); err != nil {
+		t.Errorf("expected the matching project to be vendored, got %v", err)
+	}
+}
+
+func TestEnsureParallel(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := &dep.Ctx{
+		Loggers: &dep.Loggers{
+			Out: log.New(ioutil.Discard, "", 0),
+			Err: log.New(ioutil.Discard, "", 0),
+		},
+	}
+	newLock := &dep.Lock{}
+	for i := 0; i < 10; i++ {
+		pr := gps.ProjectRoot("github.com/sdboyer/dep" + strconv.Itoa(i))
+		newLock.P = append(newLock.P, gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: pr}, gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}))
+	}
+
+	for _, n := range []int{1, 3} {
+		root := "proj" + strconv.Itoa(n)
+		h.TempDir(root)
+		p := &dep.Project{AbsRoot: h.Path(root), Manifest: &dep.Manifest{}}
+		sm := &fakeSourceManager{files: map[string]string{"x.go": "package x\n"}, exportDelay: 20 * time.Millisecond}
+		h.Must((&ensureCommand{parallel: n}).writeSolution(ctx, p, nil, newLock, sm))
+
+		if sm.exporting.Max() > n {
+			t.Errorf("-parallel %d: expected at most %d exports at once, saw %d", n, n, sm.exporting.Max())
+		}
+		if n > 1 && sm.exporting.Max() < 2 {
+			t.Errorf("-parallel %d: expected exports to run at once, saw at most %d", n, sm.exporting.Max())
+		}
+		for _, lp := range newLock.P {
+			h.MustExist(filepath.Join(h.Path(root), "vendor", filepath.FromSlash(string(lp.Ident().ProjectRoot)), "x.go"))
+		}
+	}
+
+	for _, c := range []struct{ parallel, jobs, want int }{
+		{parallel: 3, jobs: 0, want: 3},
+		{parallel: 3, jobs: 8, want: 3},
+		{parallel: 3, jobs: 2, want: 2},
+	} {
+		ctx := &dep.Ctx{Jobs: c.jobs}
+		(&ensureCommand{parallel: c.parallel}).limitJobs(ctx)
+		if ctx.Jobs != c.want {
+			t.Errorf("-parallel %d, -jobs %d: expected the source manager to run %d jobs at once, got %d", c.parallel, c.jobs, c.want, ctx.Jobs)
+		}
+	}
+
+	err := (&ensureCommand{parallel: 0}).Run(ctx, nil)
+	if err == nil || !strings.Contains(err.Error(), "-parallel") {
+		t.Errorf("expected an error for -parallel 0, got %v", err)
+	}
+}
+
+func TestEnsurePruneProtect(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	ctx := &dep.Ctx{
+		Loggers: &dep.Loggers{
+			Out: log.New(ioutil.Discard, "", 0),
+			Err: log.New(ioutil.Discard, "", 0),
+		},
+	}
+	newLock := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}),
+		},
+	}
+	h.TempDir("proj")
+	p := &dep.Project{
+		AbsRoot: h.Path("proj"),
+		Manifest: &dep.Manifest{
+			PruneOptions: gps.PruneBuildIgnoredFiles,
+			PruneKeep:    []string{"*.go"},
+			PruneProtect: []string{"**/*.proto", "data/*.json", "gen.go"},
+		},
+	}
+	sm := &fakeSourceManager{files: map[string]string{
+		"deptest.go":       "package deptest\n",
+		"gen.go":           "// +build ignore\n\npackage main\n",
+		"api.proto":        "syntax = \"proto3\";\n",
+		"sub/types.proto":  "syntax = \"proto3\";\n",
+		"data/table.json":  "{}\n",
+		"data/README.md":   "data\n",
+		"tools/install.sh": "#!/bin/sh\n",
+	}}
+	h.Must((&ensureCommand{}).writeSolution(ctx, p, nil, newLock, sm))
+
+	dir := filepath.Join(h.Path("proj"), "vendor", "github.com", "sdboyer", "deptest")
+	for _, name := range []string{"deptest.go", "gen.go", "api.proto", "sub/types.proto", "data/table.json"} {
+		h.MustExist(filepath.Join(dir, filepath.FromSlash(name)))
+	}
+	for _, name := range []string{"data/README.md", "tools"} {
+		h.MustNotExist(filepath.Join(dir, filepath.FromSlash(name)))
+	}
+}
+
+func TestEnsureLockAuthoritative(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	// Nothing in the project imports deptest anymore, and its source doesn't
+	// even parse, but the lock still records it.
+	h.TempFile(filepath.Join("proj", "main.go"), "package main\n\nfunc main() {\n")
+	root := h.Path("proj")
+
+	ctx := &dep.Ctx{
+		Loggers: &dep.Loggers{
+			Out: log.New(ioutil.Discard, "", 0),
+			Err: log.New(ioutil.Discard, "", 0),
+		},
+	}
+	l := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}),
+		},
+	}
+	p := &dep.Project{AbsRoot: root, Manifest: &dep.Manifest{}, Lock: l}
+	sm := &fakeSourceManager{files: map[string]string{"deptest.go": "package deptest\n"}}
+
+	cmd := &ensureCommand{lockAuthoritative: true}
+	h.Must(cmd.vendorLock(ctx, p, sm))
+
+	if sm.exports != 1 {
+		t.Fatalf("expected the locked project to be exported once, got %d exports", sm.exports)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(root, "vendor", "github.com", "sdboyer", "deptest", "deptest.go"))
+	h.Must(err)
+	if string(got) != "package deptest\n" {
+		t.Errorf("expected the unimported project to be vendored, got %q", got)
+	}
+
+	if err := (&ensureCommand{}).vendorLock(ctx, &dep.Project{AbsRoot: root, Manifest: &dep.Manifest{}}, sm); err == nil {
+		t.Error("expected an error without a lock")
+	}
+
+	// With -commit-times, the commit times missing from the lock are
+	// recorded in it.
+	fetched := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	sm = &fakeSourceManager{files: map[string]string{"deptest.go": "package deptest\n"}, commitTime: fetched}
+	cmd = &ensureCommand{lockAuthoritative: true, commitTimes: true}
+	h.Must(cmd.vendorLock(ctx, p, sm))
+	written, err := dep.LoadLock(filepath.Join(root, dep.LockName))
+	h.Must(err)
+	want := map[gps.ProjectRoot]time.Time{"github.com/sdboyer/deptest": fetched}
+	if !reflect.DeepEqual(written.CommitTimes, want) {
+		t.Errorf("expected the commit times %v to be recorded, got %v", want, written.CommitTimes)
+	}
+}
+
+func TestEnsureOnlyLock(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile(filepath.Join("proj", "main.go"), "package main\n\nimport _ \"github.com/sdboyer/deptest\"\n")
+	root := h.Path("proj")
+
+	ctx := &dep.Ctx{
+		CacheDir: h.Path("."),
+		Loggers: &dep.Loggers{
+			Out: log.New(ioutil.Discard, "", 0),
+			Err: log.New(ioutil.Discard, "", 0),
+		},
+	}
+	l := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}),
+		},
+	}
+	p := &dep.Project{AbsRoot: root, ImportRoot: "example.com/proj", Manifest: &dep.Manifest{}, Lock: l}
+	sm := &fakeSourceManager{files: map[string]string{"deptest.go": "package deptest\n"}}
+
+	params := p.MakeParams()
+	ptree, err := pkgtree.ListPackages(root, string(p.ImportRoot))
+	h.Must(err)
+	params.RootPackageTree = ptree
+	s, err := gps.Prepare(params, sm)
+	h.Must(err)
+	l.SolveMeta.InputsDigest = s.HashInputs()
+
+	h.Must(checkLockInSync(ctx, p, sm))
+	h.Must((&ensureCommand{onlyLock: true}).vendorLock(ctx, p, sm))
+	if sm.exports != 1 {
+		t.Fatalf("expected the locked project to be exported once, got %d exports", sm.exports)
+	}
+
+	// Importing something new leaves the lock stale.
+	h.TempFile(filepath.Join("proj", "other.go"), "package main\n\nimport _ \"github.com/sdboyer/deptestdos\"\n")
+	err = checkLockInSync(ctx, p, sm)
+	if err == nil {
+		t.Fatal("expected an error for a lock out of sync with the imports")
+	}
+	if !strings.Contains(err.Error(), "out of sync") {
+		t.Errorf("unexpected error for a stale lock: %v", err)
+	}
+
+	if err := checkLockInSync(ctx, &dep.Project{AbsRoot: root, ImportRoot: "example.com/proj", Manifest: &dep.Manifest{}}, sm); err == nil {
+		t.Error("expected an error without a lock")
+	}
+}
+
+func TestEnsureVendorLockPolicy(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile(filepath.Join("proj", "main.go"), "package main\n\nimport _ \"github.com/sdboyer/deptest\"\n")
+	h.TempFile("policy.toml", "forbidden = [\"github.com/sdboyer/deptest\"]\n")
+	root := h.Path("proj")
+
+	for _, cmd := range []*ensureCommand{
+		{onlyLock: true, policy: h.Path("policy.toml")},
+		{lockAuthoritative: true, policy: h.Path("policy.toml")},
+		{onlyLock: true, noBranches: true},
+	} {
+		ctx := &dep.Ctx{
+			Loggers: &dep.Loggers{
+				Out: log.New(ioutil.Discard, "", 0),
+				Err: log.New(ioutil.Discard, "", 0),
+			},
+		}
+		h.Must(cmd.addPolicy(ctx))
+
+		l := &dep.Lock{
+			P: []gps.LockedProject{
+				gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, gps.NewBranch("master").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}),
+			},
+		}
+		p := &dep.Project{AbsRoot: root, ImportRoot: "example.com/proj", Manifest: &dep.Manifest{}, Lock: l}
+		sm := &fakeSourceManager{files: map[string]string{"deptest.go": "package deptest\n"}}
+
+		err := cmd.vendorLock(ctx, p, sm)
+		if err == nil || !strings.Contains(err.Error(), "lock rejected") {
+			t.Errorf("expected the policy to reject the lock, got %v", err)
+		}
+		if sm.exports != 0 {
+			t.Errorf("expected nothing to be vendored, got %d exports", sm.exports)
+		}
+	}
+}
+
+func TestEnsureCanonicalImports(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile(filepath.Join("src", "proj", "main.go"), "package main\n\nimport _ \"github.com/foo/bar\"\n")
+	root := h.Path(filepath.Join("src", "proj"))
+
+	// bar imports its own hooks package under the path of the same repository
+	// with different case, so the solver locked a second copy of it.
+	const (
+		canonical = "github.com/foo/bar"
+		alias     = "github.com/Foo/Bar"
+	)
+	barFiles := map[string]string{
+		"bar.go":         "package bar\n\nimport (\n\t\"fmt\"\n\n\t\"github.com/Foo/Bar/hooks\"\n)\n\nvar _ = fmt.Sprint(hooks.X)\n",
+		"hooks/hooks.go": "package hooks\n\nconst X = 1\n",
+	}
+	tree := func(pr string) pkgtree.PackageTree {
+		return pkgtree.PackageTree{
+			ImportRoot: pr,
+			Packages: map[string]pkgtree.PackageOrErr{
+				pr:            {P: pkgtree.Package{Name: "bar", ImportPath: pr, Imports: []string{"fmt", alias + "/hooks"}}},
+				pr + "/hooks": {P: pkgtree.Package{Name: "hooks", ImportPath: pr + "/hooks"}},
+			},
+		}
+	}
+	sm := &fakeSourceManager{
+		projectFiles: map[gps.ProjectRoot]map[string]string{canonical: barFiles, alias: barFiles},
+		trees:        map[gps.ProjectRoot]pkgtree.PackageTree{canonical: tree(canonical), alias: tree(alias)},
+	}
+
+	v := gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf")
+	l := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: alias}, v, []string{"hooks"}),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: canonical}, v, []string{"."}),
+		},
+	}
+
+	ctx := &dep.Ctx{
+		Loggers: &dep.Loggers{
+			Out: log.New(ioutil.Discard, "", 0),
+			Err: log.New(ioutil.Discard, "", 0),
+		},
+	}
+	p := &dep.Project{AbsRoot: root, ImportRoot: "proj", Manifest: &dep.Manifest{}}
+	cmd := &ensureCommand{canonicalImports: true}
+	h.Must(cmd.writeSolution(ctx, p, nil, l, sm))
+
+	if _, err := os.Stat(filepath.Join(root, "vendor", "github.com", "Foo")); !os.IsNotExist(err) {
+		t.Errorf("expected the duplicate copy of bar not to be vendored, got %v", err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(root, "vendor", "github.com", "foo", "bar", "bar.go"))
+	h.Must(err)
+	if !strings.Contains(string(got), `"github.com/foo/bar/hooks"`) || strings.Contains(string(got), alias) {
+		t.Errorf("expected bar to import its own hooks package, got:\n%s", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "vendor", "github.com", "foo", "bar", "hooks", "hooks.go")); err != nil {
+		t.Errorf("expected the hooks package of bar to be vendored: %s", err)
+	}
+
+	lock, err := ioutil.ReadFile(filepath.Join(root, dep.LockName))
+	h.Must(err)
+	if strings.Contains(string(lock), alias) {
+		t.Errorf("expected the duplicate copy of bar to be dropped from the lock, got:\n%s", lock)
+	}
+	if !strings.Contains(string(lock), `packages = [".","hooks"]`) {
+		t.Errorf("expected bar to hold the packages of its duplicate in the lock, got:\n%s", lock)
+	}
+
+	// The digest in the lock is that of the rewritten copy, so that dep check
+	// agrees with what is vendored.
+	digest, err := dep.DigestDir(filepath.Join(root, "vendor", "github.com", "foo", "bar"))
+	h.Must(err)
+	if !strings.Contains(string(lock), digest) {
+		t.Errorf("expected the lock to record the digest %s of the rewritten copy of bar, got:\n%s", digest, lock)
+	}
+}
+
+func TestEnsureMinimalStrategy(t *testing.T) {
+	sv, err := gps.NewSemverConstraint("^1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr := gps.ProjectRoot("github.com/sdboyer/deptest")
+	sm := &fakeSourceManager{versions: []gps.PairedVersion{
+		gps.NewVersion("v0.8.0").Is("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"),
+		gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+		gps.NewVersion("v1.1.0").Is("5c607206be5decd28e6263ffffdcee067266015e"),
+		gps.NewVersion("v1.2.0").Is("a0196baa11ea047dd65037287451d36b861b00ea"),
+		gps.NewVersion("v2.0.0").Is("645ef00459ed84a119197bfb8d8205042c6df63d"),
+	}}
+
+	for _, tc := range []struct {
+		strategy string
+		want     string
+	}{
+		{"", "v1.2.0"},
+		{"latest", "v1.2.0"},
+		{"minimal", "v1.0.0"},
+	} {
+		params := gps.SolveParameters{
+			RootDir:         "/root",
+			ProjectAnalyzer: dep.Analyzer{},
+			Manifest: &dep.Manifest{Constraints: gps.ProjectConstraints{
+				pr: {Constraint: sv},
+			}},
+			RootPackageTree: pkgtree.PackageTree{
+				ImportRoot: "example.com/root",
+				Packages: map[string]pkgtree.PackageOrErr{
+					"example.com/root": {P: pkgtree.Package{
+						ImportPath: "example.com/root",
+						Name:       "root",
+						Imports:    []string{string(pr)},
+					}},
+				},
+			},
+		}
+		if err := applyStrategy(tc.strategy, &params); err != nil {
+			t.Fatalf("%q: %s", tc.strategy, err)
+		}
+
+		solver, err := gps.Prepare(params, sm)
+		if err != nil {
+			t.Fatalf("%q: %s", tc.strategy, err)
+		}
+		solution, err := solver.Solve()
+		if err != nil {
+			t.Fatalf("%q: %s", tc.strategy, err)
+		}
+
+		lps := solution.Projects()
+		if len(lps) != 1 {
+			t.Fatalf("%q: expected one locked project, got %d", tc.strategy, len(lps))
+		}
+		if got := lps[0].Version().String(); got != tc.want {
+			t.Errorf("%q: expected %s to be %s, got %s", tc.strategy, pr, tc.want, got)
+		}
+	}
+
+	if err := applyStrategy("oldest", &gps.SolveParameters{}); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+func TestEnsureSkipsRetracted(t *testing.T) {
+	pr := gps.ProjectRoot("github.com/sdboyer/deptest")
+	v100 := gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf")
+	v110 := gps.NewVersion("v1.1.0").Is("5c607206be5decd28e6263ffffdcee067266015e")
+	sm := &fakeSourceManager{
+		versions:  []gps.PairedVersion{v100, v110},
+		retracted: []gps.PairedVersion{v110},
+	}
+	m := &dep.Manifest{Constraints: make(gps.ProjectConstraints), Ovr: make(gps.ProjectConstraints)}
+	params := gps.SolveParameters{
+		RootDir:         "/root",
+		ProjectAnalyzer: dep.Analyzer{},
+		Manifest:        m,
+		RootPackageTree: pkgtree.PackageTree{
+			ImportRoot: "example.com/root",
+			Packages: map[string]pkgtree.PackageOrErr{
+				"example.com/root": {P: pkgtree.Package{
+					ImportPath: "example.com/root",
+					Name:       "root",
+					Imports:    []string{string(pr)},
+				}},
+			},
+		},
+	}
+
+	solver, err := gps.Prepare(params, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	solution, err := solver.Solve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := dep.LockFromSolution(solution)
+	if got := l.Projects()[0].Version().String(); got != "v1.0.0" {
+		t.Errorf("expected the retracted v1.1.0 to be avoided in favor of v1.0.0, got %s", got)
+	}
+
+	var buf bytes.Buffer
+	if err := warnRetracted(log.New(&buf, "", 0), sm, m, nil, l); err != nil {
+		t.Fatal(err)
+	}
+	want := "Skipped v1.1.0 of github.com/sdboyer/deptest, which has been retracted upstream\n"
+	if buf.String() != want {
+		t.Errorf("expected warning %q, got %q", want, buf.String())
+	}
+
+	// A lock that already pins the retracted version is warned about.
+	buf.Reset()
+	pinned := &dep.Lock{P: []gps.LockedProject{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: pr}, v110, []string{"."}),
+	}}
+	if err := warnRetracted(log.New(&buf, "", 0), sm, m, nil, pinned); err != nil {
+		t.Fatal(err)
+	}
+	want = "WARNING: github.com/sdboyer/deptest is locked to v1.1.0, which has been retracted upstream\n"
+	if buf.String() != want {
+		t.Errorf("expected warning %q, got %q", want, buf.String())
+	}
+
+	// Projects the solve left as they were locked aren't checked again.
+	buf.Reset()
+	sm.retracted = nil
+	sm.listed = 0
+	if err := warnRetracted(log.New(&buf, "", 0), sm, m, pinned, pinned); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 || sm.listed != 0 {
+		t.Errorf("expected the unchanged project not to be checked, got %d lookups and %q", sm.listed, buf.String())
+	}
+}
+
+func TestEnsureRecordCommitTimes(t *testing.T) {
+	t.Parallel()
+
+	recorded := time.Date(2017, 6, 7, 6, 9, 10, 0, time.UTC)
+	fetched := time.Date(2017, 8, 1, 0, 0, 0, 0, time.UTC)
+	lp := func(pr gps.ProjectRoot, rev gps.Revision) gps.LockedProject {
+		return gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: pr}, gps.NewVersion("v1.0.0").Is(rev), []string{"."})
+	}
+	oldLock := &dep.Lock{
+		P: []gps.LockedProject{
+			lp("github.com/same/rev", "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+			lp("github.com/new/rev", "5c607206be5decd28e6263ffffdcee067266015e"),
+		},
+		CommitTimes: map[gps.ProjectRoot]time.Time{
+			"github.com/same/rev": recorded,
+			"github.com/new/rev":  recorded,
+		},
+	}
+	newLock := func() *dep.Lock {
+		return &dep.Lock{P: []gps.LockedProject{
+			lp("github.com/same/rev", "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+			lp("github.com/new/rev", "645ef00459ed84a119197bfb8d8205042c6df63d"),
+			lp("github.com/added", "3f4c3bea144e112a69bbe5d8d01c1b09a544253f"),
+		}}
+	}
+
+	// Without fetching, only the times of unchanged revisions carry over.
+	l := newLock()
+	if err := recordCommitTimes(l, oldLock, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	want := map[gps.ProjectRoot]time.Time{"github.com/same/rev": recorded}
+	if !reflect.DeepEqual(l.CommitTimes, want) {
+		t.Errorf("expected commit times %v, got %v", want, l.CommitTimes)
+	}
+
+	// With fetching, the rest are looked up.
+	sm := &fakeSourceManager{commitTime: fetched}
+	l = newLock()
+	if err := recordCommitTimes(l, oldLock, sm, true); err != nil {
+		t.Fatal(err)
+	}
+	want = map[gps.ProjectRoot]time.Time{
+		"github.com/same/rev": recorded,
+		"github.com/new/rev":  fetched,
+		"github.com/added":    fetched,
+	}
+	if !reflect.DeepEqual(l.CommitTimes, want) {
+		t.Errorf("expected commit times %v, got %v", want, l.CommitTimes)
+	}
+	wantRevs := []gps.Revision{"645ef00459ed84a119197bfb8d8205042c6df63d", "3f4c3bea144e112a69bbe5d8d01c1b09a544253f"}
+	if !reflect.DeepEqual(sm.commitTimes, wantRevs) {
+		t.Errorf("expected commit times to be looked up for %v, got %v", wantRevs, sm.commitTimes)
+	}
+
+	// There may be no old lock at all.
+	if err := recordCommitTimes(newLock(), nil, sm, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnsureUpdateVersion(t *testing.T) {
+	sv, err := gps.NewSemverConstraint("^1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v100 := gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf")
+	recorded := time.Date(2017, 6, 7, 6, 9, 10, 0, time.UTC)
+	sm := &fakeSourceManager{
+		versions: []gps.PairedVersion{
+			v100,
+			gps.NewVersion("v1.1.0").Is("5c607206be5decd28e6263ffffdcee067266015e"),
+			gps.NewVersion("v2.1.0").Is("a0196baa11ea047dd65037287451d36b861b00ea"),
+			gps.NewVersion("v2.2.0").Is("645ef00459ed84a119197bfb8d8205042c6df63d"),
+		},
+		files: map[string]string{"x.go": "package x\n"},
+	}
+	// deptesttres is only a transitive dependency, through deptestdos.
+	sm.imports = map[gps.ProjectRoot][]string{"github.com/sdboyer/deptestdos": {"github.com/sdboyer/deptesttres"}}
+
+	for _, tc := range []struct {
+		name string
+		spec string
+		ovr  gps.Constraint
+		err  string
+		want map[string]string
+		// constrained is the project whose constraint should be bumped, if
+		// any.
+		constrained string
+	}{
+		{
+			name: "scoped bump",
+			spec: "github.com/sdboyer/deptest@v2.1.0",
+			// Only deptest moves, and to exactly the version asked for, not
+			// the newest its new constraint allows.
+			want: map[string]string{
+				"github.com/sdboyer/deptest":     "v2.1.0",
+				"github.com/sdboyer/deptestdos":  "v1.0.0",
+				"github.com/sdboyer/deptesttres": "v1.0.0",
+			},
+			constrained: "github.com/sdboyer/deptest",
+		},
+		{
+			name: "transitive",
+			spec: "github.com/sdboyer/deptesttres@v1.1.0",
+			want: map[string]string{
+				"github.com/sdboyer/deptest":     "v1.0.0",
+				"github.com/sdboyer/deptestdos":  "v1.0.0",
+				"github.com/sdboyer/deptesttres": "v1.1.0",
+			},
+		},
+		{name: "missing version", spec: "github.com/sdboyer/deptest@v9.9.9", err: "v9.9.9 is not a version of github.com/sdboyer/deptest"},
+		{name: "overridden", spec: "github.com/sdboyer/deptest@v2.1.0", ovr: sv, err: "it is overridden to ^1.0.0"},
+		{name: "not a dependency", spec: "github.com/sdboyer/deptestquatro@v2.1.0", err: "not a dependency"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := test.NewHelper(t)
+			defer h.Cleanup()
+
+			h.TempFile(filepath.Join("proj", "main.go"), "package main\n\nimport (\n\t_ \"github.com/sdboyer/deptest\"\n\t_ \"github.com/sdboyer/deptestdos\"\n)\n")
+			root := h.Path("proj")
+
+			ctx := &dep.Ctx{
+				Loggers: &dep.Loggers{
+					Out: log.New(ioutil.Discard, "", 0),
+					Err: log.New(ioutil.Discard, "", 0),
+				},
+			}
+			p := &dep.Project{
+				AbsRoot:    root,
+				ImportRoot: "example.com/proj",
+				Manifest: &dep.Manifest{
+					Constraints: gps.ProjectConstraints{
+						"github.com/sdboyer/deptest":    {Constraint: sv},
+						"github.com/sdboyer/deptestdos": {Constraint: sv},
+					},
+					Ovr: gps.ProjectConstraints{},
+				},
+				Lock: &dep.Lock{
+					P: []gps.LockedProject{
+						gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, v100, []string{"."}),
+						gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"}, v100, []string{"."}),
+						gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptesttres"}, v100, []string{"."}),
+					},
+					CommitTimes: map[gps.ProjectRoot]time.Time{
+						"github.com/sdboyer/deptest":     recorded,
+						"github.com/sdboyer/deptestdos":  recorded,
+						"github.com/sdboyer/deptesttres": recorded,
+					},
+				},
+			}
+			if tc.ovr != nil {
+				p.Manifest.Ovr["github.com/sdboyer/deptest"] = gps.ProjectProperties{Constraint: tc.ovr}
+			}
+
+			params := p.MakeParams()
+			params.RootPackageTree, err = pkgtree.ListPackages(root, string(p.ImportRoot))
+			h.Must(err)
+
+			cmd := &ensureCommand{update: true, parallel: 1}
+			err := cmd.runUpdateVersions(ctx, []string{tc.spec}, p, sm, params)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected an error containing %q, got %v", tc.err, err)
+				}
+				h.MustNotExist(filepath.Join(root, dep.ManifestName))
+				h.MustNotExist(filepath.Join(root, dep.LockName))
+				return
+			}
+			h.Must(err)
+
+			lock, err := dep.LoadLock(filepath.Join(root, dep.LockName))
+			h.Must(err)
+			got := make(map[string]string)
+			for _, lp := range lock.Projects() {
+				got[string(lp.Ident().ProjectRoot)] = lp.Version().String()
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected the lock to hold %v, got %v", tc.want, got)
+			}
+			// Only the projects that stayed at their revisions keep their
+			// commit times.
+			for pr, v := range tc.want {
+				_, kept := lock.CommitTimes[gps.ProjectRoot(pr)]
+				if unchanged := v == "v1.0.0"; kept != unchanged {
+					t.Errorf("expected %s at %s to keep its commit time: %v, got %v", pr, v, unchanged, kept)
+				}
+			}
+			manifest, err := ioutil.ReadFile(filepath.Join(root, dep.ManifestName))
+			h.Must(err)
+			if tc.constrained != "" && !strings.Contains(string(manifest), `version = "2.1.0"`) {
+				t.Errorf("expected the constraint on %s to be bumped to 2.1.0, got:\n%s", tc.constrained, manifest)
+			}
+			if strings.Contains(string(manifest), "deptesttres") {
+				t.Errorf("expected no constraint on the transitive deptesttres, got:\n%s", manifest)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/fs"
+	"github.com/pkg/errors"
+)
+
+const fmtShortHelp = `Rewrite Gopkg.toml in canonical style`
+const fmtLongHelp = `
+Fmt rewrites the project's Gopkg.toml in dep's canonical style, much like
+gofmt does for Go source. Constraints and overrides are sorted by name, keys
+are sorted and consistently indented, values are consistently quoted, and
+version constraints are normalized.
+
+Comments are preserved, and the meaning of the manifest is never changed.
+`
+
+func (cmd *fmtCommand) Name() string      { return "fmt" }
+func (cmd *fmtCommand) Args() string      { return "" }
+func (cmd *fmtCommand) ShortHelp() string { return fmtShortHelp }
+func (cmd *fmtCommand) LongHelp() string  { return fmtLongHelp }
+func (cmd *fmtCommand) Hidden() bool      { return false }
+
+func (cmd *fmtCommand) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&cmd.dryRun, "n", false, "dry run, print the formatted manifest instead of writing it")
+}
+
+type fmtCommand struct {
+	dryRun bool
+}
+
+func (cmd *fmtCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) > 0 {
+		return errors.Errorf("too many args (%d)", len(args))
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+
+	mp := filepath.Join(p.AbsRoot, dep.ManifestName)
+	orig, err := ioutil.ReadFile(mp)
+	if err != nil {
+		return errors.Wrapf(err, "could not read %s", mp)
+	}
+
+	formatted, err := dep.FormatManifest(bytes.NewReader(orig))
+	if err != nil {
+		return errors.Wrapf(err, "could not format %s", mp)
+	}
+
+	if cmd.dryRun {
+		ctx.Loggers.Out.Print(string(formatted))
+		return nil
+	}
+
+	if bytes.Equal(orig, formatted) {
+		return nil
+	}
+
+	return writeFileAtomic(mp, formatted)
+}
+
+// writeFileAtomic writes data to a temporary file next to path, then moves it
+// into place, so that path is never left partially written.
+func writeFileAtomic(path string, data []byte) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return errors.Wrap(err, "could not create temp file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "could not write %s", tmp.Name())
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), fi.Mode()); err != nil {
+		return err
+	}
+
+	return fs.RenameWithFallback(tmp.Name(), path)
+}
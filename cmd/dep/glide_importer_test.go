@@ -51,7 +51,7 @@ func TestGlideConfig_Import(t *testing.T) {
 	h.TempCopy(filepath.Join(testGlideProjectRoot, glideLockName), "glide/glide.lock")
 
 	projectRoot := h.Path(testGlideProjectRoot)
-	sm, err := gps.NewSourceManager(h.Path(cacheDir))
+	sm, err := gps.NewSourceManager(gps.SourceManagerConfig{Cachedir: h.Path(cacheDir)})
 	h.Must(err)
 	defer sm.Release()
 
@@ -102,7 +102,7 @@ func TestGlideConfig_Import_MissingLockFile(t *testing.T) {
 	h.TempCopy(filepath.Join("glidetest", glideYamlName), "glide/glide.yaml")
 
 	projectRoot := h.Path("glidetest")
-	sm, err := gps.NewSourceManager(h.Path(cacheDir))
+	sm, err := gps.NewSourceManager(gps.SourceManagerConfig{Cachedir: h.Path(cacheDir)})
 	h.Must(err)
 	defer sm.Release()
 
@@ -134,7 +134,7 @@ func TestGlideConfig_Convert_Project(t *testing.T) {
 	repo := "https://github.com/sdboyer/deptest.git"
 
 	ctx := newTestContext(h)
-	sm, err := ctx.SourceManager()
+	sm, err := ctx.SourceManager(nil)
 	h.Must(err)
 	defer sm.Release()
 
@@ -224,7 +224,7 @@ func TestGlideConfig_Convert_TestProject(t *testing.T) {
 	pkg := "github.com/sdboyer/deptest"
 
 	ctx := newTestContext(h)
-	sm, err := ctx.SourceManager()
+	sm, err := ctx.SourceManager(nil)
 	h.Must(err)
 	defer sm.Release()
 
@@ -0,0 +1,351 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/golang/dep"
+	fb "github.com/golang/dep/internal/feedback"
+	"github.com/golang/dep/internal/fs"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+const goModName = "go.mod"
+const goSumName = "go.sum"
+
+// pseudoVersionRe matches the pseudo-versions the go command gives untagged
+// revisions, such as v0.0.0-20170915032832-14c0d48ead0c, capturing the
+// abbreviated revision at their end.
+var pseudoVersionRe = regexp.MustCompile(`^v[0-9]+\.[0-9]+\.[0-9]+-(?:[0-9A-Za-z.-]*\.)?[0-9]{14}-([0-9a-f]{12,40})(?:\+incompatible)?$`)
+
+// majorSuffixRe matches the major version suffix of a module path, like the
+// /v2 of github.com/foo/bar/v2.
+var majorSuffixRe = regexp.MustCompile(`/v([2-9]|[1-9][0-9]+)$`)
+
+// gomodImporter imports go.mod and go.sum into the dep configuration format.
+type gomodImporter struct {
+	mod gomodFile
+	// sum holds the "path version" pairs that go.sum records, or is nil if
+	// there is no go.sum.
+	sum map[string]bool
+
+	logger  *log.Logger
+	verbose bool
+	sm      gps.SourceManager
+}
+
+func newGomodImporter(logger *log.Logger, verbose bool, sm gps.SourceManager) *gomodImporter {
+	return &gomodImporter{
+		logger:  logger,
+		verbose: verbose,
+		sm:      sm,
+	}
+}
+
+// gomodFile holds the parts of a go.mod that dep has a use for.
+type gomodFile struct {
+	Module   string
+	Requires []gomodRequire
+	// Replaces maps the module paths that are replaced to their
+	// replacements.
+	Replaces map[string]gomodModule
+}
+
+type gomodRequire struct {
+	gomodModule
+	// Indirect is set for the requirements marked "// indirect", which no
+	// package of the module imports.
+	Indirect bool
+}
+
+type gomodModule struct {
+	Path    string
+	Version string
+}
+
+func (g *gomodImporter) Name() string {
+	return "go.mod"
+}
+
+func (g *gomodImporter) HasDepMetadata(dir string) bool {
+	// Only require go.mod, go.sum is optional
+	exists, _ := fs.IsRegular(filepath.Join(dir, goModName))
+	return exists
+}
+
+func (g *gomodImporter) Import(dir string, pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	err := g.load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return g.convert(pr)
+}
+
+// load the go.mod and go.sum files.
+func (g *gomodImporter) load(projectDir string) error {
+	g.logger.Println("Detected go.mod configuration files...")
+	m := filepath.Join(projectDir, goModName)
+	if g.verbose {
+		g.logger.Printf("  Loading %s", m)
+	}
+	f, err := os.Open(m)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read %s", m)
+	}
+	defer f.Close()
+	g.mod, err = parseGoMod(f)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to parse %s", m)
+	}
+
+	s := filepath.Join(projectDir, goSumName)
+	if exists, _ := fs.IsRegular(s); exists {
+		if g.verbose {
+			g.logger.Printf("  Loading %s", s)
+		}
+		sf, err := os.Open(s)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to read %s", s)
+		}
+		defer sf.Close()
+		g.sum, err = parseGoSum(sf)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to parse %s", s)
+		}
+	}
+
+	return nil
+}
+
+// parseGoMod parses the module, require and replace directives of a go.mod,
+// in either their single line or block forms. Other directives are skipped.
+func parseGoMod(r io.Reader) (gomodFile, error) {
+	mod := gomodFile{Replaces: make(map[string]gomodModule)}
+
+	var block string
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		var comment string
+		if i := strings.Index(line, "//"); i >= 0 {
+			line, comment = line[:i], strings.TrimSpace(line[i+2:])
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		verb := block
+		switch {
+		case block != "" && fields[0] == ")":
+			block = ""
+			continue
+		case block == "" && len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+			continue
+		case block == "":
+			verb, fields = fields[0], fields[1:]
+		}
+
+		for i, f := range fields {
+			if strings.HasPrefix(f, `"`) {
+				uf, err := strconv.Unquote(f)
+				if err != nil {
+					return mod, errors.Errorf("line %d: invalid quoted string %s", n, f)
+				}
+				fields[i] = uf
+			}
+		}
+
+		switch verb {
+		case "module":
+			if len(fields) != 1 {
+				return mod, errors.Errorf("line %d: usage: module path", n)
+			}
+			mod.Module = fields[0]
+		case "require":
+			if len(fields) != 2 {
+				return mod, errors.Errorf("line %d: usage: require module/path v1.2.3", n)
+			}
+			mod.Requires = append(mod.Requires, gomodRequire{
+				gomodModule: gomodModule{Path: fields[0], Version: fields[1]},
+				Indirect:    comment == "indirect",
+			})
+		case "replace":
+			// Either "old => new [version]" or "old version => new [version]".
+			arrow := -1
+			for i, f := range fields {
+				if f == "=>" {
+					arrow = i
+				}
+			}
+			if arrow < 1 || arrow > 2 || len(fields)-arrow < 2 || len(fields)-arrow > 3 {
+				return mod, errors.Errorf("line %d: usage: replace module/path [v1.2.3] => other/module v1.4.5", n)
+			}
+			rep := gomodModule{Path: fields[arrow+1]}
+			if len(fields)-arrow == 3 {
+				rep.Version = fields[arrow+2]
+			}
+			mod.Replaces[fields[0]] = rep
+		}
+	}
+	return mod, scanner.Err()
+}
+
+// parseGoSum returns the set of "path version" pairs that a go.sum records
+// hashes for. The hashes themselves are of module contents, not revisions,
+// so dep has no use for them.
+func parseGoSum(r io.Reader) (map[string]bool, error) {
+	sum := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, errors.Errorf("line %d: expected a module path, version and hash", n)
+		}
+		sum[fields[0]+" "+strings.TrimSuffix(fields[1], "/go.mod")] = true
+	}
+	return sum, scanner.Err()
+}
+
+// convert the go.mod and go.sum files into dep configuration files.
+func (g *gomodImporter) convert(pr gps.ProjectRoot) (*dep.Manifest, *dep.Lock, error) {
+	task := bytes.NewBufferString("Converting from go.mod")
+	if g.sum != nil {
+		task.WriteString(" and go.sum")
+	}
+	task.WriteString("...")
+	g.logger.Println(task)
+
+	if g.mod.Module != "" && g.mod.Module != string(pr) {
+		g.logger.Printf("  go.mod thinks the module is '%s' but dep thinks it is '%s', using dep's value.\n", g.mod.Module, pr)
+	}
+
+	manifest := &dep.Manifest{
+		Constraints: make(gps.ProjectConstraints),
+	}
+	lock := &dep.Lock{}
+
+	for _, req := range g.mod.Requires {
+		m, ok := g.replacement(req.gomodModule)
+		if !ok {
+			continue
+		}
+		pi, version := g.resolveModule(req.Path, m)
+
+		if g.sum != nil && !g.sum[m.Path+" "+m.Version] {
+			g.logger.Printf("  go.sum has no hash for %s %s; importing it anyway.\n", m.Path, m.Version)
+		}
+
+		if !req.Indirect {
+			pc, err := g.buildProjectConstraint(pi, m.Version, version)
+			if err != nil {
+				return nil, nil, err
+			}
+			if pc.Constraint != nil {
+				manifest.Constraints[pc.Ident.ProjectRoot] = gps.ProjectProperties{Source: pc.Ident.Source, Constraint: pc.Constraint}
+			}
+		}
+
+		if version == nil {
+			g.logger.Printf("  Unable to find the revision of %s %s, so it is left out of the lock.\n", req.Path, req.Version)
+			continue
+		}
+		feedback(version, pi.ProjectRoot, fb.DepTypeImported, g.logger)
+		lock.P = append(lock.P, gps.NewLockedProject(pi, version, nil))
+	}
+
+	return manifest, lock, nil
+}
+
+// replacement returns the module that go.mod replaces m with, or m itself if
+// it isn't replaced. ok is false if m is replaced by a directory, which dep
+// can't import.
+func (g *gomodImporter) replacement(m gomodModule) (gomodModule, bool) {
+	rep, has := g.mod.Replaces[m.Path]
+	if !has {
+		return m, true
+	}
+	if rep.Version == "" {
+		g.logger.Printf("  %s is replaced by the directory %s, which dep can't import, so it is skipped.\n", m.Path, rep.Path)
+		return m, false
+	}
+	return rep, true
+}
+
+// resolveModule returns the project that the module path is in, with m, the
+// module that provides it, as its source if that's another, and the version
+// of the project that m's version corresponds to, or nil if it can't be
+// found.
+func (g *gomodImporter) resolveModule(path string, m gomodModule) (pi gps.ProjectIdentifier, version gps.Version) {
+	pi.ProjectRoot = gps.ProjectRoot(moduleProjectRoot(path))
+	if m.Path != path {
+		pi.Source = moduleProjectRoot(m.Path)
+	}
+
+	versions, err := g.sm.ListVersions(pi)
+	if err != nil {
+		g.logger.Printf("  %s\n", errors.Wrapf(err, "Unable to list versions for %s(%s)", pi.ProjectRoot, pi.Source))
+		return pi, nil
+	}
+
+	if match := pseudoVersionRe.FindStringSubmatch(m.Version); match != nil {
+		// Only the start of the revision is known, so it can only be
+		// resolved if a tag or branch points at it.
+		for _, v := range versions {
+			if strings.HasPrefix(string(v.Underlying()), match[1]) {
+				return pi, v.Underlying()
+			}
+		}
+		return pi, nil
+	}
+
+	tag := strings.TrimSuffix(m.Version, "+incompatible")
+	for _, v := range versions {
+		if v.Type() != gps.IsBranch && v.String() == tag {
+			return pi, v
+		}
+	}
+	return pi, nil
+}
+
+// buildProjectConstraint returns the constraint for a direct requirement on
+// the version modVersion of pi, which resolved to version. Requirements on
+// pseudo-versions are only constrained if their revision could be found.
+func (g *gomodImporter) buildProjectConstraint(pi gps.ProjectIdentifier, modVersion string, version gps.Version) (pc gps.ProjectConstraint, err error) {
+	pc.Ident = pi
+	if pseudoVersionRe.MatchString(modVersion) {
+		if version != nil {
+			pc.Constraint = version
+		}
+		return
+	}
+
+	pc.Constraint, err = deduceConstraint(strings.TrimSuffix(modVersion, "+incompatible"), pi, g.sm)
+	return
+}
+
+// moduleProjectRoot returns the path of the repository that holds the module
+// path, which is the same but for any major version suffix.
+func moduleProjectRoot(path string) string {
+	if strings.HasPrefix(path, "gopkg.in/") {
+		return path
+	}
+	return majorSuffixRe.ReplaceAllString(path, "")
+}
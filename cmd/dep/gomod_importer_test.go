@@ -0,0 +1,113 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestGomodConfig_Import(t *testing.T) {
+	t.Parallel()
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir(testGlideProjectRoot)
+	h.TempCopy(filepath.Join(testGlideProjectRoot, goModName), "gomod/go.mod")
+	h.TempCopy(filepath.Join(testGlideProjectRoot, goSumName), "gomod/go.sum")
+
+	sm := &fakeSourceManager{versions: []gps.PairedVersion{
+		gps.NewVersion("v0.8.0").Is("645ef00459ed84a119197bfb8d8205042c6df63d"),
+		gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+		gps.NewVersion("v2.0.0").Is("5c607206be5decd28e6263ffffdcee067266015e"),
+		gps.NewBranch("master").Is("a0196baa11ea047dd65037287451d36b861b00ea"),
+	}}
+
+	verboseOutput := &bytes.Buffer{}
+	g := newGomodImporter(log.New(verboseOutput, "", 0), true, sm)
+	if !g.HasDepMetadata(h.Path(testGlideProjectRoot)) {
+		t.Fatal("Expected the importer to detect go.mod")
+	}
+
+	m, l, err := g.Import(h.Path(testGlideProjectRoot), testGlideProjectRoot)
+	h.Must(err)
+
+	wantConstraints := map[gps.ProjectRoot]struct{ source, constraint string }{
+		"github.com/sdboyer/deptest":     {"github.com/carolynvs/deptest", "^1.0.0"},
+		"github.com/sdboyer/deptestdos":  {"", "^2.0.0"},
+		"github.com/sdboyer/deptesttres": {"", "a0196baa11ea047dd65037287451d36b861b00ea"},
+	}
+	if len(m.Constraints) != len(wantConstraints) {
+		t.Fatalf("Expected %d constraints, got %v", len(wantConstraints), m.Constraints)
+	}
+	for pr, want := range wantConstraints {
+		pp, has := m.Constraints[pr]
+		if !has {
+			t.Errorf("Expected a constraint on %s", pr)
+			continue
+		}
+		if pp.Source != want.source {
+			t.Errorf("Expected the source of %s to be %q, got %q", pr, want.source, pp.Source)
+		}
+		if pp.Constraint.String() != want.constraint {
+			t.Errorf("Expected the constraint on %s to be %s, got %s", pr, want.constraint, pp.Constraint)
+		}
+	}
+
+	wantLocked := map[gps.ProjectRoot]struct{ version, revision string }{
+		"github.com/sdboyer/deptest":     {"v1.0.0", "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"},
+		"github.com/sdboyer/deptestdos":  {"v2.0.0", "5c607206be5decd28e6263ffffdcee067266015e"},
+		"github.com/sdboyer/deptesttres": {"", "a0196baa11ea047dd65037287451d36b861b00ea"},
+		"github.com/pkg/errors":          {"v0.8.0", "645ef00459ed84a119197bfb8d8205042c6df63d"},
+	}
+	if len(l.P) != len(wantLocked) {
+		t.Fatalf("Expected %d locked projects, got %v", len(wantLocked), l.P)
+	}
+	for _, lp := range l.P {
+		want, has := wantLocked[lp.Ident().ProjectRoot]
+		if !has {
+			t.Errorf("Unexpected locked project %s", lp.Ident().ProjectRoot)
+			continue
+		}
+		rev, _, version := gps.VersionComponentStrings(lp.Version())
+		if version != want.version || rev != want.revision {
+			t.Errorf("Expected %s to be locked to %s %s, got %s %s", lp.Ident().ProjectRoot, want.version, want.revision, version, rev)
+		}
+	}
+
+	out := verboseOutput.String()
+	for _, want := range []string{
+		"go.sum has no hash for github.com/sdboyer/deptestdos/v2 v2.0.0",
+		"Unable to find the revision of github.com/sdboyer/deptestquatro",
+		"Unable to find the revision of golang.org/x/sys",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected the output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestGomodConfig_ParseBadInput(t *testing.T) {
+	t.Parallel()
+
+	for _, in := range []string{
+		"module\n",
+		"require github.com/sdboyer/deptest\n",
+		"require (\n\tgithub.com/sdboyer/deptest v1.0.0 v2.0.0\n)\n",
+		"replace github.com/sdboyer/deptest github.com/carolynvs/deptest v1.0.0\n",
+		"module \"github.com/golang/notexist\n",
+	} {
+		if _, err := parseGoMod(strings.NewReader(in)); err == nil {
+			t.Errorf("Expected an error parsing %q", in)
+		}
+	}
+}
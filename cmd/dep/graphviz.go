@@ -45,16 +45,15 @@ func (g graphviz) output() bytes.Buffer {
 	// Create relations
 	for _, dp := range g.ps {
 		for _, bsc := range dp.children {
-			for pr, hsh := range g.h {
-				if isPathPrefix(bsc, pr) {
-					r := fmt.Sprintf("\n\t%d -> %d", g.h[dp.project], hsh)
-
-					if _, ex := rels[r]; !ex {
-						g.b.WriteString(r + ";")
-						rels[r] = true
-					}
+			pr := g.projectOf(bsc)
+			if pr == "" || pr == dp.project {
+				continue
+			}
+			r := fmt.Sprintf("\n\t%d -> %d", g.h[dp.project], g.h[pr])
 
-				}
+			if _, ex := rels[r]; !ex {
+				g.b.WriteString(r + ";")
+				rels[r] = true
 			}
 		}
 	}
@@ -74,6 +73,19 @@ func (g *graphviz) createNode(project, version string, children []string) {
 	g.ps = append(g.ps, pr)
 }
 
+// projectOf returns the project of the graph that the package pkg belongs to,
+// or "" if there is none. When project roots are nested, the deepest one
+// containing pkg wins.
+func (g *graphviz) projectOf(pkg string) string {
+	var project string
+	for pr := range g.h {
+		if isPathPrefix(pkg, pr) && len(pr) > len(project) {
+			project = pr
+		}
+	}
+	return project
+}
+
 func (dp gvnode) hash() uint32 {
 	h := fnv.New32a()
 	h.Write([]byte(dp.project))
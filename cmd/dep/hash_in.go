@@ -9,7 +9,6 @@ import (
 
 	"github.com/golang/dep"
 	"github.com/golang/dep/internal/gps"
-	"github.com/golang/dep/internal/gps/pkgtree"
 	"github.com/pkg/errors"
 )
 
@@ -29,7 +28,7 @@ func (hashinCommand) Run(ctx *dep.Ctx, args []string) error {
 		return err
 	}
 
-	sm, err := ctx.SourceManager()
+	sm, err := ctx.SourceManager(p)
 	if err != nil {
 		return err
 	}
@@ -42,7 +41,7 @@ func (hashinCommand) Run(ctx *dep.Ctx, args []string) error {
 		return errors.Wrap(err, "determineProjectRoot")
 	}
 
-	params.RootPackageTree, err = pkgtree.ListPackages(p.AbsRoot, cpr)
+	params.RootPackageTree, err = ctx.ListPackages(p.AbsRoot, cpr)
 	if err != nil {
 		return errors.Wrap(err, "gps.ListPackages")
 	}
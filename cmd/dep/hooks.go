@@ -0,0 +1,95 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"runtime"
+	"syscall"
+
+	"github.com/golang/dep"
+)
+
+// hookError is returned when a hook command fails. dep exits with the
+// command's exit code.
+type hookError struct {
+	hook    string
+	command string
+	code    int
+}
+
+func (e *hookError) Error() string {
+	return fmt.Sprintf("%s hook %q failed with exit status %d", e.hook, e.command, e.code)
+}
+
+// runHooks runs the commands of the named hook from dir, in order, streaming
+// their output to the loggers of ctx. Each command is run by the shell, so it
+// may quote its arguments, or use pipes and redirections. It stops at the
+// first command that fails.
+func runHooks(ctx *dep.Ctx, dir, hook string, commands []string) error {
+	for _, command := range commands {
+		if ctx.Loggers.Verbose {
+			ctx.Loggers.Err.Printf("Running %s hook: %s\n", hook, command)
+		}
+
+		stdout, stderr := &lineWriter{l: ctx.Loggers.Out}, &lineWriter{l: ctx.Loggers.Err}
+		c := shellCommand(command)
+		c.Dir = dir
+		c.Stdout = stdout
+		c.Stderr = stderr
+		err := c.Run()
+		stdout.Flush()
+		stderr.Flush()
+
+		if ee, ok := err.(*exec.ExitError); ok {
+			code := 1
+			if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.ExitStatus() > 0 {
+				code = ws.ExitStatus()
+			}
+			return &hookError{hook: hook, command: command, code: code}
+		}
+		if err != nil {
+			return fmt.Errorf("unable to run %s hook %q: %s", hook, command, err)
+		}
+	}
+	return nil
+}
+
+// shellCommand returns a command that runs command with the shell: sh, or
+// cmd.exe on Windows.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// lineWriter writes what is written to it to a logger, a line at a time.
+type lineWriter struct {
+	l   *log.Logger
+	buf bytes.Buffer
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.l.Print(string(w.buf.Next(i + 1)))
+	}
+}
+
+// Flush writes out the last line, if it wasn't terminated.
+func (w *lineWriter) Flush() {
+	if w.buf.Len() > 0 {
+		w.l.Println(w.buf.String())
+		w.buf.Reset()
+	}
+}
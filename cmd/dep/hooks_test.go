@@ -0,0 +1,126 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestEnsureHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks are shell scripts")
+	}
+
+	for _, tc := range []struct {
+		name    string
+		args    []string
+		main    string
+		command string
+		hook    string
+		ran     bool
+		stdout  string
+		err     string
+		exit    string
+	}{
+		{
+			name:   "success",
+			args:   []string{"ensure"},
+			hook:   "echo hooked\ntouch ran\n",
+			ran:    true,
+			stdout: "hooked\n",
+		},
+		{
+			name: "failed ensure",
+			args: []string{"ensure"},
+			main: "package main\n\nimport _ \"github.com/foo/forbidden\"\n",
+			hook: "touch ran\n",
+			err:  "forbidden",
+		},
+		{
+			name: "skipped",
+			args: []string{"ensure", "-skip-hooks"},
+			hook: "touch ran\n",
+		},
+		{
+			name: "dry run",
+			args: []string{"ensure", "-n"},
+			hook: "touch ran\n",
+		},
+		{
+			name:    "shell command",
+			args:    []string{"ensure"},
+			command: `sh hook.sh 'two words' | tr a-z A-Z`,
+			hook:    "echo \"$1\"\ntouch ran\n",
+			ran:     true,
+			stdout:  "TWO WORDS\n",
+		},
+		{
+			name: "cache released",
+			args: []string{"ensure"},
+			hook: "test ! -e ../../pkg/dep/sm.lock || exit 4\ntouch ran\n",
+			ran:  true,
+		},
+		{
+			name: "failed hook",
+			args: []string{"ensure"},
+			hook: "echo broken >&2\nexit 3\n",
+			err:  "broken\npost-ensure hook \"sh hook.sh\" failed with exit status 3",
+			exit: "exit status 3",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := test.NewHelper(t)
+			defer h.Cleanup()
+
+			proj := filepath.Join("src", "proj")
+			main := tc.main
+			if main == "" {
+				main = "package main\n"
+			}
+			h.TempFile(filepath.Join(proj, "main.go"), main)
+			h.TempFile(filepath.Join(proj, "hook.sh"), tc.hook)
+			command := tc.command
+			if command == "" {
+				command = "sh hook.sh"
+			}
+			h.TempFile(filepath.Join(proj, dep.ManifestName), fmt.Sprintf(`forbidden-packages = ["github.com/foo/forbidden"]
+
+[hooks]
+  post-ensure = [%q]
+`, command))
+
+			var stdout, stderr bytes.Buffer
+			env := []string{"GOPATH=" + h.Path("."), "HOME=" + h.Path(".")}
+			err := runMain("dep", tc.args, &stdout, &stderr, h.Path(proj), env)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s\n%s", err, stderr.String())
+				}
+			} else if err == nil || !strings.Contains(stderr.String(), tc.err) {
+				t.Fatalf("expected an error containing %q, got %v:\n%s", tc.err, err, stderr.String())
+			}
+
+			if tc.ran {
+				h.MustExist(filepath.Join(h.Path(proj), "ran"))
+			} else {
+				h.MustNotExist(filepath.Join(h.Path(proj), "ran"))
+			}
+			if tc.stdout != "" && stdout.String() != tc.stdout {
+				t.Errorf("expected the hook's output %q, got %q", tc.stdout, stdout.String())
+			}
+			if tc.exit != "" && err.Error() != tc.exit {
+				t.Errorf("expected dep to exit with the hook's status, got %s", err)
+			}
+		})
+	}
+}
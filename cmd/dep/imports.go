@@ -0,0 +1,206 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/paths"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+const importsShortHelp = `List the external imports of the project and its dependencies`
+const importsLongHelp = `
+Imports walks the import graph of the project, from its own packages through
+the packages of its dependencies, and prints each distinct import of a package
+outside the project and the standard library, with the project in Gopkg.lock
+that provides it and the version that project is locked to.
+
+Imports that no locked project provides are listed without a project; dep
+ensure would add them to the lock.
+`
+
+func (cmd *importsCommand) Name() string      { return "imports" }
+func (cmd *importsCommand) Args() string      { return "[-json]" }
+func (cmd *importsCommand) ShortHelp() string { return importsShortHelp }
+func (cmd *importsCommand) LongHelp() string  { return importsLongHelp }
+func (cmd *importsCommand) Hidden() bool      { return false }
+
+func (cmd *importsCommand) Register(fs *flag.FlagSet) {
+	cmd.sourceFlags.register(fs)
+	fs.BoolVar(&cmd.json, "json", false, "output in JSON format")
+}
+
+type importsCommand struct {
+	sourceFlags
+
+	json bool
+}
+
+// resolvedImport is an import path, and the locked project that provides it,
+// if any.
+type resolvedImport struct {
+	Import   string `json:"import"`
+	Project  string `json:"project,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Revision string `json:"revision,omitempty"`
+}
+
+func (cmd *importsCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) > 0 {
+		return errors.Errorf("too many args (%d)", len(args))
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+	if p.Lock == nil {
+		return errors.Errorf("no %s found in project root %s", dep.LockName, p.AbsRoot)
+	}
+
+	sm, err := ctx.SourceManager(p)
+	if err != nil {
+		return err
+	}
+	sm.UseDefaultSignalHandling()
+	defer sm.Release()
+
+	ptree, err := pkgtree.ListPackages(p.AbsRoot, string(p.ImportRoot))
+	if err != nil {
+		return errors.Wrap(err, "analysis of local packages failed")
+	}
+
+	imports, err := resolveImports(ptree, p.Lock, sm)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if cmd.json {
+		b, err := json.MarshalIndent(imports, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "unable to encode the imports")
+		}
+		buf.Write(b)
+	} else {
+		w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "IMPORT\tPROJECT\tVERSION")
+		for _, ri := range imports {
+			project, version := ri.Project, ri.Version
+			if project == "" {
+				project = "(not in lock)"
+			}
+			if version == "" && len(ri.Revision) > 7 {
+				version = ri.Revision[:7]
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", ri.Import, project, version)
+		}
+		w.Flush()
+	}
+	ctx.Loggers.Out.Print(strings.TrimSuffix(buf.String(), "\n"))
+	return nil
+}
+
+// resolveImports walks the import graph from the packages of ptree, the tree
+// of the root project, through the packages of the projects in l, and returns
+// the distinct imports outside the root project and the standard library, in
+// order, each with the locked project that provides it. The imports of the
+// root project's tests are included, but not those of its dependencies'.
+func resolveImports(ptree pkgtree.PackageTree, l *dep.Lock, sm gps.SourceManager) ([]resolvedImport, error) {
+	projects := l.Projects()
+
+	// owner returns the locked project that provides the package ip, if any.
+	// The longest matching root wins, in case roots nest.
+	owner := func(ip string) (gps.LockedProject, bool) {
+		var found gps.LockedProject
+		var ok bool
+		for _, lp := range projects {
+			pr := string(lp.Ident().ProjectRoot)
+			if (ip == pr || strings.HasPrefix(ip, pr+"/")) && (!ok || len(pr) > len(found.Ident().ProjectRoot)) {
+				found, ok = lp, true
+			}
+		}
+		return found, ok
+	}
+
+	seen := make(map[string]bool)
+	var queue []string
+	enqueue := func(imports []string) {
+		for _, ip := range imports {
+			if seen[ip] || paths.IsStandardImportPath(ip) {
+				continue
+			}
+			if ip == ptree.ImportRoot || strings.HasPrefix(ip, ptree.ImportRoot+"/") {
+				continue
+			}
+			seen[ip] = true
+			queue = append(queue, ip)
+		}
+	}
+
+	for _, poe := range ptree.Packages {
+		if poe.Err == nil {
+			enqueue(poe.P.Imports)
+			enqueue(poe.P.TestImports)
+		}
+	}
+
+	trees := make(map[gps.ProjectRoot]pkgtree.PackageTree)
+	var imports []resolvedImport
+	for len(queue) > 0 {
+		ip := queue[0]
+		queue = queue[1:]
+
+		lp, ok := owner(ip)
+		if !ok {
+			imports = append(imports, resolvedImport{Import: ip})
+			continue
+		}
+
+		id := lp.Ident()
+		rev, branch, version := gps.VersionComponentStrings(lp.Version())
+		if version == "" {
+			version = branch
+		}
+		imports = append(imports, resolvedImport{
+			Import:   ip,
+			Project:  string(id.ProjectRoot),
+			Version:  version,
+			Revision: rev,
+		})
+
+		tree, has := trees[id.ProjectRoot]
+		if !has {
+			var err error
+			tree, err = sm.ListPackages(id, lp.Version())
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to list the packages of %s", id.ProjectRoot)
+			}
+			trees[id.ProjectRoot] = tree
+		}
+		if poe, has := tree.Packages[ip]; has && poe.Err == nil {
+			enqueue(poe.P.Imports)
+		}
+	}
+
+	sort.Sort(byImport(imports))
+	return imports, nil
+}
+
+type byImport []resolvedImport
+
+func (s byImport) Len() int           { return len(s) }
+func (s byImport) Less(i, j int) bool { return s[i].Import < s[j].Import }
+func (s byImport) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
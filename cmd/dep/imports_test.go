@@ -0,0 +1,82 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
+)
+
+func TestResolveImports(t *testing.T) {
+	pkg := func(ip string, imports ...string) pkgtree.PackageOrErr {
+		return pkgtree.PackageOrErr{P: pkgtree.Package{ImportPath: ip, Imports: imports}}
+	}
+
+	// The root imports foo, whose subpackage imports baz; bar is only
+	// imported by the root's tests, and quux by no one.
+	ptree := pkgtree.PackageTree{
+		ImportRoot: "proj",
+		Packages: map[string]pkgtree.PackageOrErr{
+			"proj": {P: pkgtree.Package{
+				ImportPath:  "proj",
+				Imports:     []string{"fmt", "proj/util", "github.com/foo/foo", "example.com/missing"},
+				TestImports: []string{"github.com/bar/bar/assert"},
+			}},
+			"proj/util": pkg("proj/util", "github.com/foo/foo/sub"),
+		},
+	}
+	sm := &fakeSourceManager{
+		trees: map[gps.ProjectRoot]pkgtree.PackageTree{
+			"github.com/foo/foo": {
+				ImportRoot: "github.com/foo/foo",
+				Packages: map[string]pkgtree.PackageOrErr{
+					"github.com/foo/foo":     pkg("github.com/foo/foo", "strings"),
+					"github.com/foo/foo/sub": pkg("github.com/foo/foo/sub", "github.com/baz/baz"),
+				},
+			},
+			"github.com/bar/bar": {
+				ImportRoot: "github.com/bar/bar",
+				Packages: map[string]pkgtree.PackageOrErr{
+					"github.com/bar/bar/assert": pkg("github.com/bar/bar/assert"),
+				},
+			},
+			"github.com/baz/baz": {
+				ImportRoot: "github.com/baz/baz",
+				Packages: map[string]pkgtree.PackageOrErr{
+					"github.com/baz/baz": pkg("github.com/baz/baz"),
+				},
+			},
+		},
+	}
+
+	const rev = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+	l := &dep.Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/bar/bar"}, gps.NewBranch("master").Is(rev), []string{"assert"}),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/baz/baz"}, gps.Revision(rev), []string{"."}),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/foo/foo"}, gps.NewVersion("v1.2.0").Is(rev), []string{".", "sub"}),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/quux/quux"}, gps.NewVersion("v0.1.0").Is(rev), []string{"."}),
+		},
+	}
+
+	got, err := resolveImports(ptree, l, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []resolvedImport{
+		{Import: "example.com/missing"},
+		{Import: "github.com/bar/bar/assert", Project: "github.com/bar/bar", Version: "master", Revision: rev},
+		{Import: "github.com/baz/baz", Project: "github.com/baz/baz", Revision: rev},
+		{Import: "github.com/foo/foo", Project: "github.com/foo/foo", Version: "v1.2.0", Revision: rev},
+		{Import: "github.com/foo/foo/sub", Project: "github.com/foo/foo", Version: "v1.2.0", Revision: rev},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected imports:\n\t(GOT) %+v\n\t(WNT) %+v", got, want)
+	}
+}
@@ -6,6 +6,8 @@ package main
 
 import (
 	"flag"
+	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -27,7 +29,12 @@ specified, use the current directory.
 
 When configuration for another dependency management tool is detected, it is
 imported into the initial manifest and lock. Use the -skip-tools flag to
-disable this behavior. The following external tools are supported: glide.
+disable this behavior. The following external tools are supported: glide, and
+Go modules, through go.mod and go.sum. If the configuration of more than one is
+found, all of it is imported, and where two tools constrain the same project,
+the more specific constraint wins: a revision, then a version, a branch, and a
+range of versions. Ties, and locks that disagree, go to the tool listed first,
+and disagreements over revisions are reported.
 Any dependencies that are not constrained by external configuration use the
 GOPATH analysis below.
 
@@ -42,6 +49,13 @@ versions available from the upstream source per the following algorithm:
 A Gopkg.toml file will be written with inferred version constraints for all
 direct dependencies. Gopkg.lock will be written with precise versions, and
 vendor/ will be populated with the precise versions written to Gopkg.lock.
+
+If the project already has a hand-written, possibly partial, Gopkg.toml, the
+-reconcile flag merges it with what the analysis discovers instead of refusing
+to run: the constraints, overrides, ignored and required packages already in
+the manifest are kept as they are, and constraints are added for the
+dependencies it doesn't mention. Use -n to print the changes to Gopkg.toml and
+Gopkg.lock as a unified diff, without writing anything.
 `
 
 func (cmd *initCommand) Name() string      { return "init" }
@@ -51,13 +65,20 @@ func (cmd *initCommand) LongHelp() string  { return initLongHelp }
 func (cmd *initCommand) Hidden() bool      { return false }
 
 func (cmd *initCommand) Register(fs *flag.FlagSet) {
+	cmd.sourceFlags.register(fs)
 	fs.BoolVar(&cmd.noExamples, "no-examples", false, "don't include example in Gopkg.toml")
 	fs.BoolVar(&cmd.skipTools, "skip-tools", false, "skip importing configuration from other dependency managers")
+	fs.BoolVar(&cmd.reconcile, "reconcile", false, "merge an existing Gopkg.toml with the discovered constraints")
+	fs.BoolVar(&cmd.dryRun, "n", false, "print the changes to Gopkg.toml and Gopkg.lock as a diff, without writing them")
 }
 
 type initCommand struct {
+	sourceFlags
+
 	noExamples bool
 	skipTools  bool
+	reconcile  bool
+	dryRun     bool
 }
 
 func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
@@ -86,19 +107,30 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 	if err != nil {
 		return err
 	}
-	if mok {
-		return errors.Errorf("manifest already exists: %s", mf)
+	if mok && !cmd.reconcile {
+		return errors.Errorf("manifest already exists: %s; use -reconcile to merge it with the discovered constraints", mf)
 	}
-	// Manifest file does not exist.
 
 	lok, err := fs.IsRegular(lf)
 	if err != nil {
 		return err
 	}
-	if lok {
+	if lok && !mok {
 		return errors.Errorf("invalid state: manifest %q does not exist, but lock %q does", mf, lf)
 	}
 
+	// The existing project, if any, is loaded before the source manager is
+	// created so that any VCS types and clone depths it sets are respected.
+	var existing *dep.Project
+	if mok {
+		rctx := *ctx
+		rctx.WorkingDir = root
+		existing, err = rctx.LoadProject()
+		if err != nil {
+			return err
+		}
+	}
+
 	cpr, err := ctx.SplitAbsoluteProjectRoot(root)
 	if err != nil {
 		return errors.Wrap(err, "determineProjectRoot")
@@ -107,7 +139,7 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 	if err != nil {
 		return err
 	}
-	sm, err := ctx.SourceManager()
+	sm, err := ctx.SourceManager(existing)
 	if err != nil {
 		return errors.Wrap(err, "getSourceManager")
 	}
@@ -135,6 +167,10 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 		Lock:            l,
 		ProjectAnalyzer: rootAnalyzer,
 	}
+	if existing != nil {
+		params.Manifest = reconcileManifest(existing.Manifest, m)
+		params.Lock = reconcileLock(existing.Lock, l)
+	}
 
 	if ctx.Loggers.Verbose {
 		params.TraceLogger = ctx.Loggers.Err
@@ -155,6 +191,15 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 	rootAnalyzer.FinalizeRootManifestAndLock(m, l)
 	gs.FinalizeRootManifestAndLock(m, l)
 
+	// The existing manifest is only merged in after finalizing, so that none
+	// of what it says is dropped or replaced.
+	var oldLock *dep.Lock
+	if existing != nil {
+		m = reconcileManifest(existing.Manifest, m)
+		oldLock = existing.Lock
+	}
+	params.Manifest = m
+
 	// Run gps.Prepare with appropriate constraint solutions from solve run
 	// to generate the final lock memo.
 	s, err = gps.Prepare(params, sm)
@@ -164,6 +209,10 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 
 	l.SolveMeta.InputsDigest = s.HashInputs()
 
+	if cmd.dryRun {
+		return printInitDiff(ctx.Loggers.Out, root, m, l)
+	}
+
 	// Pass timestamp (yyyyMMddHHmmss format) as suffix to backup name.
 	vendorbak, err := dep.BackupVendor(vpath, time.Now().Format("20060102150405"))
 	if err != nil {
@@ -173,18 +222,87 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 		ctx.Loggers.Err.Printf("Old vendor backed up to %v", vendorbak)
 	}
 
-	sw, err := dep.NewSafeWriter(m, nil, l, dep.VendorAlways)
+	sw, err := dep.NewSafeWriter(m, oldLock, l, dep.VendorAlways, m.VendorPruning())
 	if err != nil {
 		return err
 	}
 
-	if err := sw.Write(root, sm, !cmd.noExamples); err != nil {
+	// Examples are only added to a new manifest.
+	if err := sw.Write(root, sm, !cmd.noExamples && existing == nil); err != nil {
 		return errors.Wrap(err, "safe write of manifest and lock")
 	}
 
 	return nil
 }
 
+// reconcileManifest returns a copy of the existing manifest, to which the
+// constraints in discovered are added for the projects that existing neither
+// constrains nor overrides.
+func reconcileManifest(existing, discovered *dep.Manifest) *dep.Manifest {
+	m := copyManifest(existing)
+	for pr, pp := range discovered.Constraints {
+		if _, has := m.Constraints[pr]; has {
+			continue
+		}
+		if _, has := m.Ovr[pr]; has {
+			continue
+		}
+		m.Constraints[pr] = pp
+	}
+	return m
+}
+
+// reconcileLock returns a lock holding the projects locked in existing, which
+// may be nil, along with those in discovered that existing doesn't lock.
+func reconcileLock(existing, discovered *dep.Lock) *dep.Lock {
+	if existing == nil {
+		return discovered
+	}
+
+	l := &dep.Lock{SolveMeta: discovered.SolveMeta}
+	locked := make(map[gps.ProjectRoot]bool)
+	for _, lp := range existing.Projects() {
+		l.P = append(l.P, lp)
+		locked[lp.Ident().ProjectRoot] = true
+	}
+	for _, lp := range discovered.Projects() {
+		if !locked[lp.Ident().ProjectRoot] {
+			l.P = append(l.P, lp)
+		}
+	}
+	return l
+}
+
+// printInitDiff prints a unified diff from the manifest and lock of the
+// project at root, as they are on disk, to m and l.
+func printInitDiff(out *log.Logger, root string, m *dep.Manifest, l *dep.Lock) error {
+	mb, err := m.MarshalTOML()
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal the manifest")
+	}
+	lb, err := l.MarshalTOML()
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal the lock")
+	}
+
+	for _, f := range []struct {
+		name string
+		next []byte
+	}{
+		{dep.ManifestName, mb},
+		{dep.LockName, lb},
+	} {
+		cur, err := ioutil.ReadFile(filepath.Join(root, f.name))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "unable to read %s", f.name)
+		}
+		if diff := unifiedDiff("a/"+f.name, "b/"+f.name, cur, f.next); diff != "" {
+			out.Print(diff)
+		}
+	}
+	return nil
+}
+
 func getDirectDependencies(root, cpr string) (pkgtree.PackageTree, map[string]bool, error) {
 	pkgT, err := pkgtree.ListPackages(root, cpr)
 	if err != nil {
@@ -0,0 +1,84 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestInitReconcileDiff(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	semver := func(s string) gps.Constraint {
+		c, err := gps.NewSemverConstraintIC(s)
+		h.Must(err)
+		return c
+	}
+
+	// The hand-written manifest only knows about one of the dependencies.
+	existing := &dep.Manifest{
+		Constraints: gps.ProjectConstraints{
+			"github.com/sdboyer/deptest": {Constraint: semver("^1.0.0")},
+		},
+		Ovr:     make(gps.ProjectConstraints),
+		Ignored: []string{"github.com/sdboyer/ignored"},
+	}
+	partial, err := existing.MarshalTOML()
+	h.Must(err)
+	h.TempFile(filepath.Join("proj", dep.ManifestName), string(partial))
+
+	discovered := &dep.Manifest{
+		Constraints: gps.ProjectConstraints{
+			"github.com/sdboyer/deptest":    {Constraint: semver("^0.8.0")},
+			"github.com/sdboyer/deptestdos": {Constraint: gps.NewBranch("master")},
+		},
+		Ovr: make(gps.ProjectConstraints),
+	}
+	m := reconcileManifest(existing, discovered)
+	if got := m.Constraints["github.com/sdboyer/deptest"].Constraint.String(); got != "^1.0.0" {
+		t.Errorf("expected the existing constraint to be kept, got %s", got)
+	}
+	if len(existing.Constraints) != 1 {
+		t.Errorf("expected the existing manifest to be left untouched, got %v", existing.Constraints)
+	}
+
+	l := &dep.Lock{P: []gps.LockedProject{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}),
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"}, gps.NewBranch("master").Is("a0196baa11ea047dd65037287451d36b861b00ea"), []string{"."}),
+	}}
+
+	var buf bytes.Buffer
+	h.Must(printInitDiff(log.New(&buf, "", 0), h.Path("proj"), m, l))
+	diff := buf.String()
+
+	for _, want := range []string{
+		"--- a/Gopkg.toml\n+++ b/Gopkg.toml\n",
+		// The existing constraint is unchanged context.
+		"\n   name = \"github.com/sdboyer/deptest\"\n   version = \"1.0.0\"\n",
+		// The discovered constraint is added.
+		"\n+  branch = \"master\"\n+  name = \"github.com/sdboyer/deptestdos\"\n",
+		// There's no lock yet, so all of it is added.
+		"--- a/Gopkg.lock\n+++ b/Gopkg.lock\n",
+		"\n+  name = \"github.com/sdboyer/deptestdos\"\n",
+	} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("expected the diff to contain %q, got:\n%s", want, diff)
+		}
+	}
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "--- ") {
+			t.Errorf("expected nothing to be removed, got %q in:\n%s", line, diff)
+		}
+	}
+}
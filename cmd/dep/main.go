@@ -14,6 +14,7 @@ import (
 	"os"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/golang/dep"
 )
@@ -62,6 +63,15 @@ func (c *Config) Run() (exitCode int) {
 		&ensureCommand{},
 		&hashinCommand{},
 		&pruneCommand{},
+		&fmtCommand{},
+		&cacheCommand{},
+		&bisectCommand{},
+		&restoreCommand{},
+		&doctorCommand{},
+		&importsCommand{},
+		&checkCommand{},
+		&conflictsCommand{},
+		&removeCommand{},
 	}
 
 	examples := [][2]string{
@@ -121,8 +131,10 @@ func (c *Config) Run() (exitCode int) {
 			fs := flag.NewFlagSet(cmdName, flag.ContinueOnError)
 			fs.SetOutput(c.Stderr)
 			verbose := fs.Bool("v", false, "enable verbose logging")
+			gopath := fs.String("gopath", "", "use this GOPATH, rather than the one in the environment")
 
-			// Register the subcommand flags in there, too.
+			// Register the subcommand flags in there, too. Those that use
+			// sources register the sourceFlags themselves.
 			cmd.Register(fs)
 
 			// Override the usage text to something nicer.
@@ -148,18 +160,41 @@ func (c *Config) Run() (exitCode int) {
 				Verbose: *verbose,
 			}
 
-			// Set up the dep context.
-			ctx, err := dep.NewContext(c.WorkingDir, c.Env, loggers)
+			// Set up the dep context. An explicit GOPATH or concurrency goes
+			// last, so that it takes precedence over any in the environment.
+			env := c.Env[:len(c.Env):len(c.Env)]
+			if *gopath != "" {
+				env = append(env, "GOPATH="+*gopath)
+			}
+			sc, usesSources := cmd.(sourceCommand)
+			if usesSources {
+				env = sc.sources().environ(env)
+			}
+			if nc, ok := cmd.(noContextCommand); ok {
+				if err := nc.runWithoutContext(c.WorkingDir, env, loggers, fs.Args()); err != nil {
+					errLogger.Printf("%v\n", err)
+					exitCode = 1
+				}
+				return
+			}
+
+			ctx, err := dep.NewContext(c.WorkingDir, env, loggers)
 			if err != nil {
 				loggers.Err.Println(err)
 				exitCode = 1
 				return
 			}
+			if usesSources {
+				sc.sources().apply(fs, ctx)
+			}
 
 			// Run the command with the post-flag-processing args.
 			if err := cmd.Run(ctx, fs.Args()); err != nil {
 				errLogger.Printf("%v\n", err)
 				exitCode = 1
+				if he, ok := err.(*hookError); ok {
+					exitCode = he.code
+				}
 				return
 			}
 
@@ -174,6 +209,99 @@ func (c *Config) Run() (exitCode int) {
 	return
 }
 
+// A sourceCommand fetches dependencies from their sources, and takes the flags
+// that say how. It embeds sourceFlags, and registers them from Register.
+type sourceCommand interface {
+	command
+	sources() *sourceFlags
+}
+
+// A noContextCommand runs without a dep context, such as dep doctor, which
+// must work where one can't be set up.
+type noContextCommand interface {
+	command
+	runWithoutContext(wd string, env []string, loggers *dep.Loggers, args []string) error
+}
+
+// sourceFlags holds the flags that configure how dependencies are fetched
+// from their sources, for the commands that build a source manager.
+type sourceFlags struct {
+	cacert         string
+	cacertOnly     bool
+	lfs            bool
+	cloneDepth     int
+	cloneTimeout   time.Duration
+	metaTimeout    time.Duration
+	cacheTTL       time.Duration
+	noCache        bool
+	credHelper     string
+	vcsConcurrency string
+
+	// The settings that may also be given by the project's dep.ConfigName
+	// file or the environment.
+	cachedir string
+	jobs     int
+	offline  bool
+}
+
+func (s *sourceFlags) sources() *sourceFlags { return s }
+
+func (s *sourceFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.cacert, "cacert", "", "trust the certificate authorities in this PEM bundle for HTTPS, in addition to the system's; not supported for bzr sources over HTTPS (or set DEPCACERT)")
+	fs.BoolVar(&s.cacertOnly, "cacert-only", false, "trust only the certificate authorities given with -cacert")
+	fs.BoolVar(&s.lfs, "lfs", false, "fetch the content of files tracked with Git LFS in git dependencies, if git-lfs is installed")
+	fs.IntVar(&s.cloneDepth, "clone-depth", 0, "clone only this many commits of history of git dependencies, unless their clone-depth is set in the manifest (0 for all)")
+	fs.DurationVar(&s.cloneTimeout, "clone-timeout", 0, "give up on each clone or fetch of a dependency after this long, such as 30m (0 for no limit)")
+	fs.DurationVar(&s.metaTimeout, "meta-timeout", 0, "give up on each HTTP request for the metadata of an import path after this long, such as 10s (0 for no limit)")
+	fs.DurationVar(&s.cacheTTL, "cache-ttl", 0, "reuse the versions of dependencies listed upstream by an earlier command for this long, such as 10m; off by default (ensure -update and -add always list them upstream)")
+	fs.BoolVar(&s.noCache, "no-cache", false, "always list the versions of dependencies upstream, ignoring those cached by earlier commands")
+	fs.StringVar(&s.credHelper, "credential-helper", "", "run this command, as git runs a credential helper, to get the username and password for HTTPS hosts without a token (or set DEPCREDENTIALHELPER)")
+	fs.StringVar(&s.cachedir, "cachedir", "", "cache dependency sources in this directory, rather than $GOPATH/pkg/dep (or set DEPCACHEDIR, or cachedir in "+dep.ConfigName+")")
+	fs.IntVar(&s.jobs, "jobs", 0, "limit the operations run at once against dependency sources, whatever their VCS type (0 for no limit; or set DEPJOBS, or jobs in "+dep.ConfigName+")")
+	fs.BoolVar(&s.offline, "offline", false, "never go to the network, and use only the dependency sources already in the cache (or set DEPOFFLINE, or offline in "+dep.ConfigName+")")
+	fs.StringVar(&s.vcsConcurrency, "vcs-concurrency", "", "limit the operations run at once against sources of each VCS type, or URL scheme of a registered source backend, as a comma-separated list such as git=8,hg=2 (or set DEPVCSCONCURRENCY)")
+}
+
+// environ appends the VCS concurrency given as a flag to env, so that it takes
+// precedence over any already in it.
+func (s *sourceFlags) environ(env []string) []string {
+	if s.vcsConcurrency != "" {
+		env = append(env, "DEPVCSCONCURRENCY="+s.vcsConcurrency)
+	}
+	return env
+}
+
+// apply records the flags in ctx. Of the settings, flags that weren't given
+// in fs leave those from the config or environment alone.
+func (s *sourceFlags) apply(fs *flag.FlagSet, ctx *dep.Ctx) {
+	if s.cacert != "" {
+		ctx.CACertFile = s.cacert
+	}
+	if s.credHelper != "" {
+		ctx.CredHelper = s.credHelper
+	}
+	ctx.CACertOnly = s.cacertOnly
+	ctx.GitLFS = s.lfs
+	ctx.CloneDepth = s.cloneDepth
+	ctx.CloneTimeout = s.cloneTimeout
+	ctx.MetaTimeout = s.metaTimeout
+	ctx.MetadataTTL = s.cacheTTL
+	if s.noCache {
+		ctx.MetadataTTL = 0
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "cachedir":
+			ctx.CacheDir = s.cachedir
+		case "jobs":
+			ctx.Jobs = s.jobs
+		case "offline":
+			ctx.Offline = s.offline
+		}
+	})
+}
+
 func resetUsage(logger *log.Logger, fs *flag.FlagSet, name, args, longHelp string) {
 	var (
 		hasFlags   bool
@@ -0,0 +1,148 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// patchContext is the number of unchanged lines shown around each change in a
+// unified diff.
+const patchContext = 3
+
+// diffLine is a single line of a diff: unchanged (' '), removed ('-') or
+// added ('+'). ai and bi are the indexes in the old and new text at which
+// the line sits.
+type diffLine struct {
+	kind   byte
+	text   string
+	ai, bi int
+}
+
+// unifiedDiff returns a unified diff, as produced by diff -u, that turns a
+// into b. The files are labeled with the given names. If a and b are equal,
+// the diff is empty.
+func unifiedDiff(aName, bName string, a, b []byte) string {
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var buf bytes.Buffer
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Extend the hunk over every change that is within twice the context
+		// of the previous one, so that their context doesn't overlap.
+		start := i - patchContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(lines) && j <= end+2*patchContext; j++ {
+			if lines[j].kind != ' ' {
+				end = j
+			}
+		}
+		i = end + 1
+		end += patchContext + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", aName, bName)
+		}
+		writeHunk(&buf, lines[start:end])
+	}
+
+	return buf.String()
+}
+
+func writeHunk(buf *bytes.Buffer, hunk []diffLine) {
+	var acount, bcount int
+	for _, l := range hunk {
+		if l.kind != '+' {
+			acount++
+		}
+		if l.kind != '-' {
+			bcount++
+		}
+	}
+
+	// Hunks that are empty on one side are numbered by the line they follow.
+	astart, bstart := hunk[0].ai, hunk[0].bi
+	if acount > 0 {
+		astart++
+	}
+	if bcount > 0 {
+		bstart++
+	}
+
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(astart, acount), hunkRange(bstart, bcount))
+	for _, l := range hunk {
+		fmt.Fprintf(buf, "%c%s\n", l.kind, l.text)
+	}
+}
+
+// hunkRange formats one side of a hunk header. As with diff -u, the count is
+// left out when it is one.
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// diffLines computes a minimal line diff between a and b from their longest
+// common subsequence.
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i], i, j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i], i, j})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j], i, j})
+			j++
+		}
+	}
+	return lines
+}
+
+func splitLines(b []byte) []string {
+	s := strings.TrimSuffix(string(b), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	t.Parallel()
+
+	// numbered returns the lines with the given numbers, one per line.
+	numbered := func(ns ...string) string {
+		return strings.Join(ns, "\n") + "\n"
+	}
+	base := numbered("1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13", "14", "15", "16")
+
+	for _, tc := range []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "equal",
+			a:    base,
+			b:    base,
+			want: "",
+		},
+		{
+			name: "from empty",
+			a:    "",
+			b:    "a\nb\n",
+			want: "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "to empty",
+			a:    "a\n",
+			b:    "",
+			want: "--- a\n+++ b\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name: "nearby changes share a hunk",
+			a:    base,
+			b:    numbered("1", "2", "three", "4", "5", "6", "7", "8", "10", "11", "12", "13", "14", "15", "16"),
+			want: "--- a\n+++ b\n@@ -1,12 +1,11 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n 7\n 8\n-9\n 10\n 11\n 12\n",
+		},
+		{
+			name: "distant changes get their own hunks",
+			a:    base,
+			b:    numbered("0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13", "14", "15"),
+			want: "--- a\n+++ b\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -13,4 +14,3 @@\n 13\n 14\n 15\n-16\n",
+		},
+	} {
+		if got := unifiedDiff("a", "b", []byte(tc.a), []byte(tc.b)); got != tc.want {
+			t.Errorf("%s: unexpected diff:\n(GOT):\n%s\n(WNT):\n%s", tc.name, got, tc.want)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"flag"
 	"log"
+	"strings"
 
 	"github.com/golang/dep"
 	"github.com/golang/dep/internal/gps"
@@ -19,20 +20,31 @@ const pruneShortHelp = `Prune the vendor tree of unused packages`
 const pruneLongHelp = `
 Prune is used to remove unused packages from your vendor tree.
 
+With -explain, nothing is deleted. Instead, the prune options that apply to
+each project in Gopkg.lock, once the manifest's prune table is taken into
+account, are printed: the packages kept when unused ones are pruned, whether
+build-ignored files are pruned and file modes normalized, and which files the
+keep-only patterns retain.
+
 STABILITY NOTICE: this command creates problems for vendor/ verification. As
 such, it may be removed and/or moved out into a separate project later on.
 `
 
 type pruneCommand struct {
+	sourceFlags
+
+	explain bool
 }
 
 func (cmd *pruneCommand) Name() string      { return "prune" }
-func (cmd *pruneCommand) Args() string      { return "" }
+func (cmd *pruneCommand) Args() string      { return "[-explain]" }
 func (cmd *pruneCommand) ShortHelp() string { return pruneShortHelp }
 func (cmd *pruneCommand) LongHelp() string  { return pruneLongHelp }
 func (cmd *pruneCommand) Hidden() bool      { return false }
 
 func (cmd *pruneCommand) Register(fs *flag.FlagSet) {
+	cmd.sourceFlags.register(fs)
+	fs.BoolVar(&cmd.explain, "explain", false, "print the prune options that apply to each project, without deleting anything")
 }
 
 func (cmd *pruneCommand) Run(ctx *dep.Ctx, args []string) error {
@@ -41,7 +53,17 @@ func (cmd *pruneCommand) Run(ctx *dep.Ctx, args []string) error {
 		return err
 	}
 
-	sm, err := ctx.SourceManager()
+	if cmd.explain {
+		if p.Lock == nil {
+			return errors.Errorf("Gopkg.lock must exist for prune to know what it would prune.")
+		}
+		for _, lp := range p.Lock.Projects() {
+			explainPrune(ctx.Loggers.Out, p.Manifest, lp)
+		}
+		return nil
+	}
+
+	sm, err := ctx.SourceManager(p)
 	if err != nil {
 		return err
 	}
@@ -82,3 +104,23 @@ func (cmd *pruneCommand) Run(ctx *dep.Ctx, args []string) error {
 	}
 	return dep.PruneProject(p, sm, pruneLogger)
 }
+
+// explainPrune prints the prune options that apply to the locked project lp,
+// given the manifest m.
+func explainPrune(out *log.Logger, m *dep.Manifest, lp gps.LockedProject) {
+	yesNo := func(b bool, yes, no string) string {
+		if b {
+			return yes
+		}
+		return no
+	}
+
+	out.Printf("%s:\n", lp.Ident().ProjectRoot)
+	out.Printf("  unused packages: pruned, keeping %s\n", strings.Join(lp.Packages(), ", "))
+	out.Printf("  build-ignored files: %s\n", yesNo(m.PruneOptions&gps.PruneBuildIgnoredFiles != 0, "pruned", "kept"))
+	out.Printf("  file modes: %s\n", yesNo(m.PruneOptions&gps.NormalizeFileModes != 0, "normalized", "kept"))
+	out.Printf("  files: %s\n", yesNo(len(m.PruneKeep) > 0, "keeping only "+strings.Join(m.PruneKeep, ", "), "all kept"))
+	if len(m.PruneProtect) > 0 {
+		out.Printf("  protected files: %s\n", strings.Join(m.PruneProtect, ", "))
+	}
+}
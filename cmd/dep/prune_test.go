@@ -0,0 +1,69 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestPruneExplain(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	proj := filepath.Join("src", "proj")
+	h.TempFile(filepath.Join(proj, dep.ManifestName), `[prune]
+  build-ignored = true
+  keep-only = ["**/*.go", "LICENSE"]
+`)
+	h.TempFile(filepath.Join(proj, dep.LockName), `[[projects]]
+  name = "github.com/foo/bar"
+  packages = [".","sub"]
+  revision = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+
+[[projects]]
+  name = "github.com/foo/baz"
+  packages = ["."]
+  revision = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+
+[solve-meta]
+  analyzer-name = "dep"
+  analyzer-version = 1
+  inputs-digest = "ab4fef131ee828e96ba67d31a7d690bd5f2f42040c6766b1b12fe856f87e0ff7"
+  solver-name = "gps-cdcl"
+  solver-version = 1
+`)
+	h.TempFile(filepath.Join(proj, "vendor", "github.com", "foo", "bar", "bar.go"), "package bar\n")
+
+	// The manifest's prune table applies to every project, alongside the
+	// packages the lock lists for each.
+	env := []string{"GOPATH=" + h.Path("."), "HOME=" + h.Path(".")}
+	var stdout, stderr bytes.Buffer
+	if err := runMain("dep", []string{"prune", "-explain"}, &stdout, &stderr, h.Path(proj), env); err != nil {
+		t.Fatalf("%s\n%s", err, stderr.String())
+	}
+
+	want := `github.com/foo/bar:
+  unused packages: pruned, keeping ., sub
+  build-ignored files: pruned
+  file modes: kept
+  files: keeping only **/*.go, LICENSE
+github.com/foo/baz:
+  unused packages: pruned, keeping .
+  build-ignored files: pruned
+  file modes: kept
+  files: keeping only **/*.go, LICENSE
+`
+	if stdout.String() != want {
+		t.Errorf("unexpected plan:\n\t(GOT) %q\n\t(WNT) %q", stdout.String(), want)
+	}
+
+	// Nothing was pruned.
+	h.MustExist(h.Path(filepath.Join(proj, "vendor", "github.com", "foo", "bar", "bar.go")))
+}
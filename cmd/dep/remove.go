@@ -0,0 +1,209 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+const removeShortHelp = `Remove a dependency and solve again`
+const removeLongHelp = `
+Remove drops every [[constraint]] and [[override]] on the projects holding the
+given import paths from Gopkg.toml, along with their required packages, then
+solves again and writes the new Gopkg.lock and vendor folder.
+
+A project that the project's code still imports can't be removed, as the next
+dep ensure would only add it back. Remove those imports first, or use -force
+to remove it anyway, which leaves the build broken until they are.
+`
+
+func (cmd *removeCommand) Name() string      { return "remove" }
+func (cmd *removeCommand) Args() string      { return "<import path>..." }
+func (cmd *removeCommand) ShortHelp() string { return removeShortHelp }
+func (cmd *removeCommand) LongHelp() string  { return removeLongHelp }
+func (cmd *removeCommand) Hidden() bool      { return false }
+
+func (cmd *removeCommand) Register(fs *flag.FlagSet) {
+	cmd.sourceFlags.register(fs)
+	fs.BoolVar(&cmd.force, "force", false, "remove projects even if the project still imports them")
+}
+
+type removeCommand struct {
+	sourceFlags
+
+	force bool
+}
+
+func (cmd *removeCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) == 0 {
+		return errors.New("must specify at least one project to remove")
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+
+	sm, err := ctx.SourceManager(p)
+	if err != nil {
+		return err
+	}
+	sm.UseDefaultSignalHandling()
+	defer sm.Release()
+
+	return cmd.remove(ctx, p, sm, args)
+}
+
+// remove removes the projects holding the import paths args from the manifest
+// of p, then solves again and writes the result.
+func (cmd *removeCommand) remove(ctx *dep.Ctx, p *dep.Project, sm gps.SourceManager, args []string) error {
+	ptree, err := ctx.ListPackages(p.AbsRoot, string(p.ImportRoot))
+	if err != nil {
+		return errors.Wrap(err, "analysis of local packages failed")
+	}
+
+	staged := copyManifest(p.Manifest)
+	params := p.MakeParams()
+	params.RootPackageTree = ptree
+	if ctx.Loggers.Verbose {
+		params.TraceLogger = ctx.Loggers.Err
+	}
+	var solveManifest *dep.Manifest
+	for _, arg := range args {
+		pr, err := sm.DeduceProjectRoot(arg)
+		if err != nil {
+			return errors.Wrapf(err, "could not infer project root from %s; nothing was removed", arg)
+		}
+		if !dependsOn(p, pr) {
+			return errors.Errorf("%s is not a dependency of the project; nothing was removed", pr)
+		}
+
+		importers, imported := importersOf(ptree, p.Manifest.IgnoredPackages(), pr)
+		if len(importers) > 0 {
+			if !cmd.force {
+				return errors.Errorf("%s is still imported by %s; remove those imports first, or use -force. Nothing was removed", pr, strings.Join(importers, ", "))
+			}
+			ctx.Loggers.Err.Printf("Warning: removing %s, which is still imported by %s; the build will be broken until those imports are removed\n", pr, strings.Join(importers, ", "))
+
+			// Solve as if the imports were gone, so that the project and
+			// whatever only it needed drop out of the lock.
+			if solveManifest == nil {
+				solveManifest = copyManifest(staged)
+			}
+			solveManifest.Ignored = append(solveManifest.Ignored, imported...)
+		}
+
+		removeFromManifest(staged, pr)
+		if solveManifest != nil {
+			removeFromManifest(solveManifest, pr)
+		}
+	}
+	params.Manifest = staged
+	if solveManifest != nil {
+		params.Manifest = solveManifest
+	}
+
+	solver, err := gps.Prepare(params, sm)
+	if err != nil {
+		return errors.Wrap(err, "remove Prepare")
+	}
+	solution, err := solver.Solve()
+	if err != nil {
+		handleAllTheFailuresOfTheWorld(err)
+		return errors.Wrap(err, "remove Solve(); nothing was removed")
+	}
+
+	newLock := dep.LockFromSolution(solution)
+	if solveManifest != nil {
+		// The lock is written alongside staged, not the manifest that was
+		// solved with, so its inputs digest must be that of staged.
+		params.Manifest = staged
+		s, err := gps.Prepare(params, sm)
+		if err != nil {
+			return errors.Wrap(err, "remove Prepare")
+		}
+		newLock.SolveMeta.InputsDigest = s.HashInputs()
+	}
+
+	ensure := &ensureCommand{parallel: defaultParallel()}
+	return ensure.writeSolution(ctx, p, staged, newLock, sm)
+}
+
+// dependsOn reports whether the manifest or lock of p mentions the project pr.
+func dependsOn(p *dep.Project, pr gps.ProjectRoot) bool {
+	if _, has := p.Manifest.Constraints[pr]; has {
+		return true
+	}
+	if _, has := p.Manifest.Ovr[pr]; has {
+		return true
+	}
+	if p.Lock != nil {
+		for _, lp := range p.Lock.Projects() {
+			if lp.Ident().ProjectRoot == pr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// importersOf returns the packages of ptree, other than those ignored, that
+// import any package of the project pr, and the packages of pr they import,
+// both sorted.
+func importersOf(ptree pkgtree.PackageTree, ignored map[string]bool, pr gps.ProjectRoot) (importers, imported []string) {
+	seen := make(map[string]bool)
+	for ip, poe := range ptree.Packages {
+		if poe.Err != nil || ignored[ip] {
+			continue
+		}
+		imports := false
+		for _, imp := range append(poe.P.Imports, poe.P.TestImports...) {
+			if !isPathPrefix(imp, string(pr)) {
+				continue
+			}
+			imports = true
+			if !seen[imp] {
+				seen[imp] = true
+				imported = append(imported, imp)
+			}
+		}
+		if imports {
+			importers = append(importers, ip)
+		}
+	}
+	sort.Strings(importers)
+	sort.Strings(imported)
+	return importers, imported
+}
+
+// removeFromManifest drops everything m says about the project pr, including
+// the packages of it that m requires. pr is deleted from every map of m that
+// is keyed by project root, so that each setting added to dep.Manifest per
+// project is dropped without being listed here.
+func removeFromManifest(m *dep.Manifest, pr gps.ProjectRoot) {
+	key := reflect.ValueOf(pr)
+	mv := reflect.ValueOf(m).Elem()
+	for i := 0; i < mv.NumField(); i++ {
+		if f := mv.Field(i); f.Kind() == reflect.Map && f.Type().Key() == key.Type() && !f.IsNil() {
+			f.SetMapIndex(key, reflect.Value{})
+		}
+	}
+
+	required := m.Required[:0]
+	for _, req := range m.Required {
+		if !isPathPrefix(req, string(pr)) {
+			required = append(required, req)
+		}
+	}
+	m.Required = required
+}
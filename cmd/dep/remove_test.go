@@ -0,0 +1,183 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestRemove(t *testing.T) {
+	sv, err := gps.NewSemverConstraint("^1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := &fakeSourceManager{
+		versions: []gps.PairedVersion{
+			gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+		},
+		files: map[string]string{"x.go": "package x\n"},
+	}
+	locked := func(pr gps.ProjectRoot) gps.LockedProject {
+		return gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: pr}, gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."})
+	}
+
+	for _, tc := range []struct {
+		name    string
+		remove  string
+		force   bool
+		err     string
+		kept    []string
+		removed []string
+	}{
+		{
+			name:    "unimported",
+			remove:  "github.com/sdboyer/deptestdos",
+			kept:    []string{"github.com/sdboyer/deptest"},
+			removed: []string{"github.com/sdboyer/deptestdos"},
+		},
+		{
+			name:   "still imported",
+			remove: "github.com/sdboyer/deptest",
+			err:    "still imported by example.com/proj",
+		},
+		{
+			name:    "forced",
+			remove:  "github.com/sdboyer/deptest",
+			force:   true,
+			kept:    []string{"github.com/sdboyer/deptestdos"},
+			removed: []string{"github.com/sdboyer/deptest"},
+		},
+		{
+			name:   "not a dependency",
+			remove: "github.com/sdboyer/deptesttres",
+			err:    "not a dependency",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := test.NewHelper(t)
+			defer h.Cleanup()
+
+			h.TempFile(filepath.Join("proj", "main.go"), "package main\n\nimport _ \"github.com/sdboyer/deptest\"\n")
+			root := h.Path("proj")
+			h.TempDir("cache")
+
+			var stderr bytes.Buffer
+			ctx := &dep.Ctx{
+				CacheDir: h.Path("cache"),
+				Loggers: &dep.Loggers{
+					Out: log.New(ioutil.Discard, "", 0),
+					Err: log.New(&stderr, "", 0),
+				},
+			}
+			p := &dep.Project{
+				AbsRoot:    root,
+				ImportRoot: "example.com/proj",
+				Manifest: &dep.Manifest{
+					Constraints: gps.ProjectConstraints{
+						"github.com/sdboyer/deptest":    {Constraint: sv},
+						"github.com/sdboyer/deptestdos": {Constraint: sv},
+					},
+					Ovr:      gps.ProjectConstraints{},
+					Required: []string{"github.com/sdboyer/deptestdos"},
+				},
+				Lock: &dep.Lock{P: []gps.LockedProject{
+					locked("github.com/sdboyer/deptest"),
+					locked("github.com/sdboyer/deptestdos"),
+				}},
+			}
+
+			err := (&removeCommand{force: tc.force}).remove(ctx, p, sm, []string{tc.remove})
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected an error containing %q, got %v", tc.err, err)
+				}
+				h.MustNotExist(filepath.Join(root, dep.ManifestName))
+				h.MustNotExist(filepath.Join(root, dep.LockName))
+				return
+			}
+			h.Must(err)
+
+			manifest, err := ioutil.ReadFile(filepath.Join(root, dep.ManifestName))
+			h.Must(err)
+			lock, err := ioutil.ReadFile(filepath.Join(root, dep.LockName))
+			h.Must(err)
+			for _, pr := range tc.kept {
+				if !strings.Contains(string(manifest), `"`+pr+`"`) {
+					t.Errorf("expected %s to stay in the manifest:\n%s", pr, manifest)
+				}
+				if !strings.Contains(string(lock), `"`+pr+`"`) {
+					t.Errorf("expected %s to stay in the lock:\n%s", pr, lock)
+				}
+				h.MustExist(filepath.Join(root, "vendor", filepath.FromSlash(pr)))
+			}
+			for _, pr := range tc.removed {
+				if strings.Contains(string(manifest), `"`+pr+`"`) {
+					t.Errorf("expected %s to be removed from the manifest:\n%s", pr, manifest)
+				}
+				if strings.Contains(string(lock), `"`+pr+`"`) {
+					t.Errorf("expected %s to be removed from the lock:\n%s", pr, lock)
+				}
+				h.MustNotExist(filepath.Join(root, "vendor", filepath.FromSlash(pr)))
+			}
+			if tc.force && !strings.Contains(stderr.String(), "still imported") {
+				t.Errorf("expected a warning about the remaining imports, got:\n%s", stderr.String())
+			}
+
+			// The lock is in sync with the manifest that was written, even
+			// when the solve had to ignore the remaining imports.
+			written := copyManifest(p.Manifest)
+			removeFromManifest(written, gps.ProjectRoot(tc.remove))
+			ptree, err := ctx.ListPackages(root, string(p.ImportRoot))
+			h.Must(err)
+			params := p.MakeParams()
+			params.Manifest = written
+			params.RootPackageTree = ptree
+			s, err := gps.Prepare(params, sm)
+			h.Must(err)
+			if digest := fmt.Sprintf("inputs-digest = %q", hex.EncodeToString(s.HashInputs())); !strings.Contains(string(lock), digest) {
+				t.Errorf("expected the lock to have the inputs digest of the written manifest, %s:\n%s", digest, lock)
+			}
+		})
+	}
+}
+
+func TestRemoveFromManifest(t *testing.T) {
+	const pr = gps.ProjectRoot("github.com/sdboyer/deptest")
+	m := &dep.Manifest{
+		Constraints:  gps.ProjectConstraints{pr: {}},
+		Ovr:          gps.ProjectConstraints{pr: {}},
+		Floating:     map[gps.ProjectRoot]bool{pr: true},
+		VCS:          map[gps.ProjectRoot]string{pr: "git"},
+		CloneDepth:   map[gps.ProjectRoot]int{pr: 1},
+		RefNamespace: map[gps.ProjectRoot]string{pr: "refs/releases"},
+		Exclude:      map[gps.ProjectRoot][]string{pr: {"v1.0.0"}},
+		SignedTags:   map[gps.ProjectRoot]bool{pr: true},
+		PinDigest:    map[gps.ProjectRoot]string{pr: "sha256:00"},
+		Required:     []string{string(pr) + "/sub", "github.com/other/other"},
+	}
+	removeFromManifest(m, pr)
+
+	mv := reflect.ValueOf(m).Elem()
+	for i := 0; i < mv.NumField(); i++ {
+		if f := mv.Field(i); f.Kind() == reflect.Map && f.Len() != 0 {
+			t.Errorf("expected %s to be dropped from %s, got %v", pr, mv.Type().Field(i).Name, f.Interface())
+		}
+	}
+	if !reflect.DeepEqual(m.Required, []string{"github.com/other/other"}) {
+		t.Errorf("expected only the packages of %s to be dropped from required, got %v", pr, m.Required)
+	}
+}
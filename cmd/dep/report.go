@@ -0,0 +1,94 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+// reportName is the name of the reproducibility report that ensure -report
+// writes in the project root.
+const reportName = "dep-report.json"
+
+// depVersion is the version of dep, as recorded in reports. It is set when
+// building a release, with -ldflags "-X main.depVersion=<version>".
+var depVersion = "devel"
+
+// ensureReport records the inputs of a build, as resolved by ensure.
+type ensureReport struct {
+	InputsDigest string          `json:"inputs-digest"`
+	DepVersion   string          `json:"dep-version"`
+	GoVersion    string          `json:"go-version"`
+	ResolvedAt   string          `json:"resolved-at"`
+	Projects     []reportProject `json:"projects"`
+}
+
+type reportProject struct {
+	Name       string `json:"name"`
+	Source     string `json:"source,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Revision   string `json:"revision"`
+	Digest     string `json:"digest"`
+	CommitTime string `json:"commit-time"`
+}
+
+// writeReport writes the reproducibility report for l, which has been
+// vendored into the project at root, as of the time resolved. The commit
+// times of projects that l doesn't record are fetched with sm.
+func writeReport(root string, l *dep.Lock, sm gps.SourceManager, resolved time.Time) error {
+	r := ensureReport{
+		InputsDigest: hex.EncodeToString(l.SolveMeta.InputsDigest),
+		DepVersion:   depVersion,
+		GoVersion:    runtime.Version(),
+		ResolvedAt:   resolved.UTC().Format(time.RFC3339),
+		Projects:     []reportProject{},
+	}
+
+	for _, lp := range l.Projects() {
+		id := lp.Ident()
+		rp := reportProject{
+			Name:     string(id.ProjectRoot),
+			Source:   id.Source,
+			Revision: string(lockedRevision(lp)),
+		}
+		if pv, ok := lp.Version().(gps.PairedVersion); ok {
+			rp.Version = pv.Unpair().String()
+		}
+
+		digest, err := dep.DigestDir(filepath.Join(root, "vendor", filepath.FromSlash(string(id.ProjectRoot))))
+		if err != nil {
+			return errors.Wrapf(err, "unable to digest the vendored copy of %s", id.ProjectRoot)
+		}
+		rp.Digest = digest
+
+		t, has := l.CommitTimes[id.ProjectRoot]
+		if !has && rp.Revision != "" {
+			t, err = sm.CommitTime(id, gps.Revision(rp.Revision))
+			if err != nil {
+				return errors.Wrapf(err, "unable to get the commit time of %s at %s", id.ProjectRoot, rp.Revision)
+			}
+		}
+		if !t.IsZero() {
+			rp.CommitTime = t.UTC().Format(time.RFC3339)
+		}
+
+		r.Projects = append(r.Projects, rp)
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to encode the report")
+	}
+	return errors.Wrap(ioutil.WriteFile(filepath.Join(root, reportName), append(b, '\n'), 0666), "unable to write the report")
+}
@@ -0,0 +1,54 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"path/filepath"
+
+	"github.com/golang/dep"
+	"github.com/pkg/errors"
+)
+
+const restoreShortHelp = `Roll back vendor and Gopkg.lock to a backup`
+const restoreLongHelp = `
+Restore puts back the vendor folder and Gopkg.lock saved in a backup made by
+dep ensure -backup, replacing the current ones. Anything that wasn't there when
+the backup was made is removed.
+
+The backup itself is left in place.
+`
+
+func (cmd *restoreCommand) Name() string      { return "restore" }
+func (cmd *restoreCommand) Args() string      { return "<backup>" }
+func (cmd *restoreCommand) ShortHelp() string { return restoreShortHelp }
+func (cmd *restoreCommand) LongHelp() string  { return restoreLongHelp }
+func (cmd *restoreCommand) Hidden() bool      { return false }
+
+func (cmd *restoreCommand) Register(fs *flag.FlagSet) {}
+
+type restoreCommand struct{}
+
+func (cmd *restoreCommand) Run(ctx *dep.Ctx, args []string) error {
+	if len(args) != 1 {
+		return errors.New("restore requires the path of a backup made by dep ensure -backup")
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		return err
+	}
+
+	backup := args[0]
+	if !filepath.IsAbs(backup) {
+		backup = filepath.Join(ctx.WorkingDir, backup)
+	}
+	if err := dep.RestoreSnapshot(p.AbsRoot, backup); err != nil {
+		return errors.Wrapf(err, "unable to restore %s", backup)
+	}
+
+	ctx.Loggers.Err.Printf("Restored vendor and %s from %s\n", dep.LockName, backup)
+	return nil
+}
@@ -71,21 +71,144 @@ func (a *rootAnalyzer) importManifestAndLock(dir string, pr gps.ProjectRoot, sup
 		logger = log.New(ioutil.Discard, "", 0)
 	}
 
+	// In order of precedence: when the configuration of two tools is equally
+	// specific about a project, the first one's wins.
 	importers := []importer{
 		newGlideImporter(logger, a.ctx.Verbose, a.sm),
+		newGomodImporter(logger, a.ctx.Verbose, a.sm),
 	}
 
+	var m *dep.Manifest
+	var l *dep.Lock
 	for _, i := range importers {
-		if i.HasDepMetadata(dir) {
-			a.ctx.Loggers.Err.Printf("Importing configuration from %s. These are only initial constraints, and are further refined during the solve process.", i.Name())
-			m, l, err := i.Import(dir, pr)
-			a.removeTransitiveDependencies(m)
-			return m, l, err
+		if !i.HasDepMetadata(dir) {
+			continue
+		}
+		a.ctx.Loggers.Err.Printf("Importing configuration from %s. These are only initial constraints, and are further refined during the solve process.", i.Name())
+		im, il, err := i.Import(dir, pr)
+		if err != nil {
+			return nil, nil, err
+		}
+		if m == nil {
+			m, l = im, il
+			continue
+		}
+		l = mergeImport(m, l, im, il, i.Name(), logger)
+	}
+
+	if m == nil {
+		var emptyManifest = &dep.Manifest{Constraints: make(gps.ProjectConstraints), Ovr: make(gps.ProjectConstraints)}
+		return emptyManifest, nil, nil
+	}
+	a.removeTransitiveDependencies(m)
+	return m, l, nil
+}
+
+// mergeImport merges the manifest and lock imported from the tool named name
+// into m and l, those imported from the tools that take precedence over it,
+// and returns the merged lock.
+//
+// A constraint only replaces the one in m on the same project if it is more
+// specific, as ranked by constraintSpecificity, and a locked project is only
+// added if l has none for its project, or locks the same revision without
+// naming its version. Constraints and locked projects that disagree with
+// those in m and l about a revision are reported to logger.
+//
+// Where a constraint is replaced, the project's locked revision goes with it:
+// the one il locks is taken, if any, and otherwise the one in l is dropped
+// unless it still satisfies the new constraint, so that the solver picks the
+// project's version afresh.
+func mergeImport(m *dep.Manifest, l *dep.Lock, im *dep.Manifest, il *dep.Lock, name string, logger *log.Logger) *dep.Lock {
+	replaced := make(map[gps.ProjectRoot]bool)
+	for pr, pp := range im.Constraints {
+		cur, has := m.Constraints[pr]
+		if !has {
+			m.Constraints[pr] = pp
+			continue
+		}
+
+		cr, curIsRev := cur.Constraint.(gps.Revision)
+		r, isRev := pp.Constraint.(gps.Revision)
+		if curIsRev && isRev && cr != r {
+			logger.Printf("  Conflict: %s is constrained to revision %s, but %s says %s; keeping %s.\n", pr, cr, name, r, cr)
+			continue
+		}
+		if constraintSpecificity(pp.Constraint) > constraintSpecificity(cur.Constraint) {
+			if pp.Source == "" {
+				pp.Source = cur.Source
+			}
+			m.Constraints[pr] = pp
+			replaced[pr] = true
+		}
+	}
+	for _, ig := range im.Ignored {
+		if !contains(m.Ignored, ig) {
+			m.Ignored = append(m.Ignored, ig)
 		}
 	}
 
-	var emptyManifest = &dep.Manifest{Constraints: make(gps.ProjectConstraints), Ovr: make(gps.ProjectConstraints)}
-	return emptyManifest, nil, nil
+	if l == nil {
+		return il
+	}
+	if il != nil {
+		for _, ilp := range il.P {
+			pr := ilp.Ident().ProjectRoot
+			found := false
+			for k, lp := range l.P {
+				if lp.Ident().ProjectRoot != pr {
+					continue
+				}
+				found = true
+
+				rev, irev := lockedRevision(lp), lockedRevision(ilp)
+				if rev != irev && replaced[pr] {
+					l.P[k] = ilp
+				} else if rev != irev {
+					logger.Printf("  Conflict: %s is locked to revision %s, but %s says %s; keeping %s.\n", pr, rev, name, irev, rev)
+				} else if _, isRev := lp.Version().(gps.Revision); isRev {
+					// The same revision, but now with its version.
+					l.P[k] = ilp
+				}
+				break
+			}
+			if !found {
+				l.P = append(l.P, ilp)
+			}
+		}
+	}
+
+	kept := l.P[:0]
+	for _, lp := range l.P {
+		pr := lp.Ident().ProjectRoot
+		if replaced[pr] && !m.Constraints[pr].Constraint.Matches(lp.Version()) {
+			logger.Printf("  %s's constraint on %s replaces the one %s was locked under; it will be solved again.\n", name, pr, lp.Version())
+			continue
+		}
+		kept = append(kept, lp)
+	}
+	l.P = kept
+	return l
+}
+
+// constraintSpecificity ranks how specific the constraint c is about the
+// version of a project: a revision most, then a single version, a branch, and
+// a range of versions, with none at all least.
+func constraintSpecificity(c gps.Constraint) int {
+	switch tc := c.(type) {
+	case nil:
+		return 0
+	case gps.Revision:
+		return 4
+	case gps.Version:
+		if tc.Type() == gps.IsBranch {
+			return 2
+		}
+		return 3
+	}
+	if gps.IsAny(c) {
+		return 0
+	}
+	return 1
 }
 
 func (a *rootAnalyzer) removeTransitiveDependencies(m *dep.Manifest) {
@@ -4,7 +4,17 @@
 
 package main
 
-import "testing"
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep"
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/test"
+)
 
 func TestRootAnalyzer_Info(t *testing.T) {
 	testCases := map[bool]string{
@@ -19,3 +29,123 @@ func TestRootAnalyzer_Info(t *testing.T) {
 		}
 	}
 }
+
+func TestRootAnalyzer_ImportMultipleTools(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir(testGlideProjectRoot)
+	for _, name := range []string{glideYamlName, glideLockName, goModName} {
+		h.TempCopy(filepath.Join(testGlideProjectRoot, name), filepath.Join("multiple", name))
+	}
+
+	sm := &fakeSourceManager{versions: []gps.PairedVersion{
+		gps.NewVersion("v0.8.0").Is("645ef00459ed84a119197bfb8d8205042c6df63d"),
+		gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+		gps.NewVersion("v2.0.0").Is("5c607206be5decd28e6263ffffdcee067266015e"),
+		gps.NewBranch("master").Is("a0196baa11ea047dd65037287451d36b861b00ea"),
+	}}
+	var output bytes.Buffer
+	logger := log.New(&output, "", 0)
+	ctx := &dep.Ctx{Loggers: &dep.Loggers{Out: logger, Err: logger}}
+	directDeps := map[string]bool{
+		"github.com/pkg/errors":         true,
+		"github.com/sdboyer/deptest":    true,
+		"github.com/sdboyer/deptestdos": true,
+	}
+	a := newRootAnalyzer(false, ctx, directDeps, sm)
+
+	m, l, err := a.importManifestAndLock(h.Path(testGlideProjectRoot), testGlideProjectRoot, false)
+	h.Must(err)
+
+	// The most specific constraint wins, whichever tool it comes from.
+	wantConstraints := map[gps.ProjectRoot]string{
+		"github.com/pkg/errors":         "^0.8.0",
+		"github.com/sdboyer/deptest":    "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+		"github.com/sdboyer/deptestdos": "a0196baa11ea047dd65037287451d36b861b00ea",
+	}
+	if len(m.Constraints) != len(wantConstraints) {
+		t.Fatalf("Expected %d constraints, got %v", len(wantConstraints), m.Constraints)
+	}
+	for pr, want := range wantConstraints {
+		if got := m.Constraints[pr].Constraint; got == nil || got.String() != want {
+			t.Errorf("Expected the constraint on %s to be %s, got %v", pr, want, got)
+		}
+	}
+
+	// Where the locks disagree, glide takes precedence over go.mod.
+	wantLocked := map[gps.ProjectRoot]string{
+		"github.com/pkg/errors":         "645ef00459ed84a119197bfb8d8205042c6df63d",
+		"github.com/sdboyer/deptest":    "ff2948a2ac8f538c4ecd55962e919d1e13e74baf",
+		"github.com/sdboyer/deptestdos": "a0196baa11ea047dd65037287451d36b861b00ea",
+	}
+	if len(l.P) != len(wantLocked) {
+		t.Fatalf("Expected %d locked projects, got %v", len(wantLocked), l.P)
+	}
+	for _, lp := range l.P {
+		pr := lp.Ident().ProjectRoot
+		if got := lockedRevision(lp); string(got) != wantLocked[pr] {
+			t.Errorf("Expected %s to be locked to %s, got %s", pr, wantLocked[pr], got)
+		}
+		if pr == "github.com/sdboyer/deptest" {
+			if _, ok := lp.Version().(gps.PairedVersion); !ok {
+				t.Errorf("Expected %s to keep the version glide locked, got %s", pr, lp.Version())
+			}
+		}
+	}
+
+	want := "Conflict: github.com/sdboyer/deptestdos is locked to revision a0196baa11ea047dd65037287451d36b861b00ea, but go.mod says 5c607206be5decd28e6263ffffdcee067266015e"
+	if !strings.Contains(output.String(), want) {
+		t.Errorf("Expected the conflict to be reported, got:\n%s", output.String())
+	}
+}
+
+func TestMergeImportReplacedConstraint(t *testing.T) {
+	const (
+		bar = gps.ProjectRoot("github.com/foo/bar")
+		baz = gps.ProjectRoot("github.com/foo/baz")
+	)
+	v1 := gps.NewVersion("v1.0.0").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf")
+	rev := gps.Revision("5c607206be5decd28e6263ffffdcee067266015e")
+	rng, err := gps.NewSemverConstraint("^1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both projects were locked to v1.0.0 under a range, which the later
+	// tool replaces with a revision outside it. It locks baz there, but
+	// says nothing of bar.
+	m := &dep.Manifest{Constraints: gps.ProjectConstraints{
+		bar: {Constraint: rng},
+		baz: {Constraint: rng},
+	}}
+	l := &dep.Lock{P: []gps.LockedProject{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: bar}, v1, []string{"."}),
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: baz}, v1, []string{"."}),
+	}}
+	im := &dep.Manifest{Constraints: gps.ProjectConstraints{
+		bar: {Constraint: rev},
+		baz: {Constraint: rev},
+	}}
+	il := &dep.Lock{P: []gps.LockedProject{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: baz}, rev, []string{"."}),
+	}}
+
+	var output bytes.Buffer
+	l = mergeImport(m, l, im, il, "go.mod", log.New(&output, "", 0))
+
+	// bar is left for the solver, and baz takes the revision with its
+	// constraint.
+	if len(l.P) != 1 {
+		t.Fatalf("Expected only baz to stay locked, got %v", l.P)
+	}
+	if pr, got := l.P[0].Ident().ProjectRoot, lockedRevision(l.P[0]); pr != baz || got != rev {
+		t.Errorf("Expected %s to be locked to %s, got %s at %s", baz, rev, pr, got)
+	}
+	if strings.Contains(output.String(), "Conflict") {
+		t.Errorf("Expected no conflict for a replaced constraint, got:\n%s", output.String())
+	}
+	if !strings.Contains(output.String(), string(bar)) {
+		t.Errorf("Expected %s to be reported as solved again, got:\n%s", bar, output.String())
+	}
+}
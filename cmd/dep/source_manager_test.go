@@ -0,0 +1,154 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/golang/dep/internal/test"
+)
+
+// fakeSourceManager serves every project from memory, without going to the
+// network, and records the calls made to it. Any method it doesn't implement
+// panics through the nil SourceManager.
+type fakeSourceManager struct {
+	gps.SourceManager
+
+	// versions are listed, and retracted listed as retracted, for every
+	// project.
+	versions  []gps.PairedVersion
+	retracted []gps.PairedVersion
+
+	// trees holds the package tree of each project. Projects without one
+	// have a single package, importing what imports lists for them.
+	trees   map[gps.ProjectRoot]pkgtree.PackageTree
+	imports map[gps.ProjectRoot][]string
+
+	// files are exported for every project without files of its own in
+	// projectFiles, taking exportDelay each time.
+	files        map[string]string
+	projectFiles map[gps.ProjectRoot]map[string]string
+	exportDelay  time.Duration
+
+	// syncDelay is taken by each sync.
+	syncDelay time.Duration
+
+	// commitTime is reported for every revision.
+	commitTime time.Time
+
+	// syncing and exporting record the most syncs and exports run at once.
+	syncing   test.Concurrency
+	exporting test.Concurrency
+
+	mu          sync.Mutex
+	exports     int                              // calls to ExportProject
+	listed      int                              // calls to ListRetracted
+	synced      map[gps.ProjectRoot]bool         // projects passed to SyncSourceFor
+	present     map[gps.ProjectRoot]gps.Revision // the last revision passed to RevisionPresentIn
+	commitTimes []gps.Revision                   // revisions passed to CommitTime
+}
+
+func (sm *fakeSourceManager) SourceExists(gps.ProjectIdentifier) (bool, error) { return true, nil }
+
+func (sm *fakeSourceManager) SyncSourceFor(id gps.ProjectIdentifier) error {
+	done := sm.syncing.Start()
+	defer done()
+	time.Sleep(sm.syncDelay)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.synced == nil {
+		sm.synced = make(map[gps.ProjectRoot]bool)
+	}
+	sm.synced[id.ProjectRoot] = true
+	return nil
+}
+
+func (sm *fakeSourceManager) DeduceProjectRoot(ip string) (gps.ProjectRoot, error) {
+	return gps.ProjectRoot(ip), nil
+}
+
+func (sm *fakeSourceManager) ListVersions(gps.ProjectIdentifier) ([]gps.PairedVersion, error) {
+	return sm.versions, nil
+}
+
+func (sm *fakeSourceManager) ListRetracted(gps.ProjectIdentifier) ([]gps.PairedVersion, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.listed++
+	return sm.retracted, nil
+}
+
+func (sm *fakeSourceManager) RequiresSignedTags(gps.ProjectIdentifier) (bool, error) {
+	return false, nil
+}
+
+func (sm *fakeSourceManager) RevisionPresentIn(id gps.ProjectIdentifier, r gps.Revision) (bool, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.present == nil {
+		sm.present = make(map[gps.ProjectRoot]gps.Revision)
+	}
+	sm.present[id.ProjectRoot] = r
+	return true, nil
+}
+
+func (sm *fakeSourceManager) GetManifestAndLock(gps.ProjectIdentifier, gps.Version, gps.ProjectAnalyzer) (gps.Manifest, gps.Lock, error) {
+	return gps.SimpleManifest{}, nil, nil
+}
+
+func (sm *fakeSourceManager) ListPackages(id gps.ProjectIdentifier, _ gps.Version) (pkgtree.PackageTree, error) {
+	if ptree, has := sm.trees[id.ProjectRoot]; has {
+		return ptree, nil
+	}
+	ip := string(id.ProjectRoot)
+	return pkgtree.PackageTree{
+		ImportRoot: ip,
+		Packages: map[string]pkgtree.PackageOrErr{
+			ip: {P: pkgtree.Package{ImportPath: ip, Name: "dep", Imports: sm.imports[id.ProjectRoot]}},
+		},
+	}, nil
+}
+
+func (sm *fakeSourceManager) CommitTime(id gps.ProjectIdentifier, r gps.Revision) (time.Time, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.commitTimes = append(sm.commitTimes, r)
+	return sm.commitTime, nil
+}
+
+func (sm *fakeSourceManager) ExportProject(id gps.ProjectIdentifier, v gps.Version, to string) error {
+	done := sm.exporting.Start()
+	defer done()
+
+	sm.mu.Lock()
+	sm.exports++
+	sm.mu.Unlock()
+
+	time.Sleep(sm.exportDelay)
+	files, has := sm.projectFiles[id.ProjectRoot]
+	if !has {
+		files = sm.files
+	}
+	if err := os.MkdirAll(to, 0777); err != nil {
+		return err
+	}
+	for name, body := range files {
+		path := filepath.Join(to, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, []byte(body), 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
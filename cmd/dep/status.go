@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/golang/dep"
@@ -30,14 +31,48 @@ With no arguments, print the status of each dependency of the project.
   REVISION    VCS revision of the chosen version
   LATEST      Latest VCS revision available
   PKGS USED   Number of packages from this project that are actually used
+  OWNER       Owner of the dependency, from .dep.yaml (only shown if present)
 
 With one or more explicitly specified packages, or with the -detailed flag,
 print an extended status output for each dependency of the project.
 
+With the -unused flag, print the locked projects that no package in the
+project's import graph imports, either directly or transitively. Such projects
+are dead weight, typically left behind by a stale lock.
+
+With the -unused-constraints flag, print the projects constrained in
+Gopkg.toml that are not in Gopkg.lock. Such constraints have no effect, and
+can be dropped with dep remove.
+
+With the -depth flag, print the minimum import depth of each locked project: 1
+for those imported by the project's own packages, 2 for those they import, and
+so on. Projects deeper than -max-depth are flagged, as very deep transitive
+chains are hard to keep track of.
+
   TODO    Another column description
   FOOBAR  Another column description
 
-Status returns exit code zero if all dependencies are in a "good state".
+With the -dot flag, print the graph of the project and its dependencies in
+GraphViz format, with a node for each project, labelled with its version, and
+an edge from each project to each of those it imports. To render it as an
+image:
+
+  dep status -dot | dot -Tpng -o deps.png
+
+With the -json flag, print a JSON array with an object for each dependency,
+holding the columns above. Its keys are stable, so tooling may rely on them:
+
+  projectRoot  string  Import path of the project root
+  constraint   string  Version constraint, "*" if there is none
+  version      string  Version chosen, empty if only a revision is locked
+  revision     string  Full VCS revision of the chosen version
+  latest       string  Latest version or revision allowed by the constraint,
+                       empty if unknown
+  packages     number  Number of packages from this project that are used
+  owner        string  Owner of the dependency, omitted if not known
+
+Status returns exit code zero if all dependencies are in a "good state", and
+non-zero if the lock is out of sync with the manifest or the project's imports.
 `
 
 func (cmd *statusCommand) Name() string      { return "status" }
@@ -47,6 +82,7 @@ func (cmd *statusCommand) LongHelp() string  { return statusLongHelp }
 func (cmd *statusCommand) Hidden() bool      { return false }
 
 func (cmd *statusCommand) Register(fs *flag.FlagSet) {
+	cmd.sourceFlags.register(fs)
 	fs.BoolVar(&cmd.detailed, "detailed", false, "report more detailed status")
 	fs.BoolVar(&cmd.json, "json", false, "output in JSON format")
 	fs.StringVar(&cmd.template, "f", "", "output in text/template format")
@@ -54,19 +90,27 @@ func (cmd *statusCommand) Register(fs *flag.FlagSet) {
 	fs.BoolVar(&cmd.old, "old", false, "only show out-of-date dependencies")
 	fs.BoolVar(&cmd.missing, "missing", false, "only show missing dependencies")
 	fs.BoolVar(&cmd.unused, "unused", false, "only show unused dependencies")
+	fs.BoolVar(&cmd.unusedConstraints, "unused-constraints", false, "only show constraints on projects that are not in the lock")
 	fs.BoolVar(&cmd.modified, "modified", false, "only show modified dependencies")
+	fs.BoolVar(&cmd.depth, "depth", false, "show the import depth of each dependency")
+	fs.IntVar(&cmd.maxDepth, "max-depth", 4, "with -depth, flag dependencies deeper than this")
 }
 
 type statusCommand struct {
-	detailed bool
-	json     bool
-	template string
-	output   string
-	dot      bool
-	old      bool
-	missing  bool
-	unused   bool
-	modified bool
+	sourceFlags
+
+	detailed          bool
+	json              bool
+	template          string
+	output            string
+	dot               bool
+	old               bool
+	missing           bool
+	unused            bool
+	unusedConstraints bool
+	modified          bool
+	depth             bool
+	maxDepth          int
 }
 
 type outputter interface {
@@ -78,9 +122,17 @@ type outputter interface {
 	MissingFooter()
 }
 
-type tableOutput struct{ w *tabwriter.Writer }
+type tableOutput struct {
+	w *tabwriter.Writer
+	// owners adds an OWNER column, for projects with dependency metadata.
+	owners bool
+}
 
 func (out *tableOutput) BasicHeader() {
+	if out.owners {
+		fmt.Fprintf(out.w, "PROJECT\tCONSTRAINT\tVERSION\tREVISION\tLATEST\tPKGS USED\tOWNER\n")
+		return
+	}
 	fmt.Fprintf(out.w, "PROJECT\tCONSTRAINT\tVERSION\tREVISION\tLATEST\tPKGS USED\n")
 }
 
@@ -95,6 +147,19 @@ func (out *tableOutput) BasicLine(bs *BasicStatus) {
 	} else {
 		constraint = bs.Constraint.String()
 	}
+	if out.owners {
+		fmt.Fprintf(out.w,
+			"%s\t%s\t%s\t%s\t%s\t%d\t%s\t\n",
+			bs.ProjectRoot,
+			constraint,
+			formatVersion(bs.Version),
+			formatVersion(bs.Revision),
+			formatVersion(bs.Latest),
+			bs.PackageCount,
+			bs.Owner,
+		)
+		return
+	}
 	fmt.Fprintf(out.w,
 		"%s\t%s\t%s\t%s\t%s\t%d\t\n",
 		bs.ProjectRoot,
@@ -124,12 +189,44 @@ func (out *tableOutput) MissingFooter() {
 
 type jsonOutput struct {
 	w       io.Writer
-	basic   []*BasicStatus
+	basic   []*jsonStatus
 	missing []*MissingStatus
 }
 
+// jsonStatus is the form in which -json prints each dependency, with the
+// columns of the table output. Its keys are documented in the help for dep
+// status, so fields may be added, but not renamed or removed.
+type jsonStatus struct {
+	ProjectRoot string `json:"projectRoot"`
+	Constraint  string `json:"constraint"`
+	Version     string `json:"version"`
+	Revision    string `json:"revision"`
+	Latest      string `json:"latest"`
+	Packages    int    `json:"packages"`
+	Owner       string `json:"owner,omitempty"`
+}
+
+func newJSONStatus(bs *BasicStatus) *jsonStatus {
+	js := &jsonStatus{
+		ProjectRoot: bs.ProjectRoot,
+		Revision:    string(bs.Revision),
+		Packages:    bs.PackageCount,
+		Owner:       bs.Owner,
+	}
+	if bs.Constraint != nil {
+		js.Constraint = bs.Constraint.String()
+	}
+	if bs.Version != nil {
+		js.Version = bs.Version.String()
+	}
+	if bs.Latest != nil {
+		js.Latest = bs.Latest.String()
+	}
+	return js
+}
+
 func (out *jsonOutput) BasicHeader() {
-	out.basic = []*BasicStatus{}
+	out.basic = []*jsonStatus{}
 }
 
 func (out *jsonOutput) BasicFooter() {
@@ -137,7 +234,7 @@ func (out *jsonOutput) BasicFooter() {
 }
 
 func (out *jsonOutput) BasicLine(bs *BasicStatus) {
-	out.basic = append(out.basic, bs)
+	out.basic = append(out.basic, newJSONStatus(bs))
 }
 
 func (out *jsonOutput) MissingHeader() {
@@ -170,11 +267,16 @@ func (out *dotOutput) BasicHeader() {
 
 func (out *dotOutput) BasicFooter() {
 	gvo := out.g.output()
-	fmt.Fprintf(out.w, gvo.String())
+	fmt.Fprint(out.w, gvo.String())
 }
 
 func (out *dotOutput) BasicLine(bs *BasicStatus) {
-	out.g.createNode(bs.ProjectRoot, bs.Version.String(), bs.Children)
+	// Projects locked to a bare revision have no version to show.
+	version := formatVersion(bs.Revision)
+	if bs.Version != nil {
+		version = formatVersion(bs.Version)
+	}
+	out.g.createNode(bs.ProjectRoot, version, bs.Children)
 }
 
 func (out *dotOutput) MissingHeader()                {}
@@ -187,13 +289,23 @@ func (cmd *statusCommand) Run(ctx *dep.Ctx, args []string) error {
 		return err
 	}
 
-	sm, err := ctx.SourceManager()
+	sm, err := ctx.SourceManager(p)
 	if err != nil {
 		return err
 	}
 	sm.UseDefaultSignalHandling()
 	defer sm.Release()
 
+	if cmd.unused {
+		return runStatusUnused(ctx.Loggers, p, sm, cmd.json)
+	}
+	if cmd.unusedConstraints {
+		return runStatusUnusedConstraints(ctx.Loggers, p, cmd.json)
+	}
+	if cmd.depth {
+		return runStatusDepth(ctx.Loggers, p, sm, cmd.maxDepth, cmd.json)
+	}
+
 	var buf bytes.Buffer
 	var out outputter
 	switch {
@@ -211,7 +323,8 @@ func (cmd *statusCommand) Run(ctx *dep.Ctx, args []string) error {
 		}
 	default:
 		out = &tableOutput{
-			w: tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0),
+			w:      tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0),
+			owners: len(p.Metadata) > 0,
 		}
 	}
 
@@ -229,10 +342,10 @@ func (cmd *statusCommand) Run(ctx *dep.Ctx, args []string) error {
 			ctx.Loggers.Err.Printf("Lock inputs-digest mismatch. This happens when Gopkg.toml is modified.\n" +
 				"Run `dep ensure` to regenerate the inputs-digest.")
 		}
-	} else {
-		ctx.Loggers.Out.Print(buf.String())
+		return errors.New("lock is out of sync with the project")
 	}
 
+	ctx.Loggers.Out.Print(buf.String())
 	return nil
 }
 
@@ -246,6 +359,7 @@ type BasicStatus struct {
 	Revision     gps.Revision
 	Latest       gps.Version
 	PackageCount int
+	Owner        string `json:",omitempty"`
 }
 
 type MissingStatus struct {
@@ -304,6 +418,7 @@ func runStatusAll(loggers *dep.Loggers, out outputter, p *dep.Project, sm gps.So
 			bs := BasicStatus{
 				ProjectRoot:  string(proj.Ident().ProjectRoot),
 				PackageCount: len(proj.Packages()),
+				Owner:        p.Metadata[proj.Ident().ProjectRoot].Owner,
 			}
 
 			// Get children only for specific outputers
@@ -385,7 +500,7 @@ func runStatusAll(loggers *dep.Loggers, out outputter, p *dep.Project, sm gps.So
 	// It's possible for digests to not match, but still have a correct
 	// lock.
 	digestMismatch = true
-	rm, _ := ptree.ToReachMap(true, true, false, nil)
+	rm, _ := ptree.ToReachMap(true, !p.Manifest.SkipTestImports, false, nil)
 
 	external := rm.FlattenFn(paths.IsStandardImportPath)
 	roots := make(map[gps.ProjectRoot][]string, len(external))
@@ -440,6 +555,271 @@ outer:
 	return digestMismatch, hasMissingPkgs, nil
 }
 
+// runStatusUnused reports the locked projects that nothing in the project's
+// import graph imports.
+func runStatusUnused(loggers *dep.Loggers, p *dep.Project, sm gps.SourceManager, asJSON bool) error {
+	if p.Lock == nil {
+		return errors.New("Gopkg.lock must exist to find unused projects")
+	}
+
+	ptree, err := pkgtree.ListPackages(p.AbsRoot, string(p.ImportRoot))
+	if err != nil {
+		return errors.Errorf("analysis of local packages failed: %v", err)
+	}
+
+	unused, err := findUnusedProjects(ptree, p.Manifest, p.Lock, sm.ListPackages)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		if unused == nil {
+			unused = []string{}
+		}
+		var buf bytes.Buffer
+		if err = json.NewEncoder(&buf).Encode(unused); err != nil {
+			return errors.Wrap(err, "failed to encode unused projects")
+		}
+		loggers.Out.Print(buf.String())
+		return nil
+	}
+
+	for _, pr := range unused {
+		loggers.Out.Println(pr)
+	}
+	return nil
+}
+
+// runStatusUnusedConstraints reports the projects constrained in the
+// manifest that aren't in the lock.
+func runStatusUnusedConstraints(loggers *dep.Loggers, p *dep.Project, asJSON bool) error {
+	if p.Lock == nil {
+		return errors.New("Gopkg.lock must exist to find unused constraints")
+	}
+
+	unused := unusedConstraints(p.Manifest, p.Lock)
+	if asJSON {
+		if unused == nil {
+			unused = []string{}
+		}
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(unused); err != nil {
+			return errors.Wrap(err, "failed to encode unused constraints")
+		}
+		loggers.Out.Print(buf.String())
+		return nil
+	}
+
+	for _, pr := range unused {
+		loggers.Out.Println(pr)
+	}
+	return nil
+}
+
+// DepthStatus is the import depth of a locked project, as reported by
+// status -depth.
+type DepthStatus struct {
+	ProjectRoot string
+	Depth       int
+	// TooDeep is set if Depth is beyond the -max-depth threshold.
+	TooDeep bool
+}
+
+// runStatusDepth reports the minimum import depth of each locked project in
+// the project's import graph, and warns about those deeper than maxDepth.
+func runStatusDepth(loggers *dep.Loggers, p *dep.Project, sm gps.SourceManager, maxDepth int, asJSON bool) error {
+	if p.Lock == nil {
+		return errors.New("Gopkg.lock must exist to find the depth of projects")
+	}
+
+	ptree, err := pkgtree.ListPackages(p.AbsRoot, string(p.ImportRoot))
+	if err != nil {
+		return errors.Errorf("analysis of local packages failed: %v", err)
+	}
+
+	statuses, err := findProjectDepths(ptree, p.Manifest, p.Lock, sm.ListPackages, maxDepth)
+	if err != nil {
+		return err
+	}
+
+	for _, ds := range statuses {
+		if ds.TooDeep {
+			loggers.Err.Printf("WARNING: %s is %d imports deep, beyond the maximum of %d\n", ds.ProjectRoot, ds.Depth, maxDepth)
+		}
+	}
+
+	var buf bytes.Buffer
+	if asJSON {
+		if statuses == nil {
+			statuses = []DepthStatus{}
+		}
+		if err = json.NewEncoder(&buf).Encode(statuses); err != nil {
+			return errors.Wrap(err, "failed to encode project depths")
+		}
+	} else {
+		w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "PROJECT\tDEPTH\t")
+		for _, ds := range statuses {
+			fmt.Fprintf(w, "%s\t%d\t\n", ds.ProjectRoot, ds.Depth)
+		}
+		w.Flush()
+	}
+	loggers.Out.Print(buf.String())
+	return nil
+}
+
+// findProjectDepths returns the depth of each locked project in the project's
+// import graph, sorted by project root, flagging those deeper than maxDepth.
+func findProjectDepths(ptree pkgtree.PackageTree, m *dep.Manifest, l gps.Lock, listPackages func(gps.ProjectIdentifier, gps.Version) (pkgtree.PackageTree, error), maxDepth int) ([]DepthStatus, error) {
+	depths, err := projectDepths(ptree, m, l, listPackages)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []DepthStatus
+	for pr, d := range depths {
+		statuses = append(statuses, DepthStatus{
+			ProjectRoot: string(pr),
+			Depth:       d,
+			TooDeep:     d > maxDepth,
+		})
+	}
+	sort.Sort(byDepthProjectRoot(statuses))
+
+	return statuses, nil
+}
+
+type byDepthProjectRoot []DepthStatus
+
+func (s byDepthProjectRoot) Len() int           { return len(s) }
+func (s byDepthProjectRoot) Less(i, j int) bool { return s[i].ProjectRoot < s[j].ProjectRoot }
+func (s byDepthProjectRoot) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// findUnusedProjects returns the sorted roots of the locked projects that no
+// package in the project's import graph imports.
+func findUnusedProjects(ptree pkgtree.PackageTree, m *dep.Manifest, l gps.Lock, listPackages func(gps.ProjectIdentifier, gps.Version) (pkgtree.PackageTree, error)) ([]string, error) {
+	depths, err := projectDepths(ptree, m, l, listPackages)
+	if err != nil {
+		return nil, err
+	}
+
+	var unused []string
+	for _, lp := range l.Projects() {
+		if _, used := depths[lp.Ident().ProjectRoot]; !used {
+			unused = append(unused, string(lp.Ident().ProjectRoot))
+		}
+	}
+	sort.Strings(unused)
+
+	return unused, nil
+}
+
+// unusedConstraints returns the sorted roots of the projects constrained in m
+// that aren't in l.
+func unusedConstraints(m *dep.Manifest, l gps.Lock) []string {
+	locked := make(map[gps.ProjectRoot]bool)
+	for _, lp := range l.Projects() {
+		locked[lp.Ident().ProjectRoot] = true
+	}
+
+	var unused []string
+	for pr := range m.Constraints {
+		if !locked[pr] {
+			unused = append(unused, string(pr))
+		}
+	}
+	sort.Strings(unused)
+
+	return unused
+}
+
+// projectDepths returns the minimum import depth of each locked project that
+// is in the project's import graph. A project imported by one of the
+// project's own packages is at depth 1, one that it imports at depth 2, and
+// so on; imports between the packages of a single project don't add to the
+// depth. Locked projects that aren't in the graph are left out.
+//
+// The graph is walked from the imports of the project's own packages and
+// tests, plus any required packages, through the imports of each package that
+// is reached within the locked projects. listPackages is used to analyze the
+// locked projects at their locked versions.
+func projectDepths(ptree pkgtree.PackageTree, m *dep.Manifest, l gps.Lock, listPackages func(gps.ProjectIdentifier, gps.Version) (pkgtree.PackageTree, error)) (map[gps.ProjectRoot]int, error) {
+	rm, _ := ptree.ToReachMap(true, true, false, m.IgnoredPackages())
+
+	type reached struct {
+		ip    string
+		depth int
+	}
+	var queue []reached
+	for _, ip := range append(rm.FlattenFn(paths.IsStandardImportPath), m.Required...) {
+		queue = append(queue, reached{ip, 1})
+	}
+
+	lps := l.Projects()
+	// projectFor finds the locked project that contains the package ip.
+	projectFor := func(ip string) (gps.LockedProject, bool) {
+		var found gps.LockedProject
+		var has bool
+		for _, lp := range lps {
+			root := string(lp.Ident().ProjectRoot)
+			if (ip == root || strings.HasPrefix(ip, root+"/")) &&
+				(!has || len(root) > len(found.Ident().ProjectRoot)) {
+				found, has = lp, true
+			}
+		}
+		return found, has
+	}
+
+	// As the walk is breadth-first, with the imports that stay within a
+	// project queued ahead of the rest, each package and project is first
+	// reached at its minimum depth.
+	depths := make(map[gps.ProjectRoot]int)
+	seen := make(map[string]bool)
+	trees := make(map[gps.ProjectRoot]pkgtree.PackageTree)
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+		if seen[r.ip] {
+			continue
+		}
+		seen[r.ip] = true
+
+		lp, has := projectFor(r.ip)
+		if !has {
+			continue
+		}
+		pr := lp.Ident().ProjectRoot
+		if _, has := depths[pr]; !has {
+			depths[pr] = r.depth
+		}
+
+		tree, has := trees[pr]
+		if !has {
+			var err error
+			tree, err = listPackages(lp.Ident(), lp.Version())
+			if err != nil {
+				return nil, errors.Wrapf(err, "analysis of %s failed", pr)
+			}
+			trees[pr] = tree
+		}
+
+		if poe, has := tree.Packages[r.ip]; has && poe.Err == nil {
+			for _, imp := range poe.P.Imports {
+				if paths.IsStandardImportPath(imp) {
+					continue
+				}
+				if ilp, has := projectFor(imp); has && ilp.Ident().ProjectRoot == pr {
+					queue = append([]reached{{imp, r.depth}}, queue...)
+				} else {
+					queue = append(queue, reached{imp, r.depth + 1})
+				}
+			}
+		}
+	}
+
+	return depths, nil
+}
+
 func formatVersion(v gps.Version) string {
 	if v == nil {
 		return ""
@@ -5,9 +5,20 @@
 package main
 
 import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 	"testing"
+	"text/tabwriter"
 
+	"github.com/golang/dep"
 	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
 )
 
 func TestStatusFormatVersion(t *testing.T) {
@@ -26,3 +37,345 @@ func TestStatusFormatVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestStatusTableOwners(t *testing.T) {
+	t.Parallel()
+
+	bs := &BasicStatus{
+		ProjectRoot:  "github.com/pkg/errors",
+		Constraint:   gps.Any(),
+		Version:      gps.NewVersion("v0.8.0"),
+		Revision:     gps.Revision("645ef00459ed84a119197bfb8d8205042c6df63d"),
+		PackageCount: 1,
+		Owner:        "platform-team",
+	}
+
+	for _, owners := range []bool{false, true} {
+		var buf bytes.Buffer
+		out := &tableOutput{
+			w:      tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0),
+			owners: owners,
+		}
+		out.BasicHeader()
+		out.BasicLine(bs)
+		out.BasicFooter()
+
+		got := buf.String()
+		if has := strings.Contains(got, "OWNER") && strings.Contains(got, "platform-team"); has != owners {
+			t.Errorf("owners=%v: unexpected table output:\n%s", owners, got)
+		}
+	}
+}
+
+func TestStatusJSON(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	c, err := gps.NewSemverConstraint("^0.8.0")
+	h.Must(err)
+	statuses := []*BasicStatus{
+		{
+			ProjectRoot:  "github.com/sdboyer/deptest",
+			Constraint:   c,
+			Version:      gps.NewVersion("v0.8.0"),
+			Revision:     gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+			Latest:       gps.NewVersion("v0.8.1"),
+			PackageCount: 1,
+		},
+		{
+			ProjectRoot:  "github.com/sdboyer/deptestdos",
+			Constraint:   gps.NewBranch("master"),
+			Version:      gps.NewBranch("master"),
+			Revision:     gps.Revision("5c607206be5decd28e6263ffffdcee067266015e"),
+			Latest:       gps.Revision("a0196baa11ea047dd65037287451d36b861b00ea"),
+			PackageCount: 2,
+			Owner:        "platform-team",
+		},
+		{
+			ProjectRoot:  "github.com/sdboyer/deptesttres",
+			Constraint:   gps.Any(),
+			Revision:     gps.Revision("54aaeb0023e1f3dcf5f98f31dd8c565457945a12"),
+			PackageCount: 1,
+		},
+	}
+
+	var buf bytes.Buffer
+	out := &jsonOutput{w: &buf}
+	out.BasicHeader()
+	for _, bs := range statuses {
+		out.BasicLine(bs)
+	}
+	out.BasicFooter()
+
+	goldenFile := "status/expected_json_output.json"
+	got := buf.String()
+	want := h.GetTestFileString(goldenFile)
+	if want != got {
+		if *test.UpdateGolden {
+			if err := h.WriteTestFile(goldenFile, got); err != nil {
+				t.Fatalf("%+v", errors.Wrapf(err, "Unable to write updated golden file %s", goldenFile))
+			}
+		} else {
+			t.Fatalf("expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestStatusDot(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile(filepath.Join("proj", "main.go"), "package main\n\nimport _ \"github.com/sdboyer/deptest\"\n")
+	p := &dep.Project{AbsRoot: h.Path("proj"), ImportRoot: "example.com/proj"}
+
+	var buf bytes.Buffer
+	out := &dotOutput{w: &buf, p: p}
+	out.BasicHeader()
+	out.BasicLine(&BasicStatus{
+		ProjectRoot: "github.com/sdboyer/deptest",
+		Version:     gps.NewVersion("v0.8.0"),
+		Revision:    gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+		Children:    []string{"github.com/sdboyer/deptest/internal", "github.com/sdboyer/deptestdos/sub"},
+	})
+	out.BasicLine(&BasicStatus{
+		ProjectRoot: "github.com/sdboyer/deptestdos",
+		Revision:    gps.Revision("5c607206be5decd28e6263ffffdcee067266015e"),
+		Children:    []string{"github.com/sdboyer/deptest"},
+	})
+	out.BasicLine(&BasicStatus{
+		ProjectRoot: "github.com/sdboyer/deptestdos/sub",
+		Version:     gps.NewBranch("master"),
+		Revision:    gps.Revision("a0196baa11ea047dd65037287451d36b861b00ea"),
+	})
+	out.BasicFooter()
+
+	labels := make(map[string]string)
+	for _, m := range regexp.MustCompile(`(?m)^\t(\d+) \[label="([^"]*)"\];$`).FindAllStringSubmatch(buf.String(), -1) {
+		labels[m[1]] = m[2]
+	}
+	var edges []string
+	for _, m := range regexp.MustCompile(`(?m)^\t(\d+) -> (\d+);$`).FindAllStringSubmatch(buf.String(), -1) {
+		edges = append(edges, labels[m[1]]+" -> "+labels[m[2]])
+	}
+
+	wantLabels := []string{
+		"example.com/proj",
+		`github.com/sdboyer/deptest\nv0.8.0`,
+		`github.com/sdboyer/deptestdos/sub\nbranch master`,
+		`github.com/sdboyer/deptestdos\n5c60720`,
+	}
+	var gotLabels []string
+	for _, l := range labels {
+		gotLabels = append(gotLabels, l)
+	}
+	sort.Strings(gotLabels)
+	if !reflect.DeepEqual(gotLabels, wantLabels) {
+		t.Errorf("expected nodes %q, got %q in:\n%s", wantLabels, gotLabels, buf.String())
+	}
+
+	// Packages within a nested project root belong to that project, and a
+	// project importing its own packages has no edge to itself.
+	wantEdges := []string{
+		`example.com/proj -> github.com/sdboyer/deptest\nv0.8.0`,
+		`github.com/sdboyer/deptest\nv0.8.0 -> github.com/sdboyer/deptestdos/sub\nbranch master`,
+		`github.com/sdboyer/deptestdos\n5c60720 -> github.com/sdboyer/deptest\nv0.8.0`,
+	}
+	sort.Strings(edges)
+	if !reflect.DeepEqual(edges, wantEdges) {
+		t.Errorf("expected edges %q, got %q in:\n%s", wantEdges, edges, buf.String())
+	}
+}
+
+func TestStatusFindUnusedProjects(t *testing.T) {
+	t.Parallel()
+
+	pkg := func(ip string, imports ...string) pkgtree.PackageOrErr {
+		return pkgtree.PackageOrErr{P: pkgtree.Package{ImportPath: ip, Name: "p", Imports: imports}}
+	}
+	tree := func(root string, pkgs ...pkgtree.PackageOrErr) pkgtree.PackageTree {
+		ptree := pkgtree.PackageTree{ImportRoot: root, Packages: make(map[string]pkgtree.PackageOrErr)}
+		for _, poe := range pkgs {
+			ptree.Packages[poe.P.ImportPath] = poe
+		}
+		return ptree
+	}
+
+	root := tree("example.com/root",
+		pkg("example.com/root", "fmt", "github.com/a/a/sub"),
+	)
+	rootTests := root.Packages["example.com/root"]
+	rootTests.P.TestImports = []string{"github.com/test/only"}
+	root.Packages["example.com/root"] = rootTests
+
+	trees := map[gps.ProjectRoot]pkgtree.PackageTree{
+		// a's root package imports c, but only a/sub is used.
+		"github.com/a/a": tree("github.com/a/a",
+			pkg("github.com/a/a", "github.com/c/c"),
+			pkg("github.com/a/a/sub", "github.com/b/b"),
+		),
+		"github.com/b/b":         tree("github.com/b/b", pkg("github.com/b/b", "os")),
+		"github.com/c/c":         tree("github.com/c/c", pkg("github.com/c/c")),
+		"github.com/test/only":   tree("github.com/test/only", pkg("github.com/test/only")),
+		"github.com/required/rq": tree("github.com/required/rq", pkg("github.com/required/rq")),
+		"github.com/stale/stale": tree("github.com/stale/stale", pkg("github.com/stale/stale", "github.com/b/b")),
+	}
+	listPackages := func(id gps.ProjectIdentifier, v gps.Version) (pkgtree.PackageTree, error) {
+		if ptree, has := trees[id.ProjectRoot]; has {
+			return ptree, nil
+		}
+		return pkgtree.PackageTree{}, errors.Errorf("no such project %s", id.ProjectRoot)
+	}
+
+	l := &dep.Lock{}
+	for pr := range trees {
+		l.P = append(l.P, gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: pr}, gps.NewVersion("v1.0.0"), []string{"."}))
+	}
+	m := &dep.Manifest{Required: []string{"github.com/required/rq"}}
+
+	got, err := findUnusedProjects(root, m, l, listPackages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"github.com/c/c", "github.com/stale/stale"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected unused projects:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+}
+
+func TestStatusFindProjectDepths(t *testing.T) {
+	t.Parallel()
+
+	pkg := func(ip string, imports ...string) pkgtree.PackageOrErr {
+		return pkgtree.PackageOrErr{P: pkgtree.Package{ImportPath: ip, Name: "p", Imports: imports}}
+	}
+	tree := func(root string, pkgs ...pkgtree.PackageOrErr) pkgtree.PackageTree {
+		ptree := pkgtree.PackageTree{ImportRoot: root, Packages: make(map[string]pkgtree.PackageOrErr)}
+		for _, poe := range pkgs {
+			ptree.Packages[poe.P.ImportPath] = poe
+		}
+		return ptree
+	}
+
+	root := tree("example.com/root",
+		pkg("example.com/root", "github.com/a/a", "github.com/e/e"),
+	)
+
+	// a -> b -> c -> d -> e; e is also imported directly, so it's shallow.
+	trees := map[gps.ProjectRoot]pkgtree.PackageTree{
+		"github.com/a/a": tree("github.com/a/a", pkg("github.com/a/a", "github.com/b/b")),
+		"github.com/b/b": tree("github.com/b/b", pkg("github.com/b/b", "github.com/c/c")),
+		"github.com/c/c": tree("github.com/c/c", pkg("github.com/c/c", "github.com/d/d/sub")),
+		"github.com/d/d": tree("github.com/d/d",
+			pkg("github.com/d/d"),
+			pkg("github.com/d/d/sub", "github.com/e/e"),
+		),
+		"github.com/e/e":         tree("github.com/e/e", pkg("github.com/e/e")),
+		"github.com/stale/stale": tree("github.com/stale/stale", pkg("github.com/stale/stale")),
+	}
+	listPackages := func(id gps.ProjectIdentifier, v gps.Version) (pkgtree.PackageTree, error) {
+		if ptree, has := trees[id.ProjectRoot]; has {
+			return ptree, nil
+		}
+		return pkgtree.PackageTree{}, errors.Errorf("no such project %s", id.ProjectRoot)
+	}
+
+	l := &dep.Lock{}
+	for pr := range trees {
+		l.P = append(l.P, gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: pr}, gps.NewVersion("v1.0.0"), []string{"."}))
+	}
+
+	got, err := findProjectDepths(root, &dep.Manifest{}, l, listPackages, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DepthStatus{
+		{ProjectRoot: "github.com/a/a", Depth: 1},
+		{ProjectRoot: "github.com/b/b", Depth: 2},
+		{ProjectRoot: "github.com/c/c", Depth: 3, TooDeep: true},
+		{ProjectRoot: "github.com/d/d", Depth: 4, TooDeep: true},
+		{ProjectRoot: "github.com/e/e", Depth: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected project depths:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+}
+
+func TestStatusProjectDepthsWithinProject(t *testing.T) {
+	t.Parallel()
+
+	pkg := func(ip string, imports ...string) pkgtree.PackageOrErr {
+		return pkgtree.PackageOrErr{P: pkgtree.Package{ImportPath: ip, Name: "p", Imports: imports}}
+	}
+	tree := func(root string, pkgs ...pkgtree.PackageOrErr) pkgtree.PackageTree {
+		ptree := pkgtree.PackageTree{ImportRoot: root, Packages: make(map[string]pkgtree.PackageOrErr)}
+		for _, poe := range pkgs {
+			ptree.Packages[poe.P.ImportPath] = poe
+		}
+		return ptree
+	}
+
+	root := tree("example.com/root", pkg("example.com/root", "github.com/a/a"))
+
+	// a reaches b through two of its own packages, and imports the project
+	// nested within it, which is a project of its own.
+	trees := map[gps.ProjectRoot]pkgtree.PackageTree{
+		"github.com/a/a": tree("github.com/a/a",
+			pkg("github.com/a/a", "github.com/a/a/x", "github.com/a/a/nested"),
+			pkg("github.com/a/a/x", "github.com/a/a/y"),
+			pkg("github.com/a/a/y", "github.com/b/b"),
+		),
+		"github.com/a/a/nested": tree("github.com/a/a/nested", pkg("github.com/a/a/nested")),
+		"github.com/b/b":        tree("github.com/b/b", pkg("github.com/b/b")),
+	}
+	listPackages := func(id gps.ProjectIdentifier, v gps.Version) (pkgtree.PackageTree, error) {
+		if ptree, has := trees[id.ProjectRoot]; has {
+			return ptree, nil
+		}
+		return pkgtree.PackageTree{}, errors.Errorf("no such project %s", id.ProjectRoot)
+	}
+
+	l := &dep.Lock{}
+	for pr := range trees {
+		l.P = append(l.P, gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: pr}, gps.NewVersion("v1.0.0"), []string{"."}))
+	}
+
+	got, err := projectDepths(root, &dep.Manifest{}, l, listPackages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[gps.ProjectRoot]int{
+		"github.com/a/a":        1,
+		"github.com/a/a/nested": 2,
+		"github.com/b/b":        2,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected project depths:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+}
+
+func TestStatusUnusedConstraints(t *testing.T) {
+	t.Parallel()
+
+	pp := gps.ProjectProperties{Constraint: gps.NewVersion("v1.0.0")}
+	m := &dep.Manifest{
+		Constraints: gps.ProjectConstraints{
+			"github.com/used/used":    pp,
+			"github.com/stale/b":      pp,
+			"github.com/stale/a":      pp,
+			"github.com/transitive/t": pp,
+		},
+		Ovr: gps.ProjectConstraints{"github.com/override/o": pp},
+	}
+	l := &dep.Lock{}
+	for _, pr := range []gps.ProjectRoot{"github.com/used/used", "github.com/transitive/t", "github.com/unconstrained/u"} {
+		l.P = append(l.P, gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: pr}, gps.NewVersion("v1.0.0"), []string{"."}))
+	}
+
+	want := []string{"github.com/stale/a", "github.com/stale/b"}
+	if got := unusedConstraints(m, l); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected unused constraints:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+	if got := unusedConstraints(m, &dep.Lock{}); len(got) != 4 {
+		t.Errorf("expected every constraint to be unused with an empty lock, got %v", got)
+	}
+}
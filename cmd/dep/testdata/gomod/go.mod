@@ -0,0 +1,15 @@
+module github.com/golang/notexist
+
+require (
+	github.com/sdboyer/deptest v1.0.0
+	github.com/sdboyer/deptestdos/v2 v2.0.0
+	github.com/sdboyer/deptesttres v0.0.0-20170915032832-a0196baa11ea
+	github.com/sdboyer/deptestquatro v0.0.0-20170101000000-0123456789ab
+	github.com/pkg/errors v0.8.0 // indirect
+)
+
+require golang.org/x/sys v0.0.0-20170915032832-14c0d48ead0c // indirect
+
+replace github.com/sdboyer/deptest => github.com/carolynvs/deptest v1.0.0
+
+replace example.com/local => ../local
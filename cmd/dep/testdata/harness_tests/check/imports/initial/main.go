@@ -0,0 +1,9 @@
+package main
+
+import (
+	_ "github.com/sdboyer/deptest"
+	_ "github.com/sdboyer/deptestdos"
+)
+
+func main() {
+}
@@ -0,0 +1,8 @@
+package main
+
+import (
+	_ "github.com/sdboyer/deptest"
+)
+
+func main() {
+}
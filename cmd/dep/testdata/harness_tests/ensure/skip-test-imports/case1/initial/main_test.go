@@ -0,0 +1,11 @@
+package main
+
+import (
+	"testing"
+
+	_ "github.com/sdboyer/deptest"
+	_ "github.com/sdboyer/deptestdos"
+)
+
+func TestMain(t *testing.T) {
+}
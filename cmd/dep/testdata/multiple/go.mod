@@ -0,0 +1,7 @@
+module github.com/golang/notexist
+
+require (
+	github.com/pkg/errors v0.8.0
+	github.com/sdboyer/deptest v0.0.0-20170101000000-ff2948a2ac8f
+	github.com/sdboyer/deptestdos v2.0.0+incompatible
+)
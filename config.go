@@ -0,0 +1,95 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// ConfigName is the name of the optional file, alongside the manifest, that
+// holds the project's defaults for dep's own settings, so that they can be
+// checked in rather than set on every machine.
+//
+// Each setting in it is overridden by the environment variable for the same
+// setting, which is in turn overridden by the flag:
+//
+//	cachedir  DEPCACHEDIR  -cachedir
+//	jobs      DEPJOBS      -jobs
+//	offline   DEPOFFLINE   -offline
+const ConfigName = ".depconfig.toml"
+
+// Config holds the settings read from a project's ConfigName file.
+type Config struct {
+	// CacheDir is the directory in which dependency sources are cached, in
+	// place of $GOPATH/pkg/dep. It is relative to the project root unless it
+	// is absolute.
+	CacheDir string
+	// Jobs limits the operations run at once against sources; 0 for no limit.
+	Jobs int
+	// Offline keeps dep from going to the network, so that it must make do
+	// with the sources already in the cache.
+	Offline bool
+}
+
+type rawConfig struct {
+	CacheDir string `toml:"cachedir,omitempty"`
+	Jobs     int    `toml:"jobs,omitempty"`
+	Offline  bool   `toml:"offline,omitempty"`
+}
+
+// loadConfig reads the ConfigName file in the project root dir, if there is
+// one. A nil Config is returned if there isn't.
+func loadConfig(dir string) (*Config, error) {
+	path := filepath.Join(dir, ConfigName)
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "unable to open %s", path)
+	}
+	defer f.Close()
+
+	c, err := readConfig(f)
+	if err != nil {
+		return nil, errors.Errorf("error while parsing %s: %s", path, err)
+	}
+	if c.CacheDir != "" {
+		c.CacheDir = filepath.FromSlash(c.CacheDir)
+		if !filepath.IsAbs(c.CacheDir) {
+			c.CacheDir = filepath.Join(dir, c.CacheDir)
+		}
+	}
+	return c, nil
+}
+
+func readConfig(r io.Reader) (*Config, error) {
+	buf := &bytes.Buffer{}
+	_, err := buf.ReadFrom(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read byte stream")
+	}
+
+	raw := rawConfig{}
+	err = toml.Unmarshal(buf.Bytes(), &raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the config as TOML")
+	}
+	if raw.Jobs < 0 {
+		return nil, errors.Errorf("invalid jobs %d; must be 0, for no limit, or more", raw.Jobs)
+	}
+
+	return &Config{
+		CacheDir: raw.CacheDir,
+		Jobs:     raw.Jobs,
+		Offline:  raw.Offline,
+	}, nil
+}
@@ -5,15 +5,21 @@
 package dep
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Masterminds/vcs"
 	"github.com/golang/dep/internal/fs"
 	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
 	"github.com/pkg/errors"
 )
 
@@ -22,6 +28,40 @@ type Ctx struct {
 	GOPATH     string   // Selected Go path
 	GOPATHS    []string // Other Go paths
 	WorkingDir string
+	HostTokens map[string]string // Access tokens for source hosts, by hostname
+	CACertFile string            // Bundle of additional CAs to trust for HTTPS
+	CACertOnly bool              // Whether to trust only the CAs in CACertFile
+	CredHelper string            // Command that provides credentials for HTTPS hosts
+	GitLFS     bool              // Whether to export the content of Git LFS files
+	CloneDepth int               // Commits of history to clone for git sources; 0 for all
+
+	// VCSConcurrency limits the operations run at once against sources of
+	// each VCS type, such as "hg", or scheme of a registered source backend;
+	// types it doesn't map are unlimited.
+	VCSConcurrency map[string]int
+
+	// CloneTimeout limits each clone or fetch of a source, and MetaTimeout
+	// each HTTP request for metadata used to deduce sources; 0 for no limit.
+	CloneTimeout time.Duration
+	MetaTimeout  time.Duration
+
+	// CacheDir, if set, is where dependency sources are cached, in place of
+	// $GOPATH/pkg/dep. Jobs limits the operations run at once against
+	// sources; 0 for no limit. Offline keeps source managers off the network.
+	// Each is taken from the project's ConfigName file, unless it is
+	// overridden by the environment, or afterwards by the caller.
+	CacheDir string
+	Jobs     int
+	Offline  bool
+
+	// MetadataTTL is how long the version lists of sources are cached on
+	// disk, and used in place of listing them upstream; 0 disables the cache.
+	MetadataTTL time.Duration
+
+	// ValidateSolution, if set, is called with the lock for each new solution
+	// before anything is written. If it returns an error, nothing is written.
+	ValidateSolution func(*Lock) error
+
 	*Loggers
 }
 
@@ -34,12 +74,19 @@ type Loggers struct {
 
 // NewContext creates a struct with the project's GOPATH. It assumes
 // that of your "GOPATH"'s we want the one we are currently in.
+//
+// The GOPATH, and the home directory it defaults to, are taken from env
+// alone, never from the process's own environment, so that contexts for
+// different GOPATHs can be used side by side.
+//
+// If the project containing wd has a ConfigName file, the settings in it are
+// recorded in the context, unless env sets them too.
 func NewContext(wd string, env []string, loggers *Loggers) (*Ctx, error) {
 	ctx := &Ctx{WorkingDir: wd, Loggers: loggers}
 
 	GOPATH := getEnv(env, "GOPATH")
 	if GOPATH == "" {
-		GOPATH = defaultGOPATH()
+		GOPATH = defaultGOPATH(env)
 	}
 	for _, gp := range filepath.SplitList(GOPATH) {
 		gp = filepath.FromSlash(gp)
@@ -55,9 +102,117 @@ func NewContext(wd string, env []string, loggers *Loggers) (*Ctx, error) {
 		return nil, errors.New("project not in a GOPATH")
 	}
 
+	tokens, err := parseHostTokens(getEnv(env, "GITHUB_TOKEN"), getEnv(env, "DEPHOSTTOKENS"))
+	if err != nil {
+		return nil, err
+	}
+	ctx.HostTokens = tokens
+	ctx.CACertFile = getEnv(env, "DEPCACERT")
+	ctx.CredHelper = getEnv(env, "DEPCREDENTIALHELPER")
+
+	limits, err := parseVCSConcurrency(getEnv(env, "DEPVCSCONCURRENCY"))
+	if err != nil {
+		return nil, err
+	}
+	ctx.VCSConcurrency = limits
+
+	if err := ctx.loadSettings(env); err != nil {
+		return nil, err
+	}
+
 	return ctx, nil
 }
 
+// loadSettings records the settings of the ConfigName file in the project
+// containing c.WorkingDir, if there is one, and then those of env, which take
+// precedence.
+func (c *Ctx) loadSettings(env []string) error {
+	if root, err := findProjectRoot(c.WorkingDir); err == nil {
+		conf, err := loadConfig(root)
+		if err != nil {
+			return err
+		}
+		if conf != nil {
+			c.CacheDir = conf.CacheDir
+			c.Jobs = conf.Jobs
+			c.Offline = conf.Offline
+		}
+	}
+
+	if dir := getEnv(env, "DEPCACHEDIR"); dir != "" {
+		c.CacheDir = dir
+	}
+	if s := getEnv(env, "DEPJOBS"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return errors.Errorf("invalid DEPJOBS %q; must be 0, for no limit, or more", s)
+		}
+		c.Jobs = n
+	}
+	if s := getEnv(env, "DEPOFFLINE"); s != "" {
+		offline, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.Errorf("invalid DEPOFFLINE %q; must be true or false", s)
+		}
+		c.Offline = offline
+	}
+	return nil
+}
+
+// parseHostTokens builds the map of access tokens for source hosts. The
+// github token, if any, applies to github.com. hostTokens is a comma-separated
+// list of host=token pairs; a token given there for github.com takes
+// precedence over the github token.
+func parseHostTokens(githubToken, hostTokens string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	if githubToken != "" {
+		tokens["github.com"] = githubToken
+	}
+
+	for _, pair := range strings.Split(hostTokens, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, errors.Errorf("invalid host token %q in DEPHOSTTOKENS, expected host=token", pair)
+		}
+		tokens[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	return tokens, nil
+}
+
+// parseVCSConcurrency builds the map of concurrency limits for VCS types from a
+// comma-separated list of vcs=n pairs, such as "git=8,hg=2".
+func parseVCSConcurrency(s string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, errors.Errorf("invalid VCS concurrency %q in DEPVCSCONCURRENCY, expected vcs=n", pair)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || n < 1 {
+			return nil, errors.Errorf("invalid VCS concurrency %q in DEPVCSCONCURRENCY, n must be at least 1", pair)
+		}
+		limits[strings.TrimSpace(kv[0])] = n
+	}
+
+	if len(limits) == 0 {
+		return nil, nil
+	}
+	return limits, nil
+}
+
 // getEnv returns the last instance of an environment variable.
 func getEnv(env []string, key string) string {
 	for i := len(env) - 1; i >= 0; i-- {
@@ -75,14 +230,14 @@ func getEnv(env []string, key string) string {
 
 // defaultGOPATH gets the default GOPATH that was added in 1.8
 // copied from go/build/build.go
-func defaultGOPATH() string {
+func defaultGOPATH(environ []string) string {
 	env := "HOME"
 	if runtime.GOOS == "windows" {
 		env = "USERPROFILE"
 	} else if runtime.GOOS == "plan9" {
 		env = "home"
 	}
-	if home := os.Getenv(env); home != "" {
+	if home := getEnv(environ, env); home != "" {
 		def := filepath.Join(home, "go")
 		if def == runtime.GOROOT() {
 			// Don't set the default GOPATH to GOROOT,
@@ -94,8 +249,105 @@ func defaultGOPATH() string {
 	return ""
 }
 
-func (c *Ctx) SourceManager() (*gps.SourceMgr, error) {
-	return gps.NewSourceManager(filepath.Join(c.GOPATH, "pkg", "dep"))
+// Cachedir returns the directory in which dep keeps its cache of dependency
+// sources: CacheDir, if it is set, or $GOPATH/pkg/dep.
+func (c *Ctx) Cachedir() string {
+	if c.CacheDir != "" {
+		return c.CacheDir
+	}
+	return filepath.Join(c.GOPATH, "pkg", "dep")
+}
+
+// ListPackages lists the packages of the tree at root, under the import path
+// importRoot, as pkgtree.ListPackages does. What an earlier run found is kept
+// in the cache dir, so that only the directories that have changed since
+// are read again.
+func (c *Ctx) ListPackages(root, importRoot string) (pkgtree.PackageTree, error) {
+	sum := sha256.Sum256([]byte(root))
+	path := filepath.Join(c.Cachedir(), "packages", hex.EncodeToString(sum[:])+".json")
+
+	pc := pkgtree.LoadPackageCache(path)
+	ptree, err := pc.ListPackages(root, importRoot)
+	if err != nil {
+		return ptree, err
+	}
+	// The cache only saves time; failing to write it fails nothing.
+	if err := pc.Save(path); err != nil && c.Verbose {
+		c.Err.Println(err)
+	}
+	return ptree, nil
+}
+
+// SourceManager produces an instance of gps's built-in SourceManager
+// initialized to log to the receiver's logger. If p isn't nil, the sources
+// are also set up as its manifest asks: with the VCS types it forces, its
+// clone depths and ref namespaces, its requirements for signed tags and its
+// source mirrors.
+func (c *Ctx) SourceManager(p *Project) (*gps.SourceMgr, error) {
+	if c.CACertOnly && c.CACertFile == "" {
+		return nil, errors.New("a CA bundle must be given with -cacert or DEPCACERT to trust only its authorities")
+	}
+	if c.CloneDepth < 0 {
+		return nil, errors.Errorf("invalid clone depth %d; must be 0, for the full history, or more", c.CloneDepth)
+	}
+	if c.CloneTimeout < 0 || c.MetaTimeout < 0 {
+		return nil, errors.New("invalid timeout; must be 0, for no limit, or more")
+	}
+	if c.MetadataTTL < 0 {
+		return nil, errors.New("invalid cache TTL; must be 0, for no caching, or more")
+	}
+	if c.Jobs < 0 {
+		return nil, errors.Errorf("invalid number of jobs %d; must be 0, for no limit, or more", c.Jobs)
+	}
+
+	var certs []byte
+	if c.CACertFile != "" {
+		var err error
+		certs, err = ioutil.ReadFile(c.CACertFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read CA bundle")
+		}
+	}
+
+	var logger *log.Logger
+	if c.Verbose {
+		logger = c.Err
+	}
+
+	config := gps.SourceManagerConfig{
+		Cachedir:         c.Cachedir(),
+		HostTokens:       c.HostTokens,
+		CACerts:          certs,
+		CACertsOnly:      c.CACertOnly,
+		CredentialHelper: c.CredHelper,
+		GitLFS:           c.GitLFS,
+		GitCloneDepth:    c.CloneDepth,
+		VCSConcurrency:   c.VCSConcurrency,
+		CloneTimeout:     c.CloneTimeout,
+		MetaTimeout:      c.MetaTimeout,
+		Jobs:             c.Jobs,
+		Offline:          c.Offline,
+		MetadataTTL:      c.MetadataTTL,
+		Logger:           logger,
+	}
+	if p != nil {
+		m := p.Manifest
+		config.VCSTypes = m.VCSTypes()
+		config.GitCloneDepths = m.CloneDepths()
+		config.GitRefNamespaces = m.RefNamespaces()
+		config.GitSignedTags = m.RequireSignedTags
+		config.GitSignedTagSources = m.SignedTagSources()
+		config.Mirrors = m.Mirrors
+		if m.Keyring != "" {
+			// The keyring is given relative to the manifest.
+			config.GitKeyring = filepath.FromSlash(m.Keyring)
+			if !filepath.IsAbs(config.GitKeyring) {
+				config.GitKeyring = filepath.Join(p.AbsRoot, config.GitKeyring)
+			}
+		}
+	}
+
+	return gps.NewSourceManager(config)
 }
 
 // LoadProject starts from the current working directory and searches up the
@@ -148,6 +400,17 @@ func (c *Ctx) LoadProject() (*Project, error) {
 		return nil, errors.Errorf("error while parsing %s: %s", mp, err)
 	}
 
+	mdp := filepath.Join(p.AbsRoot, MetadataName)
+	if mdf, err := os.Open(mdp); err == nil {
+		defer mdf.Close()
+		p.Metadata, err = readMetadata(mdf)
+		if err != nil {
+			return nil, errors.Errorf("error while parsing %s: %s", mdp, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Errorf("could not open %s: %s", mdp, err)
+	}
+
 	lp := filepath.Join(p.AbsRoot, LockName)
 	lf, err := os.Open(lp)
 	if err != nil {
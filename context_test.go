@@ -9,12 +9,15 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 	"unicode"
 
 	"github.com/golang/dep/internal/gps"
+	"github.com/golang/dep/internal/gps/pkgtree"
 	"github.com/golang/dep/internal/test"
 )
 
@@ -45,6 +48,120 @@ func TestNewContextNoGOPATH(t *testing.T) {
 	}
 }
 
+func TestNewContextHostTokens(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("src")
+	wd := h.Path("src")
+
+	env := []string{
+		"GOPATH=" + h.Path("."),
+		"GITHUB_TOKEN=ghtoken",
+		"DEPHOSTTOKENS=git.example.com=exampletoken, git.example.com:8443=porttoken",
+	}
+	c, err := NewContext(wd, env, discardLoggers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"github.com":           "ghtoken",
+		"git.example.com":      "exampletoken",
+		"git.example.com:8443": "porttoken",
+	}
+	if !reflect.DeepEqual(c.HostTokens, want) {
+		t.Fatalf("unexpected host tokens:\n\t(GOT) %v\n\t(WNT) %v", c.HostTokens, want)
+	}
+
+	// A github.com entry in DEPHOSTTOKENS wins over GITHUB_TOKEN.
+	env = append(env, "DEPHOSTTOKENS=github.com=override")
+	c, err = NewContext(wd, env, discardLoggers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.HostTokens["github.com"] != "override" {
+		t.Fatalf("expected DEPHOSTTOKENS to override GITHUB_TOKEN, got %q", c.HostTokens["github.com"])
+	}
+
+	env = append(env, "DEPHOSTTOKENS=github.com")
+	if _, err = NewContext(wd, env, discardLoggers); err == nil {
+		t.Fatal("expected an error for a malformed DEPHOSTTOKENS entry")
+	}
+}
+
+func TestNewContextVCSConcurrency(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("src")
+	wd := h.Path("src")
+
+	env := []string{
+		"GOPATH=" + h.Path("."),
+		"DEPVCSCONCURRENCY=git=8, hg=2",
+	}
+	c, err := NewContext(wd, env, discardLoggers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{"git": 8, "hg": 2}
+	if !reflect.DeepEqual(c.VCSConcurrency, want) {
+		t.Fatalf("unexpected VCS concurrency:\n\t(GOT) %v\n\t(WNT) %v", c.VCSConcurrency, want)
+	}
+
+	for _, bad := range []string{"hg", "hg=0", "hg=x", "=2"} {
+		if _, err = NewContext(wd, append(env, "DEPVCSCONCURRENCY="+bad), discardLoggers); err == nil {
+			t.Errorf("expected an error for DEPVCSCONCURRENCY=%s", bad)
+		}
+	}
+}
+
+func TestNewContextConfig(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile(filepath.Join("src", "proj", ManifestName), "")
+	h.TempFile(filepath.Join("src", "proj", ConfigName), `cachedir = "cache"
+jobs = 4
+offline = true
+`)
+	h.TempDir(filepath.Join("src", "proj", "sub"))
+	root := h.Path(filepath.Join("src", "proj"))
+	env := []string{"GOPATH=" + h.Path(".")}
+
+	// The config is found from anywhere in the project.
+	c, err := NewContext(filepath.Join(root, "sub"), env, discardLoggers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Cachedir() != filepath.Join(root, "cache") || c.Jobs != 4 || !c.Offline {
+		t.Fatalf("expected the config's settings, got cachedir %s, %d jobs, offline %v", c.Cachedir(), c.Jobs, c.Offline)
+	}
+
+	// The environment takes precedence.
+	elsewhere := filepath.Join(h.Path("."), "elsewhere")
+	env = append(env, "DEPCACHEDIR="+elsewhere, "DEPJOBS=2", "DEPOFFLINE=false")
+	if c, err = NewContext(root, env, discardLoggers); err != nil {
+		t.Fatal(err)
+	}
+	if c.Cachedir() != elsewhere || c.Jobs != 2 || c.Offline {
+		t.Fatalf("expected the environment's settings, got cachedir %s, %d jobs, offline %v", c.Cachedir(), c.Jobs, c.Offline)
+	}
+
+	for _, bad := range []string{"DEPJOBS=-1", "DEPJOBS=x", "DEPOFFLINE=maybe"} {
+		if _, err = NewContext(root, append(env, bad), discardLoggers); err == nil {
+			t.Errorf("expected an error for %s", bad)
+		}
+	}
+
+	h.TempFile(filepath.Join("src", "proj", ConfigName), "jobs = -1\n")
+	if _, err = NewContext(root, env[:1], discardLoggers); err == nil {
+		t.Error("expected an error for a negative number of jobs in the config")
+	}
+}
+
 func TestSplitAbsoluteProjectRoot(t *testing.T) {
 	h := test.NewHelper(t)
 	defer h.Cleanup()
@@ -215,6 +332,74 @@ func TestLoadProject(t *testing.T) {
 	}
 }
 
+func TestSourceManagerManifestSettings(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("cache")
+	ctx := &Ctx{GOPATH: h.Path("."), CacheDir: h.Path("cache"), Loggers: discardLoggers}
+
+	// Signed tags can't be required without a keyring to check them
+	// against, so the manifest's settings must reach the source manager.
+	p := &Project{AbsRoot: h.Path("."), Manifest: &Manifest{RequireSignedTags: true}}
+	if sm, err := ctx.SourceManager(p); err == nil {
+		sm.Release()
+		t.Fatal("expected an error requiring signed tags without a keyring")
+	}
+
+	// Without a project, none of them apply.
+	sm, err := ctx.SourceManager(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.Release()
+}
+
+func TestLoadProjectMetadata(t *testing.T) {
+	tg := test.NewHelper(t)
+	defer tg.Cleanup()
+
+	tg.TempDir("src")
+	tg.TempDir("src/test1")
+	tg.TempFile(filepath.Join("src/test1", ManifestName), "")
+	tg.TempFile(filepath.Join("src/test1", MetadataName), `github.com/pkg/errors:
+  owner: platform-team
+  description: Error wrapping
+  review: approved
+github.com/sdboyer/deptest:
+  owner: build-team
+`)
+	tg.Setenv("GOPATH", tg.Path("."))
+
+	ctx := &Ctx{GOPATH: tg.Path("."), WorkingDir: tg.Path("src/test1"), Loggers: discardLoggers}
+	proj, err := ctx.LoadProject()
+	if err != nil {
+		t.Fatalf("LoadProject failed: %+v", err)
+	}
+
+	want := map[gps.ProjectRoot]DependencyMetadata{
+		"github.com/pkg/errors": {
+			Owner:       "platform-team",
+			Description: "Error wrapping",
+			Review:      "approved",
+		},
+		"github.com/sdboyer/deptest": {Owner: "build-team"},
+	}
+	if !reflect.DeepEqual(proj.Metadata, want) {
+		t.Errorf("expected metadata %#v, got %#v", want, proj.Metadata)
+	}
+
+	// Metadata must not leak into anything that feeds the solver.
+	if len(proj.Manifest.Constraints) != 0 || len(proj.Manifest.Ovr) != 0 {
+		t.Error("expected dependency metadata to leave the manifest alone")
+	}
+
+	tg.TempFile(filepath.Join("src/test1", MetadataName), "github.com/pkg/errors: [")
+	if _, err := ctx.LoadProject(); err == nil {
+		t.Error("expected an error for malformed dependency metadata")
+	}
+}
+
 func TestLoadProjectNotFoundErrors(t *testing.T) {
 	tg := test.NewHelper(t)
 	defer tg.Cleanup()
@@ -444,3 +629,44 @@ func TestResolveProjectRoot(t *testing.T) {
 		})
 	}
 }
+
+func TestCtxListPackages(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile(filepath.Join("src", "proj", "main.go"), "package main\n\nimport \"github.com/foo/bar\"\n")
+	h.TempFile(filepath.Join("src", "proj", "sub", "sub.go"), "package sub\n")
+	root := h.Path(filepath.Join("src", "proj"))
+	cachedir := filepath.Join(h.Path("."), "cache")
+
+	// Each listing stands in for a separate run, sharing only the cache dir.
+	list := func() {
+		ctx := &Ctx{GOPATH: h.Path("."), CacheDir: cachedir, Loggers: discardLoggers}
+		got, err := ctx.ListPackages(root, "proj")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := pkgtree.ListPackages(root, "proj")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("cached listing differs from full listing:\n\t(GOT) %#v\n\t(WNT) %#v", got, want)
+		}
+	}
+
+	list()
+	saved, err := filepath.Glob(filepath.Join(cachedir, "packages", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 {
+		t.Fatalf("expected the packages to be saved in the cache dir, got %v", saved)
+	}
+
+	list()
+	h.TempFile(filepath.Join("src", "proj", "sub", "sub.go"), "package sub\n\nimport \"github.com/baz/qux\"\n")
+	future := time.Now().Add(time.Minute)
+	h.Must(os.Chtimes(filepath.Join(root, "sub", "sub.go"), future, future))
+	list()
+}
@@ -0,0 +1,190 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/dep/internal/fs"
+)
+
+// A Diagnosis is the outcome of one of the checks made by Diagnose.
+type Diagnosis struct {
+	Check  string // What was checked, such as "GOPATH"
+	OK     bool   // Whether the check passed
+	Detail string // What was found
+	Hint   string // How to remedy a failure
+}
+
+// Diagnose checks the setup that dep runs in from the working directory wd,
+// with the environment env:
+//
+//  - wd must be under the src directory of a GOPATH
+//  - the source cache in that GOPATH must be writable
+//  - git must be installed; hg and bzr are only reported on, as only
+//    dependencies hosted in them need them
+//  - the manifest and lock of the project containing wd, if any, must parse
+//
+// Unlike NewContext, it works where dep can't otherwise run, so that it can
+// tell why.
+func Diagnose(wd string, env []string) []Diagnosis {
+	var ds []Diagnosis
+
+	GOPATH := getEnv(env, "GOPATH")
+	if GOPATH == "" {
+		GOPATH = defaultGOPATH(env)
+	}
+	gopaths := filepath.SplitList(GOPATH)
+	gopath := ""
+	for _, gp := range gopaths {
+		if fs.HasFilepathPrefix(filepath.FromSlash(wd), filepath.Join(filepath.FromSlash(gp), "src")) {
+			gopath = filepath.FromSlash(gp)
+			break
+		}
+	}
+
+	switch {
+	case len(gopaths) == 0:
+		ds = append(ds, Diagnosis{
+			Check:  "GOPATH",
+			Detail: "GOPATH is not set, and there is no home directory to default it to",
+			Hint:   "set GOPATH, or pass -gopath",
+		})
+	case gopath == "":
+		ds = append(ds, Diagnosis{
+			Check:  "GOPATH",
+			Detail: fmt.Sprintf("%s is not under the src directory of any GOPATH (%s)", wd, strings.Join(gopaths, string(os.PathListSeparator))),
+			Hint:   "move the project to $GOPATH/src/<import path>, or set GOPATH, or pass -gopath, to include it",
+		})
+	default:
+		ds = append(ds, Diagnosis{
+			Check:  "GOPATH",
+			OK:     true,
+			Detail: fmt.Sprintf("%s is in GOPATH %s", wd, gopath),
+		})
+	}
+
+	// The cache is in the GOPATH of the project, or else the first one.
+	if gopath == "" && len(gopaths) > 0 {
+		gopath = filepath.FromSlash(gopaths[0])
+	}
+	if gopath != "" {
+		ds = append(ds, diagnoseCache(filepath.Join(gopath, "pkg", "dep")))
+	}
+
+	ds = append(ds, diagnoseVCS("git", true), diagnoseVCS("hg", false), diagnoseVCS("bzr", false))
+
+	return append(ds, diagnoseProjectFiles(wd)...)
+}
+
+// diagnoseCache checks that files can be created in the cache directory dir.
+func diagnoseCache(dir string) Diagnosis {
+	d := Diagnosis{Check: "cache"}
+
+	err := os.MkdirAll(filepath.Join(dir, "sources"), 0777)
+	if err == nil {
+		var f *os.File
+		f, err = ioutil.TempFile(dir, ".doctor")
+		if err == nil {
+			f.Close()
+			err = os.Remove(f.Name())
+		}
+	}
+	if err != nil {
+		d.Detail = fmt.Sprintf("%s is not writable: %s", dir, err)
+		d.Hint = "fix the permissions of the directory, or remove it so dep can recreate it"
+		return d
+	}
+
+	d.OK = true
+	d.Detail = fmt.Sprintf("%s is writable", dir)
+	if _, err := os.Stat(filepath.Join(dir, "sm.lock")); err == nil {
+		d.Detail += ", but locked by sm.lock"
+		d.Hint = "if no other dep is running, a previous one crashed; remove " + filepath.Join(dir, "sm.lock")
+	}
+	return d
+}
+
+// diagnoseVCS checks that the VCS binary name is installed. Its absence is only
+// a failure if it is required.
+func diagnoseVCS(name string, required bool) Diagnosis {
+	d := Diagnosis{Check: name}
+	path, err := exec.LookPath(name)
+	if err == nil {
+		d.OK = true
+		d.Detail = "found at " + path
+		return d
+	}
+
+	d.OK = !required
+	if required {
+		d.Detail = name + " is not installed"
+	} else {
+		d.Detail = fmt.Sprintf("%s is not installed; it is only needed for dependencies hosted in %s", name, name)
+	}
+	d.Hint = fmt.Sprintf("install %s, and make sure it is in PATH", name)
+	return d
+}
+
+// diagnoseProjectFiles checks that the manifest and lock of the project
+// containing dir parse.
+func diagnoseProjectFiles(dir string) []Diagnosis {
+	root, err := findProjectRoot(dir)
+	if err == errProjectNotFound {
+		return []Diagnosis{{
+			Check:  ManifestName,
+			Detail: fmt.Sprintf("no %s found in %s or any of its parents", ManifestName, dir),
+			Hint:   "run dep init to create one",
+		}}
+	}
+	if err != nil {
+		return []Diagnosis{{Check: ManifestName, Detail: err.Error()}}
+	}
+
+	md := Diagnosis{Check: ManifestName}
+	mp := filepath.Join(root, ManifestName)
+	if mf, err := os.Open(mp); err != nil {
+		md.Detail = err.Error()
+	} else {
+		_, warns, err := readManifest(mf)
+		mf.Close()
+		if err != nil {
+			md.Detail = fmt.Sprintf("%s does not parse: %s", mp, err)
+			md.Hint = "fix the error, or run dep init again in a copy of the project to compare"
+		} else {
+			md.OK = true
+			md.Detail = mp + " parses"
+			if len(warns) > 0 {
+				md.Detail += fmt.Sprintf(", with %d warning(s): %s", len(warns), warns[0])
+			}
+		}
+	}
+
+	ld := Diagnosis{Check: LockName}
+	lp := filepath.Join(root, LockName)
+	if lf, err := os.Open(lp); os.IsNotExist(err) {
+		ld.OK = true
+		ld.Detail = fmt.Sprintf("there is no %s yet; dep ensure will write one", LockName)
+	} else if err != nil {
+		ld.Detail = err.Error()
+	} else {
+		_, err := readLock(lf)
+		lf.Close()
+		if err != nil {
+			ld.Detail = fmt.Sprintf("%s does not parse: %s", lp, err)
+			ld.Hint = fmt.Sprintf("remove %s and run dep ensure to write it again", LockName)
+		} else {
+			ld.OK = true
+			ld.Detail = lp + " parses"
+		}
+	}
+
+	return []Diagnosis{md, ld}
+}
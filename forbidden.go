@@ -0,0 +1,118 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+// A ForbiddenImport is an import of a forbidden package by one of the
+// project's files.
+type ForbiddenImport struct {
+	// File is the path of the importing file, relative to the project root.
+	File string
+	// ImportPath is the forbidden package imported.
+	ImportPath string
+}
+
+// FindForbiddenImports returns the imports, by the files of the project
+// rooted at root, of the forbidden packages or of any package below them,
+// sorted by file. ptree is the project's package tree; the files of test
+// packages are included.
+func FindForbiddenImports(root string, ptree pkgtree.PackageTree, forbidden []string) ([]ForbiddenImport, error) {
+	if len(forbidden) == 0 {
+		return nil, nil
+	}
+	isForbidden := func(ip string) bool {
+		for _, f := range forbidden {
+			if ip == f || strings.HasPrefix(ip, f+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	var found []ForbiddenImport
+	for ip, poe := range ptree.Packages {
+		if poe.Err != nil {
+			continue
+		}
+
+		// Only parse the files of packages that import something forbidden.
+		var imports bool
+		for _, imp := range append(poe.P.Imports, poe.P.TestImports...) {
+			if isForbidden(imp) {
+				imports = true
+				break
+			}
+		}
+		if !imports {
+			continue
+		}
+
+		rel := filepath.FromSlash(strings.TrimPrefix(strings.TrimPrefix(ip, ptree.ImportRoot), "/"))
+		dir := filepath.Join(root, rel)
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read package %s", ip)
+		}
+		for _, fi := range fis {
+			if fi.IsDir() || filepath.Ext(fi.Name()) != ".go" {
+				continue
+			}
+			f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, fi.Name()), nil, parser.ImportsOnly)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to parse the imports of %s", filepath.Join(rel, fi.Name()))
+			}
+			for _, spec := range f.Imports {
+				imp, err := strconv.Unquote(spec.Path.Value)
+				if err == nil && isForbidden(imp) {
+					found = append(found, ForbiddenImport{File: filepath.Join(rel, fi.Name()), ImportPath: imp})
+				}
+			}
+		}
+	}
+
+	sort.Sort(sortedForbiddenImports(found))
+	return found, nil
+}
+
+// CheckForbiddenImports returns an error naming every file of the project
+// that imports one of the packages forbidden by its manifest.
+func (p *Project) CheckForbiddenImports(ptree pkgtree.PackageTree) error {
+	found, err := FindForbiddenImports(p.AbsRoot, ptree, p.Manifest.ForbiddenPackages)
+	if err != nil || len(found) == 0 {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "forbidden packages are imported:")
+	for _, fi := range found {
+		fmt.Fprintf(&buf, "\n\t%s imports %s", fi.File, fi.ImportPath)
+	}
+	return errors.New(buf.String())
+}
+
+type sortedForbiddenImports []ForbiddenImport
+
+func (s sortedForbiddenImports) Len() int      { return len(s) }
+func (s sortedForbiddenImports) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s sortedForbiddenImports) Less(i, j int) bool {
+	if s[i].File != s[j].File {
+		return s[i].File < s[j].File
+	}
+	return s[i].ImportPath < s[j].ImportPath
+}
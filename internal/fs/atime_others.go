@@ -0,0 +1,18 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux,!darwin
+
+package fs
+
+import (
+	"os"
+	"time"
+)
+
+// atime returns the modification time of the file described by fi, as its
+// access time isn't known on this platform.
+func atime(fi os.FileInfo) time.Time {
+	return fi.ModTime()
+}
@@ -0,0 +1,52 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// sysClonefileat is the number of the clonefileat system call, which the
+// syscall package doesn't define; atFDCWD and cloneNoFollow are the AT_FDCWD
+// file descriptor and the CLONE_NOFOLLOW flag, as defined in sys/fcntl.h and
+// sys/clonefile.h.
+const (
+	sysClonefileat = 462
+	atFDCWD        = -2
+	cloneNoFollow  = 0x1
+)
+
+// clonefile makes dst, which must not exist yet, a copy-on-write clone of the
+// file src with clonefile(2), as APFS supports. The clone has the mode and
+// extended attributes of src. On anything else, when src and dst live on
+// different filesystems, or when dst exists, errReflinkUnsupported is returned
+// so that the caller can fall back to a regular copy.
+func clonefile(src, dst string) error {
+	ps, err := syscall.BytePtrFromString(src)
+	if err != nil {
+		return err
+	}
+	pd, err := syscall.BytePtrFromString(dst)
+	if err != nil {
+		return err
+	}
+
+	cwd := atFDCWD
+	_, _, errno := syscall.Syscall6(sysClonefileat,
+		uintptr(cwd), uintptr(unsafe.Pointer(ps)),
+		uintptr(cwd), uintptr(unsafe.Pointer(pd)),
+		cloneNoFollow, 0)
+	switch errno {
+	case 0:
+		return nil
+	case syscall.ENOTSUP, syscall.EXDEV, syscall.ENOSYS, syscall.EINVAL, syscall.EEXIST:
+		// An existing dst is overwritten by a regular copy instead.
+		return errReflinkUnsupported
+	default:
+		return &os.LinkError{Op: "clonefile", Old: src, New: dst, Err: errno}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClonefile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	want := "hello world"
+	srcpath := filepath.Join(dir, "src")
+	if err = ioutil.WriteFile(srcpath, []byte(want), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dstpath := filepath.Join(dir, "dst")
+	err = clonefile(srcpath, dstpath)
+	if err == errReflinkUnsupported {
+		t.Skipf("filesystem backing %s does not support clonefile", dir)
+	}
+	if err != nil {
+		t.Fatalf("expected clonefile to succeed, got %s", err)
+	}
+
+	got, err := ioutil.ReadFile(dstpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want != string(got) {
+		t.Fatalf("expected: %s, got: %s", want, string(got))
+	}
+
+	// An existing file can't be cloned over, so CopyFile falls back to a
+	// regular copy.
+	if err = ioutil.WriteFile(srcpath, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = CopyFile(srcpath, dstpath); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = ioutil.ReadFile(dstpath); err != nil || string(got) != "changed" {
+		t.Fatalf("expected the copy to be overwritten, got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,13 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !darwin
+
+package fs
+
+// clonefile is only implemented on macOS; elsewhere, files are cloned into
+// an open destination with reflink, where that is supported.
+func clonefile(src, dst string) error {
+	return errReflinkUnsupported
+}
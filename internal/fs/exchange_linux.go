@@ -0,0 +1,50 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build amd64 arm64
+
+package fs
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// atFDCWD and renameExchange are the AT_FDCWD file descriptor and the
+// RENAME_EXCHANGE flag of renameat2, as defined in linux/fcntl.h and
+// linux/fs.h.
+const (
+	atFDCWD        = -0x64
+	renameExchange = 0x2
+)
+
+// exchange atomically swaps the paths a and b, which must both exist on the
+// same filesystem, using renameat2 with RENAME_EXCHANGE. Kernels before 3.15,
+// and filesystems that can't swap paths, make it return
+// errExchangeUnsupported, so that the caller can fall back to two renames.
+func exchange(a, b string) error {
+	pa, err := syscall.BytePtrFromString(a)
+	if err != nil {
+		return err
+	}
+	pb, err := syscall.BytePtrFromString(b)
+	if err != nil {
+		return err
+	}
+
+	cwd := atFDCWD
+	_, _, errno := syscall.Syscall6(sysRenameat2,
+		uintptr(cwd), uintptr(unsafe.Pointer(pa)),
+		uintptr(cwd), uintptr(unsafe.Pointer(pb)),
+		renameExchange, 0)
+	switch errno {
+	case 0:
+		return nil
+	case syscall.ENOSYS, syscall.EINVAL, syscall.EOPNOTSUPP:
+		return errExchangeUnsupported
+	default:
+		return &os.LinkError{Op: "exchange", Old: a, New: b, Err: errno}
+	}
+}
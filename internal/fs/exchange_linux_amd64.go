@@ -0,0 +1,9 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+// sysRenameat2 is the number of the renameat2 system call, which the syscall
+// package doesn't define for amd64.
+const sysRenameat2 = 316
@@ -0,0 +1,73 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build amd64 arm64
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExchange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestExchange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	for _, path := range []string{a, b} {
+		if err = os.Mkdir(path, 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(path, "name"), []byte(filepath.Base(path)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = exchange(a, b)
+	if err == errExchangeUnsupported {
+		t.Skip("renameat2 with RENAME_EXCHANGE is not supported here")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{a: "b", b: "a"} {
+		if got, err := ioutil.ReadFile(filepath.Join(path, "name")); err != nil || string(got) != want {
+			t.Errorf("expected %s to hold %q after the exchange, got %q, %v", path, want, got, err)
+		}
+	}
+}
+
+func TestReplaceDirCrossDevice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestReplaceDirCrossDevice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if same, err := SameFilesystem(dir, "/dev/shm"); err != nil || same {
+		t.Skip("no second filesystem to stage on")
+	}
+	staging, err := ioutil.TempDir("/dev/shm", "TestReplaceDirCrossDevice")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(staging)
+
+	target := filepath.Join(dir, "vendor")
+	if err = os.Mkdir(target, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err = ReplaceDir(staging, target); err == nil {
+		t.Error("expected replacing a directory from another filesystem to be refused")
+	}
+	if _, err = os.Stat(staging); err != nil {
+		t.Errorf("expected the staging directory to be left alone, got %v", err)
+	}
+}
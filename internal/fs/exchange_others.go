@@ -0,0 +1,13 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux linux,!amd64,!arm64
+
+package fs
+
+// exchange is not implemented on this platform; ReplaceDir always falls back
+// to two renames.
+func exchange(a, b string) error {
+	return errExchangeUnsupported
+}
@@ -5,11 +5,17 @@
 package fs
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"hash"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"unicode"
 
 	"github.com/pkg/errors"
@@ -29,7 +35,8 @@ import (
 // will return true. The implementation is *not* OS-specific, so a FAT32
 // filesystem mounted on Linux will be handled correctly.
 func HasFilepathPrefix(path, prefix string) bool {
-	if filepath.VolumeName(path) != filepath.VolumeName(prefix) {
+	// Volume names, such as drive letters, are never case sensitive.
+	if !strings.EqualFold(filepath.VolumeName(path), filepath.VolumeName(prefix)) {
 		return false
 	}
 
@@ -77,15 +84,85 @@ func HasFilepathPrefix(path, prefix string) bool {
 	return true
 }
 
+// TrimFilepathPrefix returns what is left of path once prefix is removed from
+// its start, such as "bar/baz" for "/foo/bar/baz" and "/foo", or "." if path
+// is prefix itself. Whether path starts with prefix is determined as by
+// HasFilepathPrefix, so path must be an existing directory, "/foobar" is not
+// under "/foo", and case is ignored where the filesystem does; an error is
+// returned if it doesn't.
+func TrimFilepathPrefix(path, prefix string) (string, error) {
+	if !HasFilepathPrefix(path, prefix) {
+		return "", errors.Errorf("%s is not under %s", path, prefix)
+	}
+
+	rest := splitFilepath(path)[len(splitFilepath(prefix)):]
+	if len(rest) == 0 {
+		return ".", nil
+	}
+	return filepath.Join(rest...), nil
+}
+
+// HasFilepathPrefixCI is like HasFilepathPrefix, but always compares path and
+// prefix without regard to case, one path element at a time, as on the
+// case-insensitive filesystems that are the default on Windows and macOS.
+//
+// Unlike HasFilepathPrefix, it never consults the filesystem, so neither path
+// needs to exist, and path is always taken to be a directory.
+func HasFilepathPrefixCI(path, prefix string) bool {
+	if !strings.EqualFold(filepath.VolumeName(path), filepath.VolumeName(prefix)) {
+		return false
+	}
+	if isRootedFilepath(path) != isRootedFilepath(prefix) {
+		return false
+	}
+
+	dirs := splitFilepath(path)
+	prefixes := splitFilepath(prefix)
+	if len(prefixes) > len(dirs) {
+		return false
+	}
+
+	for i := range prefixes {
+		if !strings.EqualFold(dirs[i], prefixes[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitFilepath splits the cleaned path into its elements, less its volume
+// name and, for an absolute path, its leading separator.
+func splitFilepath(path string) []string {
+	path = filepath.Clean(path[len(filepath.VolumeName(path)):])
+	path = strings.TrimPrefix(path, string(os.PathSeparator))
+	if path == "" || path == "." {
+		return nil
+	}
+	return strings.Split(path, string(os.PathSeparator))
+}
+
+// isRootedFilepath reports whether path, less its volume name, starts at the
+// root of the volume.
+func isRootedFilepath(path string) bool {
+	return strings.HasPrefix(path[len(filepath.VolumeName(path)):], string(os.PathSeparator))
+}
+
 // RenameWithFallback attempts to rename a file or directory, but falls back to
-// copying in the event of a cross-device link error. If the fallback copy
-// succeeds, src is still removed, emulating normal rename behavior.
+// copying if src and dst are on different filesystems, or in the event of a
+// cross-device link error. If the fallback copy succeeds, src is still
+// removed, emulating normal rename behavior.
 func RenameWithFallback(src, dst string) error {
 	_, err := os.Stat(src)
 	if err != nil {
 		return errors.Wrapf(err, "cannot stat %s", src)
 	}
 
+	// Don't bother with a rename that is bound to fail. If we can't tell,
+	// try it anyway and let the error decide.
+	if same, err := SameFilesystem(src, filepath.Dir(dst)); err == nil && !same {
+		return renameByCopy(src, dst)
+	}
+
 	err = rename(src, dst)
 	if err == nil {
 		return nil
@@ -94,6 +171,96 @@ func RenameWithFallback(src, dst string) error {
 	return renameFallback(err, src, dst)
 }
 
+// ReplaceDir replaces the directory target with the directory staging, which
+// must be on the same filesystem; it refuses to copy across filesystems, as
+// the replacement couldn't be atomic. If target doesn't exist, staging is
+// simply renamed to it.
+//
+// Where the platform can swap the two directories in a single step, as Linux
+// does with renameat2 and RENAME_EXCHANGE on most filesystems, target is
+// replaced atomically, and the old tree is then removed from where staging
+// was. Elsewhere, the old target is first renamed aside, then staging into
+// its place; between those two renames, target is briefly missing, though it
+// is never half-written. If staging can't be moved into place, the old target
+// is restored.
+func ReplaceDir(staging, target string) error {
+	target = filepath.Clean(target)
+
+	same, err := SameFilesystem(staging, target)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return errors.Errorf("cannot replace %s with %s, which is on another filesystem", target, staging)
+	}
+
+	if _, err := os.Lstat(target); os.IsNotExist(err) {
+		return errors.Wrapf(os.Rename(staging, target), "cannot move %s into place at %s", staging, target)
+	} else if err != nil {
+		return errors.Wrapf(err, "cannot stat %s", target)
+	}
+
+	err = exchange(staging, target)
+	if err == nil {
+		return errors.Wrapf(os.RemoveAll(staging), "cannot remove the old %s from %s", target, staging)
+	}
+	if err != errExchangeUnsupported {
+		return errors.Wrapf(err, "cannot move %s into place at %s", staging, target)
+	}
+
+	tmp, err := ioutil.TempDir(filepath.Dir(target), "."+filepath.Base(target)+"-old-")
+	if err != nil {
+		return errors.Wrapf(err, "cannot make a directory to move %s aside to", target)
+	}
+	aside := filepath.Join(tmp, filepath.Base(target))
+	if err = os.Rename(target, aside); err != nil {
+		os.RemoveAll(tmp)
+		return errors.Wrapf(err, "cannot move %s aside", target)
+	}
+
+	if err = os.Rename(staging, target); err != nil {
+		err = errors.Wrapf(err, "cannot move %s into place at %s", staging, target)
+		if rerr := os.Rename(aside, target); rerr != nil {
+			return errors.Wrapf(err, "cannot restore the original %s from %s (%s)", target, aside, rerr)
+		}
+		os.RemoveAll(tmp)
+		return err
+	}
+	return errors.Wrapf(os.RemoveAll(tmp), "cannot remove the old %s", target)
+}
+
+// RemoveAllAtomic removes path and everything beneath it, like os.RemoveAll,
+// but so that path is either there as it was or gone. The tree is first
+// renamed aside, within the same directory, with RenameWithFallback, and only
+// then removed. If the removal fails part way, path is still gone; the
+// error returned names where what couldn't be removed was left. If path
+// doesn't exist, nil is returned.
+func RemoveAllAtomic(path string) error {
+	path = filepath.Clean(path)
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "cannot stat %s", path)
+	}
+
+	tmp, err := ioutil.TempDir(filepath.Dir(path), "."+filepath.Base(path)+"-removing-")
+	if err != nil {
+		return errors.Wrapf(err, "cannot make a directory to move %s aside to", path)
+	}
+	if err = RenameWithFallback(path, filepath.Join(tmp, filepath.Base(path))); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "cannot move %s aside to remove it", path)
+	}
+
+	if err = removeAll(tmp); err != nil {
+		return errors.Wrapf(err, "%s was removed, but not all of it could be deleted from %s", path, tmp)
+	}
+	return nil
+}
+
+// removeAll is os.RemoveAll, here so that tests can make it fail.
+var removeAll = os.RemoveAll
+
 // renameByCopy attempts to rename a file or directory by copying it to the
 // destination and then removing the src thus emulating the rename behavior.
 func renameByCopy(src, dst string) error {
@@ -104,9 +271,13 @@ func renameByCopy(src, dst string) error {
 			cerr = errors.Wrap(cerr, "copying directory failed")
 		}
 	} else {
-		cerr = copyFile(src, dst)
+		cerr = CopyFile(src, dst)
 		if cerr != nil {
 			cerr = errors.Wrap(cerr, "copying file failed")
+		} else {
+			// The original is about to be removed, so make sure nothing
+			// it had is lost with it.
+			cerr = checkSameMode(src, dst)
 		}
 	}
 
@@ -117,6 +288,73 @@ func renameByCopy(src, dst string) error {
 	return errors.Wrapf(os.RemoveAll(src), "cannot delete %s", src)
 }
 
+// checkSameMode returns an error if the files named src and dst don't have the
+// same mode.
+func checkSameMode(src, dst string) error {
+	si, err := os.Lstat(src)
+	if err != nil {
+		return errors.Wrapf(err, "cannot stat %s", src)
+	}
+	di, err := os.Lstat(dst)
+	if err != nil {
+		return errors.Wrapf(err, "cannot stat %s", dst)
+	}
+	if si.Mode() != di.Mode() {
+		return errors.Errorf("the mode of %s is %s, not %s as on %s", dst, di.Mode(), si.Mode(), src)
+	}
+	return nil
+}
+
+// caseSensitivity caches the results of IsCaseSensitiveFilesystem, by the
+// filesystemKey of the directories probed.
+var caseSensitivity = struct {
+	sync.Mutex
+	m map[string]bool
+}{m: make(map[string]bool)}
+
+// IsCaseSensitiveFilesystem reports whether the filesystem holding the
+// directory dir is case sensitive. It finds out by creating a file in dir,
+// checking whether the file is also found under the name genTestFilename
+// makes for it, and removing it again. The result is remembered for the
+// whole filesystem, so that it is probed only once.
+func IsCaseSensitiveFilesystem(dir string) (bool, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot stat %s", dir)
+	}
+	if !fi.IsDir() {
+		return false, errors.Errorf("%q is not a directory", dir)
+	}
+
+	key, err := filesystemKey(dir)
+	if err != nil {
+		return false, err
+	}
+
+	caseSensitivity.Lock()
+	sensitive, ok := caseSensitivity.m[key]
+	caseSensitivity.Unlock()
+	if ok {
+		return sensitive, nil
+	}
+
+	f, err := ioutil.TempFile(dir, "dep-case-probe-")
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot create a file in %s to probe its case sensitivity", dir)
+	}
+	name := f.Name()
+	f.Close()
+	sensitive = isCaseSensitiveFilesystem(name)
+	if err = os.Remove(name); err != nil {
+		return false, errors.Wrapf(err, "cannot remove %s", name)
+	}
+
+	caseSensitivity.Lock()
+	caseSensitivity.m[key] = sensitive
+	caseSensitivity.Unlock()
+	return sensitive, nil
+}
+
 // isCaseSensitiveFilesystem determines if the filesystem where dir
 // exists is case sensitive or not.
 //
@@ -158,23 +396,27 @@ func isCaseSensitiveFilesystem(dir string) bool {
 // The transformation is applied only to the first rune that can be
 // reversibly case-flipped, meaning:
 //
-// * A lowercase rune for which it's true that lower(upper(r)) == r
-// * An uppercase rune for which it's true that upper(lower(r)) == r
+//   - A lowercase rune for which it's true that upper(r) != r and
+//     lower(upper(r)) == r
+//   - An uppercase rune for which it's true that lower(r) != r and
+//     upper(lower(r)) == r
 //
-// All the other runes are left intact.
+// All the other runes are left intact. Runes without a distinct other case,
+// such as combining marks, symbols and lowercase letters like 'ß', are skipped
+// over, so that the probe name always differs from str when it can.
 func genTestFilename(str string) string {
 	flip := true
 	return strings.Map(func(r rune) rune {
 		if flip {
 			if unicode.IsLower(r) {
 				u := unicode.ToUpper(r)
-				if unicode.ToLower(u) == r {
+				if u != r && unicode.ToLower(u) == r {
 					r = u
 					flip = false
 				}
 			} else if unicode.IsUpper(r) {
 				l := unicode.ToLower(r)
-				if unicode.ToUpper(l) == r {
+				if l != r && unicode.ToUpper(l) == r {
 					r = l
 					flip = false
 				}
@@ -185,69 +427,453 @@ func genTestFilename(str string) string {
 }
 
 var (
-	errSrcNotDir = errors.New("source is not a directory")
-	errDstExist  = errors.New("destination already exists")
+	errSrcNotDir           = errors.New("source is not a directory")
+	errDstExist            = errors.New("destination already exists")
+	errReflinkUnsupported  = errors.New("reflink is not supported")
+	errExchangeUnsupported = errors.New("exchanging paths is not supported")
+	errSparseUnsupported   = errors.New("sparse copying is not supported")
 )
 
-// CopyDir recursively copies a directory tree, attempting to preserve permissions.
+// CopyError is the error returned by CopyDir and its variants when copying a
+// file or directory within the tree fails. It records which one it was, so
+// that the failure can be found in a large tree.
+type CopyError struct {
+	Op      string // the operation that failed, such as "copy" or "mkdir"
+	RelPath string // the path of the file or directory, relative to the source of the copy
+	Err     error  // the error it failed with
+}
+
+func (e *CopyError) Error() string {
+	return e.Op + " " + e.RelPath + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error the operation failed with.
+func (e *CopyError) Unwrap() error { return e.Err }
+
+// Cause returns the error the operation failed with, for errors.Cause.
+func (e *CopyError) Cause() error { return e.Err }
+
+// CopyOptions represents optional behavior of CopyDirWithOptions.
+type CopyOptions uint8
+
+const (
+	// CopyStripSpecialModes clears the setuid, setgid and sticky bits from the
+	// modes of the copied files and directories.
+	CopyStripSpecialModes CopyOptions = 1 << iota
+
+	// CopyPreserveXattrs copies the extended attributes of files along with
+	// their contents. Only Linux is supported for now; elsewhere, it has no
+	// effect.
+	CopyPreserveXattrs
+
+	// CopyHardlink hard links regular files to their sources, rather than
+	// copying them, where both are on the same filesystem and the link can be
+	// made. Either the copy or the source is then modified along with the
+	// other, so it is only safe for trees that are never modified, such as
+	// caches of immutable content.
+	CopyHardlink
+
+	// CopyExcludeVCS leaves out the metadata directories of version control
+	// systems, named in vcsDirs, wherever they are in the tree.
+	CopyExcludeVCS
+)
+
+// vcsDirs are the names of the directories left out by CopyExcludeVCS.
+var vcsDirs = map[string]bool{
+	".git": true,
+	".hg":  true,
+	".bzr": true,
+	".svn": true,
+}
+
+// specialModes are the mode bits cleared by CopyStripSpecialModes.
+const specialModes = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// mode returns the mode with which to create a copy of a file or directory
+// whose mode is m.
+func (opts CopyOptions) mode(m os.FileMode) os.FileMode {
+	if opts&CopyStripSpecialModes != 0 {
+		return m &^ specialModes
+	}
+	return m
+}
+
+// CopyDir recursively copies a directory tree, attempting to preserve permissions
+// and access and modification times.
 // Source directory must exist, destination directory must *not* exist.
 func CopyDir(src, dst string) error {
+	return CopyDirWithProgress(src, dst, func(bytesCopied, fileCount int64) {})
+}
+
+// CopyDirWithProgress is like CopyDir, but calls cb after each file is copied
+// with the total number of bytes and files copied so far, so that progress
+// through a large tree can be reported. Files are copied one at a time, so cb
+// is never called concurrently. Symlinks count as files of no bytes.
+func CopyDirWithProgress(src, dst string, cb func(bytesCopied, fileCount int64)) error {
+	return copyDir(src, dst, 0, &copyProgress{root: filepath.Clean(src), cb: cb})
+}
+
+// CopyDirWithOptions is like CopyDir, but modifies its behavior according to
+// opts.
+func CopyDirWithOptions(src, dst string, opts CopyOptions) error {
+	return copyDir(src, dst, opts, &copyProgress{root: filepath.Clean(src)})
+}
+
+// CopyDirHardlink is like CopyDir, but hard links the regular files it copies
+// to their sources, as described for CopyHardlink, where src and dst are on
+// the same filesystem, falling back to copying them otherwise. Directories and
+// symlinks are copied as CopyDir copies them.
+//
+// As files in dst share their contents with those in src, it is only safe to
+// use for trees, such as caches, whose files are never modified in place.
+func CopyDirHardlink(src, dst string) error {
+	return CopyDirWithOptions(src, dst, CopyHardlink)
+}
+
+// CopyDirExcludingVCS is like CopyDir, but leaves out any .git, .hg, .bzr and
+// .svn directories, at any depth, along with everything in them.
+func CopyDirExcludingVCS(src, dst string) error {
+	return CopyDirWithOptions(src, dst, CopyExcludeVCS)
+}
+
+// copyProgress counts what a copy of a tree has copied so far.
+type copyProgress struct {
+	root         string // the source of the copy
+	bytes, files int64
+	cb           func(bytesCopied, fileCount int64) // may be nil
+
+	// If sums is not nil, the SHA-256 of the source of each regular file
+	// copied, as it was read, is recorded in it by the path of the copy, and
+	// wrap, if not nil, wraps the writer of each such copy.
+	sums map[string][]byte
+	wrap func(io.Writer) io.Writer
+}
+
+// copyError returns a CopyError for the operation op on path, which is within
+// the source of the copy, failing with err.
+func (p *copyProgress) copyError(op, path string, err error) error {
+	rel, rerr := filepath.Rel(p.root, path)
+	if rerr != nil {
+		rel = path
+	}
+	return &CopyError{Op: op, RelPath: rel, Err: err}
+}
+
+// copied records that a file of n bytes has been copied.
+func (p *copyProgress) copied(n int64) {
+	p.bytes += n
+	p.files++
+	if p.cb != nil {
+		p.cb(p.bytes, p.files)
+	}
+}
+
+// CopyDirVerify is like CopyDir, but once the tree is copied, it reads back
+// every regular file in dst and checks that it holds exactly what was read
+// from its source while copying. If any file differs, dst is removed and the
+// error names the first such file, relative to dst.
+func CopyDirVerify(src, dst string) error {
+	return copyDirVerify(src, dst, nil)
+}
+
+// copyDirVerify is CopyDirVerify, copying each file through the writer that
+// wrap, if not nil, returns for it, such as one that corrupts what it writes.
+func copyDirVerify(src, dst string, wrap func(io.Writer) io.Writer) error {
+	progress := &copyProgress{root: filepath.Clean(src), sums: make(map[string][]byte), wrap: wrap}
+	if err := copyDir(src, dst, 0, progress); err != nil {
+		return err
+	}
+
+	dst = filepath.Clean(dst)
+	paths := make([]string, 0, len(progress.sums))
+	for path := range progress.sums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		ok, err := hasSHA256(path, progress.sums[path])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			rel, _ := filepath.Rel(dst, path)
+			if err = os.RemoveAll(dst); err != nil {
+				return errors.Wrapf(err, "cannot remove %s", dst)
+			}
+			return errors.Errorf("copy of %s does not match its source", rel)
+		}
+	}
+	return nil
+}
+
+// hasSHA256 reports whether the contents of the file named path have the
+// SHA-256 sum.
+func hasSHA256(path string, sum []byte) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot open %s", path)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return false, errors.Wrapf(err, "cannot read %s", path)
+	}
+	return bytes.Equal(h.Sum(nil), sum), nil
+}
+
+// CopyDirConcurrent is like CopyDir, but copies the entries directly within
+// src, each with all that is beneath it, on up to workers goroutines at once.
+// The first error to occur is returned, and once it has, no more entries are
+// started, though those already being copied are finished.
+func CopyDirConcurrent(src, dst string, workers int) error {
+	if workers < 1 {
+		return errors.Errorf("cannot copy with %d workers", workers)
+	}
 	src = filepath.Clean(src)
 	dst = filepath.Clean(dst)
 
+	fi, err := checkCopyDir(src, dst)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dst, fi.Mode()); err != nil {
+		return errors.Wrapf(err, "cannot mkdir %s", dst)
+	}
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return errors.Wrapf(err, "cannot read directory %s", src)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		once     sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	todo := make(chan os.FileInfo)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range todo {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := copyEntry(src, dst, entry, 0, &copyProgress{root: src}); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+	for _, entry := range entries {
+		todo <- entry
+	}
+	close(todo)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+
+	if err = os.Chtimes(dst, atime(fi), fi.ModTime()); err != nil {
+		return errors.Wrapf(err, "cannot set the times of %s", dst)
+	}
+	return nil
+}
+
+// CopyDirDryRun validates src and dst as CopyDirWithOptions would with opts,
+// but instead of copying anything, returns the paths it would create: dst
+// itself, and the copy of every directory, file and symlink beneath src that
+// opts doesn't leave out. They are sorted. Failures within the tree are
+// returned as CopyErrors, like those of the copy itself.
+func CopyDirDryRun(src, dst string, opts CopyOptions) ([]string, error) {
+	var paths []string
+	progress := &copyProgress{root: filepath.Clean(src)}
+	if err := planCopyDir(filepath.Clean(src), filepath.Clean(dst), opts, progress, &paths); err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func planCopyDir(src, dst string, opts CopyOptions, progress *copyProgress, paths *[]string) error {
+	if _, err := checkCopyDir(src, dst); err != nil {
+		if src == progress.root {
+			return err
+		}
+		return progress.copyError("plan", src, err)
+	}
+	*paths = append(*paths, dst)
+
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return progress.copyError("read", src, err)
+	}
+	for _, entry := range entries {
+		srcPath := filepath.Join(src, entry.Name())
+		dstPath := filepath.Join(dst, entry.Name())
+		if !entry.IsDir() {
+			*paths = append(*paths, dstPath)
+			continue
+		}
+		if opts&CopyExcludeVCS != 0 && vcsDirs[entry.Name()] {
+			continue
+		}
+		if err = planCopyDir(srcPath, dstPath, opts, progress, paths); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCopyDir checks that src is a directory and that dst doesn't exist, as
+// copying src to dst requires, and returns the FileInfo of src.
+func checkCopyDir(src, dst string) (os.FileInfo, error) {
 	// We use os.Lstat() here to ensure we don't fall in a loop where a symlink
 	// actually links to a one of its parent directories.
 	fi, err := os.Lstat(src)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !fi.IsDir() {
-		return errSrcNotDir
+		return nil, errSrcNotDir
 	}
 
 	_, err = os.Stat(dst)
 	if err != nil && !os.IsNotExist(err) {
-		return err
+		return nil, err
 	}
 	if err == nil {
-		return errDstExist
+		return nil, errDstExist
 	}
+	return fi, nil
+}
 
-	if err = os.MkdirAll(dst, fi.Mode()); err != nil {
-		return errors.Wrapf(err, "cannot mkdir %s", dst)
+func copyDir(src, dst string, opts CopyOptions, progress *copyProgress) error {
+	src = filepath.Clean(src)
+	dst = filepath.Clean(dst)
+
+	fi, err := checkCopyDir(src, dst)
+	if err != nil {
+		// The source and destination of the whole copy are the caller's
+		// to get right, so errSrcNotDir and errDstExist are returned as
+		// they are for those.
+		if src == progress.root {
+			return err
+		}
+		return progress.copyError("copy", src, err)
+	}
+
+	if err = os.MkdirAll(dst, opts.mode(fi.Mode())); err != nil {
+		return progress.copyError("mkdir", src, err)
 	}
 
 	entries, err := ioutil.ReadDir(src)
 	if err != nil {
-		return errors.Wrapf(err, "cannot read directory %s", dst)
+		return progress.copyError("read", src, err)
 	}
 
 	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
+		if err = copyEntry(src, dst, entry, opts, progress); err != nil {
+			return err
+		}
+	}
 
-		if entry.IsDir() {
-			if err = CopyDir(srcPath, dstPath); err != nil {
-				return errors.Wrap(err, "copying directory failed")
-			}
-		} else {
-			// This will include symlinks, which is what we want when
-			// copying things.
-			if err = copyFile(srcPath, dstPath); err != nil {
-				return errors.Wrap(err, "copying file failed")
-			}
+	// The times are set last, as copying the children into dst modifies it.
+	// Subdirectories have had theirs set by then, as they are copied first.
+	if err = os.Chtimes(dst, atime(fi), fi.ModTime()); err != nil {
+		return progress.copyError("chtimes", src, err)
+	}
+
+	return nil
+}
+
+// copyEntry copies entry, found in the directory src, into dst, along with
+// everything beneath it if it is a directory.
+func copyEntry(src, dst string, entry os.FileInfo, opts CopyOptions, progress *copyProgress) error {
+	srcPath := filepath.Join(src, entry.Name())
+	dstPath := filepath.Join(dst, entry.Name())
+
+	if entry.IsDir() {
+		if opts&CopyExcludeVCS != 0 && vcsDirs[entry.Name()] {
+			return nil
 		}
+		return copyDir(srcPath, dstPath, opts, progress)
 	}
 
+	var sum hash.Hash
+	if progress.sums != nil && entry.Mode().IsRegular() {
+		sum = sha256.New()
+	}
+
+	// This will include symlinks, which is what we want when
+	// copying things.
+	if err := copyFileWithOptions(srcPath, dstPath, opts, sum, progress.wrap); err != nil {
+		return progress.copyError("copy", srcPath, err)
+	}
+	if sum != nil {
+		progress.sums[dstPath] = sum.Sum(nil)
+	}
+	var n int64
+	if entry.Mode().IsRegular() {
+		n = entry.Size()
+	}
+	progress.copied(n)
 	return nil
 }
 
-// copyFile copies the contents of the file named src to the file named
+// CopyFile copies the contents of the file named src to the file named
 // by dst. The file will be created if it does not already exist. If the
 // destination file exists, all its contents will be replaced by the contents
-// of the source file. The file mode will be copied from the source and
-// the copied data is synced/flushed to stable storage.
-func copyFile(src, dst string) (err error) {
+// of the source file. The file mode and access and modification times will be copied
+// from the source and the copied data is synced/flushed to stable storage.
+//
+// If src is a symlink, it is copied as a symlink, pointing at the same target,
+// rather than being dereferenced.
+//
+// Where src and dst are on the same filesystem and it supports it, the data is
+// cloned with a copy-on-write reflink on Linux, or clonefile(2) on macOS,
+// rather than copied byte by byte. Otherwise, a regular copy is made. A clone
+// made by clonefile carries the extended attributes of src along.
+func CopyFile(src, dst string) error {
+	return copyFileWithOptions(src, dst, 0, nil, nil)
+}
+
+// copyBufPool holds the buffers that file contents are read through when
+// they must pass through memory, as when they are summed while copied, so
+// that handling many files, possibly at once, doesn't allocate a buffer for
+// each. Pointers are pooled, as putting a slice into the pool would allocate.
+var copyBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 32*1024)
+		return &buf
+	},
+}
+
+// writerOnly hides any ReadFrom method of the Writer it wraps, which
+// io.CopyBuffer would otherwise call in place of using its buffer.
+type writerOnly struct {
+	io.Writer
+}
+
+// CopyFileWithXattrs is like CopyFile, but also copies the extended
+// attributes of src, such as SELinux labels, to dst, skipping those that dst
+// can't store. Only Linux is supported for now; on other platforms, macOS
+// included, it is the same as CopyFile.
+func CopyFileWithXattrs(src, dst string) error {
+	return copyFileWithOptions(src, dst, CopyPreserveXattrs, nil, nil)
+}
+
+// copyFileWithOptions is like CopyFile, but modifies its behavior according to
+// opts. If sum is not nil, the contents of src are written to it as they are
+// copied, and they are never reflinked, so that they are all read; they are
+// then written through the writer that wrap, if not nil, returns for dst.
+func copyFileWithOptions(src, dst string, opts CopyOptions, sum hash.Hash, wrap func(io.Writer) io.Writer) (err error) {
 	if sym, err := IsSymlink(src); err != nil {
 		return err
 	} else if sym {
@@ -255,6 +881,34 @@ func copyFile(src, dst string) (err error) {
 		return err
 	}
 
+	// The source is stat'd before it is read, which may change its access
+	// time.
+	si, err := os.Stat(src)
+	if err != nil {
+		return
+	}
+
+	// A link has the mode and times of its source, so there is nothing more
+	// to do if one can be made, unless the mode would have to change.
+	if opts&CopyHardlink != 0 && opts.mode(si.Mode()) == si.Mode() && sum == nil {
+		if same, serr := SameFilesystem(src, dst); serr == nil && same && os.Link(src, dst) == nil {
+			return nil
+		}
+	}
+
+	// clonefile makes dst itself, so it is tried before dst is created.
+	if sum == nil {
+		if same, serr := SameFilesystem(src, dst); serr == nil && same {
+			switch err = clonefile(src, dst); err {
+			case nil:
+				return finishCopy(src, dst, si, opts)
+			case errReflinkUnsupported:
+			default:
+				return err
+			}
+		}
+	}
+
 	in, err := os.Open(src)
 	if err != nil {
 		return
@@ -271,7 +925,30 @@ func copyFile(src, dst string) (err error) {
 		}
 	}()
 
-	_, err = io.Copy(out, in)
+	err = errReflinkUnsupported
+	if same, serr := SameFilesystem(src, dst); serr == nil && same && sum == nil {
+		err = reflink(in, out)
+	}
+	if err == errReflinkUnsupported {
+		if sum != nil {
+			buf := copyBufPool.Get().(*[]byte)
+			defer copyBufPool.Put(buf)
+			var w io.Writer = out
+			if wrap != nil {
+				w = wrap(out)
+			}
+			_, err = io.CopyBuffer(writerOnly{w}, io.TeeReader(in, sum), *buf)
+		} else {
+			// Holes in src are kept as holes, rather than filled with the
+			// zeroes they read as, where the platform can tell where they
+			// are. Either way, out is copied to directly, so that the
+			// kernel can copy the data where it is able to.
+			err = copySparse(out, in, si.Size())
+			if err == errSparseUnsupported {
+				_, err = io.Copy(out, in)
+			}
+		}
+	}
 	if err != nil {
 		return
 	}
@@ -280,17 +957,23 @@ func copyFile(src, dst string) (err error) {
 	if err != nil {
 		return
 	}
+	return finishCopy(src, dst, si, opts)
+}
 
-	si, err := os.Stat(src)
-	if err != nil {
-		return
-	}
-	err = os.Chmod(dst, si.Mode())
-	if err != nil {
-		return
+// finishCopy gives dst, the copy of the file src, whose info is si, the mode
+// and times of src, and its extended attributes if opts asks for them.
+func finishCopy(src, dst string, si os.FileInfo, opts CopyOptions) error {
+	// The attributes are set before the mode, which may not allow them to be.
+	if opts&CopyPreserveXattrs != 0 {
+		if err := copyXattrs(src, dst); err != nil {
+			return err
+		}
 	}
 
-	return
+	if err := os.Chmod(dst, opts.mode(si.Mode())); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, atime(si), si.ModTime())
 }
 
 // copySymlink will resolve the src symlink and create a new symlink in dst.
@@ -309,9 +992,10 @@ func copySymlink(src, dst string) error {
 	return nil
 }
 
-// IsDir determines is the path given is a directory or not.
+// IsDir determines is the path given is a directory or not. Symlinks are
+// followed, so a symlink to a directory is reported as one; use IsDirNoFollow
+// to tell them apart.
 func IsDir(name string) (bool, error) {
-	// TODO: lstat?
 	fi, err := os.Stat(name)
 	if os.IsNotExist(err) {
 		return false, nil
@@ -325,8 +1009,50 @@ func IsDir(name string) (bool, error) {
 	return true, nil
 }
 
+// IsDirNoFollow is like IsDir, but doesn't follow symlinks: a symlink, even
+// to a directory, is reported as not being a directory.
+func IsDirNoFollow(name string) (bool, error) {
+	fi, err := os.Lstat(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !fi.IsDir() {
+		return false, errors.Errorf("%q is not a directory", name)
+	}
+	return true, nil
+}
+
+// EnsureDir makes sure that path is a directory. If nothing exists at path,
+// it is created with perm, along with any missing parents. If path already is
+// a directory, nothing is done, and if it is anything else, an error is
+// returned.
+func EnsureDir(path string, perm os.FileMode) error {
+	fi, err := os.Stat(path)
+	if err == nil {
+		if !fi.IsDir() {
+			return errors.Errorf("%s exists and is not a directory", path)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "cannot stat %s", path)
+	}
+
+	return errors.Wrapf(os.MkdirAll(path, perm), "cannot create directory %s", path)
+}
+
 // IsNonEmptyDir determines if the path given is a non-empty directory or not.
 func IsNonEmptyDir(name string) (bool, error) {
+	return IsNonEmptyDirExcluding(name)
+}
+
+// IsNonEmptyDirExcluding is like IsNonEmptyDir, but entries of the directory
+// named in ignore don't count, so that, for instance, a directory holding only
+// .git or .DS_Store can be treated as empty.
+func IsNonEmptyDirExcluding(name string, ignore ...string) (bool, error) {
 	isDir, err := IsDir(name)
 	if !isDir || err != nil {
 		return false, err
@@ -339,16 +1065,215 @@ func IsNonEmptyDir(name string) (bool, error) {
 	}
 	defer f.Close()
 
-	// Query only 1 child. EOF if no children.
-	_, err = f.Readdirnames(1)
-	switch err {
-	case io.EOF:
+	// Query only 1 child at a time when nothing is ignored. EOF if no
+	// (more) children.
+	n := 1
+	if len(ignore) > 0 {
+		n = 16
+	}
+	for {
+		names, err := f.Readdirnames(n)
+		switch err {
+		case io.EOF:
+			return false, nil
+		case nil:
+		default:
+			return false, err
+		}
+
+	next:
+		for _, child := range names {
+			for _, ig := range ignore {
+				if child == ig {
+					continue next
+				}
+			}
+			return true, nil
+		}
+	}
+}
+
+// DirSize returns the total size in bytes of the regular files and symlinks
+// in the tree rooted at path. As elsewhere in this package, symlinks are not
+// followed: a symlink counts for its own size, not that of its target. The
+// sizes of the directories themselves are not counted.
+func DirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return errors.Wrapf(err, "cannot get the size of %s", p)
+		}
+		if fi.Mode().IsRegular() || fi.Mode()&os.ModeSymlink != 0 {
+			size += fi.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// WalkWithSymlinkLoopDetection is like filepath.Walk, but when it comes to a
+// symlink to a directory, after calling fn for the symlink, it also walks the
+// directory, through the symlink's path. To keep from walking forever, it
+// returns an error if a directory, whether reached through a symlink or not,
+// is one it is already in, as determined by os.SameFile (device and inode on
+// Unix, file ID on Windows). Within each directory, entries are walked in
+// lexical order.
+func WalkWithSymlinkLoopDetection(root string, fn filepath.WalkFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkFollowingSymlinks(root, info, fn, nil)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walkFollowingSymlinks walks path, whose lstat'd info is info, for
+// WalkWithSymlinkLoopDetection. ancestors are the directories it is in.
+func walkFollowingSymlinks(path string, info os.FileInfo, fn filepath.WalkFunc, ancestors []os.FileInfo) error {
+	dir := info
+	if info.Mode()&os.ModeSymlink != 0 {
+		// A dangling symlink, or one to a file, is only visited itself.
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			dir = fi
+		}
+	}
+
+	if err := fn(path, info, nil); err != nil {
+		if err == filepath.SkipDir && dir.IsDir() {
+			return nil
+		}
+		return err
+	}
+	if !dir.IsDir() {
+		return nil
+	}
+
+	for _, a := range ancestors {
+		if os.SameFile(a, dir) {
+			return errors.Errorf("symlink loop: %s leads back to a directory it is in", path)
+		}
+	}
+
+	names, err := readDirNames(path)
+	if err != nil {
+		return fn(path, info, err)
+	}
+	ancestors = append(ancestors, dir)
+	for _, name := range names {
+		p := filepath.Join(path, name)
+		fi, err := os.Lstat(p)
+		if err != nil {
+			err = fn(p, fi, err)
+		} else {
+			err = walkFollowingSymlinks(p, fi, fn, ancestors)
+		}
+		// Directories handle a SkipDir of their own, so one that gets here
+		// is for the rest of this directory.
+		if err == filepath.SkipDir {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDirNames returns the names of the entries in the directory dirname,
+// sorted.
+func readDirNames(dirname string) ([]string, error) {
+	f, err := os.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// EqualContents reports whether the files named a and b have the same
+// contents. Files of different sizes are not read at all, and otherwise they
+// are read a buffer at a time, only until the first difference. Symlinks
+// aren't followed: two symlinks are equal if they have the same target, and a
+// symlink never equals a regular file.
+func EqualContents(a, b string) (bool, error) {
+	ai, err := os.Lstat(a)
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot stat %s", a)
+	}
+	bi, err := os.Lstat(b)
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot stat %s", b)
+	}
+
+	aLink, bLink := ai.Mode()&os.ModeSymlink != 0, bi.Mode()&os.ModeSymlink != 0
+	if aLink || bLink {
+		if aLink != bLink {
+			return false, nil
+		}
+		at, err := os.Readlink(a)
+		if err != nil {
+			return false, errors.Wrapf(err, "cannot read symlink %s", a)
+		}
+		bt, err := os.Readlink(b)
+		if err != nil {
+			return false, errors.Wrapf(err, "cannot read symlink %s", b)
+		}
+		return at == bt, nil
+	}
+
+	for _, fi := range []os.FileInfo{ai, bi} {
+		if !fi.Mode().IsRegular() {
+			return false, errors.Errorf("%s is not a regular file", fi.Name())
+		}
+	}
+	if ai.Size() != bi.Size() {
 		return false, nil
-	case nil:
-		return true, nil
-	default:
+	}
+
+	af, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer af.Close()
+	bf, err := os.Open(b)
+	if err != nil {
 		return false, err
 	}
+	defer bf.Close()
+
+	abuf, bbuf := copyBufPool.Get().(*[]byte), copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(abuf)
+	defer copyBufPool.Put(bbuf)
+	for {
+		an, aerr := io.ReadFull(af, *abuf)
+		if aerr != nil && aerr != io.EOF && aerr != io.ErrUnexpectedEOF {
+			return false, errors.Wrapf(aerr, "cannot read %s", a)
+		}
+		bn, berr := io.ReadFull(bf, *bbuf)
+		if berr != nil && berr != io.EOF && berr != io.ErrUnexpectedEOF {
+			return false, errors.Wrapf(berr, "cannot read %s", b)
+		}
+		if !bytes.Equal((*abuf)[:an], (*bbuf)[:bn]) {
+			return false, nil
+		}
+		// The sizes are the same, so the files end together, unless one
+		// has changed since it was stat'd.
+		if aerr != nil || berr != nil {
+			return aerr != nil && berr != nil, nil
+		}
+	}
 }
 
 // IsRegular determines if the path given is a regular file or not.
@@ -367,7 +1292,9 @@ func IsRegular(name string) (bool, error) {
 	return true, nil
 }
 
-// IsSymlink determines if the given path is a symbolic link.
+// IsSymlink determines if the given path is a symbolic link. The link itself
+// is examined, so a link whose target doesn't exist is still reported as one,
+// without an error. An error is returned only if the path can't be lstat'd.
 func IsSymlink(path string) (bool, error) {
 	l, err := os.Lstat(path)
 	if err != nil {
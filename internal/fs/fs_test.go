@@ -5,13 +5,22 @@
 package fs
 
 import (
+	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
 )
 
 func TestHasFilepathPrefix(t *testing.T) {
@@ -87,84 +96,875 @@ func TestHasFilepathPrefix_Files(t *testing.T) {
 	}
 }
 
+func TestTrimFilepathPrefix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, d := range []string{
+		filepath.Join("foo", "bar", "baz"),
+		filepath.Join("foobar", "baz"),
+		filepath.Join("naïve", "日本", "語"),
+	} {
+		if err = os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		path, prefix string
+		want         string
+		err          bool
+	}{
+		{filepath.Join(dir, "foo", "bar", "baz"), filepath.Join(dir, "foo"), filepath.Join("bar", "baz"), false},
+		{filepath.Join(dir, "foo", "bar", "baz"), filepath.Join(dir, "foo") + string(os.PathSeparator), filepath.Join("bar", "baz"), false},
+		{filepath.Join(dir, "foo"), filepath.Join(dir, "foo"), ".", false},
+		{filepath.Join(dir, "foobar", "baz"), filepath.Join(dir, "foo"), "", true},
+		{filepath.Join(dir, "foo"), filepath.Join(dir, "foo", "bar"), "", true},
+		{filepath.Join(dir, "naïve", "日本", "語"), filepath.Join(dir, "naïve"), filepath.Join("日本", "語"), false},
+		{filepath.Join(dir, "naïve", "日本", "語"), filepath.Join(dir, "naïv"), "", true},
+	}
+
+	for _, c := range cases {
+		got, err := TrimFilepathPrefix(c.path, c.prefix)
+		if (err != nil) != c.err {
+			t.Errorf("path: %q, prefix: %q, expected error: %v, got: %v", c.path, c.prefix, c.err, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("path: %q, prefix: %q, expected: %q, got: %q", c.path, c.prefix, c.want, got)
+		}
+	}
+}
+
+func TestHasFilepathPrefixCI(t *testing.T) {
+	// Nothing is created on disk: the comparison is purely lexical.
+	dir := filepath.Join(string(os.PathSeparator)+"Users", "Foo")
+
+	cases := []struct {
+		path   string
+		prefix string
+		want   bool
+	}{
+		{filepath.Join(dir, "a", "b"), dir, true},
+		{filepath.Join(dir, "a", "b"), filepath.Join(string(os.PathSeparator)+"users", "foo"), true},
+		{filepath.Join(dir, "A", "B"), filepath.Join(dir, "a", "b"), true},
+		{filepath.Join(dir, "a", "b"), filepath.Join(dir, "A") + string(os.PathSeparator), true},
+		{filepath.Join(dir, "a", "b"), filepath.Join(dir, "C"), false},
+		{filepath.Join(dir, "a", "b"), filepath.Join(dir, "A", "B2"), false},
+		{filepath.Join(dir, "AB"), filepath.Join(dir, "a", "b"), false},
+		{filepath.Join(dir, "Ab"), filepath.Join(dir, "a"), false},
+		{dir, filepath.Join(dir, "a"), false},
+		{filepath.Join(dir, "123"), filepath.Join(dir, "123"), true},
+		{filepath.Join(dir, "123"), filepath.Join(dir, "1"), false},
+		{filepath.Join(dir, "⌘"), filepath.Join(dir, "⌘"), true},
+		{filepath.Join(dir, "a"), filepath.Join(dir, "⌘"), false},
+		{filepath.Join(dir, "⌘"), filepath.Join(dir, "A"), false},
+		{filepath.Join(dir, "ÄÖ"), filepath.Join(dir, "äö"), true},
+		{filepath.Join("Foo", "a", "b"), filepath.Join("foo", "A"), true},
+		{filepath.Join("Foo", "a"), filepath.Join("Bar", "a"), false},
+		{filepath.Join("Foo", "a"), filepath.Join("Foo", "a", "b"), false},
+		{filepath.Join(".", "Foo", "a"), "foo", true},
+		{filepath.Join("Foo", "a"), ".", true},
+		{filepath.Join(dir, "a"), filepath.Join("Users", "Foo"), false},
+		{filepath.Join("Users", "Foo", "a"), dir, false},
+	}
+
+	for _, c := range cases {
+		if got := HasFilepathPrefixCI(c.path, c.prefix); c.want != got {
+			t.Errorf("dir: %q, prefix: %q, expected: %v, got: %v", c.path, c.prefix, c.want, got)
+		}
+	}
+}
+
 func TestRenameWithFallback(t *testing.T) {
 	dir, err := ioutil.TempDir("", "dep")
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.RemoveAll(dir)
-
-	if err = RenameWithFallback(filepath.Join(dir, "does_not_exists"), filepath.Join(dir, "dst")); err == nil {
-		t.Fatal("expected an error for non existing file, but got nil")
+	defer os.RemoveAll(dir)
+
+	if err = RenameWithFallback(filepath.Join(dir, "does_not_exists"), filepath.Join(dir, "dst")); err == nil {
+		t.Fatal("expected an error for non existing file, but got nil")
+	}
+
+	srcpath := filepath.Join(dir, "src")
+
+	if srcf, err := os.Create(srcpath); err != nil {
+		t.Fatal(err)
+	} else {
+		srcf.Close()
+	}
+
+	if err = RenameWithFallback(srcpath, filepath.Join(dir, "dst")); err != nil {
+		t.Fatal(err)
+	}
+
+	srcpath = filepath.Join(dir, "a")
+	if err = os.MkdirAll(srcpath, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	dstpath := filepath.Join(dir, "b")
+	if err = os.MkdirAll(dstpath, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = RenameWithFallback(srcpath, dstpath); err == nil {
+		t.Fatal("expected an error if dst is an existing directory, but got nil")
+	}
+}
+
+func TestReplaceDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	staging := filepath.Join(dir, "staging")
+	target := filepath.Join(dir, "vendor")
+	for path, contents := range map[string]string{
+		filepath.Join(staging, "new"): "new",
+		filepath.Join(target, "old"):  "old",
+	} {
+		if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = ReplaceDir(staging, target); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(target, "new")); err != nil || string(got) != "new" {
+		t.Errorf("expected the staged tree in place, got %q, %v", got, err)
+	}
+	if _, err = os.Stat(filepath.Join(target, "old")); !os.IsNotExist(err) {
+		t.Errorf("expected the old tree to be gone, got %v", err)
+	}
+	if _, err = os.Stat(staging); !os.IsNotExist(err) {
+		t.Errorf("expected the staging directory to be gone, got %v", err)
+	}
+
+	// Nothing but the target is left behind.
+	names, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0].Name() != "vendor" {
+		t.Errorf("expected only vendor to be left, got %v", names)
+	}
+
+	// A missing target is just created.
+	if err = os.Mkdir(staging, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err = ReplaceDir(staging, filepath.Join(dir, "fresh")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "fresh")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReplaceDirRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "vendor")
+	if err = os.Mkdir(target, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(target, "old"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Moving a staging directory that isn't there into place fails, leaving
+	// the target as it was.
+	if err = ReplaceDir(filepath.Join(dir, "missing"), target); err == nil {
+		t.Fatal("expected an error for a missing staging directory")
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(target, "old")); err != nil || string(got) != "old" {
+		t.Errorf("expected the old tree to be restored, got %q, %v", got, err)
+	}
+	names, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 {
+		t.Errorf("expected only vendor to be left, got %v", names)
+	}
+}
+
+func TestRemoveAllAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mkTree := func(root string) {
+		path := filepath.Join(root, "sub", "file")
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("contents"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	target := filepath.Join(dir, "vendor")
+	mkTree(target)
+	if err = RemoveAllAtomic(target); err != nil {
+		t.Fatal(err)
+	}
+	if names, err := ioutil.ReadDir(dir); err != nil || len(names) != 0 {
+		t.Errorf("expected nothing to be left, got %v, %v", names, err)
+	}
+
+	if err = RemoveAllAtomic(target); err != nil {
+		t.Errorf("expected no error for a missing path, got %v", err)
+	}
+
+	// When the removal fails, the target is still gone, and the error says
+	// where it was left.
+	defer func(orig func(string) error) { removeAll = orig }(removeAll)
+	removeAll = func(string) error { return errors.New("file is locked") }
+
+	mkTree(target)
+	err = RemoveAllAtomic(target)
+	if err == nil {
+		t.Fatal("expected the failed removal to be reported")
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be gone, got %v", target, err)
+	}
+	names, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 {
+		t.Fatalf("expected a single leftover directory, got %v", names)
+	}
+	if _, err = os.Stat(filepath.Join(dir, names[0].Name(), "vendor", "sub", "file")); err != nil {
+		t.Errorf("expected the leftover to hold the tree, got %v", err)
+	}
+}
+
+func TestRenameFallbackCrossDevice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcdir := filepath.Join(dir, "srcdir")
+	files := map[string]string{
+		"file":                            "hello world",
+		filepath.Join("sub", "file"):      "sub file",
+		filepath.Join("sub", "deep", "f"): "deep file",
+	}
+	for name, contents := range files {
+		path := filepath.Join(srcdir, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srcfile := filepath.Join(dir, "srcfile")
+	if err = ioutil.WriteFile(srcfile, []byte("lone file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cross-device link error is what os.Rename returns for a move to
+	// another filesystem.
+	exdev := func(src, dst string) error {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: syscall.EXDEV}
+	}
+
+	dstdir := filepath.Join(dir, "dstdir")
+	if err = renameFallback(exdev(srcdir, dstdir), srcdir, dstdir); err != nil {
+		t.Fatalf("expected the directory to be moved by copying, got %s", err)
+	}
+	if _, err = os.Stat(srcdir); !os.IsNotExist(err) {
+		t.Errorf("expected the source directory to be removed, got %v", err)
+	}
+	for name, contents := range files {
+		got, err := ioutil.ReadFile(filepath.Join(dstdir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != contents {
+			t.Errorf("%s: expected %q, got %q", name, contents, got)
+		}
+	}
+
+	dstfile := filepath.Join(dir, "dstfile")
+	if err = renameFallback(exdev(srcfile, dstfile), srcfile, dstfile); err != nil {
+		t.Fatalf("expected the file to be moved by copying, got %s", err)
+	}
+	if _, err = os.Stat(srcfile); !os.IsNotExist(err) {
+		t.Errorf("expected the source file to be removed, got %v", err)
+	}
+	if got, err := ioutil.ReadFile(dstfile); err != nil || string(got) != "lone file" {
+		t.Errorf("expected the file to be copied, got %q, %v", got, err)
+	}
+
+	// Other errors are not worked around.
+	other := &os.LinkError{Op: "rename", Old: dstdir, New: srcdir, Err: syscall.EACCES}
+	if err = renameFallback(other, dstdir, srcdir); err == nil {
+		t.Error("expected an error other than a cross-device link to be returned")
+	}
+	if _, err = os.Stat(dstdir); err != nil {
+		t.Errorf("expected the directory to be left alone, got %v", err)
+	}
+}
+
+func TestRenameFallbackPreservesMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes other than read-only are not supported on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcfile := filepath.Join(dir, "srcfile")
+	if err = ioutil.WriteFile(srcfile, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The mode is set explicitly, as the umask may have taken bits off.
+	if err = os.Chmod(srcfile, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	dstfile := filepath.Join(dir, "dstfile")
+	exdev := &os.LinkError{Op: "rename", Old: srcfile, New: dstfile, Err: syscall.EXDEV}
+	if err = renameFallback(exdev, srcfile, dstfile); err != nil {
+		t.Fatalf("expected the file to be moved by copying, got %s", err)
+	}
+	fi, err := os.Stat(dstfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode() != 0600 {
+		t.Errorf("expected the moved file to have mode %s, got %s", os.FileMode(0600), fi.Mode())
+	}
+}
+
+func TestSameFilesystem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	if err = ioutil.WriteFile(file, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, other := range []string{
+		dir,
+		file,
+		filepath.Join(dir, "does", "not", "exist"),
+	} {
+		same, err := SameFilesystem(file, other)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", other, err)
+		}
+		if !same {
+			t.Errorf("expected %s and %s to be on the same filesystem", file, other)
+		}
+	}
+
+	// procfs is always its own filesystem on linux, so it makes for a
+	// dependable cross-device case there.
+	if runtime.GOOS != "linux" {
+		t.Skip("no known cross-device path on", runtime.GOOS)
+	}
+	if _, err = os.Stat("/proc/self"); err != nil {
+		t.Skip("/proc is not mounted")
+	}
+	same, err := SameFilesystem(file, "/proc/self")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same {
+		t.Errorf("expected %s and /proc/self to be on different filesystems", file)
+	}
+}
+
+func TestIsCaseSensitiveFilesystemProbe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := filesystemKey(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caseSensitivity.Lock()
+	delete(caseSensitivity.m, key)
+	caseSensitivity.Unlock()
+
+	// Whichever way the filesystem goes, the answer is stable, and the probe
+	// leaves nothing behind.
+	first, err := IsCaseSensitiveFilesystem(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caseSensitivity.Lock()
+	cached, ok := caseSensitivity.m[key]
+	caseSensitivity.Unlock()
+	if !ok || cached != first {
+		t.Errorf("expected %t to be cached for %s, got %t, %t", first, dir, cached, ok)
+	}
+
+	sub := filepath.Join(dir, "sub")
+	if err = os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	second, err := IsCaseSensitiveFilesystem(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Errorf("expected the same answer for the same filesystem, got %t and %t", first, second)
+	}
+
+	for _, d := range []string{dir, sub} {
+		if nonEmpty, err := IsNonEmptyDirExcluding(d, "sub"); err != nil || nonEmpty {
+			t.Errorf("expected %s to be left empty, got %t, %v", d, nonEmpty, err)
+		}
+	}
+
+	if _, err = IsCaseSensitiveFilesystem(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestGenTestFilename(t *testing.T) {
+	cases := []struct {
+		str  string
+		want string
+	}{
+		{"abc", "Abc"},
+		{"ABC", "aBC"},
+		{"AbC", "abC"},
+		{"αβγ", "Αβγ"},
+		{"123", "123"},
+		{"1a2", "1A2"},
+		{"12a", "12A"},
+		{"⌘", "⌘"},
+		{"ßa", "ßA"},
+		{"\u0301a", "\u0301A"},
+		{"e\u0301", "E\u0301"},
+		{"\U00010428a", "\U00010400a"},
+		{"\U0001F600a", "\U0001F600A"},
+	}
+
+	for _, c := range cases {
+		got := genTestFilename(c.str)
+		if c.want != got {
+			t.Fatalf("str: %q, expected: %q, got: %q", c.str, c.want, got)
+		}
+	}
+}
+
+func BenchmarkGenTestFilename(b *testing.B) {
+	cases := []string{
+		"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+		"αααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααα",
+		"11111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111",
+		"⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘",
+	}
+
+	for i := 0; i < b.N; i++ {
+		for _, str := range cases {
+			genTestFilename(str)
+		}
+	}
+}
+
+func BenchmarkCopyManySmallFiles(b *testing.B) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcdir := filepath.Join(dir, "src")
+	for i := 0; i < 1000; i++ {
+		path := filepath.Join(srcdir, strconv.Itoa(i%10), strconv.Itoa(i))
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte("package tiny\n"), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dst := filepath.Join(dir, "dst"+strconv.Itoa(i))
+		if err = CopyDir(srcdir, dst); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		os.RemoveAll(dst)
+		b.StartTimer()
+	}
+}
+
+func TestCopyDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcdir := filepath.Join(dir, "src")
+	if err := os.MkdirAll(srcdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []struct {
+		path     string
+		contents string
+		fi       os.FileInfo
+	}{
+		{path: "myfile", contents: "hello world"},
+		{path: filepath.Join("subdir", "file"), contents: "subdir file"},
+	}
+
+	// Create structure indicated in 'files'
+	for i, file := range files {
+		fn := filepath.Join(srcdir, file.path)
+		dn := filepath.Dir(fn)
+		if err = os.MkdirAll(dn, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		fh, err := os.Create(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = fh.Write([]byte(file.contents)); err != nil {
+			t.Fatal(err)
+		}
+		fh.Close()
+
+		files[i].fi, err = os.Stat(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	destdir := filepath.Join(dir, "dest")
+	if err := CopyDir(srcdir, destdir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compare copy against structure indicated in 'files'
+	for _, file := range files {
+		fn := filepath.Join(srcdir, file.path)
+		dn := filepath.Dir(fn)
+		dirOK, err := IsDir(dn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !dirOK {
+			t.Fatalf("expected %s to be a directory", dn)
+		}
+
+		got, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if file.contents != string(got) {
+			t.Fatalf("expected: %s, got: %s", file.contents, string(got))
+		}
+
+		gotinfo, err := os.Stat(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if file.fi.Mode() != gotinfo.Mode() {
+			t.Fatalf("expected %s: %#v\n to be the same mode as %s: %#v",
+				file.path, file.fi.Mode(), fn, gotinfo.Mode())
+		}
+	}
+}
+
+func TestCopyDirPreservesTimes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcdir := filepath.Join(dir, "src")
+	paths := []string{"myfile", "subdir", filepath.Join("subdir", "file"), filepath.Join("subdir", "nested")}
+	if err = os.MkdirAll(filepath.Join(srcdir, "subdir", "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{paths[0], paths[2]} {
+		if err = ioutil.WriteFile(filepath.Join(srcdir, file), []byte("contents"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Give every file and directory distinct times, parents last so that
+	// creating their children doesn't overwrite them.
+	base := time.Date(2015, time.March, 1, 12, 0, 0, 0, time.UTC)
+	times := make(map[string][2]time.Time)
+	all := append([]string{"."}, paths...)
+	for i := len(all) - 1; i >= 0; i-- {
+		atime := base.Add(time.Duration(i) * time.Hour)
+		mtime := atime.Add(-24 * time.Hour)
+		if err = os.Chtimes(filepath.Join(srcdir, all[i]), atime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		times[all[i]] = [2]time.Time{atime, mtime}
+	}
+
+	destdir := filepath.Join(dir, "dest")
+	if err = CopyDir(srcdir, destdir); err != nil {
+		t.Fatal(err)
+	}
+
+	within := func(got, want time.Time) bool {
+		d := got.Sub(want)
+		return d > -time.Second && d < time.Second
+	}
+	for _, path := range all {
+		fi, err := os.Stat(filepath.Join(destdir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := times[path]
+		if !within(fi.ModTime(), want[1]) {
+			t.Errorf("%s: expected mtime %s, got %s", path, want[1], fi.ModTime())
+		}
+		if got := atime(fi); runtime.GOOS == "linux" && !within(got, want[0]) {
+			t.Errorf("%s: expected atime %s, got %s", path, want[0], got)
+		}
+	}
+}
+
+func TestCopyDirWithProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcdir := filepath.Join(dir, "src")
+	files := map[string]string{
+		"myfile":                              "hello world",
+		filepath.Join("subdir", "file"):       "subdir file",
+		filepath.Join("subdir", "deep", "f"):  "",
+		filepath.Join("other", "larger.file"): strings.Repeat("x", 64*1024),
+	}
+	var total int64
+	for path, contents := range files {
+		path = filepath.Join(srcdir, path)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		total += int64(len(contents))
+	}
+
+	var calls, lastBytes, lastCount int64
+	err = CopyDirWithProgress(srcdir, filepath.Join(dir, "dest"), func(bytesCopied, fileCount int64) {
+		calls++
+		if bytesCopied < lastBytes || fileCount != lastCount+1 {
+			t.Errorf("expected progress to accumulate a file at a time, went from (%d, %d) to (%d, %d)",
+				lastBytes, lastCount, bytesCopied, fileCount)
+		}
+		lastBytes, lastCount = bytesCopied, fileCount
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != int64(len(files)) {
+		t.Errorf("expected a call per file, got %d for %d files", calls, len(files))
+	}
+	if lastBytes != total {
+		t.Errorf("expected %d bytes to be reported in all, got %d", total, lastBytes)
+	}
+}
+
+func TestCopyDirDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcdir := filepath.Join(dir, "src")
+	for _, path := range []string{
+		"myfile",
+		filepath.Join("subdir", "file"),
+		filepath.Join("subdir", "deep", "f"),
+		filepath.Join("empty", ".keep"),
+	} {
+		path = filepath.Join(srcdir, path)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		if err = os.Symlink("myfile", filepath.Join(srcdir, "link")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := filepath.Join(dir, "dst")
+	got, err := CopyDirDryRun(srcdir, dst, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("expected a dry run not to create %s, got %v", dst, err)
+	}
+
+	if err = CopyDir(srcdir, dst); err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	err = filepath.Walk(dst, func(path string, info os.FileInfo, err error) error {
+		want = append(want, path)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the dry run to list what CopyDir creates:\n\t(GOT) %v\n\t(WNT) %v", got, want)
 	}
 
-	srcpath := filepath.Join(dir, "src")
+	// The same validation applies.
+	if _, err = CopyDirDryRun(srcdir, dst, 0); err != errDstExist {
+		t.Errorf("expected %v for an existing destination, got %v", errDstExist, err)
+	}
+	if _, err = CopyDirDryRun(filepath.Join(srcdir, "myfile"), filepath.Join(dir, "other"), 0); err != errSrcNotDir {
+		t.Errorf("expected %v for a source that isn't a directory, got %v", errSrcNotDir, err)
+	}
 
-	if srcf, err := os.Create(srcpath); err != nil {
+	// Options that leave parts of the tree out leave them out of the plan.
+	if err = os.MkdirAll(filepath.Join(srcdir, "subdir", ".git", "objects"), 0755); err != nil {
 		t.Fatal(err)
-	} else {
-		srcf.Close()
 	}
-
-	if err = RenameWithFallback(srcpath, filepath.Join(dir, "dst")); err != nil {
+	if err = ioutil.WriteFile(filepath.Join(srcdir, ".hg"), nil, 0644); err != nil {
 		t.Fatal(err)
 	}
-
-	srcpath = filepath.Join(dir, "a")
-	if err = os.MkdirAll(srcpath, 0777); err != nil {
+	other := filepath.Join(dir, "other")
+	got, err = CopyDirDryRun(srcdir, other, CopyExcludeVCS)
+	if err != nil {
 		t.Fatal(err)
 	}
-
-	dstpath := filepath.Join(dir, "b")
-	if err = os.MkdirAll(dstpath, 0777); err != nil {
+	if err = CopyDirWithOptions(srcdir, other, CopyExcludeVCS); err != nil {
+		t.Fatal(err)
+	}
+	want = nil
+	err = filepath.Walk(other, func(path string, info os.FileInfo, err error) error {
+		want = append(want, path)
+		return err
+	})
+	if err != nil {
 		t.Fatal(err)
 	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the dry run to list what CopyDirWithOptions creates:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+}
 
-	if err = RenameWithFallback(srcpath, dstpath); err == nil {
-		t.Fatal("expected an error if dst is an existing directory, but got nil")
+// flipWriter is an io.Writer that corrupts what it writes, by flipping the
+// bits of the first byte, if it is written to a file named name.
+type flipWriter struct {
+	w    io.Writer
+	name string
+}
+
+func (w flipWriter) Write(p []byte) (int, error) {
+	if f, ok := w.w.(*os.File); ok && filepath.Base(f.Name()) == w.name && len(p) > 0 {
+		q := append([]byte(nil), p...)
+		q[0] ^= 0xff
+		return w.w.Write(q)
 	}
+	return w.w.Write(p)
 }
 
-func TestGenTestFilename(t *testing.T) {
-	cases := []struct {
-		str  string
-		want string
-	}{
-		{"abc", "Abc"},
-		{"ABC", "aBC"},
-		{"AbC", "abC"},
-		{"αβγ", "Αβγ"},
-		{"123", "123"},
-		{"1a2", "1A2"},
-		{"12a", "12A"},
-		{"⌘", "⌘"},
+func TestCopyDirVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer os.RemoveAll(dir)
 
-	for _, c := range cases {
-		got := genTestFilename(c.str)
-		if c.want != got {
-			t.Fatalf("str: %q, expected: %q, got: %q", c.str, c.want, got)
+	srcdir := filepath.Join(dir, "src")
+	for _, path := range []string{"a", filepath.Join("sub", "b"), filepath.Join("sub", "c")} {
+		path = filepath.Join(srcdir, path)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte("contents of "+path), 0644); err != nil {
+			t.Fatal(err)
 		}
 	}
-}
 
-func BenchmarkGenTestFilename(b *testing.B) {
-	cases := []string{
-		"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
-		"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
-		"αααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααααα",
-		"11111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111111",
-		"⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘⌘",
+	dst := filepath.Join(dir, "dst")
+	if err = CopyDirVerify(srcdir, dst); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dst, "sub", "c")); err != nil {
+		t.Fatal(err)
 	}
 
-	for i := 0; i < b.N; i++ {
-		for _, str := range cases {
-			genTestFilename(str)
-		}
+	flip := func(w io.Writer) io.Writer { return flipWriter{w: w, name: "b"} }
+	dst = filepath.Join(dir, "corrupt")
+	err = copyDirVerify(srcdir, dst, flip)
+	if err == nil {
+		t.Fatal("expected the corrupted copy to be detected")
+	}
+	if !strings.Contains(err.Error(), filepath.Join("sub", "b")) {
+		t.Errorf("expected the error to name sub/b, got %q", err)
+	}
+	if _, err = os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("expected the corrupted copy to be removed, got %v", err)
 	}
 }
 
-func TestCopyDir(t *testing.T) {
+func TestCopyDirConcurrent(t *testing.T) {
 	dir, err := ioutil.TempDir("", "dep")
 	if err != nil {
 		t.Fatal(err)
@@ -172,78 +972,131 @@ func TestCopyDir(t *testing.T) {
 	defer os.RemoveAll(dir)
 
 	srcdir := filepath.Join(dir, "src")
-	if err := os.MkdirAll(srcdir, 0755); err != nil {
-		t.Fatal(err)
-	}
-
 	files := []struct {
-		path     string
-		contents string
-		fi       os.FileInfo
+		path string
+		mode os.FileMode
 	}{
-		{path: "myfile", contents: "hello world"},
-		{path: filepath.Join("subdir", "file"), contents: "subdir file"},
-	}
-
-	// Create structure indicated in 'files'
-	for i, file := range files {
-		fn := filepath.Join(srcdir, file.path)
-		dn := filepath.Dir(fn)
-		if err = os.MkdirAll(dn, 0755); err != nil {
+		{"top", 0644},
+		{filepath.Join("a", "file"), 0600},
+		{filepath.Join("a", "deep", "er", "file"), 0644},
+		{filepath.Join("b", "tool"), 0755},
+		{filepath.Join("c", "1"), 0644},
+		{filepath.Join("c", "2"), 0644},
+		{filepath.Join("d", "e", "f"), 0640},
+	}
+	for _, f := range files {
+		path := filepath.Join(srcdir, f.path)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 			t.Fatal(err)
 		}
-
-		fh, err := os.Create(fn)
-		if err != nil {
+		if err = ioutil.WriteFile(path, []byte(f.path), f.mode); err != nil {
 			t.Fatal(err)
 		}
-
-		if _, err = fh.Write([]byte(file.contents)); err != nil {
+		if err = os.Chmod(path, f.mode); err != nil {
 			t.Fatal(err)
 		}
-		fh.Close()
-
-		files[i].fi, err = os.Stat(fn)
-		if err != nil {
+	}
+	if runtime.GOOS != "windows" {
+		if err = os.Symlink(filepath.Join("..", "top"), filepath.Join(srcdir, "c", "link")); err != nil {
 			t.Fatal(err)
 		}
 	}
 
-	destdir := filepath.Join(dir, "dest")
-	if err := CopyDir(srcdir, destdir); err != nil {
+	// The result must be the same as that of CopyDir.
+	seq := filepath.Join(dir, "seq")
+	if err = CopyDir(srcdir, seq); err != nil {
 		t.Fatal(err)
 	}
-
-	// Compare copy against structure indicated in 'files'
-	for _, file := range files {
-		fn := filepath.Join(srcdir, file.path)
-		dn := filepath.Dir(fn)
-		dirOK, err := IsDir(dn)
-		if err != nil {
+	for _, workers := range []int{1, 3, 16} {
+		dst := filepath.Join(dir, "dst"+strconv.Itoa(workers))
+		if err = CopyDirConcurrent(srcdir, dst, workers); err != nil {
 			t.Fatal(err)
 		}
-		if !dirOK {
-			t.Fatalf("expected %s to be a directory", dn)
-		}
 
-		got, err := ioutil.ReadFile(fn)
+		err = filepath.Walk(seq, func(path string, want os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(seq, path)
+			got, err := os.Lstat(filepath.Join(dst, rel))
+			if err != nil {
+				return err
+			}
+			if got.Mode() != want.Mode() {
+				t.Errorf("%d workers: expected %s to have mode %s, got %s", workers, rel, want.Mode(), got.Mode())
+			}
+			switch {
+			case want.Mode()&os.ModeSymlink != 0:
+				wl, _ := os.Readlink(path)
+				gl, _ := os.Readlink(filepath.Join(dst, rel))
+				if gl != wl {
+					t.Errorf("%d workers: expected %s to link to %s, got %s", workers, rel, wl, gl)
+				}
+			case want.Mode().IsRegular():
+				wc, _ := ioutil.ReadFile(path)
+				gc, _ := ioutil.ReadFile(filepath.Join(dst, rel))
+				if string(gc) != string(wc) {
+					t.Errorf("%d workers: expected %s to hold %q, got %q", workers, rel, wc, gc)
+				}
+			}
+			return nil
+		})
 		if err != nil {
 			t.Fatal(err)
 		}
+	}
 
-		if file.contents != string(got) {
-			t.Fatalf("expected: %s, got: %s", file.contents, string(got))
-		}
+	if err = CopyDirConcurrent(srcdir, seq, 2); err != errDstExist {
+		t.Errorf("expected %v for an existing destination, got %v", errDstExist, err)
+	}
+	if err = CopyDirConcurrent(srcdir, filepath.Join(dir, "none"), 0); err == nil {
+		t.Error("expected an error for no workers")
+	}
+}
 
-		gotinfo, err := os.Stat(fn)
-		if err != nil {
-			t.Fatal(err)
-		}
+func TestCopyDirError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not supported on windows")
+	}
 
-		if file.fi.Mode() != gotinfo.Mode() {
-			t.Fatalf("expected %s: %#v\n to be the same mode as %s: %#v",
-				file.path, file.fi.Mode(), fn, gotinfo.Mode())
-		}
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcdir := filepath.Join(dir, "src")
+	nested := filepath.Join(srcdir, "a", "b")
+	if err = os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(srcdir, "a", "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A socket can be listed, but not opened to be copied.
+	l, err := net.Listen("unix", filepath.Join(nested, "sock"))
+	if err != nil {
+		t.Skipf("cannot make a unix socket: %s", err)
+	}
+	defer l.Close()
+
+	err = CopyDir(srcdir, filepath.Join(dir, "dst"))
+	cerr, ok := err.(*CopyError)
+	if !ok {
+		t.Fatalf("expected a *CopyError, got %#v", err)
+	}
+	if want := filepath.Join("a", "b", "sock"); cerr.RelPath != want {
+		t.Errorf("expected the error to be for %s, got %s", want, cerr.RelPath)
+	}
+	if cerr.Op != "copy" {
+		t.Errorf("expected the copy to fail, got %s", cerr.Op)
+	}
+	if errors.Cause(err) != cerr.Err || cerr.Unwrap() != cerr.Err {
+		t.Error("expected the underlying error to be reachable")
+	}
+	if !strings.HasPrefix(err.Error(), "copy "+filepath.Join("a", "b", "sock")+": ") {
+		t.Errorf("unexpected error message: %s", err)
 	}
 }
 
@@ -380,74 +1233,243 @@ func TestCopyDirFailOpen(t *testing.T) {
 	}
 	defer os.RemoveAll(dir)
 
-	srcdir = filepath.Join(dir, "src")
-	if err = os.MkdirAll(srcdir, 0755); err != nil {
+	srcdir = filepath.Join(dir, "src")
+	if err = os.MkdirAll(srcdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	srcfn := filepath.Join(srcdir, "file")
+	srcf, err := os.Create(srcfn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcf.Close()
+
+	// setup source file so that it cannot be read
+	if err = os.Chmod(srcfn, 0222); err != nil {
+		t.Fatal(err)
+	}
+
+	dstdir = filepath.Join(dir, "dst")
+
+	if err = CopyDir(srcdir, dstdir); err == nil {
+		t.Fatalf("expected error for CopyDir(%s, %s), got none", srcdir, dstdir)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcf, err := os.Create(filepath.Join(dir, "srcfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "hello world"
+	if _, err := srcf.Write([]byte(want)); err != nil {
+		t.Fatal(err)
+	}
+	srcf.Close()
+
+	destf := filepath.Join(dir, "destf")
+	if err := CopyFile(srcf.Name(), destf); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(destf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want != string(got) {
+		t.Fatalf("expected: %s, got: %s", want, string(got))
+	}
+
+	wantinfo, err := os.Stat(srcf.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotinfo, err := os.Stat(destf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wantinfo.Mode() != gotinfo.Mode() {
+		t.Fatalf("expected %s: %#v\n to be the same mode as %s: %#v", srcf.Name(), wantinfo.Mode(), destf, gotinfo.Mode())
+	}
+}
+
+func TestCopyDirExcludingVCS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcdir := filepath.Join(dir, "src")
+	for _, name := range []string{
+		"foo.go",
+		filepath.Join(".git", "HEAD"),
+		filepath.Join("sub", "bar.go"),
+		filepath.Join("sub", "nested", ".git", "objects", "pack"),
+		filepath.Join("sub", ".hg", "store"),
+		filepath.Join(".svn", "entries"),
+		filepath.Join("other", ".bzr", "branch"),
+	} {
+		path := filepath.Join(srcdir, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dstdir := filepath.Join(dir, "dst")
+	if err = CopyDirExcludingVCS(srcdir, dstdir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"foo.go", filepath.Join("sub", "bar.go"), filepath.Join("sub", "nested"), "other"} {
+		if _, err = os.Stat(filepath.Join(dstdir, name)); err != nil {
+			t.Errorf("expected %s to be copied, got %v", name, err)
+		}
+	}
+	for _, name := range []string{".git", ".svn", filepath.Join("sub", "nested", ".git"), filepath.Join("sub", ".hg"), filepath.Join("other", ".bzr")} {
+		if _, err = os.Stat(filepath.Join(dstdir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be left out, got %v", name, err)
+		}
+	}
+
+	// CopyDir itself copies everything.
+	all := filepath.Join(dir, "all")
+	if err = CopyDir(srcdir, all); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(all, "sub", "nested", ".git", "objects", "pack")); err != nil {
+		t.Errorf("expected CopyDir to copy .git, got %v", err)
+	}
+}
+
+func TestCopyDirHardlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcdir := filepath.Join(dir, "src")
+	files := []string{"a", filepath.Join("sub", "b"), filepath.Join("sub", "deep", "c")}
+	for _, name := range files {
+		path := filepath.Join(srcdir, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		if err = os.Symlink("a", filepath.Join(srcdir, "link")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dstdir := filepath.Join(dir, "dst")
+	if err = CopyDirHardlink(srcdir, dstdir); err != nil {
 		t.Fatal(err)
 	}
 
-	srcfn := filepath.Join(srcdir, "file")
-	srcf, err := os.Create(srcfn)
+	for _, name := range files {
+		si, err := os.Stat(filepath.Join(srcdir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		di, err := os.Stat(filepath.Join(dstdir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(si, di) {
+			t.Errorf("expected %s to be hard linked to its source", name)
+		}
+	}
+
+	// Directories and symlinks are copies of their own.
+	si, err := os.Stat(filepath.Join(srcdir, "sub"))
 	if err != nil {
 		t.Fatal(err)
 	}
-	srcf.Close()
-
-	// setup source file so that it cannot be read
-	if err = os.Chmod(srcfn, 0222); err != nil {
+	di, err := os.Stat(filepath.Join(dstdir, "sub"))
+	if err != nil {
 		t.Fatal(err)
 	}
-
-	dstdir = filepath.Join(dir, "dst")
-
-	if err = CopyDir(srcdir, dstdir); err == nil {
-		t.Fatalf("expected error for CopyDir(%s, %s), got none", srcdir, dstdir)
+	if os.SameFile(si, di) {
+		t.Error("expected sub to be a new directory")
+	}
+	if runtime.GOOS != "windows" {
+		if got, err := os.Readlink(filepath.Join(dstdir, "link")); err != nil || got != "a" {
+			t.Errorf("expected link to be copied as a symlink to a, got %q, %v", got, err)
+		}
 	}
 }
 
-func TestCopyFile(t *testing.T) {
+func TestCopyStripSpecialModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows, which has no setuid bit")
+	}
+
 	dir, err := ioutil.TempDir("", "dep")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer os.RemoveAll(dir)
 
-	srcf, err := os.Create(filepath.Join(dir, "srcfile"))
-	if err != nil {
+	srcdir := filepath.Join(dir, "src")
+	if err := os.Mkdir(srcdir, 0755); err != nil {
 		t.Fatal(err)
 	}
-
-	want := "hello world"
-	if _, err := srcf.Write([]byte(want)); err != nil {
+	srcf := filepath.Join(srcdir, "setuid")
+	if err := ioutil.WriteFile(srcf, []byte("#!/bin/sh\n"), 0755); err != nil {
 		t.Fatal(err)
 	}
-	srcf.Close()
-
-	destf := filepath.Join(dir, "destf")
-	if err := copyFile(srcf.Name(), destf); err != nil {
+	if err := os.Chmod(srcf, 0755|os.ModeSetuid); err != nil {
 		t.Fatal(err)
 	}
-
-	got, err := ioutil.ReadFile(destf)
-	if err != nil {
+	if fi, err := os.Stat(srcf); err != nil {
 		t.Fatal(err)
+	} else if fi.Mode()&os.ModeSetuid == 0 {
+		t.Skip("unable to set the setuid bit")
 	}
 
-	if want != string(got) {
-		t.Fatalf("expected: %s, got: %s", want, string(got))
+	// Without the option, the mode is copied as-is.
+	plain := filepath.Join(dir, "plain")
+	if err := CopyFile(srcf, plain); err != nil {
+		t.Fatal(err)
 	}
-
-	wantinfo, err := os.Stat(srcf.Name())
-	if err != nil {
+	if fi, err := os.Stat(plain); err != nil {
 		t.Fatal(err)
+	} else if fi.Mode()&os.ModeSetuid == 0 {
+		t.Errorf("expected %s to keep the setuid bit, got mode %s", plain, fi.Mode())
 	}
 
-	gotinfo, err := os.Stat(destf)
+	dstdir := filepath.Join(dir, "dst")
+	if err := CopyDirWithOptions(srcdir, dstdir, CopyStripSpecialModes); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filepath.Join(dstdir, "setuid"))
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	if wantinfo.Mode() != gotinfo.Mode() {
-		t.Fatalf("expected %s: %#v\n to be the same mode as %s: %#v", srcf.Name(), wantinfo.Mode(), destf, gotinfo.Mode())
+	if fi.Mode()&specialModes != 0 {
+		t.Errorf("expected the special mode bits to be stripped, got mode %s", fi.Mode())
+	}
+	if fi.Mode().Perm() != 0755 {
+		t.Errorf("expected the permissions to be kept as 0755, got %s", fi.Mode().Perm())
 	}
 }
 
@@ -472,7 +1494,7 @@ func TestCopyFileSymlink(t *testing.T) {
 		t.Fatalf("could not create symlink: %s", err)
 	}
 
-	if err = copyFile(symlinkPath, dstPath); err != nil {
+	if err = CopyFile(symlinkPath, dstPath); err != nil {
 		t.Fatalf("failed to copy symlink: %s", err)
 	}
 
@@ -506,7 +1528,7 @@ func TestCopyFileSymlinkToDirectory(t *testing.T) {
 		t.Fatalf("could not create symlink: %v", err)
 	}
 
-	if err = copyFile(symlinkPath, dstPath); err != nil {
+	if err = CopyFile(symlinkPath, dstPath); err != nil {
 		t.Fatalf("failed to copy symlink: %s", err)
 	}
 
@@ -549,7 +1571,7 @@ func TestCopyFileFail(t *testing.T) {
 	defer cleanup()
 
 	fn := filepath.Join(dstdir, "file")
-	if err := copyFile(srcf.Name(), fn); err == nil {
+	if err := CopyFile(srcf.Name(), fn); err == nil {
 		t.Fatalf("expected error for %s, got none", fn)
 	}
 }
@@ -716,6 +1738,294 @@ func TestIsDir(t *testing.T) {
 	}
 }
 
+func TestIsDirNoFollow(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		// XXX: creating symlinks is not supported in Go on
+		// Microsoft Windows. Skipping this this until a solution
+		// for creating symlinks is is provided.
+		t.Skip("skipping on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dirPath := filepath.Join(dir, "directory")
+	if err = os.Mkdir(dirPath, 0777); err != nil {
+		t.Fatal(err)
+	}
+	filePath := filepath.Join(dir, "file")
+	if err = ioutil.WriteFile(filePath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dirSymlink := filepath.Join(dir, "dirSymlink")
+	if err = os.Symlink(dirPath, dirSymlink); err != nil {
+		t.Fatal(err)
+	}
+	fileSymlink := filepath.Join(dir, "fileSymlink")
+	if err = os.Symlink(filePath, fileSymlink); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		follow, noFollow bool
+	}{
+		dirPath:     {true, true},
+		dirSymlink:  {true, false},
+		fileSymlink: {false, false},
+	}
+
+	for path, want := range tests {
+		if got, _ := IsDir(path); got != want.follow {
+			t.Errorf("IsDir: expected %t for %s, got %t", want.follow, path, got)
+		}
+		got, err := IsDirNoFollow(path)
+		if got != want.noFollow {
+			t.Errorf("IsDirNoFollow: expected %t for %s, got %t", want.noFollow, path, got)
+		}
+		if got && err != nil {
+			t.Errorf("IsDirNoFollow: expected no error for %s, got %v", path, err)
+		}
+	}
+}
+
+func TestEnsureDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A missing directory is created, along with its parents.
+	missing := filepath.Join(dir, "missing", "sub")
+	if err = EnsureDir(missing, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(missing); err != nil || !fi.IsDir() {
+		t.Fatalf("expected %s to be created, got %v", missing, err)
+	}
+
+	// An existing one is left as it is.
+	f := filepath.Join(missing, "file")
+	if err = ioutil.WriteFile(f, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = EnsureDir(missing, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(f); err != nil {
+		t.Errorf("expected the existing directory to be left alone, got %v", err)
+	}
+
+	// A file is not a directory.
+	err = EnsureDir(f, 0755)
+	if err == nil {
+		t.Fatal("expected an error for an existing file")
+	}
+	if !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("unexpected error for an existing file: %v", err)
+	}
+}
+
+func TestDirSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]int{
+		"a":                               10,
+		filepath.Join("sub", "b"):         200,
+		filepath.Join("sub", "deep", "c"): 3000,
+		filepath.Join("empty", "d"):       0,
+	}
+	var want int64
+	for name, n := range files {
+		path := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, make([]byte, n), 0644); err != nil {
+			t.Fatal(err)
+		}
+		want += int64(n)
+	}
+	if runtime.GOOS != "windows" {
+		// The link counts for the length of its target's name, not for the
+		// 3000 bytes it points at.
+		target := filepath.Join("deep", "c")
+		if err = os.Symlink(target, filepath.Join(dir, "sub", "link")); err != nil {
+			t.Fatal(err)
+		}
+		want += int64(len(target))
+	}
+
+	got, err := DirSize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("expected %d bytes, got %d", want, got)
+	}
+
+	if _, err = DirSize(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestWalkWithSymlinkLoopDetection(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		// XXX: creating symlinks is not supported in Go on
+		// Microsoft Windows. Skipping this this until a solution
+		// for creating symlinks is is provided.
+		t.Skip("skipping on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = os.MkdirAll(filepath.Join(dir, "a", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "a", "sub", "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Mkdir(filepath.Join(dir, "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		filepath.Join("b", "link"):     filepath.Join("..", "a", "sub"),
+		filepath.Join("b", "dangling"): "missing",
+	}
+	for link, target := range links {
+		if err = os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without a loop, symlinks to directories are walked through.
+	var got []string
+	err = WalkWithSymlinkLoopDetection(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		got = append(got, rel)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		".",
+		"a",
+		filepath.Join("a", "sub"),
+		filepath.Join("a", "sub", "file"),
+		"b",
+		filepath.Join("b", "dangling"),
+		filepath.Join("b", "link"),
+		filepath.Join("b", "link", "file"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected to walk %v, got %v", want, got)
+	}
+
+	// A symlink to its parent is a loop.
+	if err = os.Symlink("..", filepath.Join(dir, "a", "sub", "up")); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- WalkWithSymlinkLoopDetection(dir, func(path string, info os.FileInfo, err error) error {
+			return err
+		})
+	}()
+	select {
+	case err = <-done:
+		if err == nil || !strings.Contains(err.Error(), "symlink loop") {
+			t.Errorf("expected a symlink loop error, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the walk didn't end")
+	}
+}
+
+func TestEqualContents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Large enough to take several buffers, differing only at the end.
+	big := make([]byte, 100*1024)
+	bigDiff := make([]byte, len(big))
+	bigDiff[len(bigDiff)-1] = 1
+	files := map[string][]byte{
+		"a":       []byte("hello world"),
+		"same":    []byte("hello world"),
+		"diff":    []byte("hello there"),
+		"longer":  []byte("hello world!"),
+		"big":     big,
+		"bigSame": big,
+		"bigDiff": bigDiff,
+	}
+	for name, contents := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"a", "same", true},
+		{"a", "diff", false},
+		{"a", "longer", false},
+		{"big", "bigSame", true},
+		{"big", "bigDiff", false},
+	}
+	if runtime.GOOS != "windows" {
+		for link, target := range map[string]string{"link": "a", "linkSame": "a", "linkDiff": "same"} {
+			if err = os.Symlink(target, filepath.Join(dir, link)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cases = append(cases, []struct {
+			a, b string
+			want bool
+		}{
+			{"link", "linkSame", true},
+			{"link", "linkDiff", false},
+			{"link", "a", false},
+		}...)
+	}
+
+	for _, c := range cases {
+		got, err := EqualContents(filepath.Join(dir, c.a), filepath.Join(dir, c.b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("%s, %s: expected %t, got %t", c.a, c.b, c.want, got)
+		}
+	}
+
+	if _, err = EqualContents(filepath.Join(dir, "a"), filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	if _, err = EqualContents(filepath.Join(dir, "a"), dir); err == nil {
+		t.Error("expected an error for a directory")
+	}
+}
+
 func TestIsEmpty(t *testing.T) {
 	wd, err := os.Getwd()
 	if err != nil {
@@ -757,6 +2067,40 @@ func TestIsEmpty(t *testing.T) {
 	}
 }
 
+func TestIsNonEmptyDirExcluding(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("onlygit/.git")
+	h.TempFile("junk/.DS_Store", "")
+	h.TempFile("junk/Thumbs.db", "")
+	h.TempDir("full/.git")
+	h.TempFile("full/main.go", "package main\n")
+
+	tests := []struct {
+		dir    string
+		ignore []string
+		want   bool
+	}{
+		{"onlygit", nil, true},
+		{"onlygit", []string{".git"}, false},
+		{"onlygit", []string{".DS_Store"}, true},
+		{"junk", []string{".git", ".DS_Store"}, true},
+		{"junk", []string{".git", ".DS_Store", "Thumbs.db"}, false},
+		{"full", []string{".git"}, true},
+	}
+
+	for _, tc := range tests {
+		got, err := IsNonEmptyDirExcluding(h.Path(tc.dir), tc.ignore...)
+		if err != nil {
+			t.Fatalf("%s, ignoring %v: %s", tc.dir, tc.ignore, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s, ignoring %v: expected %t, got %t", tc.dir, tc.ignore, tc.want, got)
+		}
+	}
+}
+
 func TestIsSymlink(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		// XXX: creating symlinks is not supported in Go on
@@ -835,3 +2179,38 @@ func TestIsSymlink(t *testing.T) {
 		}
 	}
 }
+
+func TestIsSymlinkDangling(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		// XXX: creating symlinks is not supported in Go on
+		// Microsoft Windows. Skipping this this until a solution
+		// for creating symlinks is is provided.
+		t.Skip("skipping on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "target")
+	if err = ioutil.WriteFile(target, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err = os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(target); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := IsSymlink(link)
+	if err != nil {
+		t.Fatalf("expected no error for a dangling symlink, got %v", err)
+	}
+	if !got {
+		t.Error("expected a dangling symlink to be reported as a symlink")
+	}
+}
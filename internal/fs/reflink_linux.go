@@ -0,0 +1,29 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl request number, as defined in linux/fs.h.
+const ficlone = 0x40049409
+
+// reflink attempts to make dst a copy-on-write clone of src using the FICLONE
+// ioctl. Filesystems such as Btrfs and XFS support this; on anything else, or
+// when src and dst live on different filesystems, errReflinkUnsupported is
+// returned so that the caller can fall back to a regular copy.
+func reflink(src, dst *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	switch errno {
+	case 0:
+		return nil
+	case syscall.EOPNOTSUPP, syscall.ENOTTY, syscall.EXDEV, syscall.EINVAL, syscall.ENOSYS, syscall.EPERM:
+		return errReflinkUnsupported
+	default:
+		return errno
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReflink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	want := "hello world"
+	srcpath := filepath.Join(dir, "src")
+	if err = ioutil.WriteFile(srcpath, []byte(want), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := os.Open(srcpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	dstpath := filepath.Join(dir, "dst")
+	dst, err := os.Create(dstpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	err = reflink(src, dst)
+	if err == errReflinkUnsupported {
+		t.Skipf("filesystem backing %s does not support reflinks", dir)
+	}
+	if err != nil {
+		t.Fatalf("expected reflink to succeed, got %s", err)
+	}
+
+	got, err := ioutil.ReadFile(dstpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want != string(got) {
+		t.Fatalf("expected: %s, got: %s", want, string(got))
+	}
+
+	// CopyFile should take the same path and produce identical content.
+	cpypath := filepath.Join(dir, "cpy")
+	if err = CopyFile(srcpath, cpypath); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = ioutil.ReadFile(cpypath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want != string(got) {
+		t.Fatalf("expected: %s, got: %s", want, string(got))
+	}
+}
@@ -0,0 +1,17 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package fs
+
+import "os"
+
+// reflink is not implemented on this platform; callers fall back to a regular
+// copy. macOS clones files with clonefile instead, as clonefile(2) makes the
+// clone at a path that must not exist yet, rather than filling an open file as
+// FICLONE does.
+func reflink(src, dst *os.File) error {
+	return errReflinkUnsupported
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !windows
+
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// SameFilesystem reports whether the paths a and b are on the same
+// filesystem, as determined by their device IDs. Either path may not exist
+// yet, in which case its nearest existing parent directory is used instead.
+func SameFilesystem(a, b string) (bool, error) {
+	da, err := device(a)
+	if err != nil {
+		return false, err
+	}
+	db, err := device(b)
+	if err != nil {
+		return false, err
+	}
+	return da == db, nil
+}
+
+// filesystemKey returns a string that is the same for all paths on the same
+// filesystem as path, and different for paths on others.
+func filesystemKey(path string) (string, error) {
+	d, err := device(path)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(d, 10), nil
+}
+
+// device returns the ID of the device holding path, or its nearest existing
+// parent.
+func device(path string) (uint64, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		fi, err := os.Lstat(path)
+		if err == nil {
+			st, ok := fi.Sys().(*syscall.Stat_t)
+			if !ok {
+				return 0, errors.Errorf("cannot determine the device of %s", path)
+			}
+			return uint64(st.Dev), nil
+		}
+		if !os.IsNotExist(err) {
+			return 0, errors.Wrapf(err, "cannot stat %s", path)
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return 0, errors.Wrapf(err, "cannot stat %s", path)
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build windows
+
+package fs
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// SameFilesystem reports whether the paths a and b are on the same
+// filesystem, as determined by their volume roots (e.g. "C:" or
+// "\\server\share"). Neither path needs to exist.
+func SameFilesystem(a, b string) (bool, error) {
+	a, err := filepath.Abs(a)
+	if err != nil {
+		return false, err
+	}
+	b, err = filepath.Abs(b)
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(filepath.VolumeName(a), filepath.VolumeName(b)), nil
+}
+
+// filesystemKey returns a string that is the same for all paths on the same
+// filesystem as path, and different for paths on others.
+func filesystemKey(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToUpper(filepath.VolumeName(path)), nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// The whence values of lseek(2) that find the data and holes of a file, as
+// defined in linux/fs.h.
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// copySparse copies the contents of src, which is size bytes long, to dst,
+// skipping over the holes in src so that they are left as holes in dst. If
+// the filesystem backing src can't tell where its holes are,
+// errSparseUnsupported is returned, having copied nothing, so that the caller
+// can fall back to a regular copy.
+func copySparse(dst, src *os.File, size int64) error {
+	var off int64
+	for off < size {
+		data, err := src.Seek(off, seekData)
+		if errno(err) == syscall.ENXIO {
+			// There is no more data, only a hole up to the end.
+			break
+		}
+		if err != nil {
+			if off == 0 && errno(err) == syscall.EINVAL {
+				return errSparseUnsupported
+			}
+			return err
+		}
+		hole, err := src.Seek(data, seekHole)
+		if err != nil {
+			return err
+		}
+
+		if _, err = src.Seek(data, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err = dst.Seek(data, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err = io.Copy(dst, io.LimitReader(src, hole-data)); err != nil {
+			return err
+		}
+		off = hole
+	}
+
+	// A trailing hole is made by extending dst to its full size.
+	return dst.Truncate(size)
+}
+
+// errno returns the errno of err, an error from an os.File method, or 0 if it
+// has none.
+func errno(err error) syscall.Errno {
+	if perr, ok := err.(*os.PathError); ok {
+		if en, ok := perr.Err.(syscall.Errno); ok {
+			return en
+		}
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCopyFileSparse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Some data, a hole, more data, and a trailing hole.
+	const size = 16 << 20
+	srcpath := filepath.Join(dir, "src")
+	f, err := os.Create(srcpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt([]byte("start"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt([]byte("middle"), size/2); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := func(path string) int64 {
+		var st syscall.Stat_t
+		if err := syscall.Stat(path, &st); err != nil {
+			t.Fatal(err)
+		}
+		return st.Blocks
+	}
+	if blocks(srcpath)*512 >= size {
+		t.Skipf("filesystem backing %s does not support sparse files", dir)
+	}
+
+	dstpath := filepath.Join(dir, "dst")
+	if err = CopyFile(srcpath, dstpath); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := ioutil.ReadFile(srcpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(dstpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("expected the copy to have the same contents")
+	}
+	if sb, db := blocks(srcpath), blocks(dstpath); db*512 >= size/2 {
+		t.Errorf("expected the copy to stay sparse like the original's %d blocks, got %d", sb, db)
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package fs
+
+import "os"
+
+// copySparse is not implemented on this platform; callers always fall back to
+// a regular copy.
+func copySparse(dst, src *os.File, size int64) error {
+	return errSparseUnsupported
+}
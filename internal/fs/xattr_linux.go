@@ -0,0 +1,100 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"bytes"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// copyXattrs sets every extended attribute of the file named src on the file
+// named dst. Nothing is copied from a filesystem without extended attributes,
+// and the attributes that dst can't store, as its filesystem doesn't support
+// them or only a privileged user may set them, are skipped.
+func copyXattrs(src, dst string) error {
+	names, err := listXattrs(src)
+	if err != nil {
+		return errors.Wrapf(err, "cannot list the extended attributes of %s", src)
+	}
+
+	for _, name := range names {
+		value, err := getXattr(src, name)
+		if err != nil {
+			return errors.Wrapf(err, "cannot get extended attribute %s of %s", name, src)
+		}
+		err = syscall.Setxattr(dst, name, value, 0)
+		if unstorableXattr(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "cannot set extended attribute %s on %s", name, dst)
+		}
+	}
+	return nil
+}
+
+// unstorableXattr reports whether err, returned by Setxattr, means that the
+// attribute can't be stored on the file at all, rather than that setting it
+// failed.
+func unstorableXattr(err error) bool {
+	return err == syscall.ENOTSUP || err == syscall.EPERM
+}
+
+// listXattrs returns the names of the extended attributes of the file named
+// path.
+func listXattrs(path string) ([]string, error) {
+	buf, err := readXattr(func(dest []byte) (int, error) {
+		return syscall.Listxattr(path, dest)
+	})
+	if err == syscall.ENOTSUP {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range bytes.Split(buf, []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+// getXattr returns the value of the extended attribute name of the file named
+// path.
+func getXattr(path, name string) ([]byte, error) {
+	return readXattr(func(dest []byte) (int, error) {
+		return syscall.Getxattr(path, name, dest)
+	})
+}
+
+// readXattr calls read, which is a Listxattr or Getxattr, first to size the
+// buffer that it then reads into. Should what is read grow in between, it
+// tries again.
+func readXattr(read func(dest []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := read(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, size)
+		n, err := read(buf)
+		if err == syscall.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
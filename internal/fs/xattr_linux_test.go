@@ -0,0 +1,72 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCopyFileWithXattrs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcf := filepath.Join(dir, "src")
+	if err = ioutil.WriteFile(srcf, []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	const name, value = "user.dep.test", "quarantined"
+	err = syscall.Setxattr(srcf, name, []byte(value), 0)
+	if err == syscall.ENOTSUP {
+		t.Skipf("filesystem backing %s does not support extended attributes", dir)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A plain copy drops the attribute...
+	plain := filepath.Join(dir, "plain")
+	if err = CopyFile(srcf, plain); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = getXattr(plain, name); err != syscall.ENODATA {
+		t.Errorf("expected CopyFile to leave out %s, got %v", name, err)
+	}
+
+	// ...while CopyFileWithXattrs keeps it.
+	dstf := filepath.Join(dir, "dst")
+	if err = CopyFileWithXattrs(srcf, dstf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := getXattr(dstf, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != value {
+		t.Errorf("expected %s to be %q, got %q", name, value, got)
+	}
+	if contents, err := ioutil.ReadFile(dstf); err != nil || string(contents) != "hello world" {
+		t.Errorf("expected the contents to be copied, got %q, %v", contents, err)
+	}
+}
+
+func TestUnstorableXattr(t *testing.T) {
+	for err, want := range map[error]bool{
+		nil:             false,
+		syscall.ENOTSUP: true,
+		syscall.EPERM:   true,
+		syscall.ENOSPC:  false,
+	} {
+		if got := unstorableXattr(err); got != want {
+			t.Errorf("unstorableXattr(%v) = %v, want %v", err, got, want)
+		}
+	}
+}
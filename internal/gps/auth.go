@@ -0,0 +1,109 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"encoding/base64"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// hostTokens maps hostnames to the access tokens used to authenticate HTTPS
+// requests made to them.
+type hostTokens map[string]string
+
+// tokenFor returns the token for host, which may include a port. A token
+// registered for the exact host:port wins over one registered for the bare
+// hostname.
+func (ht hostTokens) tokenFor(host string) (string, bool) {
+	if tok, has := ht[host]; has {
+		return tok, true
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		tok, has := ht[h]
+		return tok, has
+	}
+	return "", false
+}
+
+// client returns an http.Client that sends requests through base, attaching
+// bearer tokens to HTTPS requests for hosts that have one. If there are no
+// tokens, base is used as is.
+func (ht hostTokens) client(base http.RoundTripper) *http.Client {
+	if len(ht) == 0 {
+		return &http.Client{Transport: base}
+	}
+	return &http.Client{Transport: &tokenTransport{tokens: ht, base: base}}
+}
+
+// gitEnv returns the environment entries that make git authenticate HTTPS
+// requests to hosts that have a token.
+//
+// The tokens are sent as basic auth with an x-access-token user, which is
+// what GitHub expects for app and OAuth tokens, and which other hosts accept
+// as well. They are passed through GIT_CONFIG_PARAMETERS rather than the
+// remote URL so that they never end up on disk.
+func (ht hostTokens) gitEnv() []string {
+	if len(ht) == 0 {
+		return nil
+	}
+
+	hosts := make([]string, 0, len(ht))
+	for host := range ht {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var params []string
+	if existing := os.Getenv("GIT_CONFIG_PARAMETERS"); existing != "" {
+		params = append(params, existing)
+	}
+	for _, host := range hosts {
+		cred := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + ht[host]))
+		params = append(params, shellQuote("http.https://"+host+"/.extraheader=Authorization: Basic "+cred))
+	}
+
+	return []string{"GIT_CONFIG_PARAMETERS=" + strings.Join(params, " ")}
+}
+
+// shellQuote quotes s the way git expects entries in GIT_CONFIG_PARAMETERS to
+// be quoted.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// tokenTransport is an http.RoundTripper that adds an Authorization header to
+// HTTPS requests for hosts that have a token. Plain HTTP requests are never
+// given a token, so it can't leak over an unencrypted connection.
+type tokenTransport struct {
+	tokens hostTokens
+	base   http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	tok, has := t.tokens.tokenFor(req.URL.Host)
+	if !has || req.URL.Scheme != "https" || req.Header.Get("Authorization") != "" {
+		return base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the request they're given.
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Authorization", "Bearer "+tok)
+
+	return base.RoundTrip(r)
+}
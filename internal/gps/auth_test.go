@@ -0,0 +1,100 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHostTokensMetadataAuth(t *testing.T) {
+	const token = "s3cr3t"
+
+	var ipath string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `<html><head><meta name="go-import" content="%s git https://%s"></head></html>`, ipath, ipath)
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "https://")
+	ipath = host + "/foo/bar"
+	// The test server's certificate is self-signed.
+	insecure := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	ctx := context.Background()
+
+	_, _, _, err := getMetadata(ctx, hostTokens(nil).client(insecure), ipath, "https")
+	if err == nil {
+		t.Fatal("expected metadata fetch without a token to fail")
+	}
+
+	// Tokens can be given for the bare hostname, or with a port.
+	for _, key := range []string{"127.0.0.1", host} {
+		tokens := hostTokens{key: token}
+		root, vcs, reporoot, err := getMetadata(ctx, tokens.client(insecure), ipath, "https")
+		if err != nil {
+			t.Fatalf("token for %q: %s", key, err)
+		}
+		if root != ipath || vcs != "git" || reporoot != "https://"+ipath {
+			t.Errorf("token for %q: unexpected metadata (%q, %q, %q)", key, root, vcs, reporoot)
+		}
+	}
+
+	// A token for some other host is not sent.
+	tokens := hostTokens{"github.com": token}
+	if _, _, _, err = getMetadata(ctx, tokens.client(insecure), ipath, "https"); err == nil {
+		t.Fatal("expected metadata fetch with a token for another host to fail")
+	}
+}
+
+func TestHostTokensNotSentOverHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("token sent over plain HTTP: %q", auth)
+		}
+	}))
+	defer srv.Close()
+
+	tokens := hostTokens{"127.0.0.1": "s3cr3t"}
+	resp, err := tokens.client(nil).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestHostTokensGitEnv(t *testing.T) {
+	if env := hostTokens(nil).gitEnv(); env != nil {
+		t.Fatalf("expected no env without tokens, got %v", env)
+	}
+
+	tokens := hostTokens{
+		"github.com":      "ghtoken",
+		"git.example.com": "it's",
+	}
+	env := tokens.gitEnv()
+	if len(env) != 1 || !strings.HasPrefix(env[0], "GIT_CONFIG_PARAMETERS=") {
+		t.Fatalf("unexpected git env %v", env)
+	}
+
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	for _, want := range []string{
+		"'http.https://github.com/.extraheader=Authorization: Basic " + b64("x-access-token:ghtoken") + "'",
+		"'http.https://git.example.com/.extraheader=Authorization: Basic " + b64("x-access-token:it's") + "'",
+	} {
+		if !strings.Contains(env[0], want) {
+			t.Errorf("expected %q in %q", want, env[0])
+		}
+	}
+}
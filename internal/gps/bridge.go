@@ -29,6 +29,7 @@ type sourceBridge interface {
 	//sourceExists(ProjectIdentifier) (bool, error)
 	//syncSourceFor(ProjectIdentifier) error
 	listVersions(ProjectIdentifier) ([]Version, error)
+	requiresSignedTags(ProjectIdentifier) (bool, error)
 	//revisionPresentIn(ProjectIdentifier, Revision) (bool, error)
 	//listPackages(ProjectIdentifier, Version) (pkgtree.PackageTree, error)
 	//getManifestAndLock(ProjectIdentifier, Version, ProjectAnalyzer) (Manifest, Lock, error)
@@ -108,18 +109,44 @@ func (b *bridge) listVersions(id ProjectIdentifier) ([]Version, error) {
 		return nil, err
 	}
 
+	retracted, err := b.sm.ListRetracted(id)
+	if err != nil {
+		b.s.mtr.pop()
+		return nil, err
+	}
+
 	vl := hidePair(pvl)
-	if b.down {
-		SortForDowngrade(vl)
-	} else {
-		SortForUpgrade(vl)
+	b.sortVersions(vl)
+	// Detecting the license of a version means exporting it, so it is only
+	// done when the solve has a license preference.
+	if b.s.licenses.active() {
+		b.s.licenses.prefer(id, vl)
 	}
+	deprioritizeRetracted(vl, retracted)
 
 	b.vlists[id] = vl
 	b.s.mtr.pop()
 	return vl, nil
 }
 
+func (b *bridge) requiresSignedTags(id ProjectIdentifier) (bool, error) {
+	b.s.mtr.push("b-signed-tags")
+	defer b.s.mtr.pop()
+	return b.sm.RequiresSignedTags(id)
+}
+
+// sortVersions puts vl in the order in which the solver tries versions.
+func (b *bridge) sortVersions(vl []Version) {
+	switch {
+	case b.s.preferNewest:
+		sortForNewest(vl)
+	case b.down:
+		SortForDowngrade(vl)
+	default:
+		SortForUpgrade(vl)
+	}
+}
+
 func (b *bridge) RevisionPresentIn(id ProjectIdentifier, r Revision) (bool, error) {
 	b.s.mtr.push("b-rev-present-in")
 	i, e := b.sm.RevisionPresentIn(id, r)
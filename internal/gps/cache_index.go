@@ -0,0 +1,164 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Masterminds/vcs"
+	"github.com/pkg/errors"
+)
+
+// CachedSource describes a repository held in the cache of a SourceMgr.
+type CachedSource struct {
+	// ProjectRoot is the project root that the repository's remote URL
+	// corresponds to, with its scheme, user and any .git suffix removed.
+	ProjectRoot ProjectRoot
+
+	// Source is the URL of the repository's remote.
+	Source string
+
+	// VCS is the type of the repository: "git", "hg" or "bzr".
+	VCS string
+
+	// Revisions are the revisions at the tips of the repository's branches
+	// and tags, sorted.
+	Revisions []Revision
+}
+
+// CachedSources lists the repositories in the cache of sm, in order of their
+// project root. Directories in the cache that don't hold a repository, such
+// as those of interrupted clones, are skipped.
+func (sm *SourceMgr) CachedSources() ([]CachedSource, error) {
+	if atomic.CompareAndSwapInt32(&sm.releasing, 1, 1) {
+		return nil, smIsReleased{}
+	}
+	return listCachedSources(context.TODO(), filepath.Join(sm.cachedir, "sources"))
+}
+
+func listCachedSources(ctx context.Context, dir string) ([]CachedSource, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read %s", dir)
+	}
+
+	var sources []CachedSource
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name())
+		cs, ok, err := readCachedSource(ctx, path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to index %s", path)
+		}
+		if ok {
+			sources = append(sources, cs)
+		}
+	}
+
+	sort.Sort(byCachedProjectRoot(sources))
+	return sources, nil
+}
+
+// readCachedSource describes the repository at path. It reports false if there
+// is no repository there.
+func readCachedSource(ctx context.Context, path string) (CachedSource, bool, error) {
+	typ, err := vcs.DetectVcsFromFS(path)
+	if err != nil {
+		return CachedSource{}, false, nil
+	}
+
+	// Passing no remote makes the repositories take the one they were
+	// cloned from.
+	var repo vcs.Repo
+	var args []string
+	switch typ {
+	case vcs.Git:
+		repo, err = vcs.NewGitRepo("", path)
+		args = []string{"git", "log", "--all", "--no-walk", "--format=%H"}
+	case vcs.Hg:
+		repo, err = vcs.NewHgRepo("", path)
+		args = []string{"hg", "log", "-r", "head() or tag()", "--template", "{node}\n"}
+	case vcs.Bzr:
+		repo, err = vcs.NewBzrRepo("", path)
+		args = []string{"bzr", "tags", "--show-ids"}
+	default:
+		return CachedSource{}, false, nil
+	}
+	if err != nil {
+		return CachedSource{}, false, err
+	}
+
+	out, err := runFromRepoDir(ctx, repo, args[0], args[1:]...)
+	if err != nil {
+		return CachedSource{}, false, newVcsLocalErrorOr("unable to list revisions", err, string(out))
+	}
+	revs := make(map[Revision]bool)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		// bzr lists tags as "<name> <revid>".
+		if fields := strings.Fields(line); len(fields) > 0 {
+			revs[Revision(fields[len(fields)-1])] = true
+		}
+	}
+
+	if typ == vcs.Bzr {
+		// bzr tags only cover tags, so add the tip of the branch.
+		out, err := runFromRepoDir(ctx, repo, "bzr", "version-info", "--custom", "--template={revision_id}")
+		if err != nil {
+			return CachedSource{}, false, newVcsLocalErrorOr("unable to read the tip revision", err, string(out))
+		}
+		revs[Revision(strings.TrimSpace(string(out)))] = true
+	}
+
+	cs := CachedSource{
+		ProjectRoot: remoteProjectRoot(repo.Remote()),
+		Source:      repo.Remote(),
+		VCS:         string(typ),
+		Revisions:   make([]Revision, 0, len(revs)),
+	}
+	for r := range revs {
+		cs.Revisions = append(cs.Revisions, r)
+	}
+	sort.Sort(byRevision(cs.Revisions))
+	return cs, true, nil
+}
+
+// remoteProjectRoot returns the project root corresponding to a remote URL,
+// such as github.com/pkg/errors for https://github.com/pkg/errors.git or
+// git@github.com:pkg/errors.
+func remoteProjectRoot(remote string) ProjectRoot {
+	p := remote
+	if m := scpSyntaxRe.FindStringSubmatch(remote); m != nil {
+		p = m[2] + "/" + m[3]
+	} else if u, err := url.Parse(remote); err == nil && u.Scheme != "" {
+		p = u.Host + u.Path
+	}
+	p = strings.TrimSuffix(strings.TrimSuffix(p, "/"), ".git")
+	return ProjectRoot(p)
+}
+
+type byCachedProjectRoot []CachedSource
+
+func (s byCachedProjectRoot) Len() int      { return len(s) }
+func (s byCachedProjectRoot) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCachedProjectRoot) Less(i, j int) bool {
+	if s[i].ProjectRoot != s[j].ProjectRoot {
+		return s[i].ProjectRoot < s[j].ProjectRoot
+	}
+	return s[i].Source < s[j].Source
+}
+
+type byRevision []Revision
+
+func (s byRevision) Len() int           { return len(s) }
+func (s byRevision) Less(i, j int) bool { return s[i] < s[j] }
+func (s byRevision) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,89 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCachedSources(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestCachedSources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	// The upstream has a tagged commit, and a later one on master.
+	upstream := filepath.Join(tmp, "upstream")
+	tagged := newGitFixture(t, upstream, map[string]string{"main.go": "package main\n"})
+	git(upstream, "tag", "v1.0.0")
+	git(upstream, "-c", "user.name=dep", "-c", "user.email=dep@example.com", "commit", "-q", "--allow-empty", "-m", "next")
+	tip := Revision(git(upstream, "rev-parse", "HEAD"))
+
+	cachedir := filepath.Join(tmp, "cache")
+	sources := filepath.Join(cachedir, "sources")
+	if err := os.MkdirAll(filepath.Join(sources, "interrupted"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	// The clone's remote is pointed at a hosted URL, as those in a real cache
+	// are.
+	clone := filepath.Join(sources, "https---example.com-foo-bar.git")
+	git(sources, "clone", "-q", upstream, clone)
+	git(clone, "remote", "set-url", "origin", "https://example.com/foo/bar.git")
+
+	sm, err := NewSourceManager(SourceManagerConfig{Cachedir: cachedir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+
+	got, err := sm.CachedSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	revs := []Revision{tagged, tip}
+	sort.Sort(byRevision(revs))
+	want := []CachedSource{{
+		ProjectRoot: "example.com/foo/bar",
+		Source:      "https://example.com/foo/bar.git",
+		VCS:         "git",
+		Revisions:   revs,
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected cache index:\n\t(GOT) %#v\n\t(WNT) %#v", got, want)
+	}
+}
+
+func TestRemoteProjectRoot(t *testing.T) {
+	cases := map[string]ProjectRoot{
+		"https://github.com/pkg/errors":       "github.com/pkg/errors",
+		"https://github.com/pkg/errors.git":   "github.com/pkg/errors",
+		"ssh://git@github.com/pkg/errors":     "github.com/pkg/errors",
+		"git@github.com:pkg/errors.git":       "github.com/pkg/errors",
+		"https://bitbucket.org/ww/goautoneg/": "bitbucket.org/ww/goautoneg",
+	}
+	for remote, want := range cases {
+		if got := remoteProjectRoot(remote); got != want {
+			t.Errorf("remoteProjectRoot(%q) = %q, want %q", remote, got, want)
+		}
+	}
+}
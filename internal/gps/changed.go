@@ -0,0 +1,59 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "sort"
+
+// ChangedProjects returns the sorted roots of the projects whose constraints
+// in the root manifest m, with its overrides applied, are not met by the lock
+// l. After an edit to m, they are the only projects that need to be solved
+// again; every other locked project can stay pinned to its locked version.
+//
+// A project is included if a constraint on it was:
+//
+//  - added: m constrains it, or overrides it, but it isn't in l.
+//  - modified: the constraint m places on it doesn't match the version it is
+//  locked to, or m takes it from a different source than l does.
+//
+// A removed constraint never requires a project to be solved again, as the
+// version it is locked to still meets the constraint that is left, which is
+// any version at all.
+func ChangedProjects(l Lock, m RootManifest) []ProjectRoot {
+	combined := m.DependencyConstraints().merge(m.TestDependencyConstraints())
+	for pr, pp := range m.Overrides() {
+		if _, has := combined[pr]; !has {
+			combined[pr] = pp
+		}
+	}
+
+	locked := make(map[ProjectRoot]LockedProject)
+	if l != nil {
+		for _, lp := range l.Projects() {
+			locked[lp.Ident().ProjectRoot] = lp
+		}
+	}
+
+	var changed []ProjectRoot
+	for _, wc := range m.Overrides().overrideAll(combined) {
+		lp, has := locked[wc.Ident.ProjectRoot]
+		switch {
+		case !has:
+			changed = append(changed, wc.Ident.ProjectRoot)
+		case wc.Ident.Source != lp.Ident().Source:
+			changed = append(changed, wc.Ident.ProjectRoot)
+		case wc.Constraint != nil && !wc.Constraint.Matches(lp.Version()):
+			changed = append(changed, wc.Ident.ProjectRoot)
+		}
+	}
+
+	sort.Sort(sortedProjectRoots(changed))
+	return changed
+}
+
+type sortedProjectRoots []ProjectRoot
+
+func (s sortedProjectRoots) Len() int           { return len(s) }
+func (s sortedProjectRoots) Less(i, j int) bool { return s[i] < s[j] }
+func (s sortedProjectRoots) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
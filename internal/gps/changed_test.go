@@ -0,0 +1,79 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChangedProjects(t *testing.T) {
+	semver := func(body string) Constraint {
+		c, err := NewSemverConstraint(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	locked := func(pr, source string, v Version) LockedProject {
+		return NewLockedProject(ProjectIdentifier{ProjectRoot: ProjectRoot(pr), Source: source}, v, []string{"."})
+	}
+
+	l := SimpleLock{
+		locked("github.com/kept/kept", "", NewVersion("v1.2.0").Is("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")),
+		locked("github.com/bumped/bumped", "", NewVersion("v1.2.0").Is("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")),
+		locked("github.com/removed/removed", "", NewVersion("v1.2.0").Is("cccccccccccccccccccccccccccccccccccccccc")),
+		locked("github.com/moved/moved", "", NewVersion("v1.2.0").Is("dddddddddddddddddddddddddddddddddddddddd")),
+		locked("github.com/branch/branch", "", NewBranch("master").Is("eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee")),
+		locked("github.com/overridden/overridden", "", NewVersion("v1.2.0").Is("ffffffffffffffffffffffffffffffffffffffff")),
+		locked("github.com/loosened/loosened", "", NewVersion("v1.2.0").Is("1111111111111111111111111111111111111111")),
+		locked("github.com/test/test", "", NewVersion("v1.2.0").Is("2222222222222222222222222222222222222222")),
+	}
+
+	m := simpleRootManifest{
+		c: ProjectConstraints{
+			// Still met by the locked version.
+			"github.com/kept/kept": {Constraint: semver("^1.0.0")},
+			// Bumped past the locked version.
+			"github.com/bumped/bumped": {Constraint: semver("^2.0.0")},
+			// Now taken from a fork.
+			"github.com/moved/moved": {Source: "github.com/fork/moved", Constraint: semver("^1.0.0")},
+			// Switched from a branch to releases.
+			"github.com/branch/branch": {Constraint: semver("^1.0.0")},
+			// Constrained out of the locked version, but overridden back in.
+			"github.com/loosened/loosened": {Constraint: semver("^2.0.0")},
+			// Added, so not yet locked.
+			"github.com/added/added": {Constraint: semver("^1.0.0")},
+		},
+		tc: ProjectConstraints{
+			"github.com/test/test": {Constraint: semver("~1.3.0")},
+		},
+		ovr: ProjectConstraints{
+			"github.com/overridden/overridden": {Constraint: semver("<1.0.0")},
+			"github.com/loosened/loosened":     {Constraint: semver("^1.0.0")},
+			"github.com/new/override":          {Constraint: Any()},
+		},
+	}
+
+	want := []ProjectRoot{
+		"github.com/added/added",
+		"github.com/branch/branch",
+		"github.com/bumped/bumped",
+		"github.com/moved/moved",
+		"github.com/new/override",
+		"github.com/overridden/overridden",
+		"github.com/test/test",
+	}
+	if got := ChangedProjects(l, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected changed projects:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+
+	if got := ChangedProjects(l, simpleRootManifest{}); got != nil {
+		t.Errorf("expected no changes when every constraint is removed, got %v", got)
+	}
+	if got := ChangedProjects(nil, m); len(got) != len(m.c)+len(m.tc)+2 {
+		t.Errorf("expected every constrained project to be changed without a lock, got %v", got)
+	}
+}
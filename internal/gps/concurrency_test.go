@@ -0,0 +1,162 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/internal/gps/pkgtree"
+)
+
+// opTracker counts the operations running at once, keeping the highest count
+// seen. If barrier is set, each operation waits until barrier operations are
+// running together, or gives up after a while.
+type opTracker struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	running int
+	max     int
+	barrier int
+}
+
+func newOpTracker(barrier int) *opTracker {
+	ot := &opTracker{barrier: barrier}
+	ot.cond = sync.NewCond(&ot.mu)
+	return ot
+}
+
+func (ot *opTracker) op() error {
+	ot.mu.Lock()
+	ot.running++
+	if ot.running > ot.max {
+		ot.max = ot.running
+	}
+	ot.cond.Broadcast()
+
+	var err error
+	if ot.barrier > 0 {
+		deadline := time.Now().Add(5 * time.Second)
+		timer := time.AfterFunc(5*time.Second, ot.cond.Broadcast)
+		for ot.max < ot.barrier && time.Now().Before(deadline) {
+			ot.cond.Wait()
+		}
+		timer.Stop()
+		if ot.max < ot.barrier {
+			err = errors.New("operations did not overlap")
+		}
+	}
+	ot.mu.Unlock()
+
+	// Give other operations the chance to overlap with this one.
+	time.Sleep(10 * time.Millisecond)
+
+	ot.mu.Lock()
+	ot.running--
+	ot.mu.Unlock()
+	return err
+}
+
+// fakeSource is a source of the given VCS type, whose local initialization is
+// tracked.
+type fakeSource struct {
+	typ string
+	ot  *opTracker
+}
+
+func (s fakeSource) existsLocally(context.Context) bool       { return false }
+func (s fakeSource) existsUpstream(context.Context) bool      { return true }
+func (s fakeSource) upstreamURL() string                      { return "https://example.com/" + s.typ }
+func (s fakeSource) initLocal(context.Context) error          { return s.ot.op() }
+func (s fakeSource) updateLocal(context.Context) error        { return s.ot.op() }
+func (s fakeSource) revisionPresentIn(Revision) (bool, error) { return false, nil }
+func (s fakeSource) sourceType() string                       { return s.typ }
+func (s fakeSource) listVersions(context.Context) ([]PairedVersion, error) {
+	return nil, nil
+}
+func (s fakeSource) getManifestAndLock(context.Context, ProjectRoot, Revision, ProjectAnalyzer) (Manifest, Lock, error) {
+	return nil, nil, nil
+}
+func (s fakeSource) listPackages(context.Context, ProjectRoot, Revision) (pkgtree.PackageTree, error) {
+	return pkgtree.PackageTree{}, nil
+}
+func (s fakeSource) commitTime(context.Context, Revision) (time.Time, error) {
+	return time.Time{}, nil
+}
+func (s fakeSource) exportRevisionTo(context.Context, Revision, string) error { return nil }
+
+type maybeFakeSource struct {
+	src fakeSource
+}
+
+func (m maybeFakeSource) try(ctx context.Context, cachedir string, opts sourceOptions, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
+	return m.src, 0, nil
+}
+
+func (m maybeFakeSource) getURL() string { return m.src.upstreamURL() }
+
+func TestVCSConcurrencyLimits(t *testing.T) {
+	const n = 4
+
+	for _, tc := range []struct {
+		typ     string
+		barrier int
+		wantMax int
+	}{
+		// hg is limited to one operation at a time, so they must never
+		// overlap.
+		{"hg", 0, 1},
+		// git isn't limited, so all of its operations may run at once; the
+		// barrier makes each wait for the others.
+		{"git", n, n},
+		// Registered backends are limited by their scheme.
+		{"artifact", 0, 1},
+	} {
+		t.Run(tc.typ, func(t *testing.T) {
+			ctx := context.Background()
+			superv := newSupervisor(ctx)
+			if err := superv.setLimits(map[string]int{"hg": 1, "artifact": 1}); err != nil {
+				t.Fatal(err)
+			}
+
+			ot := newOpTracker(tc.barrier)
+			var wg sync.WaitGroup
+			errs := make([]error, n)
+			for i := 0; i < n; i++ {
+				sg := newSourceGateway(maybeFakeSource{fakeSource{tc.typ, ot}}, superv, "", sourceOptions{})
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					errs[i] = sg.syncLocal(ctx)
+				}(i)
+			}
+			wg.Wait()
+
+			for _, err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if ot.max != tc.wantMax {
+				t.Errorf("expected at most %d %s operations at once, got %d", tc.wantMax, tc.typ, ot.max)
+			}
+		})
+	}
+}
+
+func TestSupervisorSetLimitsErrors(t *testing.T) {
+	for _, limits := range []map[string]int{
+		{"svn": 1},
+		{"git": 0},
+	} {
+		superv := newSupervisor(context.Background())
+		if err := superv.setLimits(limits); err == nil {
+			t.Errorf("expected an error for limits %v", limits)
+		}
+	}
+}
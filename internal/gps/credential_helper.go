@@ -0,0 +1,214 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// credential is a username and password for a host.
+type credential struct {
+	username, password string
+}
+
+// credentialHelper obtains credentials for HTTPS hosts from an external
+// program, which speaks the protocol of git's credential helpers: it is run
+// with a "get" argument, is given the protocol, host and path of the request
+// on its stdin, and prints the username and password to use.
+//
+// The credentials for each host are only asked for once, and kept for the
+// life of the helper. Hosts that have a token are never asked about, as the
+// token takes precedence. If the helper fails for a host, the failure is
+// logged and the host is left without a credential from it, so that its
+// requests fall back to whatever else authenticates them, such as git's own
+// credential configuration, or go without.
+type credentialHelper struct {
+	command []string
+	tokens  hostTokens
+	log     *log.Logger // if not nil, receives the helper's failures
+
+	mu    sync.Mutex
+	hosts map[string]*hostCredential
+}
+
+// hostCredential is the credential the helper gave for a host. Its lock is
+// held while the helper runs, so that concurrent requests to the same host
+// don't ask for it twice, while those to other hosts don't wait on it.
+type hostCredential struct {
+	mu   sync.Mutex
+	done bool
+	c    *credential // nil if the helper gave none
+}
+
+// newCredentialHelper returns a helper that runs command, split on spaces, or
+// nil if command is empty.
+func newCredentialHelper(command string, tokens hostTokens, logger *log.Logger) *credentialHelper {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil
+	}
+	return &credentialHelper{
+		command: fields,
+		tokens:  tokens,
+		log:     logger,
+		hosts:   make(map[string]*hostCredential),
+	}
+}
+
+// get returns the credential for the HTTPS URL u, asking the helper for it if
+// it hasn't been already. It reports false if there is none.
+func (h *credentialHelper) get(ctx context.Context, u *url.URL) (credential, bool) {
+	if u.Scheme != "https" {
+		return credential{}, false
+	}
+	if _, has := h.tokens.tokenFor(u.Host); has {
+		return credential{}, false
+	}
+
+	h.mu.Lock()
+	hc, has := h.hosts[u.Host]
+	if !has {
+		hc = new(hostCredential)
+		h.hosts[u.Host] = hc
+	}
+	h.mu.Unlock()
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if !hc.done {
+		c, err := h.run(ctx, u)
+		switch {
+		case err == nil:
+			hc.c, hc.done = c, true
+		case ctx.Err() != nil:
+			// The request was given up on, rather than the helper failing;
+			// a later one may ask again.
+		default:
+			if h.log != nil {
+				h.log.Println(err)
+			}
+			hc.done = true
+		}
+	}
+	if hc.c == nil {
+		return credential{}, false
+	}
+	return *hc.c, true
+}
+
+// run asks the helper for the credential for the HTTPS URL u, returning nil
+// if it gives none.
+func (h *credentialHelper) run(ctx context.Context, u *url.URL) (*credential, error) {
+
+	var in bytes.Buffer
+	fmt.Fprintf(&in, "protocol=https\nhost=%s\n", u.Host)
+	if p := strings.TrimPrefix(u.Path, "/"); p != "" {
+		fmt.Fprintf(&in, "path=%s\n", p)
+	}
+	in.WriteString("\n")
+
+	args := append(h.command[1:len(h.command):len(h.command)], "get")
+	cmd := exec.Command(h.command[0], args...)
+	cmd.Stdin = &in
+	out, err := newMonitoredCmd(cmd, 30*time.Second).combinedOutput(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %s failed for %s: %s\n%s", h.command[0], u.Host, err, out)
+	}
+
+	var c credential
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		kv := strings.SplitN(s.Text(), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "username":
+			c.username = kv[1]
+		case "password":
+			c.password = kv[1]
+		}
+	}
+	if c.username == "" && c.password == "" {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+// gitEnv returns env, with the configuration that makes git send the
+// credential for the HTTPS URL u, if there is one, added to it. Like host
+// tokens, the credential is passed through GIT_CONFIG_PARAMETERS, so that it
+// never ends up on disk.
+func (h *credentialHelper) gitEnv(ctx context.Context, u *url.URL, env []string) []string {
+	if h == nil {
+		return env
+	}
+	c, ok := h.get(ctx, u)
+	if !ok {
+		return env
+	}
+
+	cred := base64.StdEncoding.EncodeToString([]byte(c.username + ":" + c.password))
+	param := shellQuote("http.https://" + u.Host + "/.extraheader=Authorization: Basic " + cred)
+
+	out := make([]string, len(env), len(env)+1)
+	copy(out, env)
+	for i, kv := range out {
+		if strings.HasPrefix(kv, "GIT_CONFIG_PARAMETERS=") {
+			out[i] = kv + " " + param
+			return out
+		}
+	}
+	if existing := os.Getenv("GIT_CONFIG_PARAMETERS"); existing != "" {
+		param = existing + " " + param
+	}
+	return append(out, "GIT_CONFIG_PARAMETERS="+param)
+}
+
+// credentialTransport is an http.RoundTripper that adds the credential from
+// its helper as basic auth to HTTPS requests that carry no other
+// authorization.
+type credentialTransport struct {
+	helper *credentialHelper
+	base   http.RoundTripper
+}
+
+func (t *credentialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Header.Get("Authorization") != "" {
+		return base.RoundTrip(req)
+	}
+
+	c, ok := t.helper.get(req.Context(), req.URL)
+	if !ok {
+		return base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the request they're given.
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.SetBasicAuth(c.username, c.password)
+
+	return base.RoundTrip(r)
+}
@@ -0,0 +1,206 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCredentialHelper writes a credential helper script that answers every
+// request with user and pass, and records what it was asked in a log. It
+// returns the helper's command and the path of the log.
+func fakeCredentialHelper(t *testing.T, dir, user, pass string) (string, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake credential helper is a shell script")
+	}
+
+	log := filepath.Join(dir, "helper.log")
+	script := filepath.Join(dir, "helper.sh")
+	body := fmt.Sprintf("#!/bin/sh\necho \"$1\" >> %q\ncat >> %q\necho username=%s\necho password=%s\n", log, log, user, pass)
+	if err := ioutil.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return script, log
+}
+
+func TestCredentialHelperMetadataAuth(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestCredentialHelperMetadataAuth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	command, log := fakeCredentialHelper(t, tmp, "dep", "sh0rtl1ved")
+
+	var ipath string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "dep" || pass != "sh0rtl1ved" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `<html><head><meta name="go-import" content="%s git https://%s"></head></html>`, ipath, ipath)
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "https://")
+	ipath = host + "/foo/bar"
+	// The test server's certificate is self-signed.
+	insecure := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	client := &http.Client{Transport: &credentialTransport{
+		helper: newCredentialHelper(command, nil, nil),
+		base:   insecure,
+	}}
+
+	// The credentials are only asked for once, however many requests are
+	// made to the host.
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		root, vcs, reporoot, err := getMetadata(ctx, client, ipath, "https")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root != ipath || vcs != "git" || reporoot != "https://"+ipath {
+			t.Errorf("unexpected metadata (%q, %q, %q)", root, vcs, reporoot)
+		}
+	}
+
+	got, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "get\nprotocol=https\nhost=" + host + "\npath=foo/bar\n\n"
+	if string(got) != want {
+		t.Errorf("expected the helper to be asked once:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestCredentialHelperGitEnv(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestCredentialHelperGitEnv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	command, _ := fakeCredentialHelper(t, tmp, "dep", "sh0rtl1ved")
+
+	// The helper's credential is added to the token configuration, but isn't
+	// asked for hosts that have a token.
+	tokens := hostTokens{"github.com": "s3cr3t"}
+	helper := newCredentialHelper(command, tokens, nil)
+	ctx := context.Background()
+
+	u := &url.URL{Scheme: "https", Host: "example.com", Path: "/foo/bar"}
+	env := helper.gitEnv(ctx, u, tokens.gitEnv())
+	if len(env) != 1 {
+		t.Fatalf("expected a single GIT_CONFIG_PARAMETERS entry, got %v", env)
+	}
+	cred := base64.StdEncoding.EncodeToString([]byte("dep:sh0rtl1ved"))
+	for _, want := range []string{
+		"'http.https://github.com/.extraheader=Authorization: Basic ",
+		"'http.https://example.com/.extraheader=Authorization: Basic " + cred + "'",
+	} {
+		if !strings.Contains(env[0], want) {
+			t.Errorf("expected %q in %q", want, env[0])
+		}
+	}
+
+	u = &url.URL{Scheme: "https", Host: "github.com", Path: "/foo/bar"}
+	if env = helper.gitEnv(ctx, u, nil); len(env) != 0 {
+		t.Errorf("expected no credential for a host with a token, got %v", env)
+	}
+}
+
+func TestCredentialHelperFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the failing credential helper is a shell script")
+	}
+	tmp, err := ioutil.TempDir("", "TestCredentialHelperFailure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	calls := filepath.Join(tmp, "calls")
+	script := filepath.Join(tmp, "helper.sh")
+	body := fmt.Sprintf("#!/bin/sh\necho x >> %q\necho no such host >&2\nexit 1\n", calls)
+	if err := ioutil.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The request goes ahead without the helper's credential, and the
+	// failure is logged, but only once for the host.
+	var buf bytes.Buffer
+	helper := newCredentialHelper(script, nil, log.New(&buf, "", 0))
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: &credentialTransport{
+		helper: helper,
+		base:   &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL + "/foo/bar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected the request to go without a credential, got %s", resp.Status)
+		}
+	}
+
+	if got, err := ioutil.ReadFile(calls); err != nil || string(got) != "x\n" {
+		t.Errorf("expected the helper to be run once, got %q, %v", got, err)
+	}
+	if !strings.Contains(buf.String(), "no such host") {
+		t.Errorf("expected the failure to be logged, got %q", buf.String())
+	}
+}
+
+func TestCredentialHelperPerHost(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestCredentialHelperPerHost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	command, _ := fakeCredentialHelper(t, tmp, "dep", "sh0rtl1ved")
+
+	// While the helper is busy with one host, another isn't held up.
+	helper := newCredentialHelper(command, nil, nil)
+	busy := new(hostCredential)
+	busy.mu.Lock()
+	defer busy.mu.Unlock()
+	helper.hosts["busy.example.com"] = busy
+
+	done := make(chan bool)
+	go func() {
+		_, ok := helper.get(context.Background(), &url.URL{Scheme: "https", Host: "example.com"})
+		done <- ok
+	}()
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Error("expected a credential for example.com")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("asking for one host's credential waited on another's")
+	}
+}
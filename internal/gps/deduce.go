@@ -489,54 +489,86 @@ func (m vcsExtensionDeducer) deduceSource(path string, u *url.URL) (maybeSource,
 		u.Host = x[0]
 		u.Path = "/" + x[1]
 
-		if u.Scheme != "" {
-			if !validateVCSScheme(u.Scheme, v[4]) {
-				return nil, fmt.Errorf("%s is not a valid scheme for accessing %s repositories (path %s)", u.Scheme, v[4], path)
-			}
-
-			switch v[4] {
-			case "git":
-				return maybeGitSource{url: u}, nil
-			case "bzr":
-				return maybeBzrSource{url: u}, nil
-			case "hg":
-				return maybeHgSource{url: u}, nil
-			}
+		if u.Scheme != "" && !validateVCSScheme(u.Scheme, v[4]) {
+			return nil, fmt.Errorf("%s is not a valid scheme for accessing %s repositories (path %s)", u.Scheme, v[4], path)
 		}
+		return maybeSourcesForVCS(v[4], u), nil
+	default:
+		return nil, fmt.Errorf("unknown repository type: %q", v[4])
+	}
+}
 
-		var schemes []string
-		var mb maybeSources
-		var f func(k int, u *url.URL)
-
-		switch v[4] {
+// maybeSourcesForVCS returns the maybeSource for a repository of type vcs at
+// u. If u has no scheme, each scheme the vcs supports is tried in turn.
+func maybeSourcesForVCS(vcs string, u *url.URL) maybeSource {
+	if u.Scheme != "" {
+		switch vcs {
 		case "git":
-			schemes = gitSchemes
-			f = func(k int, u *url.URL) {
-				mb[k] = maybeGitSource{url: u}
-			}
+			return maybeGitSource{url: u}
 		case "bzr":
-			schemes = bzrSchemes
-			f = func(k int, u *url.URL) {
-				mb[k] = maybeBzrSource{url: u}
-			}
+			return maybeBzrSource{url: u}
 		case "hg":
-			schemes = hgSchemes
-			f = func(k int, u *url.URL) {
-				mb[k] = maybeHgSource{url: u}
-			}
+			return maybeHgSource{url: u}
 		}
+	}
 
-		mb = make(maybeSources, len(schemes))
-		for k, scheme := range schemes {
-			u2 := *u
-			u2.Scheme = scheme
-			f(k, &u2)
+	var schemes []string
+	var mb maybeSources
+	var f func(k int, u *url.URL)
+
+	switch vcs {
+	case "git":
+		schemes = gitSchemes
+		f = func(k int, u *url.URL) {
+			mb[k] = maybeGitSource{url: u}
+		}
+	case "bzr":
+		schemes = bzrSchemes
+		f = func(k int, u *url.URL) {
+			mb[k] = maybeBzrSource{url: u}
+		}
+	case "hg":
+		schemes = hgSchemes
+		f = func(k int, u *url.URL) {
+			mb[k] = maybeHgSource{url: u}
 		}
+	}
+
+	mb = make(maybeSources, len(schemes))
+	for k, scheme := range schemes {
+		u2 := *u
+		u2.Scheme = scheme
+		f(k, &u2)
+	}
+
+	return mb
+}
 
-		return mb, nil
+// forcedVCSDeduction returns the deduction for name, a project root or source
+// URL, when its repository type is forced to vcs rather than detected.
+func forcedVCSDeduction(name, vcs string) (pathDeduction, error) {
+	switch vcs {
+	case "git", "hg", "bzr":
 	default:
-		return nil, fmt.Errorf("unknown repository type: %q", v[4])
+		return pathDeduction{}, errors.Errorf("unsupported VCS type %q for %s; must be git, hg or bzr", vcs, name)
+	}
+
+	u, path, err := normalizeURI(name)
+	if err != nil {
+		return pathDeduction{}, err
 	}
+	if u.Host == "" {
+		x := strings.SplitN(path, "/", 2)
+		u.Host = x[0]
+		u.Path = ""
+		if len(x) == 2 {
+			u.Path = "/" + x[1]
+		}
+	} else if !validateVCSScheme(u.Scheme, vcs) {
+		return pathDeduction{}, errors.Errorf("%s is not a valid scheme for accessing %s repositories (source %s)", u.Scheme, vcs, name)
+	}
+
+	return pathDeduction{root: name, mb: maybeSourcesForVCS(vcs, u)}, nil
 }
 
 // A deducer takes an import path and inspects it to determine where the
@@ -555,13 +587,23 @@ type deductionCoordinator struct {
 	mut      sync.RWMutex
 	rootxt   *radix.Tree
 	deducext *deducerTrie
+	client   *http.Client // client for go-get metadata requests
 }
 
-func newDeductionCoordinator(superv *supervisor) *deductionCoordinator {
+// forceVCS makes the deducer use pd for pd.root, and for any paths beneath it,
+// rather than detecting it.
+func (dc *deductionCoordinator) forceVCS(pd pathDeduction) {
+	dc.mut.Lock()
+	dc.rootxt.Insert(pd.root, pd.mb)
+	dc.mut.Unlock()
+}
+
+func newDeductionCoordinator(superv *supervisor, client *http.Client) *deductionCoordinator {
 	dc := &deductionCoordinator{
 		suprvsr:  superv,
 		rootxt:   radix.New(),
 		deducext: pathDeducerTrie(),
+		client:   client,
 	}
 
 	return dc
@@ -622,6 +664,7 @@ func (dc *deductionCoordinator) deduceRootPath(ctx context.Context, path string)
 	hmd := &httpMetadataDeducer{
 		basePath: path,
 		suprvsr:  dc.suprvsr,
+		client:   dc.client,
 		// The vanity deducer will call this func with a completed
 		// pathDeduction if it succeeds in finding one. We process it
 		// back through the action channel to ensure serialized
@@ -659,6 +702,14 @@ func (dc *deductionCoordinator) deduceKnownPaths(path string) (pathDeduction, er
 		return pathDeduction{}, err
 	}
 
+	// Sources with a registered backend are left entirely to it.
+	if fn, has := sourceBackendFor(u.Scheme); has {
+		return pathDeduction{
+			root: path,
+			mb:   maybeBackendSource{url: u, fn: fn},
+		}, nil
+	}
+
 	// First, try the root path-based matches
 	if _, mtch, has := dc.deducext.LongestPrefix(path); has {
 		root, err := mtch.deduceRoot(path)
@@ -700,6 +751,7 @@ type httpMetadataDeducer struct {
 	basePath   string
 	returnFunc func(pathDeduction)
 	suprvsr    *supervisor
+	client     *http.Client
 }
 
 func (hmd *httpMetadataDeducer) deduce(ctx context.Context, path string) (pathDeduction, error) {
@@ -717,7 +769,7 @@ func (hmd *httpMetadataDeducer) deduce(ctx context.Context, path string) (pathDe
 		// Make the HTTP call to attempt to retrieve go-get metadata
 		var root, vcs, reporoot string
 		err = hmd.suprvsr.do(ctx, path, ctHTTPMetadata, func(ctx context.Context) error {
-			root, vcs, reporoot, err = getMetadata(ctx, path, u.Scheme)
+			root, vcs, reporoot, err = getMetadata(ctx, hmd.client, path, u.Scheme)
 			if err != nil {
 				err = errors.Wrapf(err, "unable to read metadata")
 			}
@@ -818,22 +870,22 @@ func normalizeURI(p string) (u *url.URL, newpath string, err error) {
 }
 
 // fetchMetadata fetches the remote metadata for path.
-func fetchMetadata(ctx context.Context, path, scheme string) (rc io.ReadCloser, err error) {
+func fetchMetadata(ctx context.Context, client *http.Client, path, scheme string) (rc io.ReadCloser, err error) {
 	if scheme == "http" {
-		rc, err = doFetchMetadata(ctx, "http", path)
+		rc, err = doFetchMetadata(ctx, client, "http", path)
 		return
 	}
 
-	rc, err = doFetchMetadata(ctx, "https", path)
+	rc, err = doFetchMetadata(ctx, client, "https", path)
 	if err == nil {
 		return
 	}
 
-	rc, err = doFetchMetadata(ctx, "http", path)
+	rc, err = doFetchMetadata(ctx, client, "http", path)
 	return
 }
 
-func doFetchMetadata(ctx context.Context, scheme, path string) (io.ReadCloser, error) {
+func doFetchMetadata(ctx context.Context, client *http.Client, scheme, path string) (io.ReadCloser, error) {
 	url := fmt.Sprintf("%s://%s?go-get=1", scheme, path)
 	switch scheme {
 	case "https", "http":
@@ -842,7 +894,7 @@ func doFetchMetadata(ctx context.Context, scheme, path string) (io.ReadCloser, e
 			return nil, errors.Wrapf(err, "unable to build HTTP request for URL %q", url)
 		}
 
-		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		resp, err := client.Do(req.WithContext(ctx))
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed HTTP request to URL %q", url)
 		}
@@ -858,8 +910,8 @@ func doFetchMetadata(ctx context.Context, scheme, path string) (io.ReadCloser, e
 // scheme is optional. If it's http, only http will be attempted for fetching.
 // Any other scheme (including none) will first try https, then fall back to
 // http.
-func getMetadata(ctx context.Context, path, scheme string) (string, string, string, error) {
-	rc, err := fetchMetadata(ctx, path, scheme)
+func getMetadata(ctx context.Context, client *http.Client, path, scheme string) (string, string, string, error) {
+	rc, err := fetchMetadata(ctx, client, path, scheme)
 	if err != nil {
 		return "", "", "", errors.Wrapf(err, "unable to fetch raw metadata")
 	}
@@ -9,7 +9,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/url"
+	"os"
 	"reflect"
 	"testing"
 )
@@ -54,6 +57,18 @@ var pathDeductionFixtures = map[string][]pathDeductionFixture{
 				maybeGitSource{url: mkurl("http://github.com/sdboyer/gps")},
 			},
 		},
+		{
+			// A major version published in a subdirectory of the repository
+			// lives in the same project as the root.
+			in:   "github.com/sdboyer/gps/v2/foo",
+			root: "github.com/sdboyer/gps",
+			mb: maybeSources{
+				maybeGitSource{url: mkurl("https://github.com/sdboyer/gps")},
+				maybeGitSource{url: mkurl("ssh://git@github.com/sdboyer/gps")},
+				maybeGitSource{url: mkurl("git://github.com/sdboyer/gps")},
+				maybeGitSource{url: mkurl("http://github.com/sdboyer/gps")},
+			},
+		},
 		{
 			// TODO(sdboyer) is this a problem for enforcing uniqueness? do we
 			// need to collapse these extensions?
@@ -650,7 +665,7 @@ func TestVanityDeductionSchemeMismatch(t *testing.T) {
 
 	ctx := context.Background()
 	cm := newSupervisor(ctx)
-	dc := newDeductionCoordinator(cm)
+	dc := newDeductionCoordinator(cm, http.DefaultClient)
 	_, err := dc.deduceRootPath(ctx, "ssh://golang.org/exp")
 	if err == nil {
 		t.Error("should have errored on scheme mismatch between input and go-get metadata")
@@ -670,3 +685,64 @@ func ufmt(u *url.URL) string {
 	return fmt.Sprintf("host=%q, path=%q, opaque=%q, scheme=%q, user=%#v, pass=%#v, rawpath=%q, rawq=%q, frag=%q",
 		u.Host, u.Path, u.Opaque, u.Scheme, user, pass, u.RawPath, u.RawQuery, u.Fragment)
 }
+
+func TestForcedVCSDeduction(t *testing.T) {
+	cachedir, err := ioutil.TempDir("", "TestForcedVCSDeduction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cachedir)
+
+	// bitbucket.org serves both git and hg, so detection would try both.
+	sm, err := NewSourceManager(SourceManagerConfig{
+		Cachedir: cachedir,
+		VCSTypes: map[string]string{
+			"bitbucket.org/sdboyer/reporoot": "git",
+			"https://hg.example.com/baz":     "hg",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+
+	for _, fix := range []pathDeductionFixture{
+		{
+			in:   "bitbucket.org/sdboyer/reporoot/foo/bar",
+			root: "bitbucket.org/sdboyer/reporoot",
+			mb: maybeSources{
+				maybeGitSource{url: mkurl("https://bitbucket.org/sdboyer/reporoot")},
+				maybeGitSource{url: mkurl("ssh://bitbucket.org/sdboyer/reporoot")},
+				maybeGitSource{url: mkurl("git://bitbucket.org/sdboyer/reporoot")},
+				maybeGitSource{url: mkurl("http://bitbucket.org/sdboyer/reporoot")},
+			},
+		},
+		{
+			in:   "https://hg.example.com/baz",
+			root: "https://hg.example.com/baz",
+			mb:   maybeHgSource{url: mkurl("https://hg.example.com/baz")},
+		},
+	} {
+		pd, err := sm.deduceCoord.deduceRootPath(context.Background(), fix.in)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", fix.in, err)
+			continue
+		}
+		if pd.root != fix.root {
+			t.Errorf("%s: expected root %q, got %q", fix.in, fix.root, pd.root)
+		}
+		if !reflect.DeepEqual(pd.mb, fix.mb) {
+			t.Errorf("%s: unexpected maybeSource:\n\t(GOT) %#v\n\t(WNT) %#v", fix.in, pd.mb, fix.mb)
+		}
+	}
+
+	for name, vcs := range map[string]string{
+		"example.com/foo/bar":       "svn",
+		"git://example.com/foo/bar": "hg",
+		"bzr://example.com/foo/bar": "git",
+	} {
+		if _, err := forcedVCSDeduction(name, vcs); err == nil {
+			t.Errorf("expected forcing %s to %s to fail", name, vcs)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "sort"
+
+// excludedVersions holds, for each project, the names of the versions that the
+// solver must never select, as excludeKey gives them.
+type excludedVersions map[ProjectRoot]map[string]bool
+
+func newExcludedVersions(ex map[ProjectRoot][]string) excludedVersions {
+	if len(ex) == 0 {
+		return nil
+	}
+
+	ev := make(excludedVersions, len(ex))
+	for pr, vs := range ex {
+		if len(vs) == 0 {
+			continue
+		}
+		ev[pr] = make(map[string]bool, len(vs))
+		for _, v := range vs {
+			ev[pr][excludeKey(NewVersion(v))] = true
+		}
+	}
+	return ev
+}
+
+// excludes reports whether v is excluded for the project pr. Versions are
+// matched by name, as the same version may be represented by distinct values,
+// and semantic versions by their value, so that v1.3.2 and 1.3.2 are the same;
+// branches and revisions are never excluded by name.
+func (ev excludedVersions) excludes(pr ProjectRoot, v Version) bool {
+	if v.Type() == IsBranch || v.Type() == IsRevision {
+		return false
+	}
+	return ev[pr][excludeKey(v)]
+}
+
+// excludeKey returns the name by which v is matched against the excluded
+// versions.
+func excludeKey(v Version) string {
+	switch tv := v.(type) {
+	case versionPair:
+		return excludeKey(tv.v)
+	case semVersion:
+		return tv.sv.String()
+	}
+	return v.String()
+}
+
+// sorted returns the excluded versions of each project as sorted lists, in
+// order of project root, for hashing.
+func (ev excludedVersions) sorted() []excludedProject {
+	ep := make([]excludedProject, 0, len(ev))
+	for pr, vs := range ev {
+		e := excludedProject{pr: pr}
+		for v := range vs {
+			e.versions = append(e.versions, v)
+		}
+		sort.Strings(e.versions)
+		ep = append(ep, e)
+	}
+	sort.Sort(byExcludedProjectRoot(ep))
+	return ep
+}
+
+type excludedProject struct {
+	pr       ProjectRoot
+	versions []string
+}
+
+type byExcludedProjectRoot []excludedProject
+
+func (s byExcludedProjectRoot) Len() int           { return len(s) }
+func (s byExcludedProjectRoot) Less(i, j int) bool { return s[i].pr < s[j].pr }
+func (s byExcludedProjectRoot) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,196 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSolveExcludedVersions(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a ^1.3.0"),
+			mkDepspec("a 1.3.1"),
+			mkDepspec("a 1.3.2"),
+			mkDepspec("a 1.3.3"),
+			mkDepspec("a 1.3.4"),
+		},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		down    bool
+		exclude []string
+		want    string
+	}{
+		{"none excluded", false, nil, "1.3.4"},
+		{"newest excluded", false, []string{"1.3.2", "1.3.4"}, "1.3.3"},
+		{"downgrade", true, []string{"1.3.1", "1.3.2"}, "1.3.3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			params := SolveParameters{
+				RootDir:         string(fix.ds[0].n),
+				RootPackageTree: fix.rootTree(),
+				Manifest:        fix.rootmanifest(),
+				ProjectAnalyzer: naiveAnalyzer{},
+				Downgrade:       tc.down,
+				Exclude:         map[ProjectRoot][]string{"a": tc.exclude},
+				stdLibFn:        func(string) bool { return false },
+				mkBridgeFn:      overrideMkBridge,
+			}
+
+			s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+			if err != nil {
+				t.Fatalf("Unexpected error while prepping solver: %s", err)
+			}
+			soln, err := s.Solve()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(soln.Projects()) != 1 {
+				t.Fatalf("expected a solution with only a, got %v", soln.Projects())
+			}
+			if got := soln.Projects()[0].Version().String(); got != tc.want {
+				t.Errorf("expected a to be solved to %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSolveExcludedLockedVersion(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a ^1.3.0"),
+			mkDepspec("a 1.3.1"),
+			mkDepspec("a 1.3.2"),
+			mkDepspec("a 1.3.3"),
+		},
+		l: mklock("a 1.3.3"),
+	}
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		Lock:            fix.l,
+		ProjectAnalyzer: naiveAnalyzer{},
+		Exclude:         map[ProjectRoot][]string{"a": {"1.3.3"}},
+		stdLibFn:        func(string) bool { return false },
+		mkBridgeFn:      overrideMkBridge,
+	}
+
+	s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error while prepping solver: %s", err)
+	}
+	soln, err := s.Solve()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := soln.Projects()[0].Version().String(); got != "1.3.2" {
+		t.Errorf("expected the excluded locked version to be replaced by 1.3.2, got %s", got)
+	}
+}
+
+func TestHashInputsExcludedVersions(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+		stdLibFn:        func(string) bool { return false },
+		mkBridgeFn:      overrideMkBridge,
+	}
+
+	s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error while prepping solver: %s", err)
+	}
+	without := string(s.HashInputs())
+
+	params.Exclude = map[ProjectRoot][]string{"a": {"1.0.0"}}
+	s, err = Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error while prepping solver: %s", err)
+	}
+	if string(s.HashInputs()) == without {
+		t.Error("expected excluded versions to change the inputs digest")
+	}
+}
+
+func TestSolveExcludedSelectedVersions(t *testing.T) {
+	allowed := NewVersion("1.3.2").Is("r12")
+	for _, tc := range []struct {
+		name     string
+		root     string
+		lock     fixLock
+		depLock  fixLock
+		wantFail bool
+	}{
+		{name: "newest excluded", root: "a *"},
+		{name: "excluded version locked", root: "a *", lock: mklock("a 1.3.3 r13")},
+		{name: "excluded revision locked", root: "a *", lock: mkrevlock("a 1.3.3 r13")},
+		{name: "excluded version preferred by a dependency's lock", root: "a *", depLock: mklock("a 1.3.3 r13")},
+		{name: "revision of an allowed version", root: "a rr12"},
+		{name: "revision of an excluded version", root: "a rr13", wantFail: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fix := basicFixture{
+				ds: []depspec{
+					mkDepspec("root 0.0.0", tc.root, "b 1.0.0"),
+					mkDepspec("a 1.3.2 r12"),
+					mkDepspec("a 1.3.3 r13"),
+					mkDepspec("b 1.0.0", "a *"),
+				},
+			}
+			params := SolveParameters{
+				RootDir:         string(fix.ds[0].n),
+				RootPackageTree: fix.rootTree(),
+				Manifest:        fix.rootmanifest(),
+				ProjectAnalyzer: naiveAnalyzer{},
+				// Semantic versions are excluded by value, whatever their
+				// spelling.
+				Exclude:    map[ProjectRoot][]string{"a": {"v1.3.3"}},
+				stdLibFn:   func(string) bool { return false },
+				mkBridgeFn: overrideMkBridge,
+			}
+			if tc.lock != nil {
+				params.Lock = tc.lock
+			}
+			sm := signedTagsSM{
+				depspecSourceManager: newdepspecSM(fix.ds, nil),
+				locks:                map[ProjectRoot]fixLock{"b": tc.depLock},
+			}
+
+			s, err := Prepare(params, sm)
+			if err != nil {
+				t.Fatalf("Unexpected error while prepping solver: %s", err)
+			}
+			soln, err := s.Solve()
+			if tc.wantFail {
+				if err == nil {
+					t.Fatalf("expected the solve to fail, got %v", soln.Projects())
+				}
+				if !strings.Contains(err.Error(), "excluded for a") {
+					t.Fatalf("expected an excluded version failure, got %s", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, lp := range soln.Projects() {
+				if lp.Ident().ProjectRoot == "a" && lp.Version() != allowed {
+					t.Errorf("expected a to be solved to %s, got %s", allowed, lp.Version())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileLockPoll is how often an attempt is made to take a file lock that is
+// held elsewhere.
+const fileLockPoll = 20 * time.Millisecond
+
+// fileLock is an exclusive advisory lock on a file, which holds across
+// processes as well as within one.
+type fileLock struct {
+	f *os.File
+}
+
+// lockFile takes the lock on the file at path, creating it and its directory
+// if need be. It waits for as long as the lock is held elsewhere, or until ctx
+// is done.
+func lockFile(ctx context.Context, path string) (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok {
+			return &fileLock{f: f}, nil
+		}
+
+		select {
+		case <-time.After(fileLockPoll):
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// unlock releases the lock. Closing the file is enough to do so.
+func (l *fileLock) unlock() error {
+	return l.f.Close()
+}
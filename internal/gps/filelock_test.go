@@ -0,0 +1,131 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestLockFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	ctx := context.Background()
+	path := filepath.Join(tmp, "sub", "repo.lock")
+	l, err := lockFile(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock isn't taken while it is held...
+	tctx, cancel := context.WithTimeout(ctx, 3*fileLockPoll)
+	defer cancel()
+	if _, err := lockFile(tctx, path); err != context.DeadlineExceeded {
+		t.Fatalf("expected to give up on a held lock, got %v", err)
+	}
+
+	// ...and is as soon as it is released.
+	done := make(chan error, 1)
+	go func() {
+		l2, err := lockFile(ctx, path)
+		if err == nil {
+			err = l2.unlock()
+		}
+		done <- err
+	}()
+	time.Sleep(2 * fileLockPoll)
+	if err := l.unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lock wasn't taken once it was released")
+	}
+}
+
+func TestSourceGatewayRepoLock(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestSourceGatewayRepoLock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	upstream := filepath.Join(tmp, "upstream")
+	rev := newGitFixture(t, upstream, map[string]string{"main.go": "package main\n"})
+
+	// Each gateway stands in for a dep process of its own, sharing the
+	// cache with the other.
+	ctx := context.Background()
+	cachedir := filepath.Join(tmp, "cache")
+	newGateway := func() *sourceGateway {
+		mb := maybeGitSource{url: &url.URL{Scheme: "file", Path: upstream}}
+		return newSourceGateway(mb, newSupervisor(ctx), cachedir, sourceOptions{})
+	}
+
+	// While the repository's lock is held, neither can get at the clone.
+	sg := newGateway()
+	if _, err := sg.listVersions(ctx); err != nil {
+		t.Fatal(err)
+	}
+	held, err := lockFile(ctx, sg.lockPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	finished := make(chan struct{}, 2)
+	for i := range errs {
+		sg := newGateway()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = sg.exportVersionTo(ctx, rev, filepath.Join(tmp, "export", strconv.Itoa(i)))
+			finished <- struct{}{}
+		}(i)
+	}
+
+	select {
+	case <-finished:
+		t.Fatal("expected the export to wait for the repository's lock")
+	case <-time.After(10 * fileLockPoll):
+	}
+	if err := held.unlock(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(tmp, "export", strconv.Itoa(i), "main.go")); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// The shared clone is intact.
+	cmd := exec.Command("git", "fsck", "--strict")
+	cmd.Dir = filepath.Join(cachedir, "sources", sanitizer.Replace((&url.URL{Scheme: "file", Path: upstream}).String()))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("git fsck: %s\n%s", err, out)
+	}
+}
@@ -19,6 +19,8 @@ const (
 	hhImportsReqs = "-IMPORTS/REQS-"
 	hhIgnores     = "-IGNORES-"
 	hhOverrides   = "-OVERRIDES-"
+	hhExcluded    = "-EXCLUDED-"
+	hhMirrors     = "-MIRRORS-"
 	hhAnalyzer    = "-ANALYZER-"
 )
 
@@ -105,6 +107,27 @@ func (s *solver) writeHashingInputs(w io.Writer) {
 		}
 	}
 
+	// Excluded versions are only written when there are any, so that the
+	// digests of projects that don't use them are unchanged.
+	if len(s.exclude) > 0 {
+		writeString(hhExcluded)
+		for _, ep := range s.exclude.sorted() {
+			writeString(string(ep.pr))
+			for _, v := range ep.versions {
+				writeString(v)
+			}
+		}
+	}
+
+	// Likewise for mirrors.
+	if len(s.mirrors) > 0 {
+		writeString(hhMirrors)
+		for _, m := range s.mirrors.sorted() {
+			writeString(m.Prefix)
+			writeString(m.Mirror)
+		}
+	}
+
 	writeString(hhAnalyzer)
 	an, av := s.rd.an.Info()
 	writeString(an)
@@ -8,9 +8,15 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"text/tabwriter"
+	"time"
+
+	"github.com/golang/dep/internal/gps/pkgtree"
 )
 
 func TestHashInputs(t *testing.T) {
@@ -60,6 +66,80 @@ func TestHashInputs(t *testing.T) {
 	}
 }
 
+func TestHashInputsIncremental(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+
+	dir, err := ioutil.TempDir("", "TestHashInputsIncremental")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string, mtime time.Time) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	write("root.go", "package root\n\nimport \"a\"\n", now)
+	write(filepath.Join("sub", "sub.go"), "package sub\n\nimport \"b\"\n", now)
+
+	hash := func(ptree pkgtree.PackageTree) []byte {
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: ptree,
+			Manifest:        fix.rootmanifest(),
+			ProjectAnalyzer: naiveAnalyzer{},
+			stdLibFn:        func(string) bool { return false },
+			mkBridgeFn:      overrideMkBridge,
+		}
+
+		s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+		if err != nil {
+			t.Fatalf("Unexpected error while prepping solver: %s", err)
+		}
+		return s.HashInputs()
+	}
+
+	cache := pkgtree.NewPackageCache()
+	list := func(incremental bool) pkgtree.PackageTree {
+		var ptree pkgtree.PackageTree
+		var err error
+		if incremental {
+			ptree, err = cache.ListPackages(dir, string(fix.ds[0].n))
+		} else {
+			ptree, err = pkgtree.ListPackages(dir, string(fix.ds[0].n))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ptree
+	}
+
+	before := hash(list(true))
+	if full := hash(list(false)); !bytes.Equal(before, full) {
+		t.Fatalf("incremental and full hashes differ before change: %x != %x", before, full)
+	}
+
+	// Change a single file, giving it a distinct modification time.
+	write(filepath.Join("sub", "sub.go"), "package sub\n\nimport (\n\t\"b\"\n\t\"c\"\n)\n", now.Add(time.Minute))
+
+	after := hash(list(true))
+	if full := hash(list(false)); !bytes.Equal(after, full) {
+		t.Fatalf("incremental and full hashes differ after change: %x != %x", after, full)
+	}
+	if bytes.Equal(before, after) {
+		t.Fatal("expected the hash to change after adding an import")
+	}
+}
+
 func TestHashInputsReqsIgs(t *testing.T) {
 	fix := basicFixtures["shared dependency with overlapping constraints"]
 
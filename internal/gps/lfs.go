@@ -0,0 +1,47 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"os/exec"
+)
+
+// lfsFilterConfig routes checkouts through git-lfs's smudge filter, whether or
+// not `git lfs install` has been run for the user.
+var lfsFilterConfig = []string{
+	"-c", "filter.lfs.smudge=git-lfs smudge -- %f",
+	"-c", "filter.lfs.required=true",
+}
+
+// hasLFS reports whether the git-lfs binary is available.
+func hasLFS() bool {
+	_, err := exec.LookPath("git-lfs")
+	return err == nil
+}
+
+// usesLFS reports whether any .gitattributes file in the tree at rev routes
+// files through the LFS filter.
+func (r *gitRepo) usesLFS(ctx context.Context, rev Revision) (bool, error) {
+	out, err := runFromRepoDir(ctx, r, "git", "grep", "-l", "-F", "-e", "filter=lfs", rev.String(), "--", "*.gitattributes")
+	if err != nil {
+		// git grep exits non-zero, without output, when nothing matches.
+		if len(out) == 0 {
+			return false, nil
+		}
+		return false, newVcsLocalErrorOr("unable to search .gitattributes for LFS filters", err, string(out))
+	}
+	return true, nil
+}
+
+// lfsFetch downloads the LFS objects referenced from rev into the repository,
+// so that checking out rev through the LFS filter yields their content.
+func (r *gitRepo) lfsFetch(ctx context.Context, rev Revision) error {
+	out, err := r.remoteCmd(r.CmdFromDir("git", "lfs", "fetch", r.RemoteLocation, rev.String())).combinedOutput(ctx)
+	if err != nil {
+		return newVcsRemoteErrorOr("unable to fetch LFS objects", err, string(out))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeLFS is a stand-in for git-lfs. fetch copies every object from the
+// "server" directory into the repository's LFS store, and smudge replaces a
+// pointer with the content of the object it names from that store.
+const fakeLFS = `#!/bin/sh
+store="$(git rev-parse --git-dir)/lfs/objects"
+case "$1" in
+fetch)
+	mkdir -p "$store" && cp %q/* "$store"/
+	;;
+smudge)
+	oid=$(sed -n 's/^oid sha256://p')
+	cat "$store/$oid"
+	;;
+*)
+	exit 1
+	;;
+esac
+`
+
+func TestGitSourceExportLFS(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake git-lfs is a shell script")
+	}
+
+	tmp, err := ioutil.TempDir("", "TestGitSourceExportLFS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	content := "the real, large content\n"
+	oid := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(content))
+
+	server := filepath.Join(tmp, "server")
+	bin := filepath.Join(tmp, "bin")
+	for _, dir := range []string{server, bin} {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(server, oid), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(bin, "git-lfs"), []byte(fmt.Sprintf(fakeLFS, server)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// The upstream repository holds the pointer, just as one pushed by git-lfs
+	// would.
+	upstream := filepath.Join(tmp, "upstream")
+	rev := newGitFixture(t, upstream, map[string]string{
+		".gitattributes": "*.bin filter=lfs diff=lfs merge=lfs -text\n",
+		"asset.bin":      pointer,
+		"main.go":        "package main\n",
+	})
+
+	for _, tc := range []struct {
+		lfs  bool
+		want string
+	}{
+		{false, pointer},
+		{true, content},
+	} {
+		t.Run(fmt.Sprintf("lfs=%v", tc.lfs), func(t *testing.T) {
+			cachedir := filepath.Join(tmp, fmt.Sprintf("cache-%v", tc.lfs))
+			to := filepath.Join(tmp, fmt.Sprintf("export-%v", tc.lfs))
+
+			ctx := context.Background()
+			mb := maybeGitSource{url: &url.URL{Scheme: "file", Path: upstream}}
+			src, _, err := mb.try(ctx, cachedir, sourceOptions{lfs: tc.lfs}, newMemoryCache(), newSupervisor(ctx))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := src.initLocal(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := src.exportRevisionTo(ctx, rev, to); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ioutil.ReadFile(filepath.Join(to, "asset.bin"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("expected asset.bin to hold %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// licenseFiles are the names, compared case-insensitively, of the files at
+// the root of a project that are searched for its license.
+var licenseFiles = []string{
+	"LICENSE", "LICENSE.txt", "LICENSE.md",
+	"LICENCE", "LICENCE.txt", "LICENCE.md",
+	"COPYING", "COPYING.txt", "COPYING.md",
+}
+
+// licensePatterns map phrases that identify a license to its SPDX
+// identifier. They are tried in order, so that more specific licenses come
+// before those whose text they contain.
+var licensePatterns = []struct {
+	phrase, id string
+}{
+	{"gnu affero general public license", "AGPL-3.0"},
+	{"gnu lesser general public license", "LGPL"},
+	{"gnu library general public license", "LGPL-2.0"},
+	{"gnu general public license", "GPL"},
+	{"mozilla public license version 2.0", "MPL-2.0"},
+	{"apache license", "Apache-2.0"},
+	{"permission is hereby granted, free of charge", "MIT"},
+	{"permission to use, copy, modify, and/or distribute this software", "ISC"},
+	{"neither the name of", "BSD-3-Clause"},
+	{"redistribution and use in source and binary forms", "BSD-2-Clause"},
+	{"this is free and unencumbered software released into the public domain", "Unlicense"},
+}
+
+// licenseVersion matches the version that follows the title of a license,
+// once its text is normalized, such as "version 2.1" in "gnu lesser general
+// public license version 2.1, february 1999".
+var licenseVersion = regexp.MustCompile(`^ version (\d+(?:\.\d+)?)\b`)
+
+// DetectLicense returns the SPDX identifier of the license of the project
+// checked out in dir, as found in a LICENSE or COPYING file at its root. The
+// GPL and LGPL are further told apart by the version after their title. It returns an
+// empty string if no license file is found or its license is not recognized.
+func DetectLicense(dir string) (string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to read %s", dir)
+	}
+
+	names := make(map[string]string, len(fis))
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() {
+			names[strings.ToLower(fi.Name())] = fi.Name()
+		}
+	}
+
+	for _, lf := range licenseFiles {
+		name, ok := names[strings.ToLower(lf)]
+		if !ok {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "", errors.Wrapf(err, "unable to read %s", name)
+		}
+		return classifyLicense(string(b)), nil
+	}
+	return "", nil
+}
+
+// classifyLicense returns the SPDX identifier of the license text, or an
+// empty string if it is not recognized.
+func classifyLicense(text string) string {
+	// Normalize case and whitespace, as license files are often rewrapped.
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+
+	for _, p := range licensePatterns {
+		i := strings.Index(text, p.phrase)
+		if i < 0 {
+			continue
+		}
+		if p.id == "GPL" || p.id == "LGPL" {
+			m := licenseVersion.FindStringSubmatch(text[i+len(p.phrase):])
+			if m == nil {
+				return p.id
+			}
+			v := m[1]
+			if !strings.Contains(v, ".") {
+				v += ".0"
+			}
+			return p.id + "-" + v
+		}
+		return p.id
+	}
+	return ""
+}
+
+// LicensePreference is an experimental hook through which the solver prefers
+// the versions of a project that are under certain licenses, such as when a
+// library was relicensed at some version.
+type LicensePreference struct {
+	// Allowed lists the SPDX identifiers of the preferred licenses.
+	Allowed []string
+
+	// License reports the license of the given version of a project, as an
+	// SPDX identifier, or an empty string if it is not known.
+	// SourceMgr.DetectLicense can be used here.
+	License func(ProjectIdentifier, Version) (string, error)
+}
+
+// active reports whether lp prefers any license, and so whether licenses need
+// to be detected at all.
+func (lp *LicensePreference) active() bool {
+	return lp != nil && len(lp.Allowed) > 0 && lp.License != nil
+}
+
+// prefer reorders the released versions in vl, stably, so that those under
+// an allowed license come before the rest. Otherwise, vl keeps the order in
+// which it was sorted; branches and revisions are left where they are.
+//
+// Versions whose license can't be determined are taken not to be allowed.
+func (lp *LicensePreference) prefer(id ProjectIdentifier, vl []Version) {
+	if !lp.active() {
+		return
+	}
+
+	allowed := make(map[string]bool, len(lp.Allowed))
+	for _, l := range lp.Allowed {
+		allowed[l] = true
+	}
+
+	var slots []int
+	var kept, moved []Version
+	for i, v := range vl {
+		if v.Type() == IsBranch || v.Type() == IsRevision {
+			continue
+		}
+		slots = append(slots, i)
+
+		l, err := lp.License(id, v)
+		if err == nil && allowed[l] {
+			kept = append(kept, v)
+		} else {
+			moved = append(moved, v)
+		}
+	}
+
+	for i, v := range append(kept, moved...) {
+		vl[slots[i]] = v
+	}
+}
+
+// DetectLicense returns the SPDX identifier of the license of the given
+// version of a project, as DetectLicense finds it in an export of that
+// version. It returns an empty string if the license is not recognized.
+//
+// It is suitable as the License function of a LicensePreference.
+func (sm *SourceMgr) DetectLicense(id ProjectIdentifier, v Version) (string, error) {
+	tmp, err := ioutil.TempDir("", "dep-license")
+	if err != nil {
+		return "", errors.Wrap(err, "unable to create a temporary directory")
+	}
+	defer os.RemoveAll(tmp)
+
+	// The export must go to a directory that doesn't yet exist.
+	to := filepath.Join(tmp, "src")
+	if err := sm.ExportProject(id, v, to); err != nil {
+		return "", err
+	}
+	return DetectLicense(to)
+}
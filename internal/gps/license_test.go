@@ -0,0 +1,124 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassifyLicense(t *testing.T) {
+	cases := map[string]string{
+		"MIT License\n\nPermission is hereby granted,\nfree of charge, to any person": "MIT",
+		"Apache License\nVersion 2.0, January 2004":                                   "Apache-2.0",
+		"GNU GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007":                         "GPL-3.0",
+		"GNU GENERAL PUBLIC LICENSE\nVersion 2, June 1991":                            "GPL-2.0",
+		"GNU LESSER GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007":                  "LGPL-3.0",
+		"GNU LESSER GENERAL PUBLIC LICENSE\nVersion 2.1, February 1999":               "LGPL-2.1",
+		"GNU Library General Public License\nVersion 2, June 1991":                    "LGPL-2.0",
+		"GNU General Public License, as published by the Free Software Foundation":    "GPL",
+		"Redistribution and use in source and binary forms ... Neither the name of":   "BSD-3-Clause",
+		"Redistribution and use in source and binary forms, with or without":          "BSD-2-Clause",
+		"All rights reserved.": "",
+	}
+
+	for text, want := range cases {
+		if got := classifyLicense(text); got != want {
+			t.Errorf("classifyLicense(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestDetectLicense(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestDetectLicense")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	got, err := DetectLicense(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "" {
+		t.Errorf("expected no license without a license file, got %q", got)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "license.md"), []byte("Permission is hereby granted, free of charge"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = DetectLicense(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "MIT" {
+		t.Errorf("expected MIT, got %q", got)
+	}
+}
+
+func TestSolvePrefersAllowedLicense(t *testing.T) {
+	// a was relicensed under the GPL at 1.1.0.
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a ^1.0.0"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0"),
+		},
+	}
+	licenses := map[string]string{
+		"1.0.0": "MIT",
+		"1.1.0": "GPL-3.0",
+	}
+
+	for _, tc := range []struct {
+		name string
+		pref *LicensePreference
+		want string
+	}{
+		{"no preference", nil, "1.1.0"},
+		{"nothing allowed", &LicensePreference{
+			License: func(id ProjectIdentifier, v Version) (string, error) {
+				t.Errorf("expected no license to be detected without a preference, got asked about %s", v)
+				return "", nil
+			},
+		}, "1.1.0"},
+		{"prefer MIT", &LicensePreference{
+			Allowed: []string{"MIT", "Apache-2.0"},
+			License: func(id ProjectIdentifier, v Version) (string, error) {
+				return licenses[v.String()], nil
+			},
+		}, "1.0.0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			params := SolveParameters{
+				RootDir:           string(fix.ds[0].n),
+				RootPackageTree:   fix.rootTree(),
+				Manifest:          fix.rootmanifest(),
+				ProjectAnalyzer:   naiveAnalyzer{},
+				LicensePreference: tc.pref,
+				stdLibFn:          func(string) bool { return false },
+				mkBridgeFn:        overrideMkBridge,
+			}
+
+			s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+			if err != nil {
+				t.Fatalf("Unexpected error while prepping solver: %s", err)
+			}
+			soln, err := s.Solve()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(soln.Projects()) != 1 {
+				t.Fatalf("expected a solution with only a, got %v", soln.Projects())
+			}
+			if got := soln.Projects()[0].Version().String(); got != tc.want {
+				t.Errorf("expected a to be solved to %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
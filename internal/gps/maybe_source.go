@@ -22,26 +22,43 @@ import (
 //
 // * Allows control over when deduction logic triggers network activity
 // * Makes it easy to attempt multiple URLs for a given import path
+//
+// The env passed to try holds additional environment entries for the VCS
+// commands that talk to the upstream.
 type maybeSource interface {
-	try(ctx context.Context, cachedir string, c singleSourceCache, superv *supervisor) (source, sourceState, error)
+	try(ctx context.Context, cachedir string, opts sourceOptions, c singleSourceCache, superv *supervisor) (source, sourceState, error)
 	getURL() string
 }
 
 type maybeSources []maybeSource
 
-func (mbs maybeSources) try(ctx context.Context, cachedir string, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
+func (mbs maybeSources) try(ctx context.Context, cachedir string, opts sourceOptions, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
+	src, _, state, err := trySource(ctx, mbs, cachedir, opts, c, superv)
+	return src, state, err
+}
+
+// trySource tries mb like its try method does, and also returns the URL of
+// the maybeSource the source was set up from: that of the first member of
+// mb that succeeded, if mb is a maybeSources.
+func trySource(ctx context.Context, mb maybeSource, cachedir string, opts sourceOptions, c singleSourceCache, superv *supervisor) (source, string, sourceState, error) {
+	mbs, ok := mb.(maybeSources)
+	if !ok {
+		src, state, err := mb.try(ctx, cachedir, opts, c, superv)
+		return src, mb.getURL(), state, err
+	}
+
 	var e sourceFailures
 	for _, mb := range mbs {
-		src, state, err := mb.try(ctx, cachedir, c, superv)
+		src, ustr, state, err := trySource(ctx, mb, cachedir, opts, c, superv)
 		if err == nil {
-			return src, state, nil
+			return src, ustr, state, nil
 		}
 		e = append(e, sourceSetupFailure{
 			ident: mb.getURL(),
 			err:   err,
 		})
 	}
-	return nil, 0, e
+	return nil, "", 0, e
 }
 
 // This really isn't generally intended to be used - the interface is for
@@ -80,7 +97,7 @@ type maybeGitSource struct {
 	url *url.URL
 }
 
-func (m maybeGitSource) try(ctx context.Context, cachedir string, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
+func (m maybeGitSource) try(ctx context.Context, cachedir string, opts sourceOptions, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
 	ustr := m.url.String()
 	path := filepath.Join(cachedir, "sources", sanitizer.Replace(ustr))
 
@@ -89,6 +106,13 @@ func (m maybeGitSource) try(ctx context.Context, cachedir string, c singleSource
 	if err != nil {
 		return nil, 0, unwrapVcsErr(err)
 	}
+	r.(*gitRepo).env = opts.creds.gitEnv(ctx, m.url, opts.env)
+	r.(*gitRepo).lfs = opts.lfs
+	r.(*gitRepo).depth = opts.depth
+	r.(*gitRepo).refNamespace = opts.refNamespace
+	if opts.signedTags {
+		r.(*gitRepo).keyring = opts.keyring
+	}
 
 	src := &gitSource{
 		baseVCSSource: baseVCSSource{
@@ -96,16 +120,28 @@ func (m maybeGitSource) try(ctx context.Context, cachedir string, c singleSource
 		},
 	}
 
-	// Pinging invokes the same action as calling listVersions, so just do that.
-	var vl []PairedVersion
-	err = superv.do(ctx, "git:lv:maybe", ctListVersions, func(ctx context.Context) (err error) {
-		if vl, err = src.listVersions(ctx); err != nil {
-			return fmt.Errorf("remote repository at %s does not exist, or is inaccessible", ustr)
+	if opts.offline {
+		return offlineSource(src, r, ustr)
+	}
+
+	// Pinging invokes the same action as calling listVersions, so just do that,
+	// unless a fresh list is cached.
+	key := metadataKey(m.getURL(), opts)
+	vl, cached := opts.metadata.load(key)
+	if !cached {
+		err = superv.doLimited(ctx, "git", "git:lv:maybe", ctListVersions, func(ctx context.Context) (err error) {
+			if vl, err = src.listVersions(ctx); err != nil {
+				if _, ok := err.(noSignedTagsError); ok {
+					return err
+				}
+				return fmt.Errorf("remote repository at %s does not exist, or is inaccessible", ustr)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
 		}
-		return nil
-	})
-	if err != nil {
-		return nil, 0, err
+		opts.metadata.save(key, vl)
 	}
 
 	c.storeVersionMap(vl, true)
@@ -118,6 +154,15 @@ func (m maybeGitSource) try(ctx context.Context, cachedir string, c singleSource
 	return src, state, nil
 }
 
+// offlineSource returns src, set up from the cache alone as it must be when
+// offline, or an error if its repository r isn't in the cache.
+func offlineSource(src source, r ctxRepo, ustr string) (source, sourceState, error) {
+	if !r.CheckLocal() {
+		return nil, 0, fmt.Errorf("%s is not in the cache, and cannot be fetched while offline", ustr)
+	}
+	return src, sourceIsSetUp | sourceExistsLocally, nil
+}
+
 func (m maybeGitSource) getURL() string {
 	return m.url.String()
 }
@@ -136,7 +181,7 @@ type maybeGopkginSource struct {
 	unstable bool
 }
 
-func (m maybeGopkginSource) try(ctx context.Context, cachedir string, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
+func (m maybeGopkginSource) try(ctx context.Context, cachedir string, opts sourceOptions, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
 	// We don't actually need a fully consistent transform into the on-disk path
 	// - just something that's unique to the particular gopkg.in domain context.
 	// So, it's OK to just dumb-join the scheme with the path.
@@ -147,6 +192,13 @@ func (m maybeGopkginSource) try(ctx context.Context, cachedir string, c singleSo
 	if err != nil {
 		return nil, 0, unwrapVcsErr(err)
 	}
+	r.(*gitRepo).env = opts.creds.gitEnv(ctx, m.url, opts.env)
+	r.(*gitRepo).lfs = opts.lfs
+	r.(*gitRepo).depth = opts.depth
+	r.(*gitRepo).refNamespace = opts.refNamespace
+	if opts.signedTags {
+		r.(*gitRepo).keyring = opts.keyring
+	}
 
 	src := &gopkginSource{
 		gitSource: gitSource{
@@ -158,15 +210,26 @@ func (m maybeGopkginSource) try(ctx context.Context, cachedir string, c singleSo
 		unstable: m.unstable,
 	}
 
-	var vl []PairedVersion
-	err = superv.do(ctx, "git:lv:maybe", ctListVersions, func(ctx context.Context) (err error) {
-		if vl, err = src.listVersions(ctx); err != nil {
-			return fmt.Errorf("remote repository at %s does not exist, or is inaccessible", ustr)
+	if opts.offline {
+		return offlineSource(src, r, ustr)
+	}
+
+	key := metadataKey(m.getURL(), opts)
+	vl, cached := opts.metadata.load(key)
+	if !cached {
+		err = superv.doLimited(ctx, "git", "git:lv:maybe", ctListVersions, func(ctx context.Context) (err error) {
+			if vl, err = src.listVersions(ctx); err != nil {
+				if _, ok := err.(noSignedTagsError); ok {
+					return err
+				}
+				return fmt.Errorf("remote repository at %s does not exist, or is inaccessible", ustr)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
 		}
-		return nil
-	})
-	if err != nil {
-		return nil, 0, err
+		opts.metadata.save(key, vl)
 	}
 
 	c.storeVersionMap(vl, true)
@@ -187,17 +250,27 @@ type maybeBzrSource struct {
 	url *url.URL
 }
 
-func (m maybeBzrSource) try(ctx context.Context, cachedir string, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
+func (m maybeBzrSource) try(ctx context.Context, cachedir string, opts sourceOptions, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
 	ustr := m.url.String()
 	path := filepath.Join(cachedir, "sources", sanitizer.Replace(ustr))
 
+	if !opts.offline {
+		if err := checkCustomCAs("bzr", m.url, opts); err != nil {
+			return nil, 0, err
+		}
+	}
+
 	r, err := newCtxRepo(vcs.Bzr, ustr, path)
 
 	if err != nil {
 		return nil, 0, unwrapVcsErr(err)
 	}
 
-	err = superv.do(ctx, "bzr:ping", ctSourcePing, func(ctx context.Context) error {
+	if opts.offline {
+		return offlineSource(&bzrSource{baseVCSSource: baseVCSSource{repo: r}}, r, ustr)
+	}
+
+	err = superv.doLimited(ctx, "bzr", "bzr:ping", ctSourcePing, func(ctx context.Context) error {
 		if !r.Ping() {
 			return fmt.Errorf("remote repository at %s does not exist, or is inaccessible", ustr)
 		}
@@ -229,7 +302,7 @@ type maybeHgSource struct {
 	url *url.URL
 }
 
-func (m maybeHgSource) try(ctx context.Context, cachedir string, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
+func (m maybeHgSource) try(ctx context.Context, cachedir string, opts sourceOptions, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
 	ustr := m.url.String()
 	path := filepath.Join(cachedir, "sources", sanitizer.Replace(ustr))
 
@@ -238,8 +311,13 @@ func (m maybeHgSource) try(ctx context.Context, cachedir string, c singleSourceC
 	if err != nil {
 		return nil, 0, unwrapVcsErr(err)
 	}
+	r.(*hgRepo).cacerts = opts.caBundle
+
+	if opts.offline {
+		return offlineSource(&hgSource{baseVCSSource: baseVCSSource{repo: r}}, r, ustr)
+	}
 
-	err = superv.do(ctx, "hg:ping", ctSourcePing, func(ctx context.Context) error {
+	err = superv.doLimited(ctx, "hg", "hg:ping", ctSourcePing, func(ctx context.Context) error {
 		if !r.Ping() {
 			return fmt.Errorf("remote repository at %s does not exist, or is inaccessible", ustr)
 		}
@@ -0,0 +1,166 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// metadataCache keeps the version lists of sources on disk, so that they
+// needn't be listed from upstream again until they are ttl old.
+type metadataCache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+	log *log.Logger // if not nil, receives the errors writing the cache
+}
+
+func newMetadataCache(dir string, ttl time.Duration) *metadataCache {
+	return &metadataCache{dir: dir, ttl: ttl, now: time.Now}
+}
+
+// cachedMetadata is the on-disk form of the version list of a source.
+type cachedMetadata struct {
+	Source   string          `json:"source"`
+	Fetched  time.Time       `json:"fetched"`
+	Versions []cachedVersion `json:"versions"`
+}
+
+type cachedVersion struct {
+	Type     string   `json:"type"` // "branch" or "version"
+	Name     string   `json:"name"`
+	Revision Revision `json:"revision"`
+	Default  bool     `json:"default,omitempty"`
+}
+
+// metadataKey returns the key under which the version list of the source at
+// ustr is cached, which also covers the options that change what is listed.
+func metadataKey(ustr string, opts sourceOptions) string {
+	key := ustr
+	if opts.refNamespace != "" {
+		key += " refs=" + opts.refNamespace
+	}
+	if opts.signedTags {
+		key += " signed=" + keyringDigest(opts.keyring)
+	}
+	return key
+}
+
+// keyringDigest returns a digest of the content of the keyring at path, so
+// that versions verified against an old keyring aren't reused after it
+// changes. A keyring that can't be read is keyed on its path; verifying
+// signed tags against it fails anyway.
+func keyringDigest(path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return path
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func (mc *metadataCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(mc.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load returns the versions cached for key, if they were cached less than the
+// ttl ago. Entries that can't be read are treated as missing.
+func (mc *metadataCache) load(key string) ([]PairedVersion, bool) {
+	if mc == nil {
+		return nil, false
+	}
+	b, err := ioutil.ReadFile(mc.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var cm cachedMetadata
+	if err = json.Unmarshal(b, &cm); err != nil || cm.Source != key {
+		return nil, false
+	}
+	if age := mc.now().Sub(cm.Fetched); age < 0 || age >= mc.ttl {
+		return nil, false
+	}
+
+	pvl := make([]PairedVersion, 0, len(cm.Versions))
+	for _, cv := range cm.Versions {
+		var v UnpairedVersion
+		switch cv.Type {
+		case "branch":
+			if cv.Default {
+				v = newDefaultBranch(cv.Name)
+			} else {
+				v = NewBranch(cv.Name)
+			}
+		case "version":
+			v = NewVersion(cv.Name)
+		default:
+			return nil, false
+		}
+		pvl = append(pvl, v.Is(cv.Revision))
+	}
+	return pvl, true
+}
+
+// save stores pvl for key, as store does. The cache only saves time, so
+// failing to write it fails nothing, and the error is only logged.
+func (mc *metadataCache) save(key string, pvl []PairedVersion) {
+	if err := mc.store(key, pvl); err != nil && mc.log != nil {
+		mc.log.Println(err)
+	}
+}
+
+// store caches pvl for key, fetched now. The entry is written to a temporary
+// file first, so that concurrent loads never see it half-written.
+func (mc *metadataCache) store(key string, pvl []PairedVersion) error {
+	if mc == nil {
+		return nil
+	}
+	cm := cachedMetadata{
+		Source:   key,
+		Fetched:  mc.now(),
+		Versions: make([]cachedVersion, 0, len(pvl)),
+	}
+	for _, pv := range pvl {
+		cv := cachedVersion{Name: pv.String(), Revision: pv.Underlying(), Type: "version"}
+		if bv, ok := pv.Unpair().(branchVersion); ok {
+			cv.Type = "branch"
+			cv.Default = bv.isDefault
+		}
+		cm.Versions = append(cm.Versions, cv)
+	}
+	b, err := json.Marshal(cm)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(mc.dir, 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(mc.dir, "tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), mc.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("unable to cache the versions of %s: %s", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMetadataCacheRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMetadataCacheRoundTrip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	mc := newMetadataCache(filepath.Join(dir, "metadata"), time.Hour)
+	mc.now = func() time.Time { return now }
+
+	pvl := []PairedVersion{
+		newDefaultBranch("master").Is("r1"),
+		NewBranch("dev").Is("r2"),
+		NewVersion("v1.2.0").Is("r3"),
+		NewVersion("retract/v1.1.0").Is("r4"),
+	}
+	if err = mc.store("https://example.com/foo", pvl); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := mc.load("https://example.com/foo")
+	if !ok {
+		t.Fatal("expected the stored versions to be loaded")
+	}
+	if !reflect.DeepEqual(got, pvl) {
+		t.Errorf("expected the versions to round trip:\n\t(GOT): %#v\n\t(WNT): %#v", got, pvl)
+	}
+	if _, ok = mc.load("https://example.com/bar"); ok {
+		t.Error("expected no versions for a source that wasn't stored")
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok = mc.load("https://example.com/foo"); ok {
+		t.Error("expected versions as old as the TTL to have expired")
+	}
+
+	var disabled *metadataCache
+	if err = disabled.store("https://example.com/foo", pvl); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok = disabled.load("https://example.com/foo"); ok {
+		t.Error("expected a nil cache to hold nothing")
+	}
+}
+
+func TestMetadataKeyOptions(t *testing.T) {
+	plain := metadataKey("https://example.com/foo", sourceOptions{})
+	refs := metadataKey("https://example.com/foo", sourceOptions{refNamespace: "refs/releases"})
+	signed := metadataKey("https://example.com/foo", sourceOptions{signedTags: true, keyring: "keys.asc"})
+	if plain == refs || plain == signed || refs == signed {
+		t.Errorf("expected options that change the versions listed to change the key, got %q, %q and %q", plain, refs, signed)
+	}
+
+	dir, err := ioutil.TempDir("", "TestMetadataKeyOptions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyring := filepath.Join(dir, "keys.asc")
+	opts := sourceOptions{signedTags: true, keyring: keyring}
+	if err = ioutil.WriteFile(keyring, []byte("old keys"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	before := metadataKey("https://example.com/foo", opts)
+	if err = ioutil.WriteFile(keyring, []byte("new keys"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if after := metadataKey("https://example.com/foo", opts); after == before {
+		t.Error("expected changing the content of the keyring to change the key")
+	}
+}
+
+func TestMetadataCacheSaveLogsErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMetadataCacheSaveLogsErrors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A file where the cache's directory should be keeps it from being
+	// written.
+	blocked := filepath.Join(dir, "metadata")
+	if err = ioutil.WriteFile(blocked, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	mc := newMetadataCache(blocked, time.Hour)
+	mc.log = log.New(&buf, "", 0)
+	mc.save("https://example.com/foo", []PairedVersion{NewVersion("v1.0.0").Is("r1")})
+	if buf.Len() == 0 {
+		t.Error("expected the failure to write the cache to be logged")
+	}
+
+	// Without a logger, the failure passes silently.
+	mc.log = nil
+	mc.save("https://example.com/foo", []PairedVersion{NewVersion("v1.0.0").Is("r1")})
+}
+
+// listCountingSource is a fakeSource that lists pvl, counting how often it
+// does.
+type listCountingSource struct {
+	fakeSource
+	pvl   []PairedVersion
+	lists *int
+}
+
+func (s listCountingSource) listVersions(context.Context) ([]PairedVersion, error) {
+	*s.lists++
+	return s.pvl, nil
+}
+
+type maybeListCountingSource struct {
+	src listCountingSource
+	url string // if not empty, the URL the source is tried under
+}
+
+func (m maybeListCountingSource) try(ctx context.Context, cachedir string, opts sourceOptions, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
+	return m.src, sourceIsSetUp | sourceExistsUpstream, nil
+}
+
+func (m maybeListCountingSource) getURL() string {
+	if m.url != "" {
+		return m.url
+	}
+	return m.src.upstreamURL()
+}
+
+func TestSourceGatewayMetadataCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSourceGatewayMetadataCache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	mc := newMetadataCache(filepath.Join(dir, "metadata"), 10*time.Minute)
+	mc.now = func() time.Time { return now }
+
+	var lists int
+	src := listCountingSource{
+		fakeSource: fakeSource{typ: "hg"},
+		pvl:        []PairedVersion{NewVersion("v1.0.0").Is("r1")},
+		lists:      &lists,
+	}
+	// Each gateway stands in for a separate run, sharing only the cache.
+	listVersions := func(opts sourceOptions) {
+		sg := newSourceGateway(maybeListCountingSource{src: src}, newSupervisor(context.Background()), dir, opts)
+		vl, err := sg.listVersions(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(vl, src.pvl) {
+			t.Fatalf("expected the versions %v, got %v", src.pvl, vl)
+		}
+	}
+
+	listVersions(sourceOptions{metadata: mc})
+	listVersions(sourceOptions{metadata: mc})
+	if lists != 1 {
+		t.Errorf("expected the second run to list versions from the cache, but they were listed upstream %d times", lists)
+	}
+
+	now = now.Add(10 * time.Minute)
+	listVersions(sourceOptions{metadata: mc})
+	if lists != 2 {
+		t.Errorf("expected expired versions to be listed upstream again, but they were listed %d times", lists)
+	}
+
+	listVersions(sourceOptions{})
+	if lists != 3 {
+		t.Errorf("expected versions to be listed upstream without a cache, but they were listed %d times", lists)
+	}
+}
+
+// The versions of a source are cached under the URL it was tried under, as
+// they are when try lists them, even if it's one of several maybeSources or
+// reaches a different URL upstream, like gopkg.in sources do.
+func TestSourceGatewayMetadataCacheKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSourceGatewayMetadataCacheKey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mc := newMetadataCache(filepath.Join(dir, "metadata"), 10*time.Minute)
+	opts := sourceOptions{metadata: mc}
+	pvl := []PairedVersion{NewVersion("v1.0.0").Is("r1")}
+	mc.save(metadataKey("https://gopkg.in/foo.v1", opts), pvl)
+
+	var lists int
+	src := listCountingSource{
+		fakeSource: fakeSource{typ: "git"},
+		pvl:        []PairedVersion{NewVersion("v2.0.0").Is("r2")},
+		lists:      &lists,
+	}
+	maybe := maybeSources{
+		maybeGitSource{url: mkurl("https://gopkg.in/foo.v1")},
+		maybeListCountingSource{src: src, url: "https://gopkg.in/foo.v1"},
+	}
+	// The git source fails to be tried, as there's no network nor cache.
+	opts.offline = true
+	sg := newSourceGateway(maybe, newSupervisor(context.Background()), dir, opts)
+	vl, err := sg.listVersions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lists != 0 {
+		t.Errorf("expected the versions to be listed from the cache, but they were listed upstream %d times", lists)
+	}
+	if !reflect.DeepEqual(vl, pvl) {
+		t.Errorf("expected the cached versions %v, got %v", pvl, vl)
+	}
+}
+
+func TestSourceMgrMetadataCache(t *testing.T) {
+	requiresBins(t, "git")
+
+	tmp, err := ioutil.TempDir("", "TestSourceMgrMetadataCache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	upstream := filepath.Join(tmp, "upstream")
+	rev := newGitFixture(t, upstream, map[string]string{"foo.go": "package foo\n"})
+	id := mkPI("github.com/foo/foo")
+
+	listVersions := func(ttl time.Duration) ([]PairedVersion, error) {
+		sm, err := NewSourceManager(SourceManagerConfig{
+			Cachedir:    filepath.Join(tmp, "cache"),
+			MetadataTTL: ttl,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sm.Release()
+		sm.srcCoord.deducer = &mirrorDeducer{upstream: upstream}
+		return sm.ListVersions(id)
+	}
+
+	want, err := listVersions(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != 1 || want[0].Underlying() != rev {
+		t.Fatalf("expected the fixture's default branch at %s, got %v", rev, want)
+	}
+
+	// Without its upstream, versions can only come from the cache.
+	if err = os.RemoveAll(upstream); err != nil {
+		t.Fatal(err)
+	}
+	got, err := listVersions(time.Hour)
+	if err != nil {
+		t.Fatalf("expected the versions to be listed from the cache, got %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the cached versions %v, got %v", want, got)
+	}
+
+	if _, err = listVersions(0); err == nil {
+		t.Error("expected versions to be listed upstream with the cache disabled")
+	}
+}
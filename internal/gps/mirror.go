@@ -0,0 +1,106 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SourceMirror rewrites the names of sources starting with Prefix to start
+// with Mirror instead, before they are fetched. The project roots that the
+// sources are known by, in import paths and locks, are left as they are.
+type SourceMirror struct {
+	Prefix string
+	Mirror string
+}
+
+func (m SourceMirror) String() string {
+	return fmt.Sprintf("%s => %s", m.Prefix, m.Mirror)
+}
+
+// sourceMirrors is a list of mirrors, of which the one with the longest
+// matching prefix applies to each source.
+type sourceMirrors []SourceMirror
+
+// rewrite returns name with its prefix replaced by that of the mirror with
+// the longest prefix matching it, or name itself if no mirror matches.
+func (ms sourceMirrors) rewrite(name string) string {
+	var best SourceMirror
+	for _, m := range ms {
+		if strings.HasPrefix(name, m.Prefix) && len(m.Prefix) > len(best.Prefix) {
+			best = m
+		}
+	}
+	if best.Prefix == "" {
+		return name
+	}
+	return best.Mirror + strings.TrimPrefix(name, best.Prefix)
+}
+
+// rewriteURL returns u with its host and path, taken together as a name,
+// rewritten as rewrite rewrites names, or u itself if no mirror matches.
+func (ms sourceMirrors) rewriteURL(u *url.URL) *url.URL {
+	name := u.Host + u.Path
+	mirrored := ms.rewrite(name)
+	if mirrored == name {
+		return u
+	}
+	r := *u
+	r.Host, r.Path = mirrored, ""
+	if i := strings.IndexByte(mirrored, '/'); i >= 0 {
+		r.Host, r.Path = mirrored[:i], mirrored[i:]
+	}
+	return &r
+}
+
+// rewriteSource returns mb with the URLs it fetches from rewritten by
+// rewriteURL. Everything else about it, such as the name a gopkg.in source is
+// cached under, is left as deduced from the source's own name.
+func (ms sourceMirrors) rewriteSource(mb maybeSource) maybeSource {
+	if len(ms) == 0 {
+		return mb
+	}
+	switch m := mb.(type) {
+	case maybeSources:
+		r := make(maybeSources, len(m))
+		for i, mb := range m {
+			r[i] = ms.rewriteSource(mb)
+		}
+		return r
+	case maybeGitSource:
+		m.url = ms.rewriteURL(m.url)
+		return m
+	case maybeGopkginSource:
+		m.url = ms.rewriteURL(m.url)
+		return m
+	case maybeBzrSource:
+		m.url = ms.rewriteURL(m.url)
+		return m
+	case maybeHgSource:
+		m.url = ms.rewriteURL(m.url)
+		return m
+	case maybeBackendSource:
+		m.url = ms.rewriteURL(m.url)
+		return m
+	}
+	return mb
+}
+
+// sorted returns the mirrors ordered by prefix, for hashing.
+func (ms sourceMirrors) sorted() sourceMirrors {
+	s := make(sourceMirrors, len(ms))
+	copy(s, ms)
+	sort.Sort(byMirrorPrefix(s))
+	return s
+}
+
+type byMirrorPrefix []SourceMirror
+
+func (s byMirrorPrefix) Len() int           { return len(s) }
+func (s byMirrorPrefix) Less(i, j int) bool { return s[i].Prefix < s[j].Prefix }
+func (s byMirrorPrefix) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,163 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/dep/internal/gps/pkgtree"
+)
+
+func TestSourceMirrorsRewrite(t *testing.T) {
+	ms := sourceMirrors{
+		{Prefix: "github.com/", Mirror: "git.corp.local/github/"},
+		{Prefix: "github.com/corp/", Mirror: "git.corp.local/corp/"},
+	}
+	for name, want := range map[string]string{
+		"github.com/sdboyer/deptest": "git.corp.local/github/sdboyer/deptest",
+		"github.com/corp/tool":       "git.corp.local/corp/tool",
+		"golang.org/x/sys":           "golang.org/x/sys",
+		"example.com/github.com/foo": "example.com/github.com/foo",
+	} {
+		if got := ms.rewrite(name); got != want {
+			t.Errorf("expected %s to be rewritten to %s, got %s", name, want, got)
+		}
+	}
+}
+
+func TestSourceMirrorsRewriteSource(t *testing.T) {
+	ms := sourceMirrors{{Prefix: "github.com/", Mirror: "git.corp.local/github/"}}
+	mb := maybeSources{
+		maybeGitSource{url: mkurl("https://github.com/foo/bar")},
+		maybeGitSource{url: mkurl("ssh://git@github.com/foo/bar")},
+		maybeGopkginSource{opath: "gopkg.in/foo/bar.v1", url: mkurl("https://github.com/foo/bar"), major: 1},
+		maybeHgSource{url: mkurl("https://example.com/foo/bar")},
+	}
+	want := maybeSources{
+		maybeGitSource{url: mkurl("https://git.corp.local/github/foo/bar")},
+		maybeGitSource{url: mkurl("ssh://git@git.corp.local/github/foo/bar")},
+		maybeGopkginSource{opath: "gopkg.in/foo/bar.v1", url: mkurl("https://git.corp.local/github/foo/bar"), major: 1},
+		maybeHgSource{url: mkurl("https://example.com/foo/bar")},
+	}
+	if got := ms.rewriteSource(mb); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected only the fetch URLs to be rewritten:\n\t(GOT) %#v\n\t(WNT) %#v", got, want)
+	}
+	if mb[0].getURL() != "https://github.com/foo/bar" {
+		t.Errorf("expected the deduced source to be left as it was, got %s", mb[0].getURL())
+	}
+}
+
+func TestHashInputsMirrors(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+		stdLibFn:        func(string) bool { return false },
+		mkBridgeFn:      overrideMkBridge,
+	}
+
+	s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error while prepping solver: %s", err)
+	}
+	without := string(s.HashInputs())
+
+	params.Mirrors = []SourceMirror{{Prefix: "a", Mirror: "mirror.local/a"}}
+	s, err = Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error while prepping solver: %s", err)
+	}
+	if string(s.HashInputs()) == without {
+		t.Error("expected mirrors to change the inputs digest")
+	}
+}
+
+// mirrorDeducer deduces every path to the git repository at upstream,
+// recording the paths it is asked for.
+type mirrorDeducer struct {
+	upstream string
+	paths    []string
+}
+
+func (d *mirrorDeducer) deduceRootPath(ctx context.Context, path string) (pathDeduction, error) {
+	d.paths = append(d.paths, path)
+	return pathDeduction{
+		root: path,
+		mb:   maybeGitSource{url: &url.URL{Scheme: "file", Path: d.upstream}},
+	}, nil
+}
+
+func TestSolveThroughMirror(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestSolveThroughMirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	upstream := filepath.Join(tmp, "upstream")
+	rev := newGitFixture(t, upstream, map[string]string{"bar.go": "package bar\n"})
+
+	root := filepath.Join(tmp, "root")
+	if err = os.MkdirAll(root, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n\nimport _ \"github.com/foo/bar\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ptree, err := pkgtree.ListPackages(root, "example.com/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mirrors := []SourceMirror{{Prefix: "github.com/", Mirror: "git.corp.local/github/"}}
+	sm, err := NewSourceManager(SourceManagerConfig{
+		Cachedir: filepath.Join(tmp, "cache"),
+		Mirrors:  mirrors,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+	deducer := &mirrorDeducer{upstream: upstream}
+	sm.srcCoord.deducer = deducer
+
+	s, err := Prepare(SolveParameters{
+		RootDir:         root,
+		RootPackageTree: ptree,
+		Manifest:        simpleRootManifest{},
+		ProjectAnalyzer: naiveAnalyzer{},
+		Mirrors:         mirrors,
+	}, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	soln, err := s.Solve()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(deducer.paths, []string{"github.com/foo/bar"}) {
+		t.Errorf("expected the source to be deduced from its own name, got %v", deducer.paths)
+	}
+	lps := soln.Projects()
+	if len(lps) != 1 {
+		t.Fatalf("expected one locked project, got %v", lps)
+	}
+	if id := lps[0].Ident(); id != mkPI("github.com/foo/bar") {
+		t.Errorf("expected github.com/foo/bar to be locked under its own name, got %#v", id)
+	}
+	if got := lps[0].Version().(PairedVersion).Underlying(); got != rev {
+		t.Errorf("expected the mirrored revision %s to be locked, got %s", rev, got)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A PackageCache remembers the packages it has found while listing package
+// trees, so that subsequent listings only re-read the directories whose Go
+// files have changed since they were last read.
+//
+// A directory is considered unchanged if the names, sizes, modes and
+// modification times of its Go files are all the same as when it was read.
+//
+// A PackageCache holds at most MaxCachedPackages directories; once full, the
+// least recently used are forgotten, such as those that no longer exist.
+//
+// A PackageCache is safe for concurrent use.
+type PackageCache struct {
+	mu    sync.Mutex
+	dirs  map[string]*list.Element // of *cachedPackage
+	lru   *list.List               // most recently used first
+	max   int
+	reads int // number of directories actually read; for testing
+}
+
+type cachedPackage struct {
+	dir string
+	sig string
+	ip  string
+	poe PackageOrErr
+}
+
+// MaxCachedPackages is the number of directories a PackageCache holds.
+const MaxCachedPackages = 10000
+
+// NewPackageCache returns an empty PackageCache.
+func NewPackageCache() *PackageCache {
+	return &PackageCache{
+		dirs: make(map[string]*list.Element),
+		lru:  list.New(),
+		max:  MaxCachedPackages,
+	}
+}
+
+// get returns the cached package for dir, marking it as the most recently
+// used. c.mu must be held.
+func (c *PackageCache) get(dir string) (cachedPackage, bool) {
+	e, has := c.dirs[dir]
+	if !has {
+		return cachedPackage{}, false
+	}
+	c.lru.MoveToFront(e)
+	return *e.Value.(*cachedPackage), true
+}
+
+// put caches cp as the most recently used package, forgetting the least
+// recently used if c is over its limit. c.mu must be held.
+func (c *PackageCache) put(cp cachedPackage) {
+	if e, has := c.dirs[cp.dir]; has {
+		*e.Value.(*cachedPackage) = cp
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.dirs[cp.dir] = c.lru.PushFront(&cp)
+	for c.lru.Len() > c.max {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.dirs, e.Value.(*cachedPackage).dir)
+	}
+}
+
+// savedPackage is the on-disk form of a cachedPackage.
+type savedPackage struct {
+	Sig        string  `json:"sig"`
+	ImportPath string  `json:"importPath"`
+	Package    Package `json:"package"`
+}
+
+// LoadPackageCache returns a PackageCache holding the packages saved to path
+// by Save, such as by an earlier run. If path doesn't exist or can't be
+// read, the cache is empty.
+func LoadPackageCache(path string) *PackageCache {
+	c := NewPackageCache()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c
+	}
+	var saved map[string]savedPackage
+	if err = json.Unmarshal(b, &saved); err != nil {
+		return c
+	}
+	for dir, sp := range saved {
+		c.put(cachedPackage{dir: dir, sig: sp.Sig, ip: sp.ImportPath, poe: PackageOrErr{P: sp.Package}})
+	}
+	return c
+}
+
+// Save writes the packages in c to path, for LoadPackageCache. Directories
+// that couldn't be read as a package aren't saved, and so are read again.
+// The file is written to a temporary file first, so that concurrent loads
+// never see it half-written.
+func (c *PackageCache) Save(path string) error {
+	c.mu.Lock()
+	saved := make(map[string]savedPackage, len(c.dirs))
+	for dir, e := range c.dirs {
+		if cp := e.Value.(*cachedPackage); cp.poe.Err == nil {
+			saved[dir] = savedPackage{Sig: cp.sig, ImportPath: cp.ip, Package: cp.poe.P}
+		}
+	}
+	c.mu.Unlock()
+
+	b, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("unable to save the package cache to %s: %s", path, err)
+	}
+	return nil
+}
+
+// ListPackages reports Go package information about all directories in the
+// tree at or below the provided fileRoot, exactly as the package-level
+// ListPackages does, reusing cached information for unchanged directories.
+func (c *PackageCache) ListPackages(fileRoot, importRoot string) (PackageTree, error) {
+	return listPackages(fileRoot, importRoot, c.readPackage)
+}
+
+func (c *PackageCache) readPackage(dir, ip string) (PackageOrErr, error) {
+	sig, err := dirSignature(dir)
+	if err != nil {
+		return PackageOrErr{}, err
+	}
+
+	c.mu.Lock()
+	cp, has := c.get(dir)
+	c.mu.Unlock()
+	if has && cp.sig == sig && cp.ip == ip {
+		return copyPackageOrErr(cp.poe), nil
+	}
+
+	poe, err := readPackage(dir, ip)
+	if err != nil {
+		return PackageOrErr{}, err
+	}
+
+	c.mu.Lock()
+	c.put(cachedPackage{dir: dir, sig: sig, ip: ip, poe: copyPackageOrErr(poe)})
+	c.reads++
+	c.mu.Unlock()
+
+	return poe, nil
+}
+
+// dirSignature summarizes the state of the Go files in dir, as seen by
+// fillPackage.
+func dirSignature(dir string) (string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) != ".go" {
+			continue
+		}
+		// Go files may be symlinks; look at what they point to.
+		fi, err := os.Stat(filepath.Join(dir, e.Name()))
+		if err != nil {
+			fmt.Fprintf(&buf, "%s:missing\n", e.Name())
+			continue
+		}
+		fmt.Fprintf(&buf, "%s:%d:%s:%d\n", e.Name(), fi.Size(), fi.Mode(), fi.ModTime().UnixNano())
+	}
+
+	return buf.String(), nil
+}
+
+// copyPackageOrErr returns a copy of poe that shares no slices with it, so
+// that callers can't disturb the cached copy.
+func copyPackageOrErr(poe PackageOrErr) PackageOrErr {
+	if poe.Err != nil {
+		return poe
+	}
+
+	p := poe.P
+	p.Imports = copyStrings(p.Imports)
+	p.TestImports = copyStrings(p.TestImports)
+	return PackageOrErr{P: p}
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	c := make([]string, len(s))
+	copy(c, s)
+	return c
+}
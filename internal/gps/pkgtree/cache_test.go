@@ -0,0 +1,198 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPackageCacheListPackages(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestPackageCacheListPackages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	write := func(name, content string) {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		// Make sure the change is visible even on filesystems with coarse
+		// modification times.
+		future := time.Now().Add(time.Duration(len(content)) * time.Second)
+		if err := os.Chtimes(path, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("a.go", "package root\n\nimport \"github.com/foo/bar\"\n")
+	write("sub/sub.go", "package sub\n\nimport \"sort\"\n")
+	write("empty/README", "no go here\n")
+
+	c := NewPackageCache()
+	check := func(wantReads int) {
+		got, err := c.ListPackages(root, "example.com/root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := ListPackages(root, "example.com/root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("cached listing differs from full listing:\n\t(GOT) %#v\n\t(WNT) %#v", got, want)
+		}
+		if c.reads != wantReads {
+			t.Fatalf("expected %d directory reads, got %d", wantReads, c.reads)
+		}
+	}
+
+	check(3)
+	// Nothing changed; nothing is re-read.
+	check(3)
+
+	// Changing a single file re-reads only its directory.
+	write("sub/sub.go", "package sub\n\nimport \"github.com/baz/qux\"\n")
+	check(4)
+
+	// So does adding a file to a directory without Go files.
+	write("empty/empty.go", "package empty\n")
+	check(5)
+
+	// Listing under a different import root must not reuse import paths.
+	got, err := c.ListPackages(root, "example.com/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, has := got.Packages["example.com/other/sub"]; !has {
+		t.Fatalf("expected packages under the new import root, got %v", got.Packages)
+	}
+}
+
+func TestPackageCacheSave(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestPackageCacheSave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	src := filepath.Join(root, "src")
+	write := func(name, content string, mtime time.Time) {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	write("a.go", "package root\n\nimport \"github.com/foo/bar\"\n", now)
+	write("sub/sub.go", "package sub\n\nimport \"sort\"\n", now)
+
+	saved := filepath.Join(root, "cache", "packages.json")
+	c := LoadPackageCache(saved)
+	if _, err = c.ListPackages(src, "example.com/root"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(wantReads int) {
+		c := LoadPackageCache(saved)
+		got, err := c.ListPackages(src, "example.com/root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := ListPackages(src, "example.com/root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("listing from the saved cache differs from full listing:\n\t(GOT) %#v\n\t(WNT) %#v", got, want)
+		}
+		if c.reads != wantReads {
+			t.Fatalf("expected %d directory reads, got %d", wantReads, c.reads)
+		}
+	}
+
+	// A later run re-reads nothing, until a file changes.
+	check(0)
+	write("sub/sub.go", "package sub\n\nimport \"github.com/baz/qux\"\n", now.Add(time.Minute))
+	check(1)
+
+	// A corrupt cache is as good as none.
+	if err = ioutil.WriteFile(saved, []byte("{"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	check(2)
+}
+
+func TestPackageCacheLimit(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestPackageCacheLimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"a.go", "b/b.go", "c/c.go"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("package foo\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewPackageCache()
+	c.max = 2
+	got, err := c.ListPackages(root, "example.com/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ListPackages(root, "example.com/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("cached listing differs from full listing:\n\t(GOT) %#v\n\t(WNT) %#v", got, want)
+	}
+
+	// The root was read first, and so is the one forgotten.
+	if len(c.dirs) != 2 || c.lru.Len() != 2 {
+		t.Fatalf("expected 2 cached directories, got %d", len(c.dirs))
+	}
+	if _, has := c.dirs[root]; has {
+		t.Errorf("expected the least recently used directory, %s, to be forgotten", root)
+	}
+
+	// Reading b again keeps it over c, when the root comes back.
+	if _, err = c.readPackage(filepath.Join(root, "b"), "example.com/root/b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.readPackage(root, "example.com/root"); err != nil {
+		t.Fatal(err)
+	}
+	if _, has := c.dirs[filepath.Join(root, "b")]; !has {
+		t.Error("expected the recently used b to be kept")
+	}
+	if _, has := c.dirs[filepath.Join(root, "c")]; has {
+		t.Error("expected the least recently used c to be forgotten")
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"bytes"
+	"go/build"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// maxSatTags bounds the number of distinct tags for which buildIgnored will
+// search for a satisfying assignment.
+const maxSatTags = 16
+
+// buildIgnored reports whether the build constraint in the Go source src keeps
+// it out of every build.
+//
+// Since dependency analysis must hold for every platform, rather than only for
+// the current one, a file only counts as ignored if no build context matches
+// it, whatever tags it sets, given that the "ignore" tag is never set. Thus
+// "linux && !nofast" is kept, while "linux,ignore" and
+// "(ignore || cgo) && !cgo" are not. Which constraint lines apply, and what
+// they mean, is left to go/build, so that both //go:build and legacy // +build
+// lines are read just as the toolchain reads them.
+//
+// Malformed constraints are skipped, so that the file is never left out of
+// the analysis on their account.
+func buildIgnored(src []byte) bool {
+	tags := constraintTags(src)
+	if tags == nil {
+		return false
+	}
+
+	var free []string
+	for tag := range tags {
+		if tag != "ignore" {
+			free = append(free, tag)
+		}
+	}
+	if len(free) > maxSatTags {
+		// Too many to try them all; err on the side of keeping the file.
+		return false
+	}
+
+	// The context is otherwise empty, so that only the tags in BuildTags are
+	// set; the file's name is neutral, so that it can't be ruled out by an
+	// _$GOOS or _$GOARCH suffix.
+	ctxt := build.Context{
+		JoinPath: func(elem ...string) string { return strings.Join(elem, "/") },
+		OpenFile: func(string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(src)), nil
+		},
+	}
+	for bits := 0; bits < 1<<uint(len(free)); bits++ {
+		ctxt.BuildTags = ctxt.BuildTags[:0]
+		for i, tag := range free {
+			if bits&(1<<uint(i)) != 0 {
+				ctxt.BuildTags = append(ctxt.BuildTags, tag)
+			}
+		}
+		if match, err := ctxt.MatchFile(".", "x.go"); err != nil || match {
+			return false
+		}
+	}
+	return true
+}
+
+// constraintTags returns the set of tags named by the build constraint lines
+// among the comments before src's package clause, or nil if there are none.
+// It doesn't decide which of the lines actually apply; MatchFile does that.
+func constraintTags(src []byte) map[string]bool {
+	pf, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+
+	var tags map[string]bool
+	for _, c := range pf.Comments {
+		if c.Pos() > pf.Package {
+			break
+		}
+		for _, cl := range c.List {
+			if !constraint.IsGoBuild(cl.Text) && !constraint.IsPlusBuild(cl.Text) {
+				continue
+			}
+			x, err := constraint.Parse(cl.Text)
+			if err != nil {
+				continue
+			}
+			if tags == nil {
+				tags = make(map[string]bool)
+			}
+			addConstraintTags(tags, x)
+		}
+	}
+	return tags
+}
+
+func addConstraintTags(tags map[string]bool, x constraint.Expr) {
+	switch x := x.(type) {
+	case *constraint.TagExpr:
+		tags[x.Tag] = true
+	case *constraint.NotExpr:
+		addConstraintTags(tags, x.X)
+	case *constraint.AndExpr:
+		addConstraintTags(tags, x.X)
+		addConstraintTags(tags, x.Y)
+	case *constraint.OrExpr:
+		addConstraintTags(tags, x.X)
+		addConstraintTags(tags, x.Y)
+	}
+}
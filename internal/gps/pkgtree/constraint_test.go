@@ -0,0 +1,42 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import "testing"
+
+func TestBuildIgnored(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		src     string
+		ignored bool
+	}{
+		{"none", "package foo\n", false},
+		{"go:build ignore", "//go:build ignore\n\npackage foo\n", true},
+		{"go:build compound negation", "//go:build linux && amd64 && !nofast\n\npackage foo\n", false},
+		{"go:build negated ignore", "//go:build !ignore\n\npackage foo\n", false},
+		{"go:build ignore and", "//go:build linux && ignore\n\npackage foo\n", true},
+		{"go:build ignore or", "//go:build linux || ignore\n\npackage foo\n", false},
+		{"go:build parens", "//go:build (ignore || nofast) && !nofast\n\npackage foo\n", true},
+		{"go:build parens satisfiable", "//go:build (ignore || nofast) && !(linux && !nofast)\n\npackage foo\n", false},
+		{"go:build double negation", "//go:build !!ignore\n\npackage foo\n", false}, // rejected by the toolchain
+		{"go:build contradiction", "//go:build cgo && !cgo\n\npackage foo\n", true},
+		{"go:build in package doc", "//go:build ignore\npackage foo\n", true},
+		{"go:build malformed", "//go:build ignore &&\n\npackage foo\n", false},
+		{"go:build overrides +build", "//go:build linux\n// +build ignore\n\npackage foo\n", false},
+		{"+build ignore", "// +build ignore\n\npackage foo\n", true},
+		{"+build and", "// +build linux,ignore\n\npackage foo\n", true},
+		{"+build or", "// +build linux ignore\n\npackage foo\n", false},
+		{"+build negation", "// +build linux,amd64,!nofast\n\npackage foo\n", false},
+		{"+build negated ignore", "// +build !ignore\n\npackage foo\n", false},
+		{"+build lines anded", "// +build linux ignore\n// +build ignore,!linux darwin\n\npackage foo\n", false},
+		{"+build lines anded unsatisfiable", "// +build linux ignore\n// +build ignore,!linux\n\npackage foo\n", true},
+		{"+build in package doc", "// +build ignore\npackage foo\n", false},
+		{"+build after package", "package foo\n\n// +build ignore\n", false},
+	} {
+		if got := buildIgnored([]byte(tc.src)); got != tc.ignored {
+			t.Errorf("%s: expected buildIgnored to be %v, got %v", tc.name, tc.ignored, got)
+		}
+	}
+}
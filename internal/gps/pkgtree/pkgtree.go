@@ -10,12 +10,12 @@ import (
 	"go/parser"
 	gscan "go/scanner"
 	"go/token"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
-	"unicode"
 )
 
 // Package represents a Go package. It contains a subset of the information
@@ -60,6 +60,12 @@ var vcsRoots = map[string]struct{}{
 // to PackageOrErr - each path under the root that exists will have either a
 // Package, or an error describing why the directory is not a valid package.
 func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
+	return listPackages(fileRoot, importRoot, readPackage)
+}
+
+// listPackages walks the tree at fileRoot like ListPackages, using read to
+// produce the PackageOrErr for each directory it visits.
+func listPackages(fileRoot, importRoot string, read func(dir, ip string) (PackageOrErr, error)) (PackageTree, error) {
 	ptree := PackageTree{
 		ImportRoot: importRoot,
 		Packages:   make(map[string]PackageOrErr),
@@ -122,65 +128,12 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 		// import paths.
 		ip := filepath.ToSlash(filepath.Join(importRoot, strings.TrimPrefix(wp, fileRoot)))
 
-		// Find all the imports, across all os/arch combos
-		//p, err := fullPackageInDir(wp)
-		p := &build.Package{
-			Dir: wp,
-		}
-		err = fillPackage(p)
-
-		var pkg Package
-		if err == nil {
-			pkg = Package{
-				ImportPath:  ip,
-				CommentPath: p.ImportComment,
-				Name:        p.Name,
-				Imports:     p.Imports,
-				TestImports: dedupeStrings(p.TestImports, p.XTestImports),
-			}
-		} else {
-			switch err.(type) {
-			case gscan.ErrorList, *gscan.Error, *build.NoGoError:
-				// This happens if we encounter malformed or nonexistent Go
-				// source code
-				ptree.Packages[ip] = PackageOrErr{
-					Err: err,
-				}
-				return nil
-			default:
-				return err
-			}
-		}
-
-		// This area has some...fuzzy rules, but check all the imports for
-		// local/relative/dot-ness, and record an error for the package if we
-		// see any.
-		var lim []string
-		for _, imp := range append(pkg.Imports, pkg.TestImports...) {
-			switch {
-			// Do allow the single-dot, at least for now
-			case imp == "..":
-				lim = append(lim, imp)
-			case strings.HasPrefix(imp, "./"):
-				lim = append(lim, imp)
-			case strings.HasPrefix(imp, "../"):
-				lim = append(lim, imp)
-			}
-		}
-
-		if len(lim) > 0 {
-			ptree.Packages[ip] = PackageOrErr{
-				Err: &LocalImportsError{
-					Dir:          wp,
-					ImportPath:   ip,
-					LocalImports: lim,
-				},
-			}
-		} else {
-			ptree.Packages[ip] = PackageOrErr{
-				P: pkg,
-			}
+		var poe PackageOrErr
+		poe, err = read(wp, ip)
+		if err != nil {
+			return err
 		}
+		ptree.Packages[ip] = poe
 
 		return nil
 	})
@@ -192,13 +145,73 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 	return ptree, nil
 }
 
-// fillPackage full of info. Assumes p.Dir is set at a minimum
-func fillPackage(p *build.Package) error {
-	var buildPrefix = "// +build "
-	var buildFieldSplit = func(r rune) bool {
-		return unicode.IsSpace(r) || r == ','
+// readPackage reports the package in dir, which has the import path ip.
+//
+// Malformed or absent Go source, and relative imports, are reported in the
+// returned PackageOrErr; any other failure is returned as an error.
+func readPackage(dir, ip string) (PackageOrErr, error) {
+	// Find all the imports, across all os/arch combos
+	//p, err := fullPackageInDir(wp)
+	p := &build.Package{
+		Dir: dir,
+	}
+	err := fillPackage(p)
+
+	var pkg Package
+	if err == nil {
+		pkg = Package{
+			ImportPath:  ip,
+			CommentPath: p.ImportComment,
+			Name:        p.Name,
+			Imports:     p.Imports,
+			TestImports: dedupeStrings(p.TestImports, p.XTestImports),
+		}
+	} else {
+		switch err.(type) {
+		case gscan.ErrorList, *gscan.Error, *build.NoGoError:
+			// This happens if we encounter malformed or nonexistent Go
+			// source code
+			return PackageOrErr{
+				Err: err,
+			}, nil
+		default:
+			return PackageOrErr{}, err
+		}
+	}
+
+	// This area has some...fuzzy rules, but check all the imports for
+	// local/relative/dot-ness, and record an error for the package if we
+	// see any.
+	var lim []string
+	for _, imp := range append(pkg.Imports, pkg.TestImports...) {
+		switch {
+		// Do allow the single-dot, at least for now
+		case imp == "..":
+			lim = append(lim, imp)
+		case strings.HasPrefix(imp, "./"):
+			lim = append(lim, imp)
+		case strings.HasPrefix(imp, "../"):
+			lim = append(lim, imp)
+		}
 	}
 
+	if len(lim) > 0 {
+		return PackageOrErr{
+			Err: &LocalImportsError{
+				Dir:          dir,
+				ImportPath:   ip,
+				LocalImports: lim,
+			},
+		}, nil
+	}
+
+	return PackageOrErr{
+		P: pkg,
+	}, nil
+}
+
+// fillPackage full of info. Assumes p.Dir is set at a minimum
+func fillPackage(p *build.Package) error {
 	gofiles, err := filepath.Glob(filepath.Join(p.Dir, "*.go"))
 	if err != nil {
 		return err
@@ -222,41 +235,23 @@ func fillPackage(p *build.Package) error {
 			continue
 		}
 
-		pf, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly|parser.ParseComments)
+		src, err := ioutil.ReadFile(file)
 		if err != nil {
 			if os.IsPermission(err) {
 				continue
 			}
 			return err
 		}
+		pf, err := parser.ParseFile(token.NewFileSet(), file, src, parser.ImportsOnly|parser.ParseComments)
+		if err != nil {
+			return err
+		}
 		testFile := strings.HasSuffix(file, "_test.go")
 		fname := filepath.Base(file)
 
-		var ignored bool
-		for _, c := range pf.Comments {
-			if c.Pos() > pf.Package { // +build comment must come before package
-				continue
-			}
-
-			var ct string
-			for _, cl := range c.List {
-				if strings.HasPrefix(cl.Text, buildPrefix) {
-					ct = cl.Text
-					break
-				}
-			}
-			if ct == "" {
-				continue
-			}
-
-			for _, t := range strings.FieldsFunc(ct[len(buildPrefix):], buildFieldSplit) {
-				// hardcoded (for now) handling for the "ignore" build tag
-				// We "soft" ignore the files tagged with ignore so that we pull in their imports.
-				if t == "ignore" {
-					ignored = true
-				}
-			}
-		}
+		// We "soft" ignore the files excluded from every build so that we pull
+		// in their imports.
+		ignored := buildIgnored(src)
 
 		if testFile {
 			p.TestGoFiles = append(p.TestGoFiles, fname)
@@ -290,6 +285,17 @@ func fillPackage(p *build.Package) error {
 	return nil
 }
 
+// IsBuildIgnored reports whether the build constraint on the Go file at path
+// keeps it out of every build, as with the "ignore" tag. Both //go:build and
+// legacy // +build constraints are understood.
+func IsBuildIgnored(path string) (bool, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	return buildIgnored(src), nil
+}
+
 // LocalImportsError indicates that a package contains at least one relative
 // import that will prevent it from compiling.
 //
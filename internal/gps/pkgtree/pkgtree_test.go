@@ -1976,6 +1976,29 @@ func TestToReachMapFilterDot(t *testing.T) {
 	}
 }
 
+func TestIsBuildIgnored(t *testing.T) {
+	srcdir := filepath.Join(getTestdataRootDir(t), "src")
+	for path, want := range map[string]bool{
+		"igmain/igmain.go":     true,
+		"igmain/a.go":          false,
+		"igmainlong/igmain.go": true,
+		"buildtag/invalid.go":  false,
+	} {
+		got, err := IsBuildIgnored(filepath.Join(srcdir, filepath.FromSlash(path)))
+		if err != nil {
+			t.Errorf("%s: %s", path, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: expected IsBuildIgnored to be %v, got %v", path, want, got)
+		}
+	}
+
+	if _, err := IsBuildIgnored(filepath.Join(srcdir, "notexist.go")); err == nil {
+		t.Error("expected an error for a nonexistent file")
+	}
+}
+
 func getTestdataRootDir(t *testing.T) string {
 	cwd, err := os.Getwd()
 	if err != nil {
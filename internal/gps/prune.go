@@ -0,0 +1,250 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/dep/internal/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+// PruneOptions represents the pruning options used to write the dependency tree.
+type PruneOptions uint8
+
+const (
+	// PruneBuildIgnoredFiles indicates if Go files tagged with the "ignore"
+	// build tag, which are never compiled, should be pruned.
+	PruneBuildIgnoredFiles PruneOptions = 1 << iota
+
+	// NormalizeFileModes indicates if the modes of the written files and
+	// directories should be set to a canonical set, rather than carried over
+	// from the sources as the umask leaves them, so that the tree is the same
+	// on every machine.
+	NormalizeFileModes
+)
+
+// The canonical modes that NormalizeFileModes sets. Files that anyone may
+// execute are given execModePerm, and all others fileModePerm.
+const (
+	fileModePerm os.FileMode = 0644
+	execModePerm os.FileMode = 0755
+	dirModePerm  os.FileMode = 0755
+)
+
+// pruneProject removes files from the project exported to baseDir according
+// to the given options, except for those matching one of the protect
+// patterns.
+func pruneProject(baseDir string, options PruneOptions, protect []string) error {
+	if (options & PruneBuildIgnoredFiles) != 0 {
+		if err := pruneBuildIgnoredFiles(baseDir, protect); err != nil {
+			return errors.Wrap(err, "failed to prune build-ignored files")
+		}
+	}
+
+	return nil
+}
+
+// pruneBuildIgnoredFiles deletes all Go files under baseDir that carry the
+// "ignore" build tag and match none of the protect patterns. Files that can't
+// be parsed are left alone.
+func pruneBuildIgnoredFiles(baseDir string, protect []string) error {
+	var files []string
+	err := filepath.Walk(baseDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || filepath.Ext(path) != ".go" {
+			return nil
+		}
+		if protected, err := MatchesKeepPattern(baseDir, path, protect); err != nil || protected {
+			return err
+		}
+
+		if ignored, err := pkgtree.IsBuildIgnored(path); err == nil && ignored {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// normalizeFileModes sets the permissions of the files and directories under
+// baseDir, including baseDir itself, to the canonical ones. Symlinks are left
+// alone.
+func normalizeFileModes(baseDir string) error {
+	return filepath.Walk(baseDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		var perm os.FileMode
+		switch {
+		case info.IsDir():
+			perm = dirModePerm
+		case !info.Mode().IsRegular():
+			return nil
+		case info.Mode().Perm()&0111 != 0:
+			perm = execModePerm
+		default:
+			perm = fileModePerm
+		}
+		if info.Mode()&^os.ModeType == perm {
+			return nil
+		}
+		return os.Chmod(path, perm)
+	})
+}
+
+// PruneUnkeptFiles deletes the files under baseDir, the root of an exported
+// project, whose paths relative to it match none of the keep patterns, and
+// then the directories left empty. baseDir itself is always kept, as are the
+// directories in skip, such as those of projects nested within it, which are
+// left alone entirely.
+//
+// Patterns are slash-separated, and each of their elements is matched as by
+// path.Match, except for "**", which matches any number of elements,
+// including none. For example, "**/*.go" keeps every Go file, while
+// "LICENSE*" only keeps the licenses at the root.
+func PruneUnkeptFiles(baseDir string, keep, skip []string) error {
+	skipped := make(map[string]bool, len(skip))
+	for _, dir := range skip {
+		skipped[filepath.Clean(dir)] = true
+	}
+
+	var files, dirs []string
+	err := filepath.Walk(baseDir, func(wp string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if wp == baseDir {
+			return nil
+		}
+		if info.IsDir() {
+			if skipped[wp] {
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, wp)
+			return nil
+		}
+
+		if kept, err := MatchesKeepPattern(baseDir, wp, keep); err != nil || kept {
+			return err
+		}
+		files = append(files, wp)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, wp := range files {
+		if err := os.Remove(wp); err != nil {
+			return err
+		}
+	}
+
+	// Deepest first, so that directories holding nothing but empty ones go
+	// too.
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if empty, err := isEmptyDir(dir); err != nil {
+			return err
+		} else if empty {
+			if err := os.Remove(dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateKeepPattern returns an error if pattern isn't a well-formed keep
+// pattern, as taken by PruneUnkeptFiles.
+func ValidateKeepPattern(pattern string) error {
+	if pattern == "" || strings.HasPrefix(pattern, "/") {
+		return errors.Errorf("invalid keep pattern %q; must be a relative, slash-separated path", pattern)
+	}
+	for _, elem := range strings.Split(pattern, "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return errors.Errorf("invalid keep pattern %q: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// MatchesKeepPattern reports whether the path of the file wp, relative to
+// baseDir, matches one of the keep patterns, as taken by PruneUnkeptFiles.
+func MatchesKeepPattern(baseDir, wp string, keep []string) (bool, error) {
+	if len(keep) == 0 {
+		return false, nil
+	}
+	rel, err := filepath.Rel(baseDir, wp)
+	if err != nil {
+		return false, err
+	}
+	elems := strings.Split(filepath.ToSlash(rel), "/")
+	for _, pattern := range keep {
+		if matchKeepPattern(strings.Split(pattern, "/"), elems) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchKeepPattern reports whether the elements of a path match those of a
+// keep pattern.
+func matchKeepPattern(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchKeepPattern(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], elems[0]); err != nil || !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+func isEmptyDir(dir string) (bool, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(1)
+	if len(names) > 0 {
+		return false, nil
+	}
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return true, nil
+}
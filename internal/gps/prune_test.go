@@ -0,0 +1,244 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestPruneBuildIgnoredFiles(t *testing.T) {
+	files := map[string]string{
+		"main.go":          "package foo\n",
+		"gen.go":           "// +build ignore\n\npackage main\n",
+		"gen_linux.go":     "// +build linux,ignore\n\npackage main\n",
+		"tagged.go":        "// +build linux\n\npackage foo\n",
+		"late.go":          "package foo\n\n// +build ignore\n",
+		"broken.go":        "// +build ignore\n\nthis is not go",
+		"notes.txt":        "// +build ignore\n",
+		"sub/sub.go":       "package sub\n",
+		"sub/generator.go": "// Generates things.\n\n// +build ignore\n\npackage main\n",
+	}
+
+	for _, tc := range []struct {
+		name    string
+		options PruneOptions
+		protect []string
+		pruned  []string
+	}{
+		{
+			name:    "option off",
+			options: 0,
+		},
+		{
+			name:    "option on",
+			options: PruneBuildIgnoredFiles,
+			pruned:  []string{"gen.go", "gen_linux.go", "sub/generator.go"},
+		},
+		{
+			name:    "protected",
+			options: PruneBuildIgnoredFiles,
+			protect: []string{"sub/**", "gen_*.go"},
+			pruned:  []string{"gen.go"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir, err := ioutil.TempDir("", "TestPruneBuildIgnoredFiles")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			for name, content := range files {
+				path := filepath.Join(tempDir, filepath.FromSlash(name))
+				if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+					t.Fatal(err)
+				}
+				if err = ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err = pruneProject(tempDir, tc.options, tc.protect); err != nil {
+				t.Fatal(err)
+			}
+
+			pruned := make(map[string]bool)
+			for _, name := range tc.pruned {
+				pruned[name] = true
+			}
+			for name := range files {
+				_, err := os.Stat(filepath.Join(tempDir, filepath.FromSlash(name)))
+				switch {
+				case pruned[name] && !os.IsNotExist(err):
+					t.Errorf("expected %s to be pruned", name)
+				case !pruned[name] && err != nil:
+					t.Errorf("expected %s to be kept, got %s", name, err)
+				}
+			}
+		})
+	}
+}
+
+// modeFixtureSourceManager exports each project as a fixed tree of files and
+// directories, with modes that no umask would leave.
+type modeFixtureSourceManager struct {
+	SourceManager
+}
+
+func (sm modeFixtureSourceManager) ExportProject(id ProjectIdentifier, v Version, to string) error {
+	for _, f := range []struct {
+		name string
+		perm os.FileMode
+	}{
+		{"main.go", 0600},
+		{"script.sh", 0700},
+		{"sub/sub.go", 0664},
+	} {
+		path := filepath.Join(to, filepath.FromSlash(f.name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, []byte("package foo\n"), f.perm); err != nil {
+			return err
+		}
+		if err := os.Chmod(path, f.perm); err != nil {
+			return err
+		}
+	}
+	return os.Chmod(filepath.Join(to, "sub"), 0700)
+}
+
+func TestWriteDepTreeNormalizeFileModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not kept on windows")
+	}
+
+	lock := solution{p: []LockedProject{
+		NewLockedProject(mkPI("example.com/foo"), NewVersion("v1.0.0").Is(Revision("rev")), []string{"."}),
+	}}
+
+	for _, tc := range []struct {
+		name    string
+		options PruneOptions
+		want    map[string]os.FileMode
+	}{
+		{
+			name:    "option off",
+			options: 0,
+			want: map[string]os.FileMode{
+				"example.com/foo/main.go":    0600,
+				"example.com/foo/script.sh":  0700,
+				"example.com/foo/sub":        0700,
+				"example.com/foo/sub/sub.go": 0664,
+			},
+		},
+		{
+			name:    "option on",
+			options: NormalizeFileModes,
+			want: map[string]os.FileMode{
+				".":                          0755,
+				"example.com":                0755,
+				"example.com/foo":            0755,
+				"example.com/foo/main.go":    0644,
+				"example.com/foo/script.sh":  0755,
+				"example.com/foo/sub":        0755,
+				"example.com/foo/sub/sub.go": 0644,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir, err := ioutil.TempDir("", "TestWriteDepTreeNormalizeFileModes")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			vendor := filepath.Join(tempDir, "vendor")
+			if err = WriteDepTree(vendor, lock, modeFixtureSourceManager{}, true, tc.options); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range tc.want {
+				fi, err := os.Stat(filepath.Join(vendor, filepath.FromSlash(name)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := fi.Mode().Perm(); got != want {
+					t.Errorf("expected %s to have mode %v, got %v", name, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneUnkeptFiles(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "TestPruneUnkeptFiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, name := range []string{
+		"foo.go",
+		"LICENSE",
+		"README.md",
+		"Makefile",
+		"sub/sub.go",
+		"sub/LICENSE.txt",
+		"sub/testdata/fixture.json",
+		"docs/img/logo.png",
+	} {
+		path := filepath.Join(tempDir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = PruneUnkeptFiles(tempDir, []string{"**/*.go", "**/LICENSE*"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err = filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == tempDir {
+			return err
+		}
+		rel, err := filepath.Rel(tempDir, path)
+		got = append(got, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// docs and sub/testdata held nothing worth keeping, so they are gone.
+	want := []string{"LICENSE", "foo.go", "sub", "sub/LICENSE.txt", "sub/sub.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected files left:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+}
+
+func TestValidateKeepPattern(t *testing.T) {
+	for pattern, valid := range map[string]bool{
+		"**/*.go":     true,
+		"LICENSE*":    true,
+		"a/**/b/[ab]": true,
+		"":            false,
+		"/abs/*.go":   false,
+		"[*.go":       false,
+	} {
+		if err := ValidateKeepPattern(pattern); (err == nil) != valid {
+			t.Errorf("%q: expected valid to be %v, got error %v", pattern, valid, err)
+		}
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
 // A Solution is returned by a solver run. It is mostly just a Lock, with some
@@ -23,6 +25,23 @@ type Solution interface {
 	// The version of the Solver used in generating this solution.
 	SolverVersion() int
 	Attempts() int
+	// Reasons reports, for each selected project, why the solver chose the
+	// version of it that it did.
+	Reasons() map[ProjectRoot]Reason
+}
+
+// Reason records why a version was chosen for a project: the constraint that
+// bound it, once the constraints of all the projects that require it were
+// combined, and the projects that imposed that constraint.
+//
+// RequiredBy usually holds a single project, whose constraint alone is the
+// combined one; the root project, if the constraint is an override; or, when
+// no single constraint binds, every project with a constraint that narrowed
+// it. If nothing constrained the project at all, the first project to require
+// it is taken to have bound it.
+type Reason struct {
+	Constraint Constraint
+	RequiredBy []ProjectRoot
 }
 
 type solution struct {
@@ -43,6 +62,9 @@ type solution struct {
 
 	// The solver used in producing this solution
 	solv Solver
+
+	// Why each project's version was chosen
+	why map[ProjectRoot]Reason
 }
 
 // WriteDepTree takes a basedir and a Lock, and exports all the projects
@@ -53,32 +75,124 @@ type solution struct {
 //
 // It requires a SourceManager to do the work, and takes a flag indicating
 // whether or not to strip vendor directories contained in the exported
-// dependencies.
-func WriteDepTree(basedir string, l Lock, sm SourceManager, sv bool) error {
+// dependencies. Each exported project is then pruned according to the given
+// PruneOptions, which also determine whether the modes of the whole tree are
+// normalized.
+func WriteDepTree(basedir string, l Lock, sm SourceManager, sv bool, prune PruneOptions) error {
+	return WriteDepTreeParallel(basedir, l, sm, sv, prune, nil, 1)
+}
+
+// WriteDepTreeParallel is like WriteDepTree, but exports up to n projects at
+// once, so sm must be safe for concurrent use, as SourceMgr is. A project
+// whose root is within that of another is only exported once the other has
+// been, so that the two don't write to the same directories at once.
+//
+// The files of each project whose paths relative to its root match one of
+// the protect patterns, as taken by PruneUnkeptFiles, are never pruned.
+func WriteDepTreeParallel(basedir string, l Lock, sm SourceManager, sv bool, prune PruneOptions, protect []string, n int) error {
 	if l == nil {
 		return fmt.Errorf("must provide non-nil Lock to WriteDepTree")
 	}
+	if n < 1 {
+		return fmt.Errorf("cannot export %d projects at once; must be at least 1", n)
+	}
 
 	err := os.MkdirAll(basedir, 0777)
 	if err != nil {
 		return err
 	}
 
-	// TODO(sdboyer) parallelize
-	for _, p := range l.Projects() {
-		to := filepath.FromSlash(filepath.Join(basedir, string(p.Ident().ProjectRoot)))
+	for _, level := range nestingLevels(l.Projects()) {
+		if err = exportProjects(basedir, level, sm, sv, prune, protect, n); err != nil {
+			removeAll(basedir)
+			return err
+		}
+	}
 
-		err = sm.ExportProject(p.Ident(), p.Version(), to)
-		if err != nil {
+	if (prune & NormalizeFileModes) != 0 {
+		if err = normalizeFileModes(basedir); err != nil {
 			removeAll(basedir)
-			return fmt.Errorf("error while exporting %s: %s", p.Ident().ProjectRoot, err)
+			return fmt.Errorf("error while normalizing file modes: %s", err)
 		}
-		if sv {
-			filepath.Walk(to, stripVendor)
+	}
+
+	return nil
+}
+
+// nestingLevels groups projects by how many of the others their roots are
+// within, in order: first those within none, then those within one, and so
+// on. Within each level, projects keep their order.
+func nestingLevels(projects []LockedProject) [][]LockedProject {
+	var levels [][]LockedProject
+	for _, p := range projects {
+		root := string(p.Ident().ProjectRoot)
+		depth := 0
+		for _, other := range projects {
+			if strings.HasPrefix(root, string(other.Ident().ProjectRoot)+"/") {
+				depth++
+			}
+		}
+		for len(levels) <= depth {
+			levels = append(levels, nil)
 		}
-		// TODO(sdboyer) dump version metadata file
+		levels[depth] = append(levels[depth], p)
+	}
+	return levels
+}
+
+// exportProjects exports projects into basedir, up to n at once. Once an
+// export fails, no more are started, and the first error is returned when the
+// rest have finished.
+func exportProjects(basedir string, projects []LockedProject, sm SourceManager, sv bool, prune PruneOptions, protect []string, n int) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, n)
+	for _, p := range projects {
+		sem <- struct{}{}
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(p LockedProject) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := exportProject(basedir, p, sm, sv, prune, protect); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(p)
 	}
+	wg.Wait()
+	return firstErr
+}
+
+// exportProject exports p into its directory beneath basedir, stripping its
+// vendor directories if sv is true, and prunes it, sparing the files matching
+// the protect patterns.
+func exportProject(basedir string, p LockedProject, sm SourceManager, sv bool, prune PruneOptions, protect []string) error {
+	to := filepath.FromSlash(filepath.Join(basedir, string(p.Ident().ProjectRoot)))
 
+	if err := sm.ExportProject(p.Ident(), p.Version(), to); err != nil {
+		return fmt.Errorf("error while exporting %s: %s", p.Ident().ProjectRoot, err)
+	}
+	if sv {
+		filepath.Walk(to, stripVendor)
+	}
+	if err := pruneProject(to, prune, protect); err != nil {
+		return fmt.Errorf("error while pruning %s: %s", p.Ident().ProjectRoot, err)
+	}
+	// TODO(sdboyer) dump version metadata file
 	return nil
 }
 
@@ -109,3 +223,7 @@ func (r solution) SolverName() string {
 func (r solution) SolverVersion() int {
 	return r.solv.Version()
 }
+
+func (r solution) Reasons() map[ProjectRoot]Reason {
+	return r.why
+}
@@ -9,7 +9,12 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/golang/dep/internal/test"
 )
 
 var basicResult solution
@@ -90,12 +95,12 @@ func testWriteDepTree(t *testing.T) {
 	}
 
 	// nil lock/result should err immediately
-	err = WriteDepTree(tmp, nil, sm, true)
+	err = WriteDepTree(tmp, nil, sm, true, 0)
 	if err == nil {
 		t.Errorf("Should error if nil lock is passed to WriteDepTree")
 	}
 
-	err = WriteDepTree(tmp, r, sm, true)
+	err = WriteDepTree(tmp, r, sm, true, 0)
 	if err != nil {
 		t.Errorf("Unexpected error while creating vendor tree: %s", err)
 	}
@@ -111,6 +116,86 @@ func testWriteDepTree(t *testing.T) {
 	}
 }
 
+// concurrentSourceManager exports a single file for each project, taking a
+// while to do it, and records how many exports it was running at once.
+type concurrentSourceManager struct {
+	SourceManager
+
+	test.Concurrency
+
+	mu          sync.Mutex
+	exported    map[ProjectRoot]bool
+	nestedEarly []ProjectRoot // exported before the project they are within
+}
+
+func (sm *concurrentSourceManager) ExportProject(id ProjectIdentifier, v Version, to string) error {
+	done := sm.Start()
+	defer done()
+
+	sm.mu.Lock()
+	if parent := path.Dir(string(id.ProjectRoot)); parent == "example.com/nest" && !sm.exported["example.com/nest"] {
+		sm.nestedEarly = append(sm.nestedEarly, id.ProjectRoot)
+	}
+	sm.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+	err := os.MkdirAll(to, 0777)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(to, "x.go"), []byte("package x\n"), 0666)
+	}
+
+	sm.mu.Lock()
+	sm.exported[id.ProjectRoot] = true
+	sm.mu.Unlock()
+	return err
+}
+
+func TestWriteDepTreeParallel(t *testing.T) {
+	var projects []LockedProject
+	for i := 0; i < 12; i++ {
+		projects = append(projects, NewLockedProject(pi("example.com/p"+strconv.Itoa(i)), NewVersion("v1.0.0").Is("rev"), nil))
+	}
+	// A project whose root is within another's.
+	projects = append(projects,
+		NewLockedProject(pi("example.com/nest/inner"), NewVersion("v1.0.0").Is("rev"), nil),
+		NewLockedProject(pi("example.com/nest"), NewVersion("v1.0.0").Is("rev"), nil),
+	)
+	l := SimpleLock(projects)
+
+	tmp, err := ioutil.TempDir("", "TestWriteDepTreeParallel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, n := range []int{1, 3} {
+		sm := &concurrentSourceManager{exported: make(map[ProjectRoot]bool)}
+		vendor := filepath.Join(tmp, "vendor"+strconv.Itoa(n))
+		if err = WriteDepTreeParallel(vendor, l, sm, true, 0, nil, n); err != nil {
+			t.Fatal(err)
+		}
+
+		if sm.Max() > n {
+			t.Errorf("expected at most %d exports at once, saw %d", n, sm.Max())
+		}
+		if n > 1 && sm.Max() < 2 {
+			t.Errorf("expected exports to run at once, saw at most %d", sm.Max())
+		}
+		if len(sm.nestedEarly) != 0 {
+			t.Errorf("expected %v to be exported only after example.com/nest", sm.nestedEarly)
+		}
+		for _, p := range projects {
+			if _, err = os.Stat(filepath.Join(vendor, filepath.FromSlash(string(p.Ident().ProjectRoot)), "x.go")); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	if err = WriteDepTreeParallel(filepath.Join(tmp, "none"), l, &concurrentSourceManager{}, true, 0, nil, 0); err == nil {
+		t.Error("expected an error for exporting 0 projects at once")
+	}
+}
+
 func BenchmarkCreateVendorTree(b *testing.B) {
 	// We're fs-bound here, so restrict to single parallelism
 	b.SetParallelism(1)
@@ -119,7 +204,7 @@ func BenchmarkCreateVendorTree(b *testing.B) {
 	tmp := path.Join(os.TempDir(), "vsolvtest")
 
 	clean := true
-	sm, err := NewSourceManager(path.Join(tmp, "cache"))
+	sm, err := NewSourceManager(SourceManagerConfig{Cachedir: path.Join(tmp, "cache")})
 	if err != nil {
 		b.Errorf("NewSourceManager errored unexpectedly: %q", err)
 		clean = false
@@ -143,7 +228,7 @@ func BenchmarkCreateVendorTree(b *testing.B) {
 			// ease manual inspection
 			os.RemoveAll(exp)
 			b.StartTimer()
-			err = WriteDepTree(exp, r, sm, true)
+			err = WriteDepTree(exp, r, sm, true, 0)
 			b.StopTimer()
 			if err != nil {
 				b.Errorf("unexpected error after %v iterations: %s", i, err)
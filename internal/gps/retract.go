@@ -0,0 +1,68 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "strings"
+
+// retractPrefix is the prefix of the tags with which an upstream retracts a
+// release: a tag named retract/v1.2.0, pointing anywhere, marks the v1.2.0
+// release as one that should no longer be used.
+const retractPrefix = "retract/"
+
+// splitRetracted removes the retraction tags from pvl, returning the remaining
+// versions along with those of them that have been retracted.
+func splitRetracted(pvl []PairedVersion) (vl, retracted []PairedVersion) {
+	names := make(map[string]bool)
+	for _, v := range pvl {
+		if v.Type() == IsBranch {
+			continue
+		}
+		if name := v.String(); strings.HasPrefix(name, retractPrefix) {
+			names[strings.TrimPrefix(name, retractPrefix)] = true
+		}
+	}
+	if len(names) == 0 {
+		return pvl, nil
+	}
+
+	vl = make([]PairedVersion, 0, len(pvl))
+	for _, v := range pvl {
+		if v.Type() != IsBranch && strings.HasPrefix(v.String(), retractPrefix) {
+			continue
+		}
+		if v.Type() != IsBranch && names[v.String()] {
+			retracted = append(retracted, v)
+		}
+		vl = append(vl, v)
+	}
+	return vl, retracted
+}
+
+// deprioritizeRetracted moves the retracted versions in vl to its end, keeping
+// the relative order of the rest, so that the solver only settles on one when
+// no other version is acceptable.
+func deprioritizeRetracted(vl []Version, retracted []PairedVersion) {
+	if len(retracted) == 0 {
+		return
+	}
+
+	// Versions are matched by name, as the same version may be represented by
+	// distinct values.
+	isRetracted := make(map[string]bool, len(retracted))
+	for _, v := range retracted {
+		isRetracted[v.String()] = true
+	}
+
+	kept := make([]Version, 0, len(vl))
+	var moved []Version
+	for _, v := range vl {
+		if v.Type() != IsBranch && v.Type() != IsRevision && isRetracted[v.String()] {
+			moved = append(moved, v)
+		} else {
+			kept = append(kept, v)
+		}
+	}
+	copy(vl, append(kept, moved...))
+}
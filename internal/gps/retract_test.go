@@ -0,0 +1,90 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDeprioritizeRetracted(t *testing.T) {
+	vl := []Version{
+		NewVersion("v1.2.0").Is("120rev"),
+		NewVersion("v1.1.0").Is("110rev"),
+		NewVersion("v1.0.0").Is("100rev"),
+		NewBranch("master").Is("masterrev"),
+	}
+	deprioritizeRetracted(vl, []PairedVersion{
+		NewVersion("v1.2.0").Is("120rev"),
+		NewVersion("v1.0.0").Is("100rev"),
+	})
+
+	var got []string
+	for _, v := range vl {
+		got = append(got, v.String())
+	}
+	want := []string{"v1.1.0", "master", "v1.2.0", "v1.0.0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected versions in order %v, got %v", want, got)
+	}
+}
+
+func TestGitSourceRetractedTags(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestGitSourceRetractedTags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	upstream := filepath.Join(tmp, "upstream")
+	rev := newGitFixture(t, upstream, map[string]string{"main.go": "package main\n"})
+	for _, tag := range []string{"v1.0.0", "v1.1.0", "retract/v1.1.0", "retract/v9.9.9"} {
+		cmd := exec.Command("git", "tag", tag)
+		cmd.Dir = upstream
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git tag %s: %s\n%s", tag, err, out)
+		}
+	}
+
+	ctx := context.Background()
+	mb := maybeGitSource{url: &url.URL{Scheme: "file", Path: upstream}}
+	sg := newSourceGateway(mb, newSupervisor(ctx), filepath.Join(tmp, "cache"), sourceOptions{})
+
+	vl, err := sg.listVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SortPairedForUpgrade(vl)
+	want := []string{"v1.1.0", "v1.0.0", "master"}
+	if got := pairedStrings(vl); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the retraction tags to be left out of the versions %v, got %v", want, got)
+	}
+
+	retracted, err := sg.listRetracted(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"v1.1.0"}
+	if got := pairedStrings(retracted); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the retracted versions to be %v, got %v", want, got)
+	}
+	if retracted[0].Underlying() != rev {
+		t.Errorf("expected the retracted version to be paired with %s, got %s", rev, retracted[0].Underlying())
+	}
+}
+
+func pairedStrings(vl []PairedVersion) []string {
+	var s []string
+	for _, v := range vl {
+		s = append(s, v.String())
+	}
+	return s
+}
@@ -48,13 +48,17 @@ type rootdata struct {
 
 	// The ProjectAnalyzer to use for all GetManifestAndLock calls.
 	an ProjectAnalyzer
+
+	// Whether to leave out the imports of the root's test files.
+	notests bool
 }
 
 // externalImportList returns a list of the unique imports from the root data.
 // Ignores and requires are taken into consideration, stdlib is excluded, and
-// errors within the local set of package are not backpropagated.
+// errors within the local set of package are not backpropagated. The imports
+// of test files are only included if notests is unset.
 func (rd rootdata) externalImportList(stdLibFn func(string) bool) []string {
-	rm, _ := rd.rpt.ToReachMap(true, true, false, rd.ig)
+	rm, _ := rd.rpt.ToReachMap(true, !rd.notests, false, rd.ig)
 	reach := rm.FlattenFn(stdLibFn)
 
 	// If there are any requires, slide them into the reach list, as well.
@@ -33,6 +33,12 @@ func (s *solver) check(a atomWithPackages, pkgonly bool) error {
 		if err = s.checkAtomAllowable(pa); err != nil {
 			return err
 		}
+		if err = s.checkAtomExcluded(pa); err != nil {
+			return err
+		}
+		if err = s.checkAtomSigned(pa); err != nil {
+			return err
+		}
 	}
 
 	if err = s.checkRequiredPackagesExist(a); err != nil {
@@ -100,6 +106,71 @@ func (s *solver) checkAtomAllowable(pa atom) error {
 	return err
 }
 
+// checkAtomExcluded ensures that the atom is neither one of the versions
+// excluded for its project, nor, if it is a revision, the revision of one.
+// Excluded versions are rejected here, where every version is selected, rather
+// than left out of the version lists, as locks and revision constraints bring
+// in versions of their own.
+func (s *solver) checkAtomExcluded(pa atom) error {
+	pr := pa.id.ProjectRoot
+	if len(s.exclude[pr]) == 0 {
+		return nil
+	}
+	if s.exclude.excludes(pr, pa.v) {
+		return &excludedVersionFailure{goal: pa}
+	}
+
+	r, ok := pa.v.(Revision)
+	if !ok {
+		return nil
+	}
+	vl, err := s.b.listVersions(pa.id)
+	if err != nil {
+		return err
+	}
+	for _, v := range vl {
+		if pv, ok := v.(PairedVersion); ok && pv.Underlying() == r && s.exclude.excludes(pr, pv) {
+			return &excludedVersionFailure{goal: pa, version: pv}
+		}
+	}
+	return nil
+}
+
+// checkAtomSigned ensures that, if the versions of the atom's source are limited
+// to signed tags, the atom is one of those tags, at the revision it was listed
+// with. Versions from locks and revision constraints don't come from the
+// source's version list, so they must be checked against it here.
+func (s *solver) checkAtomSigned(pa atom) error {
+	signed, err := s.b.requiresSignedTags(pa.id)
+	if err != nil || !signed {
+		return err
+	}
+
+	vl, err := s.b.listVersions(pa.id)
+	if err != nil {
+		return err
+	}
+	for _, v := range vl {
+		if pv, ok := v.(PairedVersion); ok && isSignedTag(pv, pa.v) {
+			return nil
+		}
+	}
+	return &unsignedVersionFailure{goal: pa}
+}
+
+// isSignedTag reports whether v is, or is the revision of, the signed tag pv.
+func isSignedTag(pv PairedVersion, v Version) bool {
+	switch tv := v.(type) {
+	case Revision:
+		return pv.Underlying() == tv
+	case PairedVersion:
+		return pv.Underlying() == tv.Underlying() && pv.Unpair() == tv.Unpair()
+	case UnpairedVersion:
+		return pv.Unpair() == tv
+	}
+	return false
+}
+
 // checkRequiredPackagesExist ensures that all required packages enumerated by
 // existing dependencies on this atom are actually present in the atom.
 func (s *solver) checkRequiredPackagesExist(a atomWithPackages) error {
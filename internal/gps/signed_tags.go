@@ -0,0 +1,90 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// noSignedTagsError indicates that none of the tags of a git source that must
+// only offer signed tags are signed by a trusted key.
+type noSignedTagsError struct {
+	remote, keyring string
+}
+
+func (e noSignedTagsError) Error() string {
+	return fmt.Sprintf("none of the tags of %s are signed by a key in %s", e.remote, e.keyring)
+}
+
+// onlySignedTags returns the versions in vlist that are tags signed by a key in
+// r.keyring, named under tagPrefix, and pointing at the revision they are
+// listed with. Branches are dropped as well, as nothing vouches for them. An
+// error is returned if no tags remain.
+//
+// The signatures are verified in the local clone, which is made, or brought up
+// to date, first, as listing the remote's refs doesn't bring the tag objects.
+func (r *gitRepo) onlySignedTags(ctx context.Context, vlist []PairedVersion, tagPrefix string) ([]PairedVersion, error) {
+	if r.CheckLocal() {
+		if err := r.fetch(ctx); err != nil {
+			return nil, err
+		}
+	} else if err := r.get(ctx); err != nil {
+		return nil, err
+	}
+
+	// The keyring is imported into a home of its own, so that only its keys
+	// are trusted, rather than any the user happens to have.
+	home, err := ioutil.TempDir("", "dep-gnupg")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create a home for gpg")
+	}
+	defer os.RemoveAll(home)
+	env := mergeEnvLists([]string{"GNUPGHOME=" + home}, os.Environ())
+
+	c := newMonitoredCmd(exec.Command("gpg", "--batch", "--quiet", "--import", r.keyring), 30*time.Second)
+	c.cmd.Env = env
+	if out, err := c.combinedOutput(ctx); err != nil {
+		return nil, newVcsLocalErrorOr("unable to import keyring "+r.keyring, err, string(out))
+	}
+
+	signed := vlist[:0]
+	for _, v := range vlist {
+		if _, ok := v.Unpair().(branchVersion); ok {
+			continue
+		}
+		tag := tagPrefix + v.String()
+		c := newMonitoredCmd(r.CmdFromDir("git", "verify-tag", tag), 30*time.Second)
+		c.cmd.Env = env
+		if _, err := c.combinedOutput(ctx); err != nil {
+			if err == context.Canceled || err == context.DeadlineExceeded {
+				return nil, err
+			}
+			continue
+		}
+
+		// The signature vouches for the commit the tag points at in the
+		// clone, so it only vouches for v if that is v's revision.
+		out, err := runFromRepoDir(ctx, r, "git", "rev-parse", tag+"^{commit}")
+		if err != nil {
+			return nil, newVcsLocalErrorOr("unable to resolve tag "+tag, err, string(out))
+		}
+		if Revision(strings.TrimSpace(string(out))) == v.Underlying() {
+			signed = append(signed, v)
+		}
+	}
+
+	if len(signed) == 0 {
+		return nil, noSignedTagsError{remote: r.Remote(), keyring: r.keyring}
+	}
+	return signed, nil
+}
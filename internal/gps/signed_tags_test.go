@@ -0,0 +1,213 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGitSourceSignedTags(t *testing.T) {
+	requiresBins(t, "git", "gpg")
+
+	tmp, err := ioutil.TempDir("", "TestGitSourceSignedTags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// The signing key lives in a home of its own, which the source never
+	// sees; it is only given the exported public key.
+	gnupghome := filepath.Join(tmp, "gnupg")
+	if err := os.Mkdir(gnupghome, 0700); err != nil {
+		t.Fatal(err)
+	}
+	env := []string{"GNUPGHOME=" + gnupghome}
+	run := func(dir string, args ...string) string {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = dir
+		cmd.Env = mergeEnvLists(env, os.Environ())
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %s\n%s", strings.Join(args, " "), err, out)
+		}
+		return string(out)
+	}
+	defer exec.Command("gpgconf", "--homedir", gnupghome, "--kill", "gpg-agent").Run()
+
+	run(tmp, "gpg", "--batch", "--pinentry-mode", "loopback", "--passphrase", "",
+		"--quick-gen-key", "dep <dep@example.com>", "default", "sign", "never")
+	keyring := filepath.Join(tmp, "trusted.asc")
+	if err := ioutil.WriteFile(keyring, []byte(run(tmp, "gpg", "--armor", "--export", "dep@example.com")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := filepath.Join(tmp, "upstream")
+	newGitFixture(t, upstream, map[string]string{"main.go": "package main\n"})
+	tag := []string{"git", "-c", "user.name=dep", "-c", "user.email=dep@example.com", "tag"}
+	run(upstream, append(tag, "-s", "-u", "dep@example.com", "-m", "signed", "v1.0.0")...)
+	run(upstream, append(tag, "-a", "-m", "unsigned", "v1.1.0")...)
+	run(upstream, append(tag, "v1.2.0")...)
+
+	opts := sourceOptions{
+		keyring:          keyring,
+		signedTagSources: map[string]bool{"example.com/signed": true},
+	}
+	for _, tc := range []struct {
+		name   string
+		signed bool
+		want   []string
+	}{
+		{"example.com/signed", true, []string{"v1.0.0"}},
+		{"example.com/any", false, []string{"v1.2.0", "v1.1.0", "v1.0.0", "master"}},
+	} {
+		ctx := context.Background()
+		mb := maybeGitSource{url: &url.URL{Scheme: "file", Path: upstream}}
+		sg := newSourceGateway(mb, newSupervisor(ctx), filepath.Join(tmp, tc.name), opts.forSource(tc.name))
+
+		vl, err := sg.listVersions(ctx)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		SortPairedForUpgrade(vl)
+		if got := pairedStrings(vl); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected versions %v, got %v", tc.name, tc.want, got)
+		}
+
+		signed, err := sg.requiresSignedTags(ctx)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if signed != tc.signed {
+			t.Errorf("%s: expected requiresSignedTags to be %t, got %t", tc.name, tc.signed, signed)
+		}
+	}
+
+	// A key that signed none of the tags leaves nothing to select.
+	other := filepath.Join(tmp, "other")
+	if err := os.Mkdir(other, 0700); err != nil {
+		t.Fatal(err)
+	}
+	env = []string{"GNUPGHOME=" + other}
+	defer exec.Command("gpgconf", "--homedir", other, "--kill", "gpg-agent").Run()
+	run(tmp, "gpg", "--batch", "--pinentry-mode", "loopback", "--passphrase", "",
+		"--quick-gen-key", "other <other@example.com>", "default", "sign", "never")
+	untrusted := filepath.Join(tmp, "untrusted.asc")
+	if err := ioutil.WriteFile(untrusted, []byte(run(tmp, "gpg", "--armor", "--export", "other@example.com")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	mb := maybeGitSource{url: &url.URL{Scheme: "file", Path: upstream}}
+	_, _, err = mb.try(ctx, filepath.Join(tmp, "untrusted"), sourceOptions{keyring: untrusted, signedTags: true}, newMemoryCache(), newSupervisor(ctx))
+	if _, ok := err.(noSignedTagsError); !ok {
+		t.Errorf("expected an error for a source with no tags signed by a trusted key, got %v", err)
+	}
+}
+
+// signedTagsSM limits the versions of the projects in signed to the tags listed
+// there, as SourceMgr does for sources that require signed tags, and gives the
+// projects in locks those locks.
+type signedTagsSM struct {
+	*depspecSourceManager
+	signed map[ProjectRoot][]PairedVersion
+	locks  map[ProjectRoot]fixLock
+}
+
+func (sm signedTagsSM) RequiresSignedTags(id ProjectIdentifier) (bool, error) {
+	_, ok := sm.signed[id.ProjectRoot]
+	return ok, nil
+}
+
+func (sm signedTagsSM) ListVersions(id ProjectIdentifier) ([]PairedVersion, error) {
+	if vl, ok := sm.signed[id.ProjectRoot]; ok {
+		return vl, nil
+	}
+	return sm.depspecSourceManager.ListVersions(id)
+}
+
+func (sm signedTagsSM) GetManifestAndLock(id ProjectIdentifier, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
+	m, l, err := sm.depspecSourceManager.GetManifestAndLock(id, v, an)
+	if lock, ok := sm.locks[id.ProjectRoot]; ok && err == nil {
+		l = lock
+	}
+	return m, l, err
+}
+
+func TestSolveSignedTagsOnly(t *testing.T) {
+	signed := NewVersion("1.0.0").Is("r10")
+	for _, tc := range []struct {
+		name     string
+		root     string
+		lock     fixLock
+		depLock  fixLock
+		want     Version
+		wantFail bool
+	}{
+		{name: "unsigned tag locked", root: "a ^1.0.0", lock: mklock("a 1.1.0 r11"), want: signed},
+		{name: "signed tag locked at another revision", root: "a ^1.0.0", lock: mklock("a 1.0.0 r11"), want: signed},
+		{name: "revision of an unsigned tag locked", root: "a ^1.0.0", lock: mkrevlock("a 1.1.0 r11"), want: signed},
+		{name: "signed tag locked", root: "a ^1.0.0", lock: mklock("a 1.0.0 r10"), want: signed},
+		{name: "unsigned tag preferred by a dependency's lock", root: "a ^1.0.0", depLock: mklock("a 1.1.0 r11"), want: signed},
+		{name: "revision of a signed tag", root: "a rr10", want: signed},
+		{name: "revision of an unsigned tag", root: "a rr11", wantFail: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ds := []depspec{
+				mkDepspec("root 0.0.0", tc.root, "b 1.0.0"),
+				mkDepspec("a 1.0.0 r10"),
+				mkDepspec("a 1.1.0 r11"),
+				mkDepspec("b 1.0.0", "a *"),
+			}
+			fix := basicFixture{ds: ds, l: tc.lock}
+			params := SolveParameters{
+				RootDir:         string(fix.ds[0].n),
+				RootPackageTree: fix.rootTree(),
+				Manifest:        fix.rootmanifest(),
+				ProjectAnalyzer: naiveAnalyzer{},
+				stdLibFn:        func(string) bool { return false },
+				mkBridgeFn:      overrideMkBridge,
+			}
+			if tc.lock != nil {
+				params.Lock = tc.lock
+			}
+			sm := signedTagsSM{
+				depspecSourceManager: newdepspecSM(fix.ds, nil),
+				signed:               map[ProjectRoot][]PairedVersion{"a": {signed.(PairedVersion)}},
+				locks:                map[ProjectRoot]fixLock{"b": tc.depLock},
+			}
+
+			s, err := Prepare(params, sm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			soln, err := s.Solve()
+			if tc.wantFail {
+				if err == nil {
+					t.Fatalf("expected the solve to fail, got %v", soln.Projects())
+				}
+				if !strings.Contains(err.Error(), "only signed tags") {
+					t.Fatalf("expected an unsigned version failure, got %s", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, lp := range soln.Projects() {
+				if lp.Ident().ProjectRoot == "a" && lp.Version() != tc.want {
+					t.Errorf("expected a to be solved to %s, got %s", tc.want, lp.Version())
+				}
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/Masterminds/semver"
 	"github.com/golang/dep/internal/gps/pkgtree"
@@ -900,6 +901,21 @@ var basicFixtures = map[string]basicFixture{
 			"foo bmaster oldrev",
 		),
 	},
+	// This is how dep implements floating constraints: the project is always
+	// marked for change, so the branch head wins over the locked rev.
+	"lock to branch on old rev moves to new rev when changed": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo bmaster"),
+			mkDepspec("foo bmaster newrev"),
+		},
+		l: mklock(
+			"foo bmaster oldrev",
+		),
+		r: mksolution(
+			"foo bmaster newrev",
+		),
+		changelist: []ProjectRoot{"foo"},
+	},
 	// Whereas this is a normal situation for a branch, when it occurs for a
 	// tag, it means someone's been naughty upstream. Still, though, the outcome
 	// is the same.
@@ -1522,6 +1538,18 @@ func (sm *depspecSourceManager) SyncSourceFor(id ProjectIdentifier) error {
 	return nil
 }
 
+func (sm *depspecSourceManager) ListRetracted(id ProjectIdentifier) ([]PairedVersion, error) {
+	return nil, nil
+}
+
+func (sm *depspecSourceManager) RequiresSignedTags(id ProjectIdentifier) (bool, error) {
+	return false, nil
+}
+
+func (sm *depspecSourceManager) CommitTime(id ProjectIdentifier, r Revision) (time.Time, error) {
+	return time.Time{}, fmt.Errorf("Project %s has no commit time for revision %s", id.errString(), r)
+}
+
 func (sm *depspecSourceManager) Release() {}
 
 func (sm *depspecSourceManager) ExportProject(id ProjectIdentifier, v Version, to string) error {
@@ -1575,11 +1603,8 @@ func (b *depspecBridge) listVersions(id ProjectIdentifier) ([]Version, error) {
 		}
 	}
 
-	if b.down {
-		SortForDowngrade(vl)
-	} else {
-		SortForUpgrade(vl)
-	}
+	b.sortVersions(vl)
+	b.s.licenses.prefer(id, vl)
 
 	b.vlists[id] = vl
 	return vl, nil
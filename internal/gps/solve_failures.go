@@ -494,3 +494,51 @@ func (e *nonexistentRevisionFailure) traceString() string {
 		e.goal.dep.Ident.errString(),
 	)
 }
+
+// unsignedVersionFailure indicates that an atom was rejected because its source
+// is limited to signed tags, and it is not one, or not at the revision the tag
+// was signed at.
+type unsignedVersionFailure struct {
+	goal atom
+}
+
+func (e *unsignedVersionFailure) Error() string {
+	return fmt.Sprintf(
+		"Could not introduce %s, as only signed tags of %s may be used",
+		a2vs(e.goal),
+		e.goal.id.errString(),
+	)
+}
+
+func (e *unsignedVersionFailure) traceString() string {
+	return fmt.Sprintf("%s is not a signed tag", a2vs(e.goal))
+}
+
+// excludedVersionFailure indicates that an atom was rejected because it is one
+// of the versions excluded for its project, or the revision of one.
+type excludedVersionFailure struct {
+	goal atom
+	// version is the excluded version that the goal is the revision of, if
+	// the goal is a revision.
+	version Version
+}
+
+func (e *excludedVersionFailure) Error() string {
+	if e.version != nil {
+		return fmt.Sprintf(
+			"Could not introduce %s, as it is the revision of %s, which is excluded for %s",
+			a2vs(e.goal),
+			e.version,
+			e.goal.id.errString(),
+		)
+	}
+	return fmt.Sprintf(
+		"Could not introduce %s, as it is excluded for %s",
+		a2vs(e.goal),
+		e.goal.id.errString(),
+	)
+}
+
+func (e *excludedVersionFailure) traceString() string {
+	return fmt.Sprintf("%s is excluded", a2vs(e.goal))
+}
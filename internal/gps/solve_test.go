@@ -293,6 +293,186 @@ func TestRootLockNoVersionPairMatching(t *testing.T) {
 	fixtureSolveSimpleChecks(fix, res, err, t)
 }
 
+func TestSolutionReasons(t *testing.T) {
+	// A diamond: root requires a and b, which both require shared, and b's
+	// constraint is the one that binds.
+	fix := basicFixture{
+		n: "diamond",
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a 1.0.0", "b *"),
+			mkDepspec("a 1.0.0", "shared >=1.0.0, <2.0.0"),
+			mkDepspec("b 1.0.0", "shared >=1.2.0, <1.3.0"),
+			mkDepspec("shared 1.0.0"),
+			mkDepspec("shared 1.2.3"),
+			mkDepspec("shared 1.3.0"),
+		},
+		r: mksolution(
+			"a 1.0.0",
+			"b 1.0.0",
+			"shared 1.2.3",
+		),
+	}
+
+	res, err := solveBasicsAndCheck(fix, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[ProjectRoot]string{
+		"a":      "sv-1.0.0 [root]",
+		"b":      "svc-* [root]",
+		"shared": "svc-~1.2.0 [b]",
+	}
+	got := make(map[ProjectRoot]string)
+	for pr, r := range res.Reasons() {
+		got[pr] = fmt.Sprintf("%s %v", r.Constraint.typedString(), r.RequiredBy)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected reasons:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+
+	// The chosen version must be admitted by the recorded constraint.
+	for _, lp := range res.Projects() {
+		r := res.Reasons()[lp.Ident().ProjectRoot]
+		if !r.Constraint.Matches(lp.Version()) {
+			t.Errorf("%s %s is not admitted by its reason's constraint %s", lp.Ident().ProjectRoot, lp.Version(), r.Constraint)
+		}
+	}
+
+	// When neither constraint binds alone, both requirers are recorded.
+	fix.ds[1] = mkDepspec("a 1.0.0", "shared >=1.1.0")
+	fix.ds[2] = mkDepspec("b 1.0.0", "shared <1.3.0")
+	res, err = solveBasicsAndCheck(fix, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := res.Reasons()["shared"]
+	by := make([]string, len(r.RequiredBy))
+	for i, pr := range r.RequiredBy {
+		by[i] = string(pr)
+	}
+	sort.Strings(by)
+	if !reflect.DeepEqual(by, []string{"a", "b"}) {
+		t.Errorf("expected shared to be required by a and b, got %v", r.RequiredBy)
+	}
+
+	// A revision and a version constraint only intersect through the
+	// versions paired with the revision.
+	fix.ds[1] = mkDepspec("a 1.0.0", "shared r123")
+	fix.ds[4] = mkDepspec("shared 1.2.3 123")
+	fix.ds = append(fix.ds, mkDepspec("shared r123"))
+	fix.r = mksolution("a 1.0.0", "b 1.0.0", "shared 1.2.3 123")
+	if _, err = solveBasicsAndCheck(fix, t); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSolvePreferNewest(t *testing.T) {
+	ds := []depspec{
+		mkDepspec("root 0.0.0", "a ^1.0.0"),
+		mkDepspec("a 1.0.0 r10"),
+		mkDepspec("a 1.1.0 r11"),
+		mkDepspec("a 1.2.0+build.1 r12a"),
+		mkDepspec("a 1.2.0+build.2 r12b"),
+		mkDepspec("a 1.3.0-beta r13"),
+		mkDepspec("a 2.0.0 r20"),
+	}
+
+	solve := func(ds []depspec, newest, down bool) (Version, error) {
+		fix := basicFixture{ds: ds}
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: fix.rootTree(),
+			Manifest:        fix.rootmanifest(),
+			ProjectAnalyzer: naiveAnalyzer{},
+			PreferNewest:    newest,
+			Downgrade:       down,
+			stdLibFn:        func(string) bool { return false },
+			mkBridgeFn:      overrideMkBridge,
+		}
+		s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+		if err != nil {
+			return nil, err
+		}
+		soln, err := s.Solve()
+		if err != nil {
+			return nil, err
+		}
+		return soln.Projects()[0].Version(), nil
+	}
+
+	// The two 1.2.0 builds are the newest compatible versions, and of equal
+	// precedence, so the one with the greater build metadata is chosen, as it
+	// is without PreferNewest, however the versions are listed.
+	want := NewVersion("1.2.0+build.2").Is("r12b")
+	for i := 1; i < len(ds); i++ {
+		listed := append(append([]depspec{ds[0]}, ds[i:]...), ds[1:i]...)
+		got, err := solve(listed, true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("expected %s to be chosen from %v, got %s", want, listed[1:], got)
+		}
+	}
+
+	if got, err := solve(ds, false, false); err != nil || got != want {
+		t.Errorf("expected the default order to choose %s as well, got %s, %v", want, got, err)
+	}
+
+	if _, err := solve(ds, true, true); err == nil || !strings.Contains(err.Error(), "cannot both be set") {
+		t.Errorf("expected PreferNewest and Downgrade to be rejected together, got %v", err)
+	}
+}
+
+func TestSolveSkipTestImports(t *testing.T) {
+	// a is imported by both the root's code and its tests, b only by its
+	// tests.
+	fix := basicFixture{ds: []depspec{
+		mkDepspec("root 0.0.0", "a 1.0.0", "(dev) a 1.0.0", "(dev) b 1.0.0"),
+		mkDepspec("a 1.0.0"),
+		mkDepspec("b 1.0.0"),
+	}}
+
+	solve := func(skip bool) ([]string, []byte) {
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: fix.rootTree(),
+			Manifest:        fix.rootmanifest(),
+			ProjectAnalyzer: naiveAnalyzer{},
+			SkipTestImports: skip,
+			stdLibFn:        func(string) bool { return false },
+			mkBridgeFn:      overrideMkBridge,
+		}
+		s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		soln, err := s.Solve()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var roots []string
+		for _, lp := range soln.Projects() {
+			roots = append(roots, string(lp.Ident().ProjectRoot))
+		}
+		sort.Strings(roots)
+		return roots, soln.InputHash()
+	}
+
+	all, withTests := solve(false)
+	if !reflect.DeepEqual(all, []string{"a", "b"}) {
+		t.Errorf("expected the test imports to be solved for, got %v", all)
+	}
+	prod, withoutTests := solve(true)
+	if !reflect.DeepEqual(prod, []string{"a"}) {
+		t.Errorf("expected only the project imported outside tests to be solved for, got %v", prod)
+	}
+	if bytes.Equal(withTests, withoutTests) {
+		t.Error("expected leaving out the test imports to change the inputs digest")
+	}
+}
+
 // TestBadSolveOpts exercises the different possible inputs to a solver that can
 // be determined as invalid in Prepare(), without any further work
 func TestBadSolveOpts(t *testing.T) {
@@ -88,6 +88,37 @@ type SolveParameters struct {
 	// typical case.
 	Downgrade bool
 
+	// PreferNewest makes the order in which the solver tries the versions of
+	// each project fully deterministic: the order of SortForUpgrade, with
+	// versions that are the same but for their revision ordered by revision,
+	// ascending. See sortForNewest for the complete order. The solver then
+	// always picks the same version given the same source state, however the
+	// versions were listed. It can't be combined with Downgrade.
+	PreferNewest bool
+
+	// LicensePreference, if set, makes the solver try the versions of each
+	// project that are under one of its allowed licenses before the others.
+	// Among either, versions are still tried in the order given by Downgrade.
+	//
+	// This is experimental.
+	LicensePreference *LicensePreference
+
+	// Exclude lists, by project root, the versions of projects that the
+	// solver must never select, even where their constraints would allow
+	// them. Branches and revisions can't be excluded.
+	Exclude map[ProjectRoot][]string
+
+	// SkipTestImports leaves out the imports of the root project's test
+	// files, so that packages imported only by its tests are neither solved
+	// for nor locked. Packages that the root also imports from non-test files
+	// are kept.
+	SkipTestImports bool
+
+	// Mirrors lists the source mirrors that the SourceManager was configured
+	// with. They play no part in solving, but are hashed with the other
+	// inputs, so that a lock is out of date once they change.
+	Mirrors []SourceMirror
+
 	// TraceLogger is the logger to use for generating trace output. If set, the
 	// solver will generate informative trace output as it moves through the
 	// solving process.
@@ -117,6 +148,18 @@ type solver struct {
 	// The function to use to recognize standard library import paths.
 	stdLibFn func(string) bool
 
+	// The licenses to prefer among the versions of each project, if any.
+	licenses *LicensePreference
+
+	// Whether to order versions with sortForNewest.
+	preferNewest bool
+
+	// The versions of each project that must not be selected.
+	exclude excludedVersions
+
+	// The source mirrors in use, for hashing.
+	mirrors sourceMirrors
+
 	// A bridge to the standard SourceManager. The adapter does some local
 	// caching of pre-sorted version lists, as well as translation between the
 	// full-on ProjectIdentifiers that the solver deals with and the simplified
@@ -192,6 +235,7 @@ func (params SolveParameters) toRootdata() (rootdata, error) {
 		chngall: params.ChangeAll,
 		dir:     params.RootDir,
 		an:      params.ProjectAnalyzer,
+		notests: params.SkipTestImports,
 	}
 
 	// Ensure the required, ignore and overrides maps are at least initialized
@@ -279,6 +323,10 @@ func Prepare(params SolveParameters, sm SourceManager) (Solver, error) {
 		return nil, err
 	}
 
+	if params.Downgrade && params.PreferNewest {
+		return nil, badOptsFailure("Downgrade and PreferNewest cannot both be set")
+	}
+
 	if params.stdLibFn == nil {
 		params.stdLibFn = paths.IsStandardImportPath
 	}
@@ -286,7 +334,12 @@ func Prepare(params SolveParameters, sm SourceManager) (Solver, error) {
 	s := &solver{
 		tl:       params.TraceLogger,
 		stdLibFn: params.stdLibFn,
+		licenses: params.LicensePreference,
+		exclude:  newExcludedVersions(params.Exclude),
+		mirrors:  params.Mirrors,
 		rd:       rd,
+
+		preferNewest: params.PreferNewest,
 	}
 
 	// Set up the bridge and ensure the root dir is in good, working order
@@ -389,6 +442,7 @@ func (s *solver) Solve() (Solution, error) {
 	// Set up a metrics object
 	s.mtr = newMetrics()
 	s.vUnify.mtr = s.mtr
+	s.sel.vu.mtr = s.mtr
 
 	// Prime the queues with the root project
 	err := s.selectRoot()
@@ -398,6 +452,13 @@ func (s *solver) Solve() (Solution, error) {
 
 	all, err := s.solve()
 
+	// The reasons are worked out while the metrics are still open, as
+	// intersecting constraints may still record them.
+	var why map[ProjectRoot]Reason
+	if err == nil {
+		why = s.reasons()
+	}
+
 	s.mtr.pop()
 	var soln solution
 	if err == nil {
@@ -407,6 +468,7 @@ func (s *solver) Solve() (Solution, error) {
 		}
 		soln.analyzerName, soln.analyzerVersion = s.rd.an.Info()
 		soln.hd = s.HashInputs()
+		soln.why = why
 
 		// Convert ProjectAtoms into LockedProjects
 		soln.p = make([]LockedProject, len(all))
@@ -956,6 +1018,11 @@ func (s *solver) getLockVersionIfValid(id ProjectIdentifier) (Version, error) {
 		}
 	}
 
+	if s.exclude.excludes(id.ProjectRoot, v) {
+		s.b.breakLock()
+		return nil, nil
+	}
+
 	return v, nil
 }
 
@@ -1256,6 +1323,42 @@ func (s *solver) unselectLast() (atomWithPackages, bool) {
 	return awp, first
 }
 
+// reasons works out, from the final selection, why each selected project's
+// version was chosen. It plays no part in the input hash, which is computed
+// from the solver's inputs alone.
+func (s *solver) reasons() map[ProjectRoot]Reason {
+	why := make(map[ProjectRoot]Reason)
+	for _, sp := range s.sel.projects {
+		id := sp.a.a.id
+		if _, has := why[id.ProjectRoot]; has || s.rd.isRoot(id.ProjectRoot) {
+			continue
+		}
+
+		combined := s.sel.getConstraint(id)
+		r := Reason{Constraint: combined}
+		deps := s.sel.getDependenciesOn(id)
+		if pp, has := s.rd.ovr[id.ProjectRoot]; has && pp.Constraint != nil {
+			r.RequiredBy = []ProjectRoot{ProjectRoot(s.rd.rpt.ImportRoot)}
+		} else {
+			for _, dep := range deps {
+				if dep.dep.Constraint.typedString() == combined.typedString() {
+					r.RequiredBy = []ProjectRoot{dep.depender.id.ProjectRoot}
+					break
+				}
+			}
+			if r.RequiredBy == nil {
+				for _, dep := range deps {
+					if !IsAny(dep.dep.Constraint) {
+						r.RequiredBy = append(r.RequiredBy, dep.depender.id.ProjectRoot)
+					}
+				}
+			}
+		}
+		why[id.ProjectRoot] = r
+	}
+	return why
+}
+
 // simple (temporary?) helper just to convert atoms into locked projects
 func pa2lp(pa atom, pkgs map[string]struct{}) LockedProject {
 	lp := LockedProject{
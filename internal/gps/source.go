@@ -8,7 +8,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/golang/dep/internal/gps/pkgtree"
 )
@@ -40,6 +42,70 @@ func (rc srcReturnChans) awaitReturn() (sg *sourceGateway, err error) {
 	return
 }
 
+// sourceOptions holds the settings, beyond the cache location, that apply to
+// every source the coordinator sets up.
+type sourceOptions struct {
+	env   []string // additional environment for VCS commands
+	lfs   bool     // whether to materialize Git LFS content on export
+	depth int      // commits of history to clone for git sources; 0 for all
+
+	// depths overrides depth for the sources it maps, by the name they are
+	// requested by.
+	depths map[string]int
+
+	// refNamespace is the namespace of refs from which a git source's
+	// versions are listed, in place of refs/tags; refNamespaces maps it for
+	// the sources that set it, by the name they are requested by.
+	refNamespace  string
+	refNamespaces map[string]string
+
+	// keyring is a file of the public keys trusted to sign tags. If
+	// signedTags is set, the versions of git sources are limited to tags
+	// signed by one of them; signedTagSources sets it for the sources it
+	// maps, by the name they are requested by.
+	keyring          string
+	signedTags       bool
+	signedTagSources map[string]bool
+
+	// creds, if set, provides credentials for HTTPS sources.
+	creds *credentialHelper
+
+	// caBundle, if set, is the file of the certificate authorities that git
+	// and hg sources trust for HTTPS, in place of the system's.
+	caBundle string
+
+	// customCAs is set if certificate authorities other than the system's
+	// are to be trusted for HTTPS, which bzr sources can't be given.
+	customCAs bool
+
+	// cloneTimeout, if set, limits how long each clone or fetch may take.
+	cloneTimeout time.Duration
+
+	// offline, if set, refuses every operation that goes upstream, and sets
+	// up sources from the cache alone.
+	offline bool
+
+	// mirrors rewrites the URLs that sources are fetched from, once they
+	// are deduced from the sources' own names.
+	mirrors sourceMirrors
+
+	// metadata, if set, keeps the version lists of sources on disk, so that
+	// they aren't listed from upstream again until they go stale.
+	metadata *metadataCache
+}
+
+// forSource returns the options for the source requested by name.
+func (o sourceOptions) forSource(name string) sourceOptions {
+	if d, has := o.depths[name]; has {
+		o.depth = d
+	}
+	o.refNamespace = o.refNamespaces[name]
+	if o.signedTagSources[name] {
+		o.signedTags = true
+	}
+	return o
+}
+
 type sourceCoordinator struct {
 	supervisor *supervisor
 	srcmut     sync.RWMutex // guards srcs and nameToURL maps
@@ -49,13 +115,15 @@ type sourceCoordinator struct {
 	protoSrcs  map[string][]srcReturnChans
 	deducer    deducer
 	cachedir   string
+	opts       sourceOptions
 }
 
-func newSourceCoordinator(superv *supervisor, deducer deducer, cachedir string) *sourceCoordinator {
+func newSourceCoordinator(superv *supervisor, deducer deducer, cachedir string, opts sourceOptions) *sourceCoordinator {
 	return &sourceCoordinator{
 		supervisor: superv,
 		deducer:    deducer,
 		cachedir:   cachedir,
+		opts:       opts,
 		srcs:       make(map[string]*sourceGateway),
 		nameToURL:  make(map[string]string),
 		protoSrcs:  make(map[string][]srcReturnChans),
@@ -123,6 +191,9 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 		doReturn(nil, err)
 		return nil, err
 	}
+	// Only the fetching is redirected to a mirror; the source is still
+	// deduced, and its options looked up, by its own name.
+	pd.mb = sc.opts.mirrors.rewriteSource(pd.mb)
 
 	// It'd be quite the feat - but not impossible - for a gateway
 	// corresponding to this normalizedName to have slid into the main
@@ -141,7 +212,7 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 	}
 	sc.srcmut.RUnlock()
 
-	srcGate = newSourceGateway(pd.mb, sc.supervisor, sc.cachedir)
+	srcGate = newSourceGateway(pd.mb, sc.supervisor, sc.cachedir, sc.opts.forSource(normalizedName))
 
 	// The normalized name is usually different from the source URL- e.g.
 	// github.com/golang/dep/internal/gps vs. https://github.com/golang/dep/internal/gps. But it's
@@ -181,7 +252,9 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 // and caching them as needed.
 type sourceGateway struct {
 	cachedir string
+	opts     sourceOptions
 	maybe    maybeSource
+	url      string // the URL of the maybeSource src was set up from
 	srcState sourceState
 	src      source
 	cache    singleSourceCache
@@ -189,10 +262,11 @@ type sourceGateway struct {
 	suprvsr  *supervisor
 }
 
-func newSourceGateway(maybe maybeSource, superv *supervisor, cachedir string) *sourceGateway {
+func newSourceGateway(maybe maybeSource, superv *supervisor, cachedir string, opts sourceOptions) *sourceGateway {
 	sg := &sourceGateway{
 		maybe:    maybe,
 		cachedir: cachedir,
+		opts:     opts,
 		suprvsr:  superv,
 	}
 	sg.cache = sg.createSingleSourceCache()
@@ -246,7 +320,7 @@ func (sg *sourceGateway) exportVersionTo(ctx context.Context, v Version, to stri
 		return err
 	}
 
-	err = sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
+	err = sg.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
 		return sg.src.exportRevisionTo(ctx, r, to)
 	})
 
@@ -258,7 +332,7 @@ func (sg *sourceGateway) exportVersionTo(ctx context.Context, v Version, to stri
 	// actually was the cause of the problem.
 	if err != nil && sg.srcState&sourceHasLatestLocally == 0 {
 		if _, err = sg.require(ctx, sourceHasLatestLocally); err != nil {
-			err = sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
+			err = sg.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
 				return sg.src.exportRevisionTo(ctx, r, to)
 			})
 		}
@@ -288,7 +362,7 @@ func (sg *sourceGateway) getManifestAndLock(ctx context.Context, pr ProjectRoot,
 
 	name, vers := an.Info()
 	label := fmt.Sprintf("%s:%s.%v", sg.src.upstreamURL(), name, vers)
-	err = sg.suprvsr.do(ctx, label, ctGetManifestAndLock, func(ctx context.Context) error {
+	err = sg.do(ctx, label, ctGetManifestAndLock, func(ctx context.Context) error {
 		m, l, err = sg.src.getManifestAndLock(ctx, pr, r, an)
 		return err
 	})
@@ -307,7 +381,7 @@ func (sg *sourceGateway) getManifestAndLock(ctx context.Context, pr ProjectRoot,
 			return nil, nil, err
 		}
 
-		err = sg.suprvsr.do(ctx, label, ctGetManifestAndLock, func(ctx context.Context) error {
+		err = sg.do(ctx, label, ctGetManifestAndLock, func(ctx context.Context) error {
 			m, l, err = sg.src.getManifestAndLock(ctx, pr, r, an)
 			return err
 		})
@@ -343,7 +417,7 @@ func (sg *sourceGateway) listPackages(ctx context.Context, pr ProjectRoot, v Ver
 	}
 
 	label := fmt.Sprintf("%s:%s", pr, sg.src.upstreamURL())
-	err = sg.suprvsr.do(ctx, label, ctListPackages, func(ctx context.Context) error {
+	err = sg.do(ctx, label, ctListPackages, func(ctx context.Context) error {
 		ptree, err = sg.src.listPackages(ctx, pr, r)
 		return err
 	})
@@ -362,7 +436,7 @@ func (sg *sourceGateway) listPackages(ctx context.Context, pr ProjectRoot, v Ver
 			return pkgtree.PackageTree{}, err
 		}
 
-		err = sg.suprvsr.do(ctx, label, ctGetManifestAndLock, func(ctx context.Context) error {
+		err = sg.do(ctx, label, ctGetManifestAndLock, func(ctx context.Context) error {
 			ptree, err = sg.src.listPackages(ctx, pr, r)
 			return err
 		})
@@ -428,7 +502,36 @@ func (sg *sourceGateway) listVersions(ctx context.Context) ([]PairedVersion, err
 		return nil, err
 	}
 
-	return sg.cache.getAllVersions(), nil
+	vl, _ := splitRetracted(sg.cache.getAllVersions())
+	return vl, nil
+}
+
+func (sg *sourceGateway) listRetracted(ctx context.Context) ([]PairedVersion, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	_, err := sg.require(ctx, sourceIsSetUp|sourceExistsUpstream|sourceHasLatestVersionList)
+	if err != nil {
+		return nil, err
+	}
+
+	_, retracted := splitRetracted(sg.cache.getAllVersions())
+	return retracted, nil
+}
+
+// requiresSignedTags reports whether the versions of sg's source are limited
+// to signed tags, which is only done for git sources.
+func (sg *sourceGateway) requiresSignedTags(ctx context.Context) (bool, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	if !sg.opts.signedTags {
+		return false, nil
+	}
+	if _, err := sg.require(ctx, sourceIsSetUp); err != nil {
+		return false, err
+	}
+	return sg.src.sourceType() == "git", nil
 }
 
 func (sg *sourceGateway) revisionPresentIn(ctx context.Context, r Revision) (bool, error) {
@@ -451,6 +554,28 @@ func (sg *sourceGateway) revisionPresentIn(ctx context.Context, r Revision) (boo
 	return present, err
 }
 
+func (sg *sourceGateway) commitTime(ctx context.Context, r Revision) (time.Time, error) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	_, err := sg.require(ctx, sourceIsSetUp|sourceExistsLocally)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, err := sg.src.commitTime(ctx, r)
+
+	// As with exports, the revision may only be missing because the local
+	// repository is out of date.
+	if err != nil && sg.srcState&sourceHasLatestLocally == 0 {
+		if _, err := sg.require(ctx, sourceHasLatestLocally); err != nil {
+			return time.Time{}, err
+		}
+		t, err = sg.src.commitTime(ctx, r)
+	}
+	return t, err
+}
+
 func (sg *sourceGateway) sourceURL(ctx context.Context) (string, error) {
 	sg.mu.Lock()
 	defer sg.mu.Unlock()
@@ -463,6 +588,59 @@ func (sg *sourceGateway) sourceURL(ctx context.Context) (string, error) {
 	return sg.src.upstreamURL(), nil
 }
 
+// do runs f through the supervisor, within the concurrency limit for the type
+// of sg's source.
+func (sg *sourceGateway) do(ctx context.Context, name string, typ callType, f func(context.Context) error) error {
+	if sg.opts.offline {
+		switch typ {
+		case ctSourcePing, ctSourceInit, ctSourceFetch, ctListVersions:
+			return fmt.Errorf("cannot reach %s while offline", sg.src.upstreamURL())
+		}
+	}
+	// Listing the versions of a source limited to signed tags fetches them
+	// into its local copy to verify them, so it is bound as a fetch is.
+	fetches := typ == ctSourceInit || typ == ctSourceFetch || (typ == ctListVersions && sg.opts.signedTags)
+	if timeout := sg.opts.cloneTimeout; timeout > 0 && fetches {
+		// The clock only starts once the operation is allowed to run.
+		unlimited := f
+		f = func(ctx context.Context) error {
+			tctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			err := unlimited(tctx)
+			if err != nil && ctx.Err() == nil && tctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("gave up after the clone timeout of %s", timeout)
+			}
+			return err
+		}
+	}
+	switch {
+	case fetches, typ == ctCheckoutVersion, typ == ctExportTree, typ == ctGetManifestAndLock, typ == ctListPackages:
+		if sg.cachedir == "" {
+			// Without a cache, there is no local copy to share.
+			break
+		}
+		// These use the local copy of the source, which another dep process
+		// may be using at the same time, so they take its lock. It is taken
+		// before the clone timeout's clock starts.
+		unlocked := f
+		f = func(ctx context.Context) error {
+			l, err := lockFile(ctx, sg.lockPath())
+			if err != nil {
+				return fmt.Errorf("unable to lock the cache of %s: %s", sg.src.upstreamURL(), err)
+			}
+			defer l.unlock()
+			return unlocked(ctx)
+		}
+	}
+	return sg.suprvsr.doLimited(ctx, sg.src.sourceType(), name, typ, f)
+}
+
+// lockPath returns the path of the file that is locked while the local copy
+// of sg's source is in use.
+func (sg *sourceGateway) lockPath() string {
+	return filepath.Join(sg.cachedir, "sources", sanitizer.Replace(sg.src.upstreamURL())+".lock")
+}
+
 // createSingleSourceCache creates a singleSourceCache instance for use by
 // the encapsulated source.
 func (sg *sourceGateway) createSingleSourceCache() singleSourceCache {
@@ -487,9 +665,9 @@ func (sg *sourceGateway) require(ctx context.Context, wanted sourceState) (errSt
 
 			switch flag {
 			case sourceIsSetUp:
-				sg.src, addlState, err = sg.maybe.try(ctx, sg.cachedir, sg.cache, sg.suprvsr)
+				sg.src, sg.url, addlState, err = trySource(ctx, sg.maybe, sg.cachedir, sg.opts, sg.cache, sg.suprvsr)
 			case sourceExistsUpstream:
-				err = sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourcePing, func(ctx context.Context) error {
+				err = sg.do(ctx, sg.src.sourceType(), ctSourcePing, func(ctx context.Context) error {
 					if !sg.src.existsUpstream(ctx) {
 						return fmt.Errorf("%s does not exist upstream", sg.src.upstreamURL())
 					}
@@ -497,7 +675,12 @@ func (sg *sourceGateway) require(ctx context.Context, wanted sourceState) (errSt
 				})
 			case sourceExistsLocally:
 				if !sg.src.existsLocally(ctx) {
-					err = sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourceInit, func(ctx context.Context) error {
+					err = sg.do(ctx, sg.src.sourceType(), ctSourceInit, func(ctx context.Context) error {
+						// Another process may have set up the local copy
+						// while its lock was awaited.
+						if sg.src.existsLocally(ctx) {
+							return sg.src.updateLocal(ctx)
+						}
 						return sg.src.initLocal(ctx)
 					})
 
@@ -508,17 +691,23 @@ func (sg *sourceGateway) require(ctx context.Context, wanted sourceState) (errSt
 					}
 				}
 			case sourceHasLatestVersionList:
-				var pvl []PairedVersion
-				err = sg.suprvsr.do(ctx, sg.src.sourceType(), ctListVersions, func(ctx context.Context) error {
-					pvl, err = sg.src.listVersions(ctx)
-					return err
-				})
+				key := metadataKey(sg.url, sg.opts)
+				pvl, cached := sg.opts.metadata.load(key)
+				if !cached {
+					err = sg.do(ctx, sg.src.sourceType(), ctListVersions, func(ctx context.Context) error {
+						pvl, err = sg.src.listVersions(ctx)
+						return err
+					})
+					if err == nil {
+						sg.opts.metadata.save(key, pvl)
+					}
+				}
 
 				if err == nil {
 					sg.cache.storeVersionMap(pvl, true)
 				}
 			case sourceHasLatestLocally:
-				err = sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourceFetch, func(ctx context.Context) error {
+				err = sg.do(ctx, sg.src.sourceType(), ctSourceFetch, func(ctx context.Context) error {
 					return sg.src.updateLocal(ctx)
 				})
 			}
@@ -551,6 +740,7 @@ type source interface {
 	getManifestAndLock(context.Context, ProjectRoot, Revision, ProjectAnalyzer) (Manifest, Lock, error)
 	listPackages(context.Context, ProjectRoot, Revision) (pkgtree.PackageTree, error)
 	revisionPresentIn(Revision) (bool, error)
+	commitTime(context.Context, Revision) (time.Time, error)
 	exportRevisionTo(context.Context, Revision, string) error
 	sourceType() string
 }
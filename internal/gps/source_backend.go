@@ -0,0 +1,261 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/dep/internal/gps/pkgtree"
+)
+
+// A SourceBackend fetches the versions and code of a project from one kind of
+// source. Programs that embed gps can teach it about other kinds of source,
+// such as an artifact store, by registering a backend for a URL scheme with
+// RegisterSourceBackend.
+//
+// The built-in VCS sources are SourceBackends as well. The source manager
+// still uses them directly, though, as they keep a local clone from which they
+// read manifests, locks and packages in place, where a registered
+// SourceBackend can only export trees to read them from.
+type SourceBackend interface {
+	// ListVersions returns every version in the source, each paired with the
+	// revision it refers to.
+	ListVersions(ctx context.Context) ([]PairedVersion, error)
+
+	// RevisionPresentIn reports whether the revision r exists in the source.
+	RevisionPresentIn(ctx context.Context, r Revision) (bool, error)
+
+	// ExportRevisionTo writes the tree of the source at revision r to the
+	// directory to. Its parent exists, but to itself does not.
+	ExportRevisionTo(ctx context.Context, r Revision, to string) error
+}
+
+// SourceBackendFunc creates the SourceBackend for the source at u. cachedir
+// is a directory, which may not exist yet, in which the backend may keep what
+// it fetches across runs.
+type SourceBackendFunc func(u *url.URL, cachedir string) (SourceBackend, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]SourceBackendFunc)
+)
+
+// RegisterSourceBackend makes fn the backend for sources whose URL has the
+// given scheme, so that a manifest can name them as, for example,
+// source = "artifact://example.com/foo". Sources with other schemes are left
+// to the built-in VCS sources.
+//
+// It panics if fn is nil, if a backend is already registered for scheme, or if
+// scheme is one the built-in VCS sources use. It is meant to be called from
+// an init function.
+func RegisterSourceBackend(scheme string, fn SourceBackendFunc) {
+	if fn == nil {
+		panic("gps: RegisterSourceBackend with a nil backend")
+	}
+	for _, schemes := range [][]string{gitSchemes, bzrSchemes, hgSchemes, svnSchemes} {
+		for _, s := range schemes {
+			if s == scheme {
+				panic(fmt.Sprintf("gps: the %s scheme is reserved for the built-in VCS sources", scheme))
+			}
+		}
+	}
+
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if _, has := backends[scheme]; has {
+		panic(fmt.Sprintf("gps: a source backend is already registered for the %s scheme", scheme))
+	}
+	backends[scheme] = fn
+}
+
+// sourceBackendFor returns the backend registered for scheme, if there is one.
+func sourceBackendFor(scheme string) (SourceBackendFunc, bool) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	fn, has := backends[scheme]
+	return fn, has
+}
+
+// maybeBackendSource is the maybeSource for a source with a registered
+// backend.
+type maybeBackendSource struct {
+	url *url.URL
+	fn  SourceBackendFunc
+}
+
+func (m maybeBackendSource) try(ctx context.Context, cachedir string, opts sourceOptions, c singleSourceCache, superv *supervisor) (source, sourceState, error) {
+	ustr := m.url.String()
+	b, err := m.fn(m.url, filepath.Join(cachedir, "sources", sanitizer.Replace(ustr)))
+	if err != nil {
+		return nil, 0, err
+	}
+	src := &backendSource{url: m.url, b: b}
+
+	// Whatever the backend has kept is all there is to go on while offline.
+	if opts.offline {
+		return src, sourceIsSetUp | sourceExistsLocally, nil
+	}
+
+	var vl []PairedVersion
+	err = superv.doLimited(ctx, m.url.Scheme, m.url.Scheme+":lv:maybe", ctListVersions, func(ctx context.Context) (err error) {
+		if vl, err = b.ListVersions(ctx); err != nil {
+			return fmt.Errorf("source at %s does not exist, or is inaccessible: %s", ustr, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	c.storeVersionMap(vl, true)
+	return src, sourceIsSetUp | sourceExistsUpstream | sourceExistsLocally | sourceHasLatestVersionList, nil
+}
+
+func (m maybeBackendSource) getURL() string {
+	return m.url.String()
+}
+
+// backendSource is a source served by a registered SourceBackend. The backend
+// only exports trees, so the manifest, lock and packages of a revision are
+// read from an export of it.
+type backendSource struct {
+	url *url.URL
+	b   SourceBackend
+}
+
+func (s *backendSource) existsLocally(ctx context.Context) bool  { return true }
+func (s *backendSource) existsUpstream(ctx context.Context) bool { return true }
+func (s *backendSource) upstreamURL() string                     { return s.url.String() }
+func (s *backendSource) initLocal(ctx context.Context) error     { return nil }
+func (s *backendSource) updateLocal(ctx context.Context) error   { return nil }
+
+// sourceType is the scheme the backend is registered for, which is what
+// VCSConcurrency limits it by.
+func (s *backendSource) sourceType() string { return s.url.Scheme }
+
+func (s *backendSource) revisionPresentIn(r Revision) (bool, error) {
+	return s.b.RevisionPresentIn(context.Background(), r)
+}
+
+func (s *backendSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
+	return s.b.ListVersions(ctx)
+}
+
+func (s *backendSource) exportRevisionTo(ctx context.Context, r Revision, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+		return err
+	}
+	return s.b.ExportRevisionTo(ctx, r, to)
+}
+
+func (s *backendSource) commitTime(ctx context.Context, r Revision) (time.Time, error) {
+	return time.Time{}, fmt.Errorf("%s sources don't record commit times", s.url.Scheme)
+}
+
+func (s *backendSource) getManifestAndLock(ctx context.Context, pr ProjectRoot, r Revision, an ProjectAnalyzer) (m Manifest, l Lock, err error) {
+	err = s.withExport(ctx, r, func(dir string) error {
+		m, l, err = an.DeriveManifestAndLock(dir, pr)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if l != nil && l != Lock(nil) {
+		l = prepLock(l)
+	}
+	return prepManifest(m), l, nil
+}
+
+func (s *backendSource) listPackages(ctx context.Context, pr ProjectRoot, r Revision) (ptree pkgtree.PackageTree, err error) {
+	err = s.withExport(ctx, r, func(dir string) error {
+		ptree, err = pkgtree.ListPackages(dir, string(pr))
+		return err
+	})
+	return
+}
+
+// withExport exports revision r to a temporary directory, which is removed
+// once f, which is passed it, returns.
+func (s *backendSource) withExport(ctx context.Context, r Revision, f func(dir string) error) error {
+	tmp, err := ioutil.TempDir("", "dep-backend")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := filepath.Join(tmp, "src")
+	if err := s.b.ExportRevisionTo(ctx, r, dir); err != nil {
+		return err
+	}
+	return f(dir)
+}
+
+var (
+	_ SourceBackend = (*gitSource)(nil)
+	_ SourceBackend = (*gopkginSource)(nil)
+	_ SourceBackend = (*bzrSource)(nil)
+	_ SourceBackend = (*hgSource)(nil)
+)
+
+// setUpLocal makes the local clone of bs, if it doesn't have one yet, as its
+// methods as a SourceBackend read from it.
+func (bs *baseVCSSource) setUpLocal(ctx context.Context) error {
+	if bs.existsLocally(ctx) {
+		return nil
+	}
+	return bs.initLocal(ctx)
+}
+
+// RevisionPresentIn implements SourceBackend.
+func (bs *baseVCSSource) RevisionPresentIn(ctx context.Context, r Revision) (bool, error) {
+	if err := bs.setUpLocal(ctx); err != nil {
+		return false, err
+	}
+	return bs.revisionPresentIn(r)
+}
+
+// ExportRevisionTo implements SourceBackend.
+func (bs *baseVCSSource) ExportRevisionTo(ctx context.Context, r Revision, to string) error {
+	if err := bs.setUpLocal(ctx); err != nil {
+		return err
+	}
+	return bs.exportRevisionTo(ctx, r, to)
+}
+
+// ListVersions implements SourceBackend.
+func (s *gitSource) ListVersions(ctx context.Context) ([]PairedVersion, error) {
+	return s.listVersions(ctx)
+}
+
+// ExportRevisionTo implements SourceBackend.
+func (s *gitSource) ExportRevisionTo(ctx context.Context, r Revision, to string) error {
+	if err := s.setUpLocal(ctx); err != nil {
+		return err
+	}
+	return s.exportRevisionTo(ctx, r, to)
+}
+
+// ListVersions implements SourceBackend.
+func (s *gopkginSource) ListVersions(ctx context.Context) ([]PairedVersion, error) {
+	return s.listVersions(ctx)
+}
+
+// ListVersions implements SourceBackend.
+func (s *bzrSource) ListVersions(ctx context.Context) ([]PairedVersion, error) {
+	return s.listVersions(ctx)
+}
+
+// ListVersions implements SourceBackend.
+func (s *hgSource) ListVersions(ctx context.Context) ([]PairedVersion, error) {
+	return s.listVersions(ctx)
+}
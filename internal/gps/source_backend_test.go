@@ -0,0 +1,164 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/internal/gps/pkgtree"
+)
+
+// artifactBackend is a fake SourceBackend serving a single Go package, at a
+// fixed set of versions.
+type artifactBackend struct {
+	versions []PairedVersion
+}
+
+func (b artifactBackend) ListVersions(ctx context.Context) ([]PairedVersion, error) {
+	return b.versions, nil
+}
+
+func (b artifactBackend) RevisionPresentIn(ctx context.Context, r Revision) (bool, error) {
+	for _, v := range b.versions {
+		if v.Underlying() == r {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (b artifactBackend) ExportRevisionTo(ctx context.Context, r Revision, to string) error {
+	if ok, _ := b.RevisionPresentIn(ctx, r); !ok {
+		return fmt.Errorf("no artifact for %s", r)
+	}
+	if err := os.Mkdir(to, 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(to, "foo.go"), []byte("package foo\n"), 0644)
+}
+
+func init() {
+	RegisterSourceBackend("artifact", func(u *url.URL, cachedir string) (SourceBackend, error) {
+		return artifactBackend{versions: []PairedVersion{
+			NewVersion("v1.0.0").Is("rev100"),
+			NewVersion("v1.2.0").Is("rev120"),
+			NewVersion("v2.0.0").Is("rev200"),
+		}}, nil
+	})
+}
+
+func TestSourceBackendSolve(t *testing.T) {
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+	tmp, err := ioutil.TempDir("", "TestSourceBackendSolve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	params := SolveParameters{
+		RootDir: tmp,
+		RootPackageTree: pkgtree.PackageTree{
+			ImportRoot: "root",
+			Packages: map[string]pkgtree.PackageOrErr{
+				"root": {P: pkgtree.Package{
+					ImportPath: "root",
+					Name:       "root",
+					Imports:    []string{"example.com/foo"},
+				}},
+			},
+		},
+		Manifest: simpleRootManifest{
+			c: ProjectConstraints{
+				"example.com/foo": {Source: "artifact://example.com/foo", Constraint: mkSVC("^1.0.0")},
+			},
+		},
+		ProjectAnalyzer: naiveAnalyzer{},
+	}
+	s, err := Prepare(params, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	soln, err := s.Solve()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(soln.Projects()) != 1 {
+		t.Fatalf("expected a single project in the solution, got %v", soln.Projects())
+	}
+	lp := soln.Projects()[0]
+	if lp.Ident().Source != "artifact://example.com/foo" {
+		t.Errorf("expected the project to come from its artifact source, got %q", lp.Ident().Source)
+	}
+	if want := NewVersion("v1.2.0").Is("rev120"); lp.Version() != want {
+		t.Errorf("expected ^1.0.0 to resolve to %s through the backend, got %s", want, lp.Version())
+	}
+
+	// The backend's exports are what gets vendored.
+	to := filepath.Join(tmp, "vendor", "foo")
+	if err := sm.ExportProject(lp.Ident(), lp.Version(), to); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(to, "foo.go")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegisterSourceBackendReserved(t *testing.T) {
+	fn := func(u *url.URL, cachedir string) (SourceBackend, error) { return nil, nil }
+	for _, scheme := range []string{"https", "artifact"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected registering a backend for %s to panic", scheme)
+				}
+			}()
+			RegisterSourceBackend(scheme, fn)
+		}()
+	}
+}
+
+func TestBuiltinSourceBackend(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestBuiltinSourceBackend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	upstream := filepath.Join(tmp, "upstream")
+	rev := newGitFixture(t, upstream, map[string]string{"foo.go": "package foo\n"})
+
+	ctx := context.Background()
+	mb := maybeGitSource{url: &url.URL{Scheme: "file", Path: upstream}}
+	gs, _, err := mb.try(ctx, filepath.Join(tmp, "cache"), sourceOptions{}, newMemoryCache(), newSupervisor(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The git source hasn't been cloned yet; going through SourceBackend
+	// must do that itself.
+	src := &backendSource{url: mb.url, b: gs.(SourceBackend)}
+	ptree, err := src.listPackages(ctx, "example.com/foo", rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, has := ptree.Packages["example.com/foo"]; !has {
+		t.Errorf("expected example.com/foo to be listed, got %v", ptree.Packages)
+	}
+	vl, err := src.listVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vl) == 0 {
+		t.Error("expected the git source to list its default branch")
+	}
+}
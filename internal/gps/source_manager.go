@@ -7,6 +7,8 @@ package gps
 import (
 	"context"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -44,10 +46,23 @@ type SourceManager interface {
 	// TODO convert to []PairedVersion
 	ListVersions(ProjectIdentifier) ([]PairedVersion, error)
 
+	// ListRetracted retrieves the versions of the given repository that its
+	// upstream has retracted. They are still included by ListVersions.
+	ListRetracted(ProjectIdentifier) ([]PairedVersion, error)
+
+	// RequiresSignedTags reports whether the versions of the given repository
+	// are limited to the tags signed by a trusted key. A version selected for
+	// it must then be one of those ListVersions returns, at its revision.
+	RequiresSignedTags(ProjectIdentifier) (bool, error)
+
 	// RevisionPresentIn indicates whether the provided Version is present in
 	// the given repository.
 	RevisionPresentIn(ProjectIdentifier, Revision) (bool, error)
 
+	// CommitTime returns the time at which the provided Revision was committed
+	// to the given repository.
+	CommitTime(ProjectIdentifier, Revision) (time.Time, error)
+
 	// ListPackages parses the tree of the Go packages at or below root of the
 	// provided ProjectIdentifier, at the provided version.
 	ListPackages(ProjectIdentifier, Version) (pkgtree.PackageTree, error)
@@ -116,9 +131,121 @@ func (smIsReleased) Error() string {
 
 var _ SourceManager = &SourceMgr{}
 
-// NewSourceManager produces an instance of gps's built-in SourceManager. It
-// takes a cache directory, where local instances of upstream sources are
-// stored.
+// SourceManagerConfig holds configuration information for creating SourceMgrs.
+type SourceManagerConfig struct {
+	Cachedir string // Where to store local instances of upstream sources.
+
+	// HostTokens maps hostnames, optionally with a port, to access tokens.
+	// HTTPS requests to these hosts, both for go-get metadata and for git
+	// sources, are authenticated with the corresponding token.
+	HostTokens map[string]string
+
+	// CACerts holds PEM encoded certificates of additional certificate
+	// authorities to trust for all HTTPS operations. The system's trusted
+	// authorities remain trusted as well, unless CACertsOnly is set. bzr can't
+	// be given them, so its sources can't be set up over HTTPS while either is
+	// set.
+	CACerts     []byte
+	CACertsOnly bool
+
+	// VCSTypes forces the type of repository ("git", "hg" or "bzr") used for
+	// the project roots or source URLs it maps, skipping detection.
+	VCSTypes map[string]string
+
+	// GitLFS makes exports of git sources that track files with Git LFS fetch
+	// and check out the real content of those files, rather than their
+	// pointers, if git-lfs is installed.
+	GitLFS bool
+
+	// GitCloneDepth makes clones of git sources shallow, limiting their
+	// history to that many commits from the tip of each branch and tag. 0
+	// clones the full history.
+	GitCloneDepth int
+
+	// GitCloneDepths overrides GitCloneDepth for the project roots or source
+	// URLs it maps.
+	GitCloneDepths map[string]int
+
+	// GitRefNamespaces maps project roots or source URLs to the namespace of
+	// refs, such as refs/releases, from which their versions are listed in
+	// place of refs/tags.
+	GitRefNamespaces map[string]string
+
+	// GitKeyring is a file of the public keys, armored or not, trusted to
+	// sign tags. If GitSignedTags is set, the versions of all git sources are
+	// limited to the tags signed by one of those keys; GitSignedTagSources
+	// limits only those of the project roots or source URLs it maps.
+	GitKeyring          string
+	GitSignedTags       bool
+	GitSignedTagSources map[string]bool
+
+	// CredentialHelper is a command, split on spaces, that is run to obtain
+	// the username and password for HTTPS hosts that have no token, as git's
+	// credential helpers are. It is run at most once per host; if it fails,
+	// the failure goes to Logger and the host goes without its credential.
+	CredentialHelper string
+
+	// CloneTimeout limits how long each clone or fetch of a source may take,
+	// and MetaTimeout how long each HTTP request for the metadata used to
+	// deduce sources may take. Clones of large repositories can take far
+	// longer than metadata lookups should. 0 means no limit, beyond the
+	// inactivity timeout that applies to all VCS commands.
+	CloneTimeout time.Duration
+	MetaTimeout  time.Duration
+
+	// VCSConcurrency limits the number of operations run at once against
+	// sources of each VCS type ("git", "hg" or "bzr"), or of each URL scheme
+	// with a registered SourceBackend, so that fragile servers aren't
+	// overwhelmed. Types it doesn't map are unlimited.
+	VCSConcurrency map[string]int
+
+	// Jobs, if not 0, limits the number of operations run at once against
+	// all sources, whatever their type.
+	Jobs int
+
+	// Offline keeps the SourceMgr from going to the network: sources must
+	// already be in Cachedir, and anything that needs upstream, such as
+	// listing versions, fetching or resolving an import path through HTTP,
+	// fails.
+	Offline bool
+
+	// Mirrors rewrites the names of sources matching their prefixes before
+	// they are fetched, such as to fetch everything from github.com/ from an
+	// internal mirror instead. Where several match, the longest prefix wins.
+	Mirrors []SourceMirror
+
+	// MetadataTTL, if not 0, keeps the lists of the versions of sources in
+	// Cachedir, so that later SourceMgrs list them from the cache rather than
+	// upstream until they are that old.
+	MetadataTTL time.Duration
+
+	// Logger, if not nil, receives the failures that don't fail the
+	// operation they happen in, such as writing the metadata cache.
+	Logger *log.Logger
+}
+
+// offlineTransport is the http.RoundTripper of offline SourceMgrs, which
+// refuses every request.
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("cannot fetch %s while offline", req.URL)
+}
+
+// metadataClient returns the client for the HTTP requests made to deduce
+// sources, which authenticates them with tokens or creds, and gives up on
+// each after timeout, if it isn't 0.
+func metadataClient(transport http.RoundTripper, tokens hostTokens, creds *credentialHelper, timeout time.Duration) *http.Client {
+	client := tokens.client(transport)
+	if creds != nil {
+		client.Transport = &credentialTransport{helper: creds, base: client.Transport}
+	}
+	client.Timeout = timeout
+	return client
+}
+
+// NewSourceManager produces an instance of gps's built-in SourceManager. The
+// config's Cachedir is where local instances of upstream sources are stored.
 //
 // The returned SourceManager aggressively caches information wherever possible.
 // If tools need to do preliminary work involving upstream repository analysis
@@ -129,12 +256,34 @@ var _ SourceManager = &SourceMgr{}
 // gps's SourceManager is intended to be threadsafe (if it's not, please file a
 // bug!). It should be safe to reuse across concurrent solving runs, even on
 // unrelated projects.
-func NewSourceManager(cachedir string) (*SourceMgr, error) {
+func NewSourceManager(c SourceManagerConfig) (*SourceMgr, error) {
+	cachedir := c.Cachedir
 	err := os.MkdirAll(filepath.Join(cachedir, "sources"), 0777)
 	if err != nil {
 		return nil, err
 	}
 
+	if c.GitKeyring == "" && (c.GitSignedTags || len(c.GitSignedTagSources) > 0) {
+		return nil, fmt.Errorf("a keyring must be given to require signed tags")
+	}
+
+	transport, err := newCATransport(c.CACerts, c.CACertsOnly)
+	if err != nil {
+		return nil, err
+	}
+	if c.Offline {
+		transport = offlineTransport{}
+	}
+
+	var forced []pathDeduction
+	for name, vcs := range c.VCSTypes {
+		pd, err := forcedVCSDeduction(name, vcs)
+		if err != nil {
+			return nil, err
+		}
+		forced = append(forced, pd)
+	}
+
 	glpath := filepath.Join(cachedir, "sm.lock")
 	_, err = os.Stat(glpath)
 	if err == nil {
@@ -152,9 +301,58 @@ func NewSourceManager(cachedir string) (*SourceMgr, error) {
 		}
 	}
 
+	tokens := hostTokens(c.HostTokens)
+	caBundle, err := writeCABundle(cachedir, c.CACerts, c.CACertsOnly)
+	if err != nil {
+		fi.Close()
+		os.Remove(glpath)
+		return nil, err
+	}
+	env := tokens.gitEnv()
+	if caBundle != "" {
+		env = append(env, "GIT_SSL_CAINFO="+caBundle)
+	}
+
 	ctx, cf := context.WithCancel(context.TODO())
 	superv := newSupervisor(ctx)
-	deducer := newDeductionCoordinator(superv)
+	err = superv.setLimits(c.VCSConcurrency)
+	if err == nil {
+		err = superv.setJobs(c.Jobs)
+	}
+	if err != nil {
+		cf()
+		fi.Close()
+		os.Remove(glpath)
+		return nil, err
+	}
+	creds := newCredentialHelper(c.CredentialHelper, tokens, c.Logger)
+	deducer := newDeductionCoordinator(superv, metadataClient(transport, tokens, creds, c.MetaTimeout))
+	for _, pd := range forced {
+		deducer.forceVCS(pd)
+	}
+
+	opts := sourceOptions{
+		env:           env,
+		lfs:           c.GitLFS,
+		depth:         c.GitCloneDepth,
+		depths:        c.GitCloneDepths,
+		refNamespaces: c.GitRefNamespaces,
+
+		keyring:          c.GitKeyring,
+		signedTags:       c.GitSignedTags,
+		signedTagSources: c.GitSignedTagSources,
+
+		creds:        creds,
+		caBundle:     caBundle,
+		customCAs:    len(c.CACerts) > 0 || c.CACertsOnly,
+		cloneTimeout: c.CloneTimeout,
+		offline:      c.Offline,
+		mirrors:      c.Mirrors,
+	}
+	if c.MetadataTTL > 0 {
+		opts.metadata = newMetadataCache(filepath.Join(cachedir, "metadata"), c.MetadataTTL)
+		opts.metadata.log = c.Logger
+	}
 
 	sm := &SourceMgr{
 		cachedir:    cachedir,
@@ -162,7 +360,7 @@ func NewSourceManager(cachedir string) (*SourceMgr, error) {
 		suprvsr:     superv,
 		cancelAll:   cf,
 		deduceCoord: deducer,
-		srcCoord:    newSourceCoordinator(superv, deducer, cachedir),
+		srcCoord:    newSourceCoordinator(superv, deducer, cachedir, opts),
 		qch:         make(chan struct{}),
 	}
 
@@ -364,6 +562,41 @@ func (sm *SourceMgr) ListVersions(id ProjectIdentifier) ([]PairedVersion, error)
 	return srcg.listVersions(context.TODO())
 }
 
+// ListRetracted retrieves the versions of the repository for the provided
+// ProjectIdentifier that its upstream has retracted.
+//
+// An upstream retracts a release by pushing a tag named after it with a
+// "retract/" prefix; retract/v1.2.0 retracts v1.2.0. Those tags are not
+// themselves reported as versions, but the releases they retract still are.
+func (sm *SourceMgr) ListRetracted(id ProjectIdentifier) ([]PairedVersion, error) {
+	if atomic.CompareAndSwapInt32(&sm.releasing, 1, 1) {
+		return nil, smIsReleased{}
+	}
+
+	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	return srcg.listRetracted(context.TODO())
+}
+
+// RequiresSignedTags reports whether the versions of the repository for the
+// provided ProjectIdentifier are limited to the tags signed by a key in the
+// keyring, as GitSignedTags and GitSignedTagSources say for git sources.
+func (sm *SourceMgr) RequiresSignedTags(id ProjectIdentifier) (bool, error) {
+	if atomic.CompareAndSwapInt32(&sm.releasing, 1, 1) {
+		return false, smIsReleased{}
+	}
+
+	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	if err != nil {
+		return false, err
+	}
+
+	return srcg.requiresSignedTags(context.TODO())
+}
+
 // RevisionPresentIn indicates whether the provided Revision is present in the given
 // repository.
 func (sm *SourceMgr) RevisionPresentIn(id ProjectIdentifier, r Revision) (bool, error) {
@@ -380,6 +613,21 @@ func (sm *SourceMgr) RevisionPresentIn(id ProjectIdentifier, r Revision) (bool,
 	return srcg.revisionPresentIn(context.TODO(), r)
 }
 
+// CommitTime returns the time at which the provided Revision was committed to
+// the repository for the provided ProjectIdentifier.
+func (sm *SourceMgr) CommitTime(id ProjectIdentifier, r Revision) (time.Time, error) {
+	if atomic.CompareAndSwapInt32(&sm.releasing, 1, 1) {
+		return time.Time{}, smIsReleased{}
+	}
+
+	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return srcg.commitTime(context.TODO(), r)
+}
+
 // SourceExists checks if a repository exists, either upstream or in the cache,
 // for the provided ProjectIdentifier.
 func (sm *SourceMgr) SourceExists(id ProjectIdentifier) (bool, error) {
@@ -461,6 +709,11 @@ type supervisor struct {
 	cond       sync.Cond  // Wraps mu so callers can wait until all calls end
 	running    map[callInfo]timeCount
 	ran        map[callType]durCount
+
+	// limits holds a semaphore for each VCS type whose concurrent operations
+	// are limited, and jobs one for all operations, if they are limited.
+	limits map[string]chan struct{}
+	jobs   chan struct{}
 }
 
 func newSupervisor(ctx context.Context) *supervisor {
@@ -497,6 +750,60 @@ func (sup *supervisor) do(inctx context.Context, name string, typ callType, f fu
 	return err
 }
 
+// setLimits limits the operations run at once through doLimited to n for each
+// VCS type, or scheme of a registered SourceBackend, in limits.
+func (sup *supervisor) setLimits(limits map[string]int) error {
+	for vcs, n := range limits {
+		switch vcs {
+		case "git", "hg", "bzr":
+		default:
+			if _, has := sourceBackendFor(vcs); !has {
+				return fmt.Errorf("cannot limit the concurrency of unknown VCS type %q", vcs)
+			}
+		}
+		if n < 1 {
+			return fmt.Errorf("invalid concurrency %d for %s; must be at least 1", n, vcs)
+		}
+		if sup.limits == nil {
+			sup.limits = make(map[string]chan struct{})
+		}
+		sup.limits[vcs] = make(chan struct{}, n)
+	}
+	return nil
+}
+
+// setJobs limits the operations run at once through doLimited to n, whatever
+// their VCS type. 0 leaves them unlimited.
+func (sup *supervisor) setJobs(n int) error {
+	if n < 0 {
+		return fmt.Errorf("invalid number of jobs %d; must be 0, for no limit, or more", n)
+	}
+	if n > 0 {
+		sup.jobs = make(chan struct{}, n)
+	}
+	return nil
+}
+
+// doLimited is like do, but first waits until fewer operations than the limit
+// for the VCS type vcs, if it has one, and than the limit on jobs, if there
+// is one, are running through doLimited.
+func (sup *supervisor) doLimited(inctx context.Context, vcs, name string, typ callType, f func(context.Context) error) error {
+	for _, sem := range []chan struct{}{sup.limits[vcs], sup.jobs} {
+		if sem == nil {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+			defer func(sem chan struct{}) { <-sem }(sem)
+		case <-inctx.Done():
+			return inctx.Err()
+		case <-sup.ctx.Done():
+			return sup.ctx.Err()
+		}
+	}
+	return sup.do(inctx, name, typ, f)
+}
+
 func (sup *supervisor) getLifetimeContext() context.Context {
 	return sup.ctx
 }
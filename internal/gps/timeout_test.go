@@ -0,0 +1,92 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetaTimeout(t *testing.T) {
+	done := make(chan struct{})
+	var ipath string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "slow") {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-done:
+			}
+		}
+		fmt.Fprintf(w, `<html><head><meta name="go-import" content="%s git https://%s"></head></html>`, ipath, ipath)
+	}))
+	defer srv.Close()
+	// The slow request must be let go before the server can close.
+	defer close(done)
+
+	host := strings.TrimPrefix(srv.URL, "https://")
+	// The test server's certificate is self-signed.
+	insecure := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	client := metadataClient(insecure, nil, nil, 200*time.Millisecond)
+	ctx := context.Background()
+
+	ipath = host + "/foo/fast"
+	if _, _, _, err := getMetadata(ctx, client, ipath, "https"); err != nil {
+		t.Fatalf("expected a quick metadata fetch to succeed: %s", err)
+	}
+
+	ipath = host + "/foo/slow"
+	start := time.Now()
+	if _, _, _, err := getMetadata(ctx, client, ipath, "https"); err == nil {
+		t.Fatal("expected a slow metadata fetch to trip the meta timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the meta timeout to cut the fetch short, took %s", elapsed)
+	}
+}
+
+func TestCloneTimeout(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestCloneTimeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	upstream := filepath.Join(tmp, "upstream")
+	newGitFixture(t, upstream, map[string]string{"main.go": "package main\n"})
+
+	for _, tc := range []struct {
+		name    string
+		timeout time.Duration
+		fail    bool
+	}{
+		{"generous", time.Minute, false},
+		{"none", 0, false},
+		{"impossible", time.Nanosecond, true},
+	} {
+		ctx := context.Background()
+		mb := maybeGitSource{url: &url.URL{Scheme: "file", Path: upstream}}
+		sg := newSourceGateway(mb, newSupervisor(ctx), filepath.Join(tmp, tc.name), sourceOptions{cloneTimeout: tc.timeout})
+
+		err := sg.syncLocal(ctx)
+		switch {
+		case tc.fail && err == nil:
+			t.Errorf("%s: expected the clone to trip the clone timeout", tc.name)
+		case tc.fail && !strings.Contains(err.Error(), "clone timeout"):
+			t.Errorf("%s: expected the error to name the clone timeout, got %s", tc.name, err)
+		case !tc.fail && err != nil:
+			t.Errorf("%s: expected the clone to succeed, got %s", tc.name, err)
+		}
+	}
+}
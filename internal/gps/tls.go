@@ -0,0 +1,117 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// systemCABundles lists the usual locations of the system's CA bundle, as
+// searched by crypto/x509.
+var systemCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian/Ubuntu/Gentoo etc.
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora/RHEL 6
+	"/etc/ssl/ca-bundle.pem",                            // OpenSUSE
+	"/etc/pki/tls/cacert.pem",                           // OpenELEC
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS/RHEL 7
+	"/etc/ssl/cert.pem",                                 // Alpine, OpenBSD, macOS
+}
+
+// newCATransport returns an http.RoundTripper that trusts the certificate
+// authorities in the PEM encoded certs, in addition to the system's unless
+// only is set. If there are no certs and only is not set, the default
+// transport is returned.
+func newCATransport(certs []byte, only bool) (http.RoundTripper, error) {
+	if len(certs) == 0 && !only {
+		return http.DefaultTransport, nil
+	}
+
+	var pool *x509.CertPool
+	if only {
+		pool = x509.NewCertPool()
+	} else {
+		var err error
+		pool, err = x509.SystemCertPool()
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load the system's certificate authorities")
+		}
+	}
+	if !pool.AppendCertsFromPEM(certs) {
+		return nil, errors.New("no valid PEM encoded certificates found in CA bundle")
+	}
+
+	// Mirror http.DefaultTransport, apart from the roots.
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       &tls.Config{RootCAs: pool},
+	}, nil
+}
+
+// writeCABundle writes the CA bundle that git and hg should use to dir, and
+// returns its path, or "" if they should trust the system's authorities.
+//
+// git and hg can only be given a single bundle, which replaces the system's.
+// Unless only is set, the system bundle is therefore copied into it along with
+// the given certs. If the system bundle can't be found, the given certs can't
+// be added to the authorities git and hg trust without dropping the system's,
+// and an error is returned.
+func writeCABundle(dir string, certs []byte, only bool) (string, error) {
+	if len(certs) == 0 && !only {
+		return "", nil
+	}
+
+	var bundle bytes.Buffer
+	if !only {
+		var sys []byte
+		for _, f := range systemCABundles {
+			if b, err := ioutil.ReadFile(f); err == nil {
+				sys = b
+				break
+			}
+		}
+		if sys == nil {
+			return "", errors.New("no system CA bundle found to add the given certificate authorities to for git and hg, which only take a single bundle; trust only the given authorities instead, with a bundle that holds all of those they need")
+		}
+		bundle.Write(sys)
+		bundle.WriteByte('\n')
+	}
+	bundle.Write(certs)
+
+	path := filepath.Join(dir, "ca-bundle.pem")
+	if err := ioutil.WriteFile(path, bundle.Bytes(), 0644); err != nil {
+		return "", errors.Wrap(err, "unable to write CA bundle for git and hg")
+	}
+
+	return path, nil
+}
+
+// checkCustomCAs returns an error if certificate authorities other than the
+// system's are to be trusted for HTTPS, but the source at u, fetched with
+// vcs, can't be told about them. git and hg are given a CA bundle; bzr would
+// quietly trust the system's authorities alone.
+func checkCustomCAs(vcs string, u *url.URL, opts sourceOptions) error {
+	if opts.customCAs && u.Scheme == "https" {
+		return errors.Errorf("unable to fetch %s: custom certificate authorities can't be given to %s, which trusts only the system's; fetch it over another scheme, such as ssh", u, vcs)
+	}
+	return nil
+}
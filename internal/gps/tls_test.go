@@ -0,0 +1,170 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSourceManagerCACerts(t *testing.T) {
+	var ipath string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><head><meta name="go-import" content="%s git https://%s"></head></html>`, ipath, ipath)
+	}))
+	defer srv.Close()
+	ipath = strings.TrimPrefix(srv.URL, "https://") + "/foo/bar"
+
+	// The test server's certificate is self-signed, so it doubles as the test
+	// CA.
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.TLS.Certificates[0].Certificate[0]})
+
+	for _, tc := range []struct {
+		name    string
+		certs   []byte
+		only    bool
+		success bool
+	}{
+		{name: "system roots", success: false},
+		{name: "with bundle", certs: ca, success: true},
+		{name: "with bundle only", certs: ca, only: true, success: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cachedir, err := ioutil.TempDir("", "TestSourceManagerCACerts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(cachedir)
+
+			sm, err := NewSourceManager(SourceManagerConfig{
+				Cachedir:    cachedir,
+				CACerts:     tc.certs,
+				CACertsOnly: tc.only,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sm.Release()
+
+			root, _, _, err := getMetadata(context.Background(), sm.deduceCoord.client, ipath, "https")
+			if !tc.success {
+				if err == nil {
+					t.Fatal("expected fetch to fail without the test CA")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if root != ipath {
+				t.Errorf("expected root %q, got %q", ipath, root)
+			}
+
+			// git and hg get a bundle that includes the test CA, too.
+			bundle, err := ioutil.ReadFile(filepath.Join(cachedir, "ca-bundle.pem"))
+			if err != nil {
+				if !tc.only && os.IsNotExist(err) {
+					t.Skip("no system CA bundle found for git")
+				}
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(bundle), string(ca)) {
+				t.Error("expected the git CA bundle to contain the test CA")
+			}
+			if tc.only && string(bundle) != string(ca) {
+				t.Error("expected the git CA bundle to contain only the test CA")
+			}
+		})
+	}
+}
+
+func TestNewCATransportInvalid(t *testing.T) {
+	if _, err := newCATransport([]byte("not a certificate"), false); err == nil {
+		t.Fatal("expected an error for a bundle without certificates")
+	}
+}
+
+func TestWriteCABundleNoSystemBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteCABundleNoSystemBundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	orig := systemCABundles
+	systemCABundles = []string{filepath.Join(dir, "missing.pem")}
+	defer func() { systemCABundles = orig }()
+
+	ca := []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n")
+	if _, err = writeCABundle(dir, ca, false); err == nil {
+		t.Error("expected an error adding to a system bundle that can't be found")
+	}
+
+	// Trusting only the given authorities needs no system bundle.
+	path, err := writeCABundle(dir, ca, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path == "" {
+		t.Error("expected git and hg to be pointed at the bundle")
+	}
+
+	// Without any, git and hg are left alone.
+	if path, err = writeCABundle(dir, nil, false); err != nil || path != "" {
+		t.Errorf("expected git and hg to be left alone without a bundle, got %q, %v", path, err)
+	}
+}
+
+func TestCheckCustomCAs(t *testing.T) {
+	https := &url.URL{Scheme: "https", Host: "example.com", Path: "/foo"}
+	ssh := &url.URL{Scheme: "ssh", Host: "example.com", Path: "/foo"}
+
+	if err := checkCustomCAs("bzr", https, sourceOptions{customCAs: true}); err == nil {
+		t.Error("expected an error fetching over HTTPS with custom CAs")
+	}
+	if err := checkCustomCAs("bzr", ssh, sourceOptions{customCAs: true}); err != nil {
+		t.Errorf("expected custom CAs not to matter over ssh, got %s", err)
+	}
+	if err := checkCustomCAs("bzr", https, sourceOptions{}); err != nil {
+		t.Errorf("expected no error without custom CAs, got %s", err)
+	}
+
+	// The source refuses before it ever goes upstream.
+	ctx := context.Background()
+	cachedir, err := ioutil.TempDir("", "TestCheckCustomCAs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cachedir)
+
+	mb := maybeBzrSource{url: https}
+	_, _, err = mb.try(ctx, cachedir, sourceOptions{customCAs: true}, newMemoryCache(), newSupervisor(ctx))
+	if err == nil || !strings.Contains(err.Error(), "custom certificate authorities") {
+		t.Errorf("expected bzr to refuse custom CAs, got %v", err)
+	}
+}
+
+func TestHgRepoCACerts(t *testing.T) {
+	r := &hgRepo{}
+	if got := r.remoteArgs("pull"); !reflect.DeepEqual(got, []string{"pull"}) {
+		t.Errorf("expected hg to be left alone without a bundle, got %v", got)
+	}
+
+	r.cacerts = "/cache/ca-bundle.pem"
+	want := []string{"--config", "web.cacerts=/cache/ca-bundle.pem", "pull"}
+	if got := r.remoteArgs("pull"); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected hg to be given the bundle, got %v", got)
+	}
+}
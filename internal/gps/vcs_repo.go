@@ -8,8 +8,10 @@ import (
 	"context"
 	"encoding/xml"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -44,7 +46,7 @@ func getVCSRepo(s vcs.Type, ustr, path string) (r ctxRepo, err error) {
 	case vcs.Git:
 		var repo *vcs.GitRepo
 		repo, err = vcs.NewGitRepo(ustr, path)
-		r = &gitRepo{repo}
+		r = &gitRepo{GitRepo: repo}
 	case vcs.Bzr:
 		var repo *vcs.BzrRepo
 		repo, err = vcs.NewBzrRepo(ustr, path)
@@ -52,7 +54,7 @@ func getVCSRepo(s vcs.Type, ustr, path string) (r ctxRepo, err error) {
 	case vcs.Hg:
 		var repo *vcs.HgRepo
 		repo, err = vcs.NewHgRepo(ustr, path)
-		r = &hgRepo{repo}
+		r = &hgRepo{HgRepo: repo}
 	}
 
 	return
@@ -63,6 +65,20 @@ func getVCSRepo(s vcs.Type, ustr, path string) (r ctxRepo, err error) {
 
 type gitRepo struct {
 	*vcs.GitRepo
+	// env holds additional environment entries for git commands that talk
+	// to the remote, such as those carrying credentials.
+	env []string
+	// lfs enables fetching and checking out Git LFS content on export.
+	lfs bool
+	// depth limits the history that is cloned and fetched to that many
+	// commits from the tip of each ref. 0 means the full history.
+	depth int
+	// refNamespace, if set, is the namespace of refs, such as refs/releases,
+	// from which versions are listed in place of refs/tags.
+	refNamespace string
+	// keyring, if set, is a file of the public keys trusted to sign tags.
+	// Only tags signed by one of them are listed as versions.
+	keyring string
 }
 
 func newVcsRemoteErrorOr(msg string, err error, out string) error {
@@ -80,20 +96,65 @@ func newVcsLocalErrorOr(msg string, err error, out string) error {
 }
 
 func (r *gitRepo) get(ctx context.Context) error {
-	out, err := runFromCwd(ctx, "git", "clone", "--recursive", r.Remote(), r.LocalPath())
+	args := []string{"clone", "--recursive"}
+	if r.depth > 0 {
+		// A shallow clone otherwise only takes the default branch.
+		args = append(args, "--depth", strconv.Itoa(r.depth), "--no-single-branch")
+	}
+	args = append(args, r.Remote(), r.LocalPath())
+
+	out, err := r.remoteCmd(exec.Command("git", args...)).combinedOutput(ctx)
 	if err != nil {
 		return newVcsRemoteErrorOr("unable to get repository", err, string(out))
 	}
 
-	return nil
+	return r.fetchRefNamespace(ctx)
 }
 
 func (r *gitRepo) fetch(ctx context.Context) error {
 	// Perform a fetch to make sure everything is up to date.
-	out, err := runFromRepoDir(ctx, r, "git", "fetch", "--tags", "--prune", r.RemoteLocation)
+	args := []string{"fetch", "--tags", "--prune"}
+	if r.depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(r.depth))
+	} else if r.isShallow() {
+		// The cache was cloned shallow before, but the full history is
+		// wanted now.
+		args = append(args, "--unshallow")
+	}
+	args = append(args, r.RemoteLocation)
+
+	out, err := r.remoteCmd(r.CmdFromDir("git", args...)).combinedOutput(ctx)
 	if err != nil {
 		return newVcsRemoteErrorOr("unable to update repository", err, string(out))
 	}
+	return r.fetchRefNamespace(ctx)
+}
+
+// isShallow reports whether the local clone of r has only part of the history.
+func (r *gitRepo) isShallow() bool {
+	_, err := os.Stat(filepath.Join(r.LocalPath(), ".git", "shallow"))
+	return err == nil
+}
+
+// fetchRefNamespace fetches the refs in r.refNamespace, if any, which neither
+// clone nor a plain fetch bring in, so that the versions listed from them can
+// be checked out.
+func (r *gitRepo) fetchRefNamespace(ctx context.Context) error {
+	if r.refNamespace == "" {
+		return nil
+	}
+
+	ns := strings.TrimSuffix(r.refNamespace, "/")
+	args := []string{"fetch", "--prune"}
+	if r.depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(r.depth))
+	}
+	args = append(args, r.RemoteLocation, "+"+ns+"/*:"+ns+"/*")
+
+	out, err := r.remoteCmd(r.CmdFromDir("git", args...)).combinedOutput(ctx)
+	if err != nil {
+		return newVcsRemoteErrorOr("unable to fetch refs in "+ns, err, string(out))
+	}
 	return nil
 }
 
@@ -110,7 +171,7 @@ func (r *gitRepo) updateVersion(ctx context.Context, v string) error {
 // submodules. Or nested submodules. What a great idea, submodules.
 func (r *gitRepo) defendAgainstSubmodules(ctx context.Context) error {
 	// First, update them to whatever they should be, if there should happen to be any.
-	out, err := runFromRepoDir(ctx, r, "git", "submodule", "update", "--init", "--recursive")
+	out, err := r.remoteCmd(r.CmdFromDir("git", "submodule", "update", "--init", "--recursive")).combinedOutput(ctx)
 	if err != nil {
 		return newVcsLocalErrorOr("unexpected error while defensively updating submodules", err, string(out))
 	}
@@ -131,6 +192,16 @@ func (r *gitRepo) defendAgainstSubmodules(ctx context.Context) error {
 	return nil
 }
 
+// remoteCmd prepares a git command that may talk to the remote, applying the
+// repo's additional environment to it.
+func (r *gitRepo) remoteCmd(cmd *exec.Cmd) *monitoredCmd {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = mergeEnvLists(r.env, cmd.Env)
+	return newMonitoredCmd(cmd, 2*time.Minute)
+}
+
 type bzrRepo struct {
 	*vcs.BzrRepo
 }
@@ -170,10 +241,27 @@ func (r *bzrRepo) updateVersion(ctx context.Context, version string) error {
 
 type hgRepo struct {
 	*vcs.HgRepo
+	// cacerts, if set, is the CA bundle trusted for HTTPS in place of the
+	// system's.
+	cacerts string
+}
+
+// remoteArgs returns args, for an hg command that talks to the remote, with
+// the repo's CA bundle configured.
+func (r *hgRepo) remoteArgs(args ...string) []string {
+	if r.cacerts == "" {
+		return args
+	}
+	return append([]string{"--config", "web.cacerts=" + r.cacerts}, args...)
+}
+
+func (r *hgRepo) Ping() bool {
+	_, err := runFromCwd(context.Background(), "hg", r.remoteArgs("identify", r.Remote())...)
+	return err == nil
 }
 
 func (r *hgRepo) get(ctx context.Context) error {
-	out, err := runFromCwd(ctx, "hg", "clone", r.Remote(), r.LocalPath())
+	out, err := runFromCwd(ctx, "hg", r.remoteArgs("clone", r.Remote(), r.LocalPath())...)
 	if err != nil {
 		return newVcsRemoteErrorOr("unable to get repository", err, string(out))
 	}
@@ -182,7 +270,7 @@ func (r *hgRepo) get(ctx context.Context) error {
 }
 
 func (r *hgRepo) fetch(ctx context.Context) error {
-	out, err := runFromRepoDir(ctx, r, "hg", "pull")
+	out, err := runFromRepoDir(ctx, r, "hg", r.remoteArgs("pull")...)
 	if err != nil {
 		return newVcsRemoteErrorOr("unable to fetch latest changes", err, string(out))
 	}
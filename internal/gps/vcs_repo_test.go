@@ -237,7 +237,7 @@ func testHgRepo(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	repo := &hgRepo{rep}
+	repo := &hgRepo{HgRepo: rep}
 
 	// Do an initial clone.
 	err = repo.get(ctx)
@@ -297,7 +297,7 @@ func testGitRepo(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	repo := &gitRepo{rep}
+	repo := &gitRepo{GitRepo: rep}
 
 	// Do an initial clone.
 	err = repo.get(ctx)
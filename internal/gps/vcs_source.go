@@ -11,6 +11,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -62,6 +63,14 @@ func (bs *baseVCSSource) revisionPresentIn(r Revision) (bool, error) {
 	return bs.repo.IsReference(string(r)), nil
 }
 
+func (bs *baseVCSSource) commitTime(ctx context.Context, r Revision) (time.Time, error) {
+	ci, err := bs.repo.CommitInfo(string(r))
+	if err != nil {
+		return time.Time{}, unwrapVcsErr(err)
+	}
+	return ci.Date, nil
+}
+
 // initLocal clones/checks out the upstream repository to disk for the first
 // time.
 func (bs *baseVCSSource) initLocal(ctx context.Context) error {
@@ -110,7 +119,10 @@ func (bs *baseVCSSource) exportRevisionTo(ctx context.Context, r Revision, to st
 	// TODO(sdboyer) this is a simplistic approach and relying on the tools
 	// themselves might make it faster, but git's the overwhelming case (and has
 	// its own method) so fine for now
-	return fs.CopyDir(bs.repo.LocalPath(), to)
+	//
+	// Vendored code has no business being setuid or setgid, so those bits are
+	// never carried over.
+	return fs.CopyDirWithOptions(bs.repo.LocalPath(), to, fs.CopyStripSpecialModes)
 }
 
 // gitSource is a generic git repository implementation that should work with
@@ -152,7 +164,29 @@ func (s *gitSource) exportRevisionTo(ctx context.Context, rev Revision, to strin
 	// though we have a bunch of housekeeping to do to set up, then tear
 	// down, the sparse checkout controls, as well as restore the original
 	// index and HEAD.
-	out, err = runFromRepoDir(ctx, r, "git", "checkout-index", "-a", "--prefix="+to)
+	//
+	// If LFS content was asked for, fetch it first and have the checkout pass
+	// tracked files through the LFS filter, which is what `git lfs pull` would
+	// do for a working tree.
+	args := []string{"checkout-index", "-a", "--prefix=" + to}
+	if gr, ok := r.(*gitRepo); ok && gr.lfs && hasLFS() {
+		lfs, err := gr.usesLFS(ctx, rev)
+		if err != nil {
+			return err
+		}
+		if lfs {
+			if err := gr.lfsFetch(ctx, rev); err != nil {
+				return err
+			}
+			out, err = gr.remoteCmd(gr.CmdFromDir("git", append(lfsFilterConfig, args...)...)).combinedOutput(ctx)
+			if err != nil {
+				return fmt.Errorf("%s: %s", out, err)
+			}
+			return nil
+		}
+	}
+
+	out, err = runFromRepoDir(ctx, r, "git", args...)
 	if err != nil {
 		return fmt.Errorf("%s: %s", out, err)
 	}
@@ -160,13 +194,37 @@ func (s *gitSource) exportRevisionTo(ctx context.Context, rev Revision, to strin
 	return nil
 }
 
+// commitTime returns the committer date of the revision, which, unlike the
+// author date that vcs.Repo's CommitInfo reports, reflects when the commit
+// actually landed.
+func (s *gitSource) commitTime(ctx context.Context, rev Revision) (time.Time, error) {
+	out, err := runFromRepoDir(ctx, s.repo, "git", "log", "-1", "--format=%ct", rev.String())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %s", out, err)
+	}
+	sec, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected commit time %q for %s", out, rev)
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
 func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, err error) {
 	r := s.repo
 
 	var out []byte
 	c := newMonitoredCmd(exec.Command("git", "ls-remote", r.Remote()), 30*time.Second)
 	// Ensure no prompting for PWs
-	c.cmd.Env = mergeEnvLists([]string{"GIT_ASKPASS=", "GIT_TERMINAL_PROMPT=0"}, os.Environ())
+	env := []string{"GIT_ASKPASS=", "GIT_TERMINAL_PROMPT=0"}
+	// Versions are taken from tags, unless another namespace is configured.
+	tagPrefix := "refs/tags/"
+	if gr, ok := r.(*gitRepo); ok {
+		env = append(env, gr.env...)
+		if gr.refNamespace != "" {
+			tagPrefix = strings.TrimSuffix(gr.refNamespace, "/") + "/"
+		}
+	}
+	c.cmd.Env = mergeEnvLists(env, os.Environ())
 	out, err = c.combinedOutput(ctx)
 
 	if err != nil {
@@ -210,7 +268,7 @@ func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, er
 	smap := make(map[string]bool)
 	uniq := 0
 	vlist = make([]PairedVersion, len(all)-1) // less 1, because always ignore HEAD
-	for _, pair := range all {
+	for _, pair := range all[1:] {
 		var v PairedVersion
 		if string(pair[46:51]) == "heads" {
 			rev := Revision(pair[:40])
@@ -233,8 +291,8 @@ func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, er
 
 			vlist[uniq] = v
 			uniq++
-		} else if string(pair[46:50]) == "tags" {
-			vstr := string(pair[51:])
+		} else if ref := string(pair[41:]); strings.HasPrefix(ref, tagPrefix) {
+			vstr := strings.TrimPrefix(ref, tagPrefix)
 			if strings.HasSuffix(vstr, "^{}") {
 				// If the suffix is there, then we *know* this is the rev of
 				// the underlying commit object that we actually want
@@ -271,6 +329,9 @@ func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, er
 		}
 	}
 
+	if gr, ok := r.(*gitRepo); ok && gr.keyring != "" {
+		return gr.onlySignedTags(ctx, vlist, tagPrefix)
+	}
 	return
 }
 
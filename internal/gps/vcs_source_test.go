@@ -8,11 +8,15 @@ import (
 	"context"
 	"io/ioutil"
 	"net/url"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 // Parent test that executes all the slow vcs interaction tests in parallel.
@@ -62,7 +66,7 @@ func testGitSourceInteractions(t *testing.T) {
 
 	ctx := context.Background()
 	superv := newSupervisor(ctx)
-	isrc, state, err := mb.try(ctx, cpath, newMemoryCache(), superv)
+	isrc, state, err := mb.try(ctx, cpath, sourceOptions{}, newMemoryCache(), superv)
 	if err != nil {
 		t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
 	}
@@ -163,7 +167,7 @@ func testGopkginSourceInteractions(t *testing.T) {
 
 		ctx := context.Background()
 		superv := newSupervisor(ctx)
-		isrc, state, err := mb.try(ctx, cpath, newMemoryCache(), superv)
+		isrc, state, err := mb.try(ctx, cpath, sourceOptions{}, newMemoryCache(), superv)
 		if err != nil {
 			t.Errorf("Unexpected error while setting up gopkginSource for test repo: %s", err)
 			return
@@ -309,7 +313,7 @@ func testBzrSourceInteractions(t *testing.T) {
 
 	ctx := context.Background()
 	superv := newSupervisor(ctx)
-	isrc, state, err := mb.try(ctx, cpath, newMemoryCache(), superv)
+	isrc, state, err := mb.try(ctx, cpath, sourceOptions{}, newMemoryCache(), superv)
 	if err != nil {
 		t.Fatalf("Unexpected error while setting up bzrSource for test repo: %s", err)
 	}
@@ -420,7 +424,7 @@ func testHgSourceInteractions(t *testing.T) {
 
 		ctx := context.Background()
 		superv := newSupervisor(ctx)
-		isrc, state, err := mb.try(ctx, cpath, newMemoryCache(), superv)
+		isrc, state, err := mb.try(ctx, cpath, sourceOptions{}, newMemoryCache(), superv)
 		if err != nil {
 			t.Errorf("Unexpected error while setting up hgSource for test repo: %s", err)
 			return
@@ -529,3 +533,305 @@ func requiresBins(t *testing.T, bins ...string) {
 		}
 	}
 }
+
+// newGitFixture creates a git repository in dir holding files in a single
+// commit, made with the additional environment env, and returns the commit's
+// revision.
+func newGitFixture(t *testing.T, dir string, files map[string]string, env ...string) Revision {
+	requiresBins(t, "git")
+
+	for name, body := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = mergeEnvLists(env, os.Environ())
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	git("add", "-A")
+	git("-c", "user.name=dep", "-c", "user.email=dep@example.com", "commit", "-q", "-m", "fixture")
+	return Revision(git("rev-parse", "HEAD"))
+}
+
+func TestGitSourceCommitTime(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestGitSourceCommitTime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// The author date is deliberately different, as the commit time is the
+	// time the commit landed.
+	upstream := filepath.Join(tmp, "upstream")
+	rev := newGitFixture(t, upstream, map[string]string{"main.go": "package main\n"},
+		"GIT_AUTHOR_DATE=2016-01-02T03:04:05Z",
+		"GIT_COMMITTER_DATE=2017-06-07T08:09:10+02:00",
+	)
+
+	ctx := context.Background()
+	mb := maybeGitSource{url: &url.URL{Scheme: "file", Path: upstream}}
+	src, _, err := mb.try(ctx, filepath.Join(tmp, "cache"), sourceOptions{}, newMemoryCache(), newSupervisor(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.initLocal(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := src.commitTime(ctx, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2017, 6, 7, 6, 9, 10, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("expected commit time %s, got %s", want, got)
+	}
+
+	if _, err := src.commitTime(ctx, Revision("0000000000000000000000000000000000000000")); err == nil {
+		t.Error("expected an error for a revision that doesn't exist")
+	}
+}
+
+func TestGitSourceCloneDepth(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestGitSourceCloneDepth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	upstream := filepath.Join(tmp, "upstream")
+	newGitFixture(t, upstream, map[string]string{"main.go": "package main\n"})
+	for i := 0; i < 2; i++ {
+		cmd := exec.Command("git", "-c", "user.name=dep", "-c", "user.email=dep@example.com", "commit", "-q", "--allow-empty", "-m", "more history")
+		cmd.Dir = upstream
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git commit: %s\n%s", err, out)
+		}
+	}
+
+	// Everything is shallow-cloned, except for the project that needs its
+	// full history.
+	opts := sourceOptions{
+		depth:  1,
+		depths: map[string]int{"example.com/full": 0},
+	}
+	for _, tc := range []struct {
+		name    string
+		commits string
+	}{
+		{"example.com/shallow", "1"},
+		{"example.com/full", "3"},
+	} {
+		ctx := context.Background()
+		mb := maybeGitSource{url: &url.URL{Scheme: "file", Path: upstream}}
+		src, _, err := mb.try(ctx, filepath.Join(tmp, tc.name), opts.forSource(tc.name), newMemoryCache(), newSupervisor(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := src.initLocal(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := runFromRepoDir(ctx, src.(*gitSource).repo, "git", "rev-list", "--count", "HEAD")
+		if err != nil {
+			t.Fatalf("%s: %s\n%s", tc.name, err, out)
+		}
+		if got := strings.TrimSpace(string(out)); got != tc.commits {
+			t.Errorf("%s: expected %s commits to be cloned, got %s", tc.name, tc.commits, got)
+		}
+	}
+
+	// Once the full history is wanted, updating the shallow clone brings in
+	// the rest of it.
+	ctx := context.Background()
+	mb := maybeGitSource{url: &url.URL{Scheme: "file", Path: upstream}}
+	src, _, err := mb.try(ctx, filepath.Join(tmp, "example.com/shallow"), sourceOptions{}, newMemoryCache(), newSupervisor(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.updateLocal(ctx); err != nil {
+		t.Fatal(err)
+	}
+	out, err := runFromRepoDir(ctx, src.(*gitSource).repo, "git", "rev-list", "--count", "HEAD")
+	if err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+	if got := strings.TrimSpace(string(out)); got != "3" {
+		t.Errorf("expected the shallow clone to be deepened to 3 commits, got %s", got)
+	}
+}
+
+func TestGitSourceRefNamespace(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestGitSourceRefNamespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// v0.1.0 is an ordinary tag, while v1.0.0 is published as
+	// refs/releases/v1.0.0, on a commit that no branch or tag reaches.
+	upstream := filepath.Join(tmp, "upstream")
+	base := newGitFixture(t, upstream, map[string]string{"main.go": "package main\n"})
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = upstream
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("tag", "v0.1.0")
+	git("-c", "user.name=dep", "-c", "user.email=dep@example.com", "commit", "-q", "--allow-empty", "-m", "release")
+	release := git("rev-parse", "HEAD")
+	git("update-ref", "refs/releases/v1.0.0", release)
+	git("reset", "-q", "--hard", string(base))
+
+	opts := sourceOptions{
+		refNamespaces: map[string]string{"example.com/releases": "refs/releases"},
+	}
+	for _, tc := range []struct {
+		name string
+		want []string
+	}{
+		{"example.com/tags", []string{"master", "v0.1.0"}},
+		{"example.com/releases", []string{"master", "v1.0.0"}},
+	} {
+		ctx := context.Background()
+		mb := maybeGitSource{url: &url.URL{Scheme: "file", Path: upstream}}
+		src, _, err := mb.try(ctx, filepath.Join(tmp, tc.name), opts.forSource(tc.name), newMemoryCache(), newSupervisor(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pvl, err := src.listVersions(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, pv := range pvl {
+			got = append(got, pv.String())
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected versions %v, got %v", tc.name, tc.want, got)
+		}
+
+		// The released commit must be fetched for the version to be usable.
+		if tc.name != "example.com/releases" {
+			continue
+		}
+		if err := src.initLocal(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := src.exportRevisionTo(ctx, Revision(release), filepath.Join(tmp, "export")); err != nil {
+			t.Errorf("%s: unable to export the released revision: %s", tc.name, err)
+		}
+	}
+}
+
+func TestGitSourceMajorVersionSubdirectory(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestGitSourceMajorVersionSubdirectory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// v1 stays at the root of the repository, while v2 is published under
+	// v2/, and imported with that in its path.
+	upstream := filepath.Join(tmp, "upstream")
+	rev := newGitFixture(t, upstream, map[string]string{
+		"bar.go":        "package bar\n",
+		"v2/bar.go":     "package bar\n",
+		"v2/pkg/pkg.go": "package pkg\n\nimport \"github.com/foo/bar/v2\"\n",
+	})
+
+	ctx := context.Background()
+	mb := maybeGitSource{url: &url.URL{Scheme: "file", Path: upstream}}
+	src, _, err := mb.try(ctx, filepath.Join(tmp, "cache"), sourceOptions{}, newMemoryCache(), newSupervisor(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.initLocal(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	ptree, err := src.listPackages(ctx, "github.com/foo/bar", rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, name := range map[string]string{
+		"github.com/foo/bar":        "bar",
+		"github.com/foo/bar/v2":     "bar",
+		"github.com/foo/bar/v2/pkg": "pkg",
+	} {
+		poe, has := ptree.Packages[ip]
+		if !has || poe.Err != nil {
+			t.Errorf("expected package %s to be found, got %#v", ip, poe)
+			continue
+		}
+		if poe.P.Name != name {
+			t.Errorf("expected package %s to be named %s, got %s", ip, name, poe.P.Name)
+		}
+	}
+
+	// The v2 packages import each other within the project, so they have no
+	// external reach.
+	rm, _ := ptree.ToReachMap(true, false, false, nil)
+	if ext := rm["github.com/foo/bar/v2/pkg"].External; len(ext) != 0 {
+		t.Errorf("expected github.com/foo/bar/v2/pkg to import nothing external, got %v", ext)
+	}
+	if in := rm["github.com/foo/bar/v2/pkg"].Internal; !reflect.DeepEqual(in, []string{"github.com/foo/bar/v2"}) {
+		t.Errorf("expected github.com/foo/bar/v2/pkg to import github.com/foo/bar/v2, got %v", in)
+	}
+}
+
+func TestGitSourceOffline(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "TestGitSourceOffline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	upstream := filepath.Join(tmp, "upstream")
+	rev := newGitFixture(t, upstream, map[string]string{"main.go": "package main\n"})
+	mb := maybeGitSource{url: &url.URL{Scheme: "file", Path: upstream}}
+	cachedir := filepath.Join(tmp, "cache")
+	ctx := context.Background()
+
+	// Nothing can be had offline until the source is in the cache.
+	offline := sourceOptions{offline: true}
+	sg := newSourceGateway(mb, newSupervisor(ctx), cachedir, offline)
+	if err = sg.exportVersionTo(ctx, rev, filepath.Join(tmp, "before")); err == nil {
+		t.Fatal("expected an export of an uncached source to fail offline")
+	}
+
+	sg = newSourceGateway(mb, newSupervisor(ctx), cachedir, sourceOptions{})
+	if err = sg.syncLocal(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sg = newSourceGateway(mb, newSupervisor(ctx), cachedir, offline)
+	to := filepath.Join(tmp, "after")
+	if err = sg.exportVersionTo(ctx, rev, to); err != nil {
+		t.Fatalf("expected a cached revision to be exported offline, got %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(to, "main.go")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sg.listVersions(ctx); err == nil || !strings.Contains(err.Error(), "offline") {
+		t.Fatalf("expected listing versions to be refused offline, got %v", err)
+	}
+}
@@ -603,6 +603,10 @@ func compareVersionType(l, r Version) int {
 //  - Semver versions with a prerelease are after *all* non-prerelease semver.
 //  Within this subset they are sorted first by their numerical component, then
 //  lexicographically by their prerelease version.
+//  - Semver versions that differ only in build metadata, which semver ignores
+//  for precedence, are sorted in descending lexicographic order of their
+//  metadata, so v1.0.0+ci.99 comes before v1.0.0+ci.42. This keeps the choice
+//  between them, and thus the lock, deterministic.
 //  - The default branch(es) is next; the exact semantics of that are specific
 //  to the underlying source.
 //  - All other branches come next, sorted lexicographically.
@@ -642,7 +646,8 @@ func SortPairedForUpgrade(vl []PairedVersion) {
 // concept of "upgrade" vs "downgrade", so there is no reason to reverse them.
 //
 // Thus, the only binary relation that is reversed for downgrade is within-type
-// comparisons for semver.
+// comparisons for semver, including the build metadata tie-breaker:
+// v1.0.0+ci.42 comes before v1.0.0+ci.99.
 //
 // So, given a slice of the following versions:
 //
@@ -664,6 +669,47 @@ func SortPairedForDowngrade(vl []PairedVersion) {
 	sort.Sort(pvdowngradeVersionSorter(vl))
 }
 
+// sortForNewest sorts a slice of []Version as SortForUpgrade does, but breaks
+// every tie deterministically, so that the same versions are always put in
+// the same order, whatever order they were listed in.
+//
+// Versions are put in the order SortForUpgrade gives them, including its
+// tie-break on build metadata, so v1.0.0+ci.99 still comes before
+// v1.0.0+ci.42. Any that are the same but for their revision, such as a
+// branch or tag listed twice, are then ordered by revision, ascending.
+func sortForNewest(vl []Version) {
+	sort.Sort(newestVersionSorter(vl))
+}
+
+type newestVersionSorter []Version
+
+func (vs newestVersionSorter) Len() int {
+	return len(vs)
+}
+
+func (vs newestVersionSorter) Swap(i, j int) {
+	vs[i], vs[j] = vs[j], vs[i]
+}
+
+func (vs newestVersionSorter) Less(i, j int) bool {
+	l, r := vs[i], vs[j]
+	if lless, rless := vLess(l, r, false), vLess(r, l, false); lless != rless {
+		return lless
+	}
+	return revisionOf(l) < revisionOf(r)
+}
+
+// revisionOf returns the revision v is, or is paired with, or "" if neither.
+func revisionOf(v Version) Revision {
+	switch tv := v.(type) {
+	case Revision:
+		return tv
+	case versionPair:
+		return tv.r
+	}
+	return ""
+}
+
 type upgradeVersionSorter []Version
 
 func (vs upgradeVersionSorter) Len() int {
@@ -765,6 +811,21 @@ func vLess(l, r Version, down bool) bool {
 		return lpre
 	}
 
+	if lsv.Equal(rsv) {
+		// Build metadata has no bearing on precedence, but leaving the order
+		// of such versions to the sort would make the solver's choice between
+		// them arbitrary. Break the tie lexically, and then on the original
+		// string (e.g. "1.0.0" vs. "v1.0.0") as a last resort.
+		lm, rm := lsv.Metadata(), rsv.Metadata()
+		if lm == rm {
+			return l.String() < r.String()
+		}
+		if down {
+			return lm < rm
+		}
+		return lm > rm
+	}
+
 	if down {
 		return lsv.LessThan(rsv)
 	}
@@ -4,7 +4,10 @@
 
 package gps
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestVersionSorts(t *testing.T) {
 	rev := Revision("flooboofoobooo")
@@ -187,3 +190,75 @@ func TestVersionSorts(t *testing.T) {
 		t.Errorf("Up-then-downgrade sort positions with wrong versions: %v", wrong)
 	}
 }
+
+func TestVersionSortsBuildMetadata(t *testing.T) {
+	v42 := NewVersion("v1.0.0+ci.42").Is(Revision("c42"))
+	v99 := NewVersion("v1.0.0+ci.99").Is(Revision("c99"))
+
+	// Whatever order they start in, the version with the lexically greater
+	// build metadata must always be chosen first on upgrade, and last on
+	// downgrade.
+	for _, start := range [][]Version{{v42, v99}, {v99, v42}} {
+		up := []Version{start[0], start[1]}
+		SortForUpgrade(up)
+		if up[0] != v99 || up[1] != v42 {
+			t.Errorf("Expected upgrade sort of %s to be [%s %s], got %s", start, v99, v42, up)
+		}
+
+		down := []Version{start[0], start[1]}
+		SortForDowngrade(down)
+		if down[0] != v42 || down[1] != v99 {
+			t.Errorf("Expected downgrade sort of %s to be [%s %s], got %s", start, v42, v99, down)
+		}
+	}
+}
+
+func TestVersionSortsNewest(t *testing.T) {
+	rev := Revision("r1")
+	vl := []Version{
+		NewBranch("master").Is("r2"),
+		NewVersion("v1.0.0").Is("r4"),
+		NewVersion("v1.1.0-beta").Is("r5"),
+		NewVersion("v1.0.0+ci.42").Is("r3"),
+		NewVersion("v1.0.0+ci.99").Is("r8"),
+		NewVersion("1.0.0").Is("r3"),
+		NewVersion("footag").Is("r9"),
+		NewBranch("master").Is("r1"),
+		NewVersion("footag").Is("r6"),
+		NewVersion("v0.9.0").Is("r7"),
+		rev,
+	}
+	// Build metadata breaks ties as it does for SortForUpgrade, whatever the
+	// revisions; only versions that are otherwise the same go by revision.
+	want := []Version{
+		NewVersion("v1.0.0+ci.99").Is("r8"),
+		NewVersion("v1.0.0+ci.42").Is("r3"),
+		NewVersion("1.0.0").Is("r3"),
+		NewVersion("v1.0.0").Is("r4"),
+		NewVersion("v0.9.0").Is("r7"),
+		NewVersion("v1.1.0-beta").Is("r5"),
+		NewBranch("master").Is("r1"),
+		NewBranch("master").Is("r2"),
+		NewVersion("footag").Is("r6"),
+		NewVersion("footag").Is("r9"),
+		rev,
+	}
+
+	// The order must be the same whatever order the versions start in.
+	for i := 0; i < len(vl); i++ {
+		start := append(append([]Version{}, vl[i:]...), vl[:i]...)
+		sortForNewest(start)
+		if !reflect.DeepEqual(start, want) {
+			t.Errorf("Expected newest sort to give\n\t%s\ngot\n\t%s", want, start)
+		}
+	}
+
+	// Both sorts must agree on the order of the build metadata variants.
+	up := []Version{NewVersion("v1.0.0+ci.42").Is("r3"), NewVersion("v1.0.0+ci.99").Is("r8")}
+	newest := append([]Version{}, up...)
+	SortForUpgrade(up)
+	sortForNewest(newest)
+	if !reflect.DeepEqual(up, newest) {
+		t.Errorf("Expected newest sort to order build metadata as upgrade sort does, %s, got %s", up, newest)
+	}
+}
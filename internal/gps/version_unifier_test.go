@@ -101,6 +101,10 @@ func TestTypeUnionIntersect(t *testing.T) {
 	}
 }
 
+func (lb lvFixBridge) requiresSignedTags(ProjectIdentifier) (bool, error) {
+	panic("not implemented")
+}
+
 func (lb lvFixBridge) SourceExists(ProjectIdentifier) (bool, error) {
 	panic("not implemented")
 }
@@ -617,3 +617,32 @@ func (h *Helper) GetCommit(repo string) string {
 	}
 	return strings.TrimSpace(string(out))
 }
+
+// Concurrency records the most calls that were running at once between
+// Start and the func it returns. Fakes use it to check concurrency limits.
+type Concurrency struct {
+	mu           sync.Mutex
+	running, max int
+}
+
+// Start records the start of a call, returning the func that records its end.
+func (c *Concurrency) Start() (done func()) {
+	c.mu.Lock()
+	c.running++
+	if c.running > c.max {
+		c.max = c.running
+	}
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		c.running--
+		c.mu.Unlock()
+	}
+}
+
+// Max returns the most calls that were running at once.
+func (c *Concurrency) Max() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.max
+}
@@ -8,7 +8,9 @@ import (
 	"bytes"
 	"encoding/hex"
 	"io"
+	"os"
 	"sort"
+	"time"
 
 	"github.com/golang/dep/internal/gps"
 	"github.com/pelletier/go-toml"
@@ -22,6 +24,25 @@ const LockName = "Gopkg.lock"
 type Lock struct {
 	SolveMeta SolveMeta
 	P         []gps.LockedProject
+	// CommitTimes records when the locked revisions of projects were
+	// committed, for those projects for which it is known. It is informational
+	// only, and plays no part in solving.
+	CommitTimes map[gps.ProjectRoot]time.Time
+	// Reasons records, for the projects for which it is known, why the solver
+	// chose the locked version. Like CommitTimes, it is informational only,
+	// and plays no part in solving or in the inputs digest.
+	Reasons map[gps.ProjectRoot]Reason
+	// Digests records the content digest of the vendored copy of each
+	// project, as DigestDir computes it, for those projects that were
+	// vendored when the lock was written.
+	Digests map[gps.ProjectRoot]string
+}
+
+// Reason records why a locked project's version was chosen: the constraint
+// that bound it, and the projects that imposed that constraint.
+type Reason struct {
+	Constraint string
+	RequiredBy []gps.ProjectRoot
 }
 
 // SolveMeta holds solver meta data.
@@ -39,20 +60,44 @@ type rawLock struct {
 }
 
 type solveMeta struct {
-	InputsDigest    string `toml:"inputs-digest"`
-	AnalyzerName    string `toml:"analyzer-name"`
-	AnalyzerVersion int    `toml:"analyzer-version"`
-	SolverName      string `toml:"solver-name"`
-	SolverVersion   int    `toml:"solver-version"`
+	InputsDigest    string      `toml:"inputs-digest"`
+	AnalyzerName    string      `toml:"analyzer-name"`
+	AnalyzerVersion int         `toml:"analyzer-version"`
+	SolverName      string      `toml:"solver-name"`
+	SolverVersion   int         `toml:"solver-version"`
+	Reasons         []rawReason `toml:"reasons,omitempty"`
+}
+
+type rawReason struct {
+	Name       string   `toml:"name"`
+	Constraint string   `toml:"constraint"`
+	RequiredBy []string `toml:"required-by"`
 }
 
 type rawLockedProject struct {
-	Name     string   `toml:"name"`
-	Branch   string   `toml:"branch,omitempty"`
-	Revision string   `toml:"revision"`
-	Version  string   `toml:"version,omitempty"`
-	Source   string   `toml:"source,omitempty"`
-	Packages []string `toml:"packages"`
+	Name       string   `toml:"name"`
+	Branch     string   `toml:"branch,omitempty"`
+	Revision   string   `toml:"revision"`
+	Version    string   `toml:"version,omitempty"`
+	Source     string   `toml:"source,omitempty"`
+	Packages   []string `toml:"packages"`
+	CommitTime string   `toml:"commit-time,omitempty"`
+	Digest     string   `toml:"digest,omitempty"`
+}
+
+// LoadLock reads the lock file at path.
+func LoadLock(path string) (*Lock, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open lock file")
+	}
+	defer f.Close()
+
+	l, err := readLock(f)
+	if err != nil {
+		return nil, errors.Errorf("error while parsing %s: %s", path, err)
+	}
+	return l, nil
 }
 
 func readLock(r io.Reader) (*Lock, error) {
@@ -87,6 +132,17 @@ func fromRawLock(raw rawLock) (*Lock, error) {
 	l.SolveMeta.SolverName = raw.SolveMeta.SolverName
 	l.SolveMeta.SolverVersion = raw.SolveMeta.SolverVersion
 
+	for _, rr := range raw.SolveMeta.Reasons {
+		if l.Reasons == nil {
+			l.Reasons = make(map[gps.ProjectRoot]Reason)
+		}
+		r := Reason{Constraint: rr.Constraint}
+		for _, by := range rr.RequiredBy {
+			r.RequiredBy = append(r.RequiredBy, gps.ProjectRoot(by))
+		}
+		l.Reasons[gps.ProjectRoot(rr.Name)] = r
+	}
+
 	for i, ld := range raw.Projects {
 		r := gps.Revision(ld.Revision)
 
@@ -107,6 +163,24 @@ func fromRawLock(raw rawLock) (*Lock, error) {
 			Source:      ld.Source,
 		}
 		l.P[i] = gps.NewLockedProject(id, v, ld.Packages)
+
+		if ld.CommitTime != "" {
+			t, err := time.Parse(time.RFC3339, ld.CommitTime)
+			if err != nil {
+				return nil, errors.Errorf("invalid commit-time %q for %s", ld.CommitTime, ld.Name)
+			}
+			if l.CommitTimes == nil {
+				l.CommitTimes = make(map[gps.ProjectRoot]time.Time)
+			}
+			l.CommitTimes[id.ProjectRoot] = t
+		}
+
+		if ld.Digest != "" {
+			if l.Digests == nil {
+				l.Digests = make(map[gps.ProjectRoot]string)
+			}
+			l.Digests[id.ProjectRoot] = ld.Digest
+		}
 	}
 
 	return l, nil
@@ -148,7 +222,24 @@ func (l *Lock) toRaw() rawLock {
 		v := lp.Version()
 		ld.Revision, ld.Branch, ld.Version = gps.VersionComponentStrings(v)
 
+		if t, has := l.CommitTimes[id.ProjectRoot]; has {
+			ld.CommitTime = t.Format(time.RFC3339)
+		}
+		ld.Digest = l.Digests[id.ProjectRoot]
+
 		raw.Projects[k] = ld
+
+		if r, has := l.Reasons[id.ProjectRoot]; has {
+			rr := rawReason{
+				Name:       ld.Name,
+				Constraint: r.Constraint,
+				RequiredBy: make([]string, len(r.RequiredBy)),
+			}
+			for i, by := range r.RequiredBy {
+				rr.RequiredBy[i] = string(by)
+			}
+			raw.SolveMeta.Reasons = append(raw.SolveMeta.Reasons, rr)
+		}
 	}
 
 	return raw
@@ -184,6 +275,19 @@ func LockFromSolution(in gps.Solution) *Lock {
 	return l
 }
 
+// ReasonsFromSolution converts the reasons recorded in a gps.Solution for
+// the projects it selected into dep's representation, for Lock.Reasons.
+func ReasonsFromSolution(in gps.Solution) map[gps.ProjectRoot]Reason {
+	reasons := make(map[gps.ProjectRoot]Reason)
+	for pr, r := range in.Reasons() {
+		reasons[pr] = Reason{
+			Constraint: r.Constraint.String(),
+			RequiredBy: append([]gps.ProjectRoot(nil), r.RequiredBy...),
+		}
+	}
+	return reasons
+}
+
 // SortedLockedProjects implements sort.Interface.
 type SortedLockedProjects []gps.LockedProject
 
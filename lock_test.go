@@ -9,6 +9,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/dep/internal/gps"
 	"github.com/golang/dep/internal/test"
@@ -163,3 +164,103 @@ func TestReadLockErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestLockCommitTime(t *testing.T) {
+	in := `[[projects]]
+  commit-time = "2017-06-07T08:09:10+02:00"
+  name = "github.com/sdboyer/deptest"
+  packages = ["."]
+  revision = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+  version = "v1.0.0"
+
+[[projects]]
+  name = "github.com/sdboyer/deptestdos"
+  packages = ["."]
+  revision = "5c607206be5decd28e6263ffffdcee067266015e"
+`
+	l, err := readLock(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := time.Date(2017, 6, 7, 6, 9, 10, 0, time.UTC)
+	if len(l.CommitTimes) != 1 || !l.CommitTimes["github.com/sdboyer/deptest"].Equal(want) {
+		t.Fatalf("expected a single commit time of %s, got %v", want, l.CommitTimes)
+	}
+
+	out, err := l.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(out), "commit-time"); got != 1 {
+		t.Errorf("expected one commit-time to be written, got %d:\n%s", got, out)
+	}
+	if !strings.Contains(string(out), `commit-time = "2017-06-07T08:09:10+02:00"`) {
+		t.Errorf("expected the commit time to be written back as it was read, got:\n%s", out)
+	}
+
+	_, err = readLock(strings.NewReader(strings.Replace(in, "2017-06-07T08:09:10+02:00", "last tuesday", 1)))
+	if err == nil || !strings.Contains(err.Error(), "invalid commit-time") {
+		t.Errorf("expected an invalid commit-time error, got %v", err)
+	}
+}
+
+func TestLockDigest(t *testing.T) {
+	digest := "sha256:f4e8ada84ff512d947c19618ff2a1b190ea8a5bf6406ce552aaea900a35295c3"
+	in := `[[projects]]
+  digest = "` + digest + `"
+  name = "github.com/sdboyer/deptest"
+  packages = ["."]
+  revision = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+  version = "v1.0.0"
+
+[[projects]]
+  name = "github.com/sdboyer/deptestdos"
+  packages = ["."]
+  revision = "5c607206be5decd28e6263ffffdcee067266015e"
+`
+	l, err := readLock(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[gps.ProjectRoot]string{"github.com/sdboyer/deptest": digest}
+	if !reflect.DeepEqual(l.Digests, want) {
+		t.Fatalf("unexpected digests:\n\t(GOT) %v\n\t(WNT) %v", l.Digests, want)
+	}
+
+	out, err := l.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(out), "  digest = "); got != 1 {
+		t.Errorf("expected one digest to be written, got %d:\n%s", got, out)
+	}
+}
+
+func TestLockReasons(t *testing.T) {
+	l := &Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest"}, gps.NewVersion("v1.2.3").Is("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"), []string{"."}),
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"}, gps.Revision("5c607206be5decd28e6263ffffdcee067266015e"), []string{"."}),
+		},
+		Reasons: map[gps.ProjectRoot]Reason{
+			"github.com/sdboyer/deptest": {Constraint: "~1.2.0", RequiredBy: []gps.ProjectRoot{"github.com/sdboyer/deptestdos"}},
+		},
+	}
+
+	out, err := l.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "[[solve-meta.reasons]]") {
+		t.Errorf("expected the reasons to be written to solve-meta, got:\n%s", out)
+	}
+	got, err := readLock(strings.NewReader(string(out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Reasons, l.Reasons) {
+		t.Errorf("expected the reasons to be read back as they were written, got %v", got.Reasons)
+	}
+}
@@ -6,11 +6,14 @@ package dep
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"reflect"
 	"regexp"
 	"sort"
+	"strings"
 
 	"github.com/golang/dep/internal/gps"
 	"github.com/pelletier/go-toml"
@@ -26,21 +29,133 @@ type Manifest struct {
 	Ovr         gps.ProjectConstraints
 	Ignored     []string
 	Required    []string
+
+	// Floating is the set of constrained projects that are re-resolved to
+	// the newest version allowed by their constraint on every solve, rather
+	// than retaining the version recorded in the lock.
+	Floating map[gps.ProjectRoot]bool
+
+	// PruneOptions determines which files are pruned from dependencies as
+	// they are written into vendor, and whether their modes are normalized.
+	PruneOptions gps.PruneOptions
+
+	// PruneKeep, if not empty, lists the patterns of the files to keep in
+	// each dependency as it is written into vendor; all others are pruned.
+	// It is given as keep-only in the prune table. See gps.PruneUnkeptFiles
+	// for the pattern syntax.
+	PruneKeep []string
+
+	// PruneProtect lists the patterns of the files in each dependency that
+	// no pruning removes, whether by PruneOptions, PruneKeep or dep prune,
+	// such as generated code or data files the build needs. Unlike
+	// PruneKeep, it prunes nothing itself. It is given as keep-patterns in
+	// the prune table, and its syntax is that of PruneKeep.
+	PruneProtect []string
+
+	// SkipTestImports leaves the packages imported only by the project's own
+	// test files out of the solve, and so out of the lock and vendor.
+	SkipTestImports bool
+
+	// VCS is the set of projects whose repository type is forced, rather than
+	// detected from their import path or source.
+	VCS map[gps.ProjectRoot]string
+
+	// CloneDepth is the set of projects whose git history is cloned to a
+	// given depth, overriding the depth used for other sources. A depth of 0
+	// clones the full history.
+	CloneDepth map[gps.ProjectRoot]int
+
+	// RefNamespace is the set of projects whose versions are listed from a
+	// namespace of git refs, such as refs/releases, rather than from tags.
+	RefNamespace map[gps.ProjectRoot]string
+
+	// Exclude is the set of projects with versions that must never be
+	// selected, though their constraints allow them.
+	Exclude map[gps.ProjectRoot][]string
+
+	// ForbiddenPackages lists import paths that the project's own packages
+	// must not import, nor any package below them.
+	ForbiddenPackages []string
+
+	// Keyring is the path, relative to the manifest, of a file of the public
+	// keys trusted to sign the tags of dependencies.
+	Keyring string
+
+	// RequireSignedTags limits the versions of all git dependencies to tags
+	// signed by a key in Keyring. SignedTags does so for only the projects it
+	// holds.
+	RequireSignedTags bool
+	SignedTags        map[gps.ProjectRoot]bool
+
+	// PinDigest is the set of projects whose vendored copies must have a
+	// given content digest, in the form sha256:<hex>, as recorded in the
+	// reports written by ensure -report.
+	PinDigest map[gps.ProjectRoot]string
+
+	// ShortDigest is the set of projects whose PinDigest was given as digest,
+	// rather than pin-digest, so that it is written back out the same way.
+	ShortDigest map[gps.ProjectRoot]bool
+
+	// Mirrors lists the prefixes of sources that are fetched from elsewhere,
+	// such as from a mirror inside a firewall. The projects keep their own
+	// names in import paths and in the lock.
+	Mirrors []gps.SourceMirror
+
+	// PostEnsure lists the commands, split on spaces, that dep ensure runs
+	// from the project root, in order, after it has successfully written the
+	// lock and vendor.
+	PostEnsure []string
 }
 
 type rawManifest struct {
-	Constraints []rawProject `toml:"constraint,omitempty"`
-	Overrides   []rawProject `toml:"override,omitempty"`
-	Ignored     []string     `toml:"ignored,omitempty"`
-	Required    []string     `toml:"required,omitempty"`
+	Constraints  []rawProject     `toml:"constraint,omitempty"`
+	Overrides    []rawProject     `toml:"override,omitempty"`
+	Ignored      []string         `toml:"ignored,omitempty"`
+	Required     []string         `toml:"required,omitempty"`
+	PruneOptions *rawPruneOptions `toml:"prune,omitempty"`
+
+	ForbiddenPackages []string `toml:"forbidden-packages,omitempty"`
+	Keyring           string   `toml:"keyring,omitempty"`
+	RequireSignedTags bool     `toml:"require-signed-tags,omitempty"`
+
+	Sources []rawSource `toml:"source,omitempty"`
+
+	Hooks *rawHooks `toml:"hooks,omitempty"`
+}
+
+type rawHooks struct {
+	PostEnsure []string `toml:"post-ensure,omitempty"`
+}
+
+type rawSource struct {
+	Prefix string `toml:"prefix"`
+	Mirror string `toml:"mirror"`
+}
+
+type rawPruneOptions struct {
+	BuildIgnored   bool     `toml:"build-ignored,omitempty"`
+	NormalizeModes bool     `toml:"normalize-modes,omitempty"`
+	KeepOnly       []string `toml:"keep-only,omitempty"`
+	KeepPatterns   []string `toml:"keep-patterns,omitempty"`
+
+	SkipTestImports bool `toml:"skip-test-imports,omitempty"`
 }
 
 type rawProject struct {
-	Name     string `toml:"name"`
-	Branch   string `toml:"branch,omitempty"`
-	Revision string `toml:"revision,omitempty"`
-	Version  string `toml:"version,omitempty"`
-	Source   string `toml:"source,omitempty"`
+	Name         string   `toml:"name"`
+	Branch       string   `toml:"branch,omitempty"`
+	Revision     string   `toml:"revision,omitempty"`
+	Version      string   `toml:"version,omitempty"`
+	Source       string   `toml:"source,omitempty"`
+	VCS          string   `toml:"vcs,omitempty"`
+	Float        bool     `toml:"float,omitempty"`
+	CloneDepth   *int     `toml:"clone-depth,omitempty"`
+	RefNamespace string   `toml:"ref-namespace,omitempty"`
+	Exclude      []string `toml:"exclude,omitempty"`
+
+	RequireSignedTags bool   `toml:"require-signed-tags,omitempty"`
+	PinDigest         string `toml:"pin-digest,omitempty"`
+	Digest            string `toml:"digest,omitempty"` // the same as pin-digest
 }
 
 func validateManifest(s string) ([]error, error) {
@@ -72,7 +187,7 @@ func validateManifest(s string) ([]error, error) {
 					for key, value := range v.(map[string]interface{}) {
 						// Check if the key is valid
 						switch key {
-						case "name", "branch", "version", "source":
+						case "name", "branch", "version", "source", "vcs", "float", "clone-depth", "ref-namespace", "exclude", "require-signed-tags", "pin-digest", "digest":
 							// valid key
 						case "revision":
 							if valueStr, ok := value.(string); ok {
@@ -94,7 +209,83 @@ func validateManifest(s string) ([]error, error) {
 			} else {
 				errs = append(errs, fmt.Errorf("%v should be a TOML array of tables", prop))
 			}
-		case "ignored", "required":
+		case "prune":
+			opts, ok := val.(map[string]interface{})
+			if !ok {
+				errs = append(errs, errors.New("prune should be a TOML table"))
+				break
+			}
+			for key, value := range opts {
+				switch key {
+				case "build-ignored", "normalize-modes", "skip-test-imports":
+					if _, ok := value.(bool); !ok {
+						errs = append(errs, fmt.Errorf("%q in prune should be a boolean", key))
+					}
+				case "keep-only", "keep-patterns":
+					patterns, ok := value.([]interface{})
+					if !ok {
+						errs = append(errs, fmt.Errorf("%q in prune should be a TOML array of strings", key))
+						break
+					}
+					for _, pattern := range patterns {
+						if _, ok := pattern.(string); !ok {
+							errs = append(errs, fmt.Errorf("%q in prune should be a TOML array of strings", key))
+							break
+						}
+					}
+				default:
+					errs = append(errs, fmt.Errorf("Invalid key %q in %q", key, prop))
+				}
+			}
+		case "source":
+			sources, ok := val.([]interface{})
+			if !ok {
+				errs = append(errs, errors.New("source should be a TOML array of tables"))
+				break
+			}
+			for _, v := range sources {
+				source, ok := v.(map[string]interface{})
+				if !ok {
+					errs = append(errs, errors.New("source should be a TOML array of tables"))
+					break
+				}
+				for key := range source {
+					switch key {
+					case "prefix", "mirror":
+					default:
+						errs = append(errs, fmt.Errorf("Invalid key %q in %q", key, prop))
+					}
+				}
+			}
+		case "hooks":
+			hooks, ok := val.(map[string]interface{})
+			if !ok {
+				errs = append(errs, errors.New("hooks should be a TOML table"))
+				break
+			}
+			for key, value := range hooks {
+				switch key {
+				case "post-ensure":
+					commands, ok := value.([]interface{})
+					if !ok {
+						errs = append(errs, fmt.Errorf("%q in hooks should be a TOML array of strings", key))
+						break
+					}
+					for _, command := range commands {
+						if _, ok := command.(string); !ok {
+							errs = append(errs, fmt.Errorf("%q in hooks should be a TOML array of strings", key))
+							break
+						}
+					}
+				default:
+					errs = append(errs, fmt.Errorf("Invalid key %q in %q", key, prop))
+				}
+			}
+		case "ignored", "required", "forbidden-packages", "keyring":
+		case "require-signed-tags":
+			if _, ok := val.(bool); !ok {
+				errs = append(errs, fmt.Errorf("%q should be a boolean", prop))
+			}
 		default:
 			errs = append(errs, fmt.Errorf("Unknown field in manifest: %v", prop))
 		}
@@ -132,9 +323,16 @@ func fromRawManifest(raw rawManifest) (*Manifest, error) {
 		Ovr:         make(gps.ProjectConstraints, len(raw.Overrides)),
 		Ignored:     raw.Ignored,
 		Required:    raw.Required,
+
+		ForbiddenPackages: raw.ForbiddenPackages,
+		Keyring:           raw.Keyring,
+		RequireSignedTags: raw.RequireSignedTags,
 	}
 
 	for i := 0; i < len(raw.Constraints); i++ {
+		if err := splitVCS(&raw.Constraints[i]); err != nil {
+			return nil, err
+		}
 		name, prj, err := toProject(raw.Constraints[i])
 		if err != nil {
 			return nil, err
@@ -143,14 +341,102 @@ func fromRawManifest(raw rawManifest) (*Manifest, error) {
 			return nil, errors.Errorf("multiple dependencies specified for %s, can only specify one", name)
 		}
 		m.Constraints[name] = prj
+		m.setVCS(name, raw.Constraints[i].VCS)
+		if err := m.setCloneDepth(name, raw.Constraints[i].CloneDepth); err != nil {
+			return nil, err
+		}
+		if err := m.setRefNamespace(name, raw.Constraints[i].RefNamespace); err != nil {
+			return nil, err
+		}
+		if err := m.setExclude(name, raw.Constraints[i].Exclude); err != nil {
+			return nil, err
+		}
+		m.setSignedTags(name, raw.Constraints[i].RequireSignedTags)
+		if err := m.setPinDigest(name, raw.Constraints[i]); err != nil {
+			return nil, err
+		}
+
+		if raw.Constraints[i].Float {
+			if raw.Constraints[i].Revision != "" {
+				return nil, errors.Errorf("cannot float %s, it is pinned to a revision", name)
+			}
+			if m.Floating == nil {
+				m.Floating = make(map[gps.ProjectRoot]bool)
+			}
+			m.Floating[name] = true
+		}
 	}
 
 	for i := 0; i < len(raw.Overrides); i++ {
+		if err := splitVCS(&raw.Overrides[i]); err != nil {
+			return nil, err
+		}
 		name, prj, err := toProject(raw.Overrides[i])
 		if err != nil {
 			return nil, err
 		}
 		m.Ovr[name] = prj
+		m.setVCS(name, raw.Overrides[i].VCS)
+		if err := m.setCloneDepth(name, raw.Overrides[i].CloneDepth); err != nil {
+			return nil, err
+		}
+		if err := m.setRefNamespace(name, raw.Overrides[i].RefNamespace); err != nil {
+			return nil, err
+		}
+		if err := m.setExclude(name, raw.Overrides[i].Exclude); err != nil {
+			return nil, err
+		}
+		m.setSignedTags(name, raw.Overrides[i].RequireSignedTags)
+		if err := m.setPinDigest(name, raw.Overrides[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.Keyring == "" && (m.RequireSignedTags || len(m.SignedTags) > 0) {
+		return nil, errors.New("require-signed-tags is set, but no keyring of trusted keys is given")
+	}
+
+	if raw.PruneOptions != nil && raw.PruneOptions.BuildIgnored {
+		m.PruneOptions |= gps.PruneBuildIgnoredFiles
+	}
+	if raw.PruneOptions != nil && raw.PruneOptions.NormalizeModes {
+		m.PruneOptions |= gps.NormalizeFileModes
+	}
+	if raw.PruneOptions != nil {
+		for _, pattern := range raw.PruneOptions.KeepOnly {
+			if err := gps.ValidateKeepPattern(pattern); err != nil {
+				return nil, err
+			}
+		}
+		m.PruneKeep = raw.PruneOptions.KeepOnly
+		for _, pattern := range raw.PruneOptions.KeepPatterns {
+			if err := gps.ValidateKeepPattern(pattern); err != nil {
+				return nil, err
+			}
+		}
+		m.PruneProtect = raw.PruneOptions.KeepPatterns
+		m.SkipTestImports = raw.PruneOptions.SkipTestImports
+	}
+
+	if raw.Hooks != nil {
+		for _, command := range raw.Hooks.PostEnsure {
+			if len(strings.Fields(command)) == 0 {
+				return nil, errors.New("empty command in post-ensure hooks")
+			}
+		}
+		m.PostEnsure = raw.Hooks.PostEnsure
+	}
+
+	seen := make(map[string]bool, len(raw.Sources))
+	for _, src := range raw.Sources {
+		if src.Prefix == "" || src.Mirror == "" {
+			return nil, errors.New("each [[source]] must have both a prefix and a mirror")
+		}
+		if seen[src.Prefix] {
+			return nil, errors.Errorf("multiple mirrors specified for the prefix %s, can only specify one", src.Prefix)
+		}
+		seen[src.Prefix] = true
+		m.Mirrors = append(m.Mirrors, gps.SourceMirror{Prefix: src.Prefix, Mirror: src.Mirror})
 	}
 
 	return m, nil
@@ -190,6 +476,25 @@ func toProject(raw rawProject) (n gps.ProjectRoot, pp gps.ProjectProperties, err
 	return n, pp, nil
 }
 
+// splitVCS moves a VCS type given in front of raw's source, as in
+// "git::https://example.com/foo/bar", into its VCS field, and checks that the
+// VCS type is supported.
+func splitVCS(raw *rawProject) error {
+	if i := strings.Index(raw.Source, "::"); i >= 0 {
+		vcs := raw.Source[:i]
+		if raw.VCS != "" && raw.VCS != vcs {
+			return errors.Errorf("conflicting VCS types %q and %q specified for %s", raw.VCS, vcs, raw.Name)
+		}
+		raw.VCS, raw.Source = vcs, raw.Source[i+2:]
+	}
+
+	switch raw.VCS {
+	case "", "git", "hg", "bzr":
+		return nil
+	}
+	return errors.Errorf("unsupported VCS type %q for %s; must be git, hg or bzr", raw.VCS, raw.Name)
+}
+
 // toRaw converts the manifest into a representation suitable to write to the manifest file
 func (m *Manifest) toRaw() rawManifest {
 	raw := rawManifest{
@@ -197,17 +502,54 @@ func (m *Manifest) toRaw() rawManifest {
 		Overrides:   make([]rawProject, 0, len(m.Ovr)),
 		Ignored:     m.Ignored,
 		Required:    m.Required,
+
+		ForbiddenPackages: m.ForbiddenPackages,
+		Keyring:           m.Keyring,
+		RequireSignedTags: m.RequireSignedTags,
 	}
 	for n, prj := range m.Constraints {
-		raw.Constraints = append(raw.Constraints, toRawProject(n, prj))
+		rp := toRawProject(n, prj)
+		rp.VCS = m.VCS[n]
+		rp.Float = m.Floating[n]
+		rp.CloneDepth = m.rawCloneDepth(n)
+		rp.RefNamespace = m.RefNamespace[n]
+		rp.Exclude = m.Exclude[n]
+		rp.RequireSignedTags = m.SignedTags[n]
+		m.setRawPinDigest(n, &rp)
+		raw.Constraints = append(raw.Constraints, rp)
 	}
 	sort.Sort(sortedRawProjects(raw.Constraints))
 
 	for n, prj := range m.Ovr {
-		raw.Overrides = append(raw.Overrides, toRawProject(n, prj))
+		rp := toRawProject(n, prj)
+		rp.VCS = m.VCS[n]
+		rp.CloneDepth = m.rawCloneDepth(n)
+		rp.RefNamespace = m.RefNamespace[n]
+		rp.Exclude = m.Exclude[n]
+		rp.RequireSignedTags = m.SignedTags[n]
+		m.setRawPinDigest(n, &rp)
+		raw.Overrides = append(raw.Overrides, rp)
 	}
 	sort.Sort(sortedRawProjects(raw.Overrides))
 
+	if m.PruneOptions != 0 || len(m.PruneKeep) > 0 || len(m.PruneProtect) > 0 || m.SkipTestImports {
+		raw.PruneOptions = &rawPruneOptions{
+			BuildIgnored:    (m.PruneOptions & gps.PruneBuildIgnoredFiles) != 0,
+			NormalizeModes:  (m.PruneOptions & gps.NormalizeFileModes) != 0,
+			KeepOnly:        m.PruneKeep,
+			KeepPatterns:    m.PruneProtect,
+			SkipTestImports: m.SkipTestImports,
+		}
+	}
+
+	for _, mirror := range m.Mirrors {
+		raw.Sources = append(raw.Sources, rawSource{Prefix: mirror.Prefix, Mirror: mirror.Mirror})
+	}
+
+	if len(m.PostEnsure) > 0 {
+		raw.Hooks = &rawHooks{PostEnsure: m.PostEnsure}
+	}
+
 	return raw
 }
 
@@ -265,6 +607,201 @@ func toRawProject(name gps.ProjectRoot, project gps.ProjectProperties) rawProjec
 	return raw
 }
 
+// setVCS records the VCS type forced for the project n, if any.
+func (m *Manifest) setVCS(n gps.ProjectRoot, vcs string) {
+	if vcs == "" {
+		return
+	}
+	if m.VCS == nil {
+		m.VCS = make(map[gps.ProjectRoot]string)
+	}
+	m.VCS[n] = vcs
+}
+
+// VCSTypes returns the forced VCS types of projects, keyed by the name the
+// source manager knows each project by.
+func (m *Manifest) VCSTypes() map[string]string {
+	if len(m.VCS) == 0 {
+		return nil
+	}
+
+	types := make(map[string]string, len(m.VCS))
+	for n, vcs := range m.VCS {
+		types[m.sourceName(n)] = vcs
+	}
+	return types
+}
+
+// setCloneDepth records the clone depth given for the project n, if any.
+func (m *Manifest) setCloneDepth(n gps.ProjectRoot, depth *int) error {
+	if depth == nil {
+		return nil
+	}
+	if *depth < 0 {
+		return errors.Errorf("invalid clone-depth %d for %s; must be 0, for the full history, or more", *depth, n)
+	}
+	if m.CloneDepth == nil {
+		m.CloneDepth = make(map[gps.ProjectRoot]int)
+	}
+	m.CloneDepth[n] = *depth
+	return nil
+}
+
+func (m *Manifest) rawCloneDepth(n gps.ProjectRoot) *int {
+	if depth, has := m.CloneDepth[n]; has {
+		return &depth
+	}
+	return nil
+}
+
+// CloneDepths returns the clone depths given for projects, keyed by the name
+// the source manager knows each project by.
+func (m *Manifest) CloneDepths() map[string]int {
+	if len(m.CloneDepth) == 0 {
+		return nil
+	}
+
+	depths := make(map[string]int, len(m.CloneDepth))
+	for n, depth := range m.CloneDepth {
+		depths[m.sourceName(n)] = depth
+	}
+	return depths
+}
+
+// VendorPruning returns how the manifest says dependencies are pruned as
+// they are written into vendor.
+func (m *Manifest) VendorPruning() VendorPruning {
+	return VendorPruning{
+		Options: m.PruneOptions,
+		Keep:    m.PruneKeep,
+		Protect: m.PruneProtect,
+	}
+}
+
+// setRefNamespace records the namespace of refs given for the project n, if
+// any.
+func (m *Manifest) setRefNamespace(n gps.ProjectRoot, ns string) error {
+	if ns == "" {
+		return nil
+	}
+	if !strings.HasPrefix(ns, "refs/") || strings.TrimSuffix(ns, "/") == "refs" {
+		return errors.Errorf("invalid ref-namespace %q for %s; must be a namespace of refs, such as refs/releases", ns, n)
+	}
+	if m.RefNamespace == nil {
+		m.RefNamespace = make(map[gps.ProjectRoot]string)
+	}
+	m.RefNamespace[n] = ns
+	return nil
+}
+
+// RefNamespaces returns the namespaces of refs given for projects, keyed by
+// the name the source manager knows each project by.
+func (m *Manifest) RefNamespaces() map[string]string {
+	if len(m.RefNamespace) == 0 {
+		return nil
+	}
+
+	namespaces := make(map[string]string, len(m.RefNamespace))
+	for n, ns := range m.RefNamespace {
+		namespaces[m.sourceName(n)] = ns
+	}
+	return namespaces
+}
+
+// setExclude records the versions excluded for the project n, if any.
+func (m *Manifest) setExclude(n gps.ProjectRoot, versions []string) error {
+	if len(versions) == 0 {
+		return nil
+	}
+	for _, v := range versions {
+		if v == "" {
+			return errors.Errorf("invalid exclude for %s; versions must not be empty", n)
+		}
+	}
+	if m.Exclude == nil {
+		m.Exclude = make(map[gps.ProjectRoot][]string)
+	}
+	m.Exclude[n] = versions
+	return nil
+}
+
+// setSignedTags records that the versions of the project n are limited to
+// signed tags, if required is set.
+func (m *Manifest) setSignedTags(n gps.ProjectRoot, required bool) {
+	if !required {
+		return
+	}
+	if m.SignedTags == nil {
+		m.SignedTags = make(map[gps.ProjectRoot]bool)
+	}
+	m.SignedTags[n] = true
+}
+
+// setPinDigest records the content digest that the vendored copy of the
+// project rp must have, if one is given, as either its pin-digest or its
+// digest. The digest may be given without its sha256: prefix.
+func (m *Manifest) setPinDigest(n gps.ProjectRoot, rp rawProject) error {
+	digest := rp.PinDigest
+	if rp.Digest != "" {
+		if digest != "" {
+			return errors.Errorf("both digest and pin-digest are given for %s; give only one", n)
+		}
+		digest = rp.Digest
+		if m.ShortDigest == nil {
+			m.ShortDigest = make(map[gps.ProjectRoot]bool)
+		}
+		m.ShortDigest[n] = true
+	}
+	if digest == "" {
+		return nil
+	}
+	sum := strings.TrimPrefix(strings.ToLower(digest), "sha256:")
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+		return errors.Errorf("invalid pin-digest %q for %s; must be a sha256 digest, such as sha256:<64 hex digits>", digest, n)
+	}
+	if m.PinDigest == nil {
+		m.PinDigest = make(map[gps.ProjectRoot]string)
+	}
+	m.PinDigest[n] = "sha256:" + sum
+	return nil
+}
+
+// setRawPinDigest sets the digest of rp, the raw form of the project n, under
+// the key it was given as.
+func (m *Manifest) setRawPinDigest(n gps.ProjectRoot, rp *rawProject) {
+	if m.ShortDigest[n] {
+		rp.Digest = m.PinDigest[n]
+	} else {
+		rp.PinDigest = m.PinDigest[n]
+	}
+}
+
+// SignedTagSources returns the set of projects whose versions are limited to
+// signed tags, keyed by the name the source manager knows each project by.
+func (m *Manifest) SignedTagSources() map[string]bool {
+	if len(m.SignedTags) == 0 {
+		return nil
+	}
+
+	sources := make(map[string]bool, len(m.SignedTags))
+	for n := range m.SignedTags {
+		sources[m.sourceName(n)] = true
+	}
+	return sources
+}
+
+// sourceName returns the name the source manager knows the project n by: its
+// source, if one is specified in an override or constraint, and its project
+// root otherwise.
+func (m *Manifest) sourceName(n gps.ProjectRoot) string {
+	if pp, has := m.Ovr[n]; has && pp.Source != "" {
+		return pp.Source
+	} else if pp, has := m.Constraints[n]; has && pp.Source != "" {
+		return pp.Source
+	}
+	return string(n)
+}
+
 // DependencyConstraints returns a list of project-level constraints.
 func (m *Manifest) DependencyConstraints() gps.ProjectConstraints {
 	return m.Constraints
@@ -281,6 +818,26 @@ func (m *Manifest) Overrides() gps.ProjectConstraints {
 	return m.Ovr
 }
 
+// FloatingProjects returns the sorted list of project roots that should
+// always be resolved to their newest allowed version.
+func (m *Manifest) FloatingProjects() []gps.ProjectRoot {
+	if len(m.Floating) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(m.Floating))
+	for pr := range m.Floating {
+		names = append(names, string(pr))
+	}
+	sort.Strings(names)
+
+	prs := make([]gps.ProjectRoot, len(names))
+	for i, n := range names {
+		prs[i] = gps.ProjectRoot(n)
+	}
+	return prs
+}
+
 // IgnoredPackages returns a set of import paths to ignore.
 func (m *Manifest) IgnoredPackages() map[string]bool {
 	if len(m.Ignored) == 0 {
@@ -0,0 +1,397 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/dep/internal/gps"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// fmtEntry is a single key/value pair in a manifest, along with the comments
+// that accompany it.
+type fmtEntry struct {
+	comments []string // comment lines (and blank separators) preceding the entry
+	key      string
+	value    string // canonical TOML representation of the value
+	trailing string // comment on the same line as the entry, if any
+}
+
+// fmtTable is a table or array-of-tables element in a manifest. Subtables,
+// such as [constraint.metadata], travel with the table they belong to.
+type fmtTable struct {
+	comments []string
+	name     string
+	array    bool
+	trailing string
+	entries  []fmtEntry
+	subs     []*fmtTable
+}
+
+// FormatManifest reads a manifest from r and returns it rewritten in dep's
+// canonical style:
+//
+// - Top-level keys come first, followed by plain tables, [[constraint]] and
+// [[override]], with the array tables sorted by name and source.
+//
+// - Keys within a table are sorted, indented consistently and their values
+// are quoted the same way dep itself writes them.
+//
+// - Version constraints are normalized the same way dep writes them.
+//
+// Comments are preserved and move together with the key or table that follows
+// them. The formatted manifest is guaranteed to have the same meaning as the
+// original; if it would not, an error is returned.
+func FormatManifest(r io.Reader) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, errors.Wrap(err, "Unable to read byte stream")
+	}
+	orig := buf.Bytes()
+
+	before, _, err := readManifest(bytes.NewReader(orig))
+	if err != nil {
+		return nil, err
+	}
+
+	header, root, tables, footer, err := parseManifestLayout(string(orig))
+	if err != nil {
+		return nil, err
+	}
+
+	out := writeManifestLayout(header, root, tables, footer)
+
+	after, _, err := readManifest(bytes.NewReader(out))
+	if err != nil {
+		return nil, errors.Wrap(err, "formatting produced an invalid manifest")
+	}
+	if !sameManifest(before, after) {
+		return nil, errors.New("formatting would change the meaning of the manifest")
+	}
+
+	return out, nil
+}
+
+func parseManifestLayout(s string) (header []string, root *fmtTable, tables []*fmtTable, footer []string, err error) {
+	root = &fmtTable{}
+	cur := root
+	seenStmt := false
+
+	var pending []string
+	// takeComments hands out the pending comments to the statement that is
+	// about to be recorded. Comments that precede the very first statement and
+	// are separated from it by a blank line belong to the file itself.
+	takeComments := func() []string {
+		c := pending
+		pending = nil
+		if !seenStmt {
+			seenStmt = true
+			for i := len(c) - 1; i >= 0; i-- {
+				if c[i] == "" {
+					header = trimBlank(c[:i])
+					return trimBlank(c[i+1:])
+				}
+			}
+		}
+		return trimBlank(c)
+	}
+
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case line == "":
+			if len(pending) > 0 && pending[len(pending)-1] != "" {
+				pending = append(pending, "")
+			}
+		case strings.HasPrefix(line, "#"):
+			pending = append(pending, line)
+		case strings.HasPrefix(line, "["):
+			body, trailing := splitComment(line)
+			t := &fmtTable{comments: takeComments(), trailing: trailing}
+			switch {
+			case strings.HasPrefix(body, "[[") && strings.HasSuffix(body, "]]"):
+				t.array = true
+				t.name = strings.TrimSpace(body[2 : len(body)-2])
+			case strings.HasSuffix(body, "]"):
+				t.name = strings.TrimSpace(body[1 : len(body)-1])
+			default:
+				return nil, nil, nil, nil, errors.Errorf("malformed table header %q", line)
+			}
+
+			if len(tables) > 0 && strings.HasPrefix(t.name, tables[len(tables)-1].name+".") {
+				parent := tables[len(tables)-1]
+				parent.subs = append(parent.subs, t)
+			} else {
+				tables = append(tables, t)
+			}
+			cur = t
+		default:
+			e := fmtEntry{comments: takeComments()}
+			body, trailing := splitComment(line)
+			// Arrays may span several lines; gather them up into one. Any
+			// comments within them are hoisted above the entry.
+			for bracketDepth(body) > 0 && i+1 < len(lines) {
+				i++
+				b, c := splitComment(lines[i])
+				body += " " + b
+				if c != "" {
+					e.comments = append(e.comments, c)
+				}
+			}
+			e.trailing = trailing
+
+			eq := strings.Index(body, "=")
+			if eq < 0 {
+				return nil, nil, nil, nil, errors.Errorf("malformed line %q", line)
+			}
+			e.key = strings.TrimSpace(body[:eq])
+			e.value, err = canonicalValue(cur, e.key, strings.TrimSpace(body[eq+1:]))
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			cur.entries = append(cur.entries, e)
+		}
+	}
+	footer = trimBlank(pending)
+
+	return header, root, tables, footer, nil
+}
+
+func writeManifestLayout(header []string, root *fmtTable, tables []*fmtTable, footer []string) []byte {
+	var buf bytes.Buffer
+	sep := func() {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+	}
+
+	if len(header) > 0 {
+		writeComments(&buf, header, "")
+	}
+
+	if len(root.entries) > 0 {
+		sep()
+		writeEntries(&buf, root.entries, "")
+	}
+
+	sort.Stable(sortedFmtTables(tables))
+	for _, t := range tables {
+		sep()
+		writeTable(&buf, t)
+		for _, sub := range t.subs {
+			buf.WriteString("\n")
+			writeTable(&buf, sub)
+		}
+	}
+
+	if len(footer) > 0 {
+		sep()
+		writeComments(&buf, footer, "")
+	}
+
+	return buf.Bytes()
+}
+
+func writeTable(buf *bytes.Buffer, t *fmtTable) {
+	indent := strings.Repeat("  ", strings.Count(t.name, "."))
+	writeComments(buf, t.comments, indent)
+
+	buf.WriteString(indent)
+	if t.array {
+		buf.WriteString("[[" + t.name + "]]")
+	} else {
+		buf.WriteString("[" + t.name + "]")
+	}
+	if t.trailing != "" {
+		buf.WriteString(" " + t.trailing)
+	}
+	buf.WriteString("\n")
+
+	writeEntries(buf, t.entries, indent+"  ")
+}
+
+func writeEntries(buf *bytes.Buffer, entries []fmtEntry, indent string) {
+	sort.Stable(sortedFmtEntries(entries))
+	for _, e := range entries {
+		writeComments(buf, e.comments, indent)
+		buf.WriteString(indent + e.key + " = " + e.value)
+		if e.trailing != "" {
+			buf.WriteString(" " + e.trailing)
+		}
+		buf.WriteString("\n")
+	}
+}
+
+func writeComments(buf *bytes.Buffer, comments []string, indent string) {
+	for _, c := range comments {
+		if c == "" {
+			buf.WriteString("\n")
+			continue
+		}
+		buf.WriteString(indent + c + "\n")
+	}
+}
+
+// canonicalValue parses raw as a TOML value and renders it back the way dep
+// writes values. Version constraints in [[constraint]] and [[override]] are
+// also normalized.
+func canonicalValue(t *fmtTable, key, raw string) (string, error) {
+	if strings.Contains(raw, `"""`) || strings.Contains(raw, `'''`) {
+		return "", errors.Errorf("multi-line string for %q is not supported", key)
+	}
+
+	tree, err := toml.Load("v = " + raw)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid value for %q", key)
+	}
+
+	switch v := tree.Get("v").(type) {
+	case *toml.TomlTree:
+		// Inline tables can't be rendered on a single line by go-toml; leave
+		// them as they are.
+		return raw, nil
+	case string:
+		if t.array && (t.name == "constraint" || t.name == "override") && key == "version" {
+			tree.Set("v", normalizeVersionString(v))
+		}
+	}
+
+	s, err := tree.ToTomlString()
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to format value for %q", key)
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(s, "v = "), "\n"), nil
+}
+
+// normalizeVersionString renders a version constraint the same way dep does
+// when it writes out a manifest.
+func normalizeVersionString(v string) string {
+	v = strings.TrimSpace(v)
+	if c, err := gps.NewSemverConstraintIC(v); err == nil {
+		return c.ImpliedCaretString()
+	}
+	return v
+}
+
+// splitComment splits a line into its TOML content and a trailing comment,
+// ignoring any # characters that appear within strings.
+func splitComment(line string) (string, string) {
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i:])
+		}
+	}
+	return strings.TrimSpace(line), ""
+}
+
+// bracketDepth reports how many square brackets are left open in s, ignoring
+// those within strings.
+func bracketDepth(s string) int {
+	var quote rune
+	escaped := false
+	depth := 0
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		}
+	}
+	return depth
+}
+
+// trimBlank strips leading and trailing blank separators from a comment block.
+func trimBlank(c []string) []string {
+	for len(c) > 0 && c[0] == "" {
+		c = c[1:]
+	}
+	for len(c) > 0 && c[len(c)-1] == "" {
+		c = c[:len(c)-1]
+	}
+	return c
+}
+
+func sameManifest(a, b *Manifest) bool {
+	// The raw form holds every field of the manifest, in a canonical order,
+	// so that fields added to the manifest are covered here as well.
+	return reflect.DeepEqual(a.toRaw(), b.toRaw())
+}
+
+type sortedFmtEntries []fmtEntry
+
+func (s sortedFmtEntries) Len() int           { return len(s) }
+func (s sortedFmtEntries) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s sortedFmtEntries) Less(i, j int) bool { return s[i].key < s[j].key }
+
+// sortedFmtTables orders plain tables before arrays of tables, then by table
+// name, and finally, for arrays of tables, by their name and source keys.
+type sortedFmtTables []*fmtTable
+
+func (s sortedFmtTables) Len() int      { return len(s) }
+func (s sortedFmtTables) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s sortedFmtTables) Less(i, j int) bool {
+	l, r := s[i], s[j]
+
+	if l.array != r.array {
+		return !l.array
+	}
+	if l.name != r.name {
+		return l.name < r.name
+	}
+	if !l.array {
+		return false
+	}
+
+	ln, rn := l.value("name"), r.value("name")
+	if ln != rn {
+		return ln < rn
+	}
+	return l.value("source") < r.value("source")
+}
+
+// value returns the unquoted string value of key in t, or "" if there is none.
+func (t *fmtTable) value(key string) string {
+	for _, e := range t.entries {
+		if e.key == key {
+			if v, err := strconv.Unquote(e.value); err == nil {
+				return v
+			}
+			return e.value
+		}
+	}
+	return ""
+}
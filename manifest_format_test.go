@@ -0,0 +1,181 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestFormatManifest(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "manifest/format_golden.toml"
+	mf := h.GetTestFile("manifest/format_input.toml")
+	defer mf.Close()
+
+	got, err := FormatManifest(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *test.UpdateGolden {
+		if err = h.WriteTestFile(golden, string(got)); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		want := h.GetTestFileString(golden)
+		if string(got) != want {
+			t.Fatalf("Manifest did not format as expected:\n\t(GOT): %s\n\t(WNT): %s", string(got), want)
+		}
+	}
+
+	// Formatting must be idempotent.
+	again, err := FormatManifest(bytes.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, again) {
+		t.Fatalf("Formatting is not idempotent:\n\t(FIRST): %s\n\t(SECOND): %s", string(got), string(again))
+	}
+}
+
+func TestFormatManifestErrors(t *testing.T) {
+	cases := []string{
+		// Not valid TOML.
+		`[[constraint]`,
+		// Valid TOML, but not a valid manifest.
+		`
+		[[constraint]]
+		  name = "github.com/foo/bar"
+		  branch = "master"
+		  version = "1.0.0"
+		`,
+	}
+
+	for _, c := range cases {
+		if _, err := FormatManifest(strings.NewReader(c)); err == nil {
+			t.Errorf("expected an error formatting manifest:\n%s", c)
+		}
+	}
+}
+
+func TestFormatManifestKeepsFields(t *testing.T) {
+	cases := []struct {
+		name, key, manifest string
+		without             string // the manifest without the field, if dropping its key isn't enough
+	}{
+		{"clone-depth", "clone-depth", `
+[[constraint]]
+  name = "github.com/foo/bar"
+  clone-depth = 1
+  version = "1.0.0"
+`, ""},
+		{"ref-namespace", "ref-namespace", `
+[[constraint]]
+  name = "github.com/foo/bar"
+  ref-namespace = "refs/releases"
+`, ""},
+		{"forbidden-packages", "forbidden-packages", `
+forbidden-packages = ["github.com/foo/forbidden"]
+`, ""},
+		{"exclude", "exclude", `
+[[constraint]]
+  name = "github.com/foo/bar"
+  exclude = ["1.2.0"]
+  version = "1.0.0"
+`, ""},
+		{"keyring", "keyring", `
+keyring = "keys.asc"
+`, ""},
+		{"require-signed-tags", "require-signed-tags", `
+keyring = "keys.asc"
+require-signed-tags = true
+`, ""},
+		{"per-project require-signed-tags", "require-signed-tags", `
+keyring = "keys.asc"
+
+[[constraint]]
+  name = "github.com/foo/bar"
+  require-signed-tags = true
+`, ""},
+		{"prune keep-only", "keep-only", `
+[prune]
+  keep-only = ["*.go"]
+`, ""},
+		{"pin-digest", "pin-digest", `
+[[constraint]]
+  name = "github.com/foo/bar"
+  pin-digest = "sha256:abababababababababababababababababababababababababababababababab"
+  version = "1.0.0"
+`, ""},
+		{"digest", "digest", `
+[[constraint]]
+  digest = "sha256:abababababababababababababababababababababababababababababababab"
+  name = "github.com/foo/bar"
+  version = "1.0.0"
+`, ""},
+		{"prune keep-patterns", "keep-patterns", `
+[prune]
+  keep-patterns = ["*.dat"]
+`, ""},
+		{"source", "mirror", `
+[[source]]
+  mirror = "https://mirror.example.com/foo"
+  prefix = "github.com/foo"
+`, "\n"},
+		{"skip-test-imports", "skip-test-imports", `
+[prune]
+  skip-test-imports = true
+`, ""},
+		{"post-ensure", "post-ensure", `
+[hooks]
+  post-ensure = ["go generate ./..."]
+`, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			before, _, err := readManifest(strings.NewReader(c.manifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := FormatManifest(strings.NewReader(c.manifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, _, err := readManifest(bytes.NewReader(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameManifest(before, after) {
+				t.Errorf("formatting changed the manifest:\n\t(GOT): %s\n\t(WNT): %s", got, c.manifest)
+			}
+
+			// Without the field, the manifest must no longer be the same.
+			if c.without == "" {
+				var lines []string
+				for _, line := range strings.Split(c.manifest, "\n") {
+					if !strings.HasPrefix(strings.TrimSpace(line), c.key+" =") {
+						lines = append(lines, line)
+					}
+				}
+				c.without = strings.Join(lines, "\n")
+			}
+			without, _, err := readManifest(strings.NewReader(c.without))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sameManifest(before, without) {
+				t.Errorf("expected dropping %s to change the manifest", c.key)
+			}
+		})
+	}
+}
@@ -96,6 +96,502 @@ func TestWriteManifest(t *testing.T) {
 	}
 }
 
+func TestReadManifestFloat(t *testing.T) {
+	in := `
+[[constraint]]
+  branch = "master"
+  float = true
+  name = "github.com/foo/bar"
+
+[[constraint]]
+  name = "github.com/foo/baz"
+  version = "1.0.0"
+`
+	m, warns, err := readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Fatalf("expected no warnings, got %v", warns)
+	}
+
+	want := []gps.ProjectRoot{"github.com/foo/bar"}
+	if got := m.FloatingProjects(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected floating projects:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+
+	out, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "float = true") {
+		t.Fatalf("expected float to be written back out, got:\n%s", out)
+	}
+
+	in = `
+[[constraint]]
+  name = "github.com/foo/bar"
+  float = true
+  revision = "d05d5aca9f895d19e9265839bffeadd74a2d2ecb"
+`
+	if _, _, err = readManifest(strings.NewReader(in)); err == nil {
+		t.Fatal("expected an error when floating a revision constraint")
+	}
+}
+
+func TestReadManifestPrune(t *testing.T) {
+	in := `
+[prune]
+  build-ignored = true
+`
+	m, warns, err := readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Fatalf("expected no warnings, got %v", warns)
+	}
+	if m.PruneOptions != gps.PruneBuildIgnoredFiles {
+		t.Fatalf("expected build-ignored files to be pruned, got options %v", m.PruneOptions)
+	}
+
+	out, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "build-ignored = true") {
+		t.Fatalf("expected prune options to be written back out, got:\n%s", out)
+	}
+
+	in = `
+[prune]
+  normalize-modes = true
+`
+	m, _, err = readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.PruneOptions != gps.NormalizeFileModes {
+		t.Fatalf("expected file modes to be normalized, got options %v", m.PruneOptions)
+	}
+	out, err = m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "normalize-modes = true") {
+		t.Fatalf("expected prune options to be written back out, got:\n%s", out)
+	}
+
+	m, _, err = readManifest(strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.PruneOptions != 0 {
+		t.Fatalf("expected no pruning by default, got options %v", m.PruneOptions)
+	}
+
+	in = `
+[prune]
+  keep-only = ["**/*.go", "**/LICENSE*"]
+`
+	m, warns, err = readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Fatalf("expected no warnings, got %v", warns)
+	}
+	if want := []string{"**/*.go", "**/LICENSE*"}; !reflect.DeepEqual(m.PruneKeep, want) {
+		t.Fatalf("expected keep patterns %v, got %v", want, m.PruneKeep)
+	}
+	out, err = m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `keep-only = ["**/*.go","**/LICENSE*"]`) {
+		t.Fatalf("expected keep patterns to be written back out, got:\n%s", out)
+	}
+
+	if _, _, err = readManifest(strings.NewReader("[prune]\n  keep-only = [\"[*.go\"]\n")); err == nil {
+		t.Fatal("expected a malformed keep pattern to be rejected")
+	}
+
+	in = `
+[prune]
+  keep-patterns = ["**/*.proto", "data/*.json"]
+`
+	m, warns, err = readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Fatalf("expected no warnings, got %v", warns)
+	}
+	if want := []string{"**/*.proto", "data/*.json"}; !reflect.DeepEqual(m.PruneProtect, want) {
+		t.Fatalf("expected protected patterns %v, got %v", want, m.PruneProtect)
+	}
+	out, err = m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `keep-patterns = ["**/*.proto","data/*.json"]`) {
+		t.Fatalf("expected protected patterns to be written back out, got:\n%s", out)
+	}
+
+	if _, _, err = readManifest(strings.NewReader("[prune]\n  keep-patterns = [\"/abs\"]\n")); err == nil {
+		t.Fatal("expected a malformed keep-patterns entry to be rejected")
+	}
+
+	in = `
+[prune]
+  skip-test-imports = true
+`
+	m, warns, err = readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Fatalf("expected no warnings, got %v", warns)
+	}
+	if !m.SkipTestImports {
+		t.Fatal("expected test imports to be skipped")
+	}
+	out, err = m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "skip-test-imports = true") {
+		t.Fatalf("expected skip-test-imports to be written back out, got:\n%s", out)
+	}
+}
+
+func TestReadManifestVCS(t *testing.T) {
+	in := `
+[[constraint]]
+  name = "example.com/foo/bar"
+  vcs = "git"
+
+[[constraint]]
+  name = "bitbucket.org/foo/baz"
+  source = "hg::https://hg.example.com/baz"
+
+[[override]]
+  name = "github.com/foo/qux"
+  vcs = "git"
+  source = "git::https://git.example.com/qux"
+`
+	m, warns, err := readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Fatalf("expected no warnings, got %v", warns)
+	}
+
+	want := map[string]string{
+		"example.com/foo/bar":         "git",
+		"https://hg.example.com/baz":  "hg",
+		"https://git.example.com/qux": "git",
+	}
+	if got := m.VCSTypes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected VCS types:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+	if src := m.Constraints["bitbucket.org/foo/baz"].Source; src != "https://hg.example.com/baz" {
+		t.Fatalf("expected the VCS type to be split from the source, got %q", src)
+	}
+
+	out, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `vcs = "hg"`) {
+		t.Fatalf("expected VCS types to be written back out, got:\n%s", out)
+	}
+
+	for _, in := range []string{
+		"[[constraint]]\n  name = \"example.com/foo/bar\"\n  vcs = \"svn\"\n",
+		"[[constraint]]\n  name = \"example.com/foo/bar\"\n  vcs = \"git\"\n  source = \"hg::https://example.com/bar\"\n",
+	} {
+		if _, _, err = readManifest(strings.NewReader(in)); err == nil {
+			t.Errorf("expected an error for manifest:\n%s", in)
+		}
+	}
+}
+
+func TestReadManifestCloneDepth(t *testing.T) {
+	in := `
+[[constraint]]
+  name = "example.com/foo/bar"
+  clone-depth = 0
+
+[[override]]
+  name = "github.com/foo/qux"
+  source = "https://git.example.com/qux"
+  clone-depth = 50
+
+[[constraint]]
+  name = "example.com/foo/baz"
+`
+	m, warns, err := readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Fatalf("expected no warnings, got %v", warns)
+	}
+
+	want := map[string]int{
+		"example.com/foo/bar":         0,
+		"https://git.example.com/qux": 50,
+	}
+	if got := m.CloneDepths(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected clone depths:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+
+	out, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"clone-depth = 0", "clone-depth = 50"} {
+		if !strings.Contains(string(out), line) {
+			t.Fatalf("expected %q to be written back out, got:\n%s", line, out)
+		}
+	}
+	if n := strings.Count(string(out), "clone-depth"); n != 2 {
+		t.Fatalf("expected only the given clone depths to be written back out, got:\n%s", out)
+	}
+
+	in = "[[constraint]]\n  name = \"example.com/foo/bar\"\n  clone-depth = -1\n"
+	if _, _, err = readManifest(strings.NewReader(in)); err == nil {
+		t.Errorf("expected an error for manifest:\n%s", in)
+	}
+}
+
+func TestReadManifestRefNamespace(t *testing.T) {
+	in := `
+[[constraint]]
+  name = "example.com/foo/bar"
+  ref-namespace = "refs/releases"
+
+[[constraint]]
+  name = "example.com/foo/baz"
+`
+	m, warns, err := readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Fatalf("expected no warnings, got %v", warns)
+	}
+
+	want := map[string]string{"example.com/foo/bar": "refs/releases"}
+	if got := m.RefNamespaces(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected ref namespaces:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+
+	out, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(out), `ref-namespace = "refs/releases"`); n != 1 {
+		t.Fatalf("expected the ref namespace to be written back out once, got:\n%s", out)
+	}
+
+	for _, ns := range []string{"releases", "refs", "refs/"} {
+		in = "[[constraint]]\n  name = \"example.com/foo/bar\"\n  ref-namespace = \"" + ns + "\"\n"
+		if _, _, err = readManifest(strings.NewReader(in)); err == nil {
+			t.Errorf("expected an error for manifest:\n%s", in)
+		}
+	}
+}
+
+func TestReadManifestExclude(t *testing.T) {
+	in := `
+[[constraint]]
+  name = "example.com/foo/bar"
+  version = "^1.3.0"
+  exclude = ["v1.3.2", "v1.3.4"]
+`
+	m, warns, err := readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Fatalf("expected no warnings, got %v", warns)
+	}
+
+	want := map[gps.ProjectRoot][]string{"example.com/foo/bar": {"v1.3.2", "v1.3.4"}}
+	if !reflect.DeepEqual(m.Exclude, want) {
+		t.Fatalf("unexpected excluded versions:\n\t(GOT) %v\n\t(WNT) %v", m.Exclude, want)
+	}
+	if got := m.toRaw().Constraints[0].Exclude; !reflect.DeepEqual(got, want["example.com/foo/bar"]) {
+		t.Fatalf("expected the excluded versions to be written back out, got %v", got)
+	}
+
+	in = "[[constraint]]\n  name = \"example.com/foo/bar\"\n  exclude = [\"\"]\n"
+	if _, _, err = readManifest(strings.NewReader(in)); err == nil {
+		t.Errorf("expected an error for manifest:\n%s", in)
+	}
+}
+
+func TestReadManifestSources(t *testing.T) {
+	in := `
+[[source]]
+  prefix = "github.com/"
+  mirror = "git.corp.local/github/"
+
+[[constraint]]
+  name = "github.com/foo/bar"
+  version = "^1.0.0"
+`
+	m, warns, err := readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Fatalf("expected no warnings, got %v", warns)
+	}
+
+	want := []gps.SourceMirror{{Prefix: "github.com/", Mirror: "git.corp.local/github/"}}
+	if !reflect.DeepEqual(m.Mirrors, want) {
+		t.Fatalf("unexpected mirrors:\n\t(GOT) %v\n\t(WNT) %v", m.Mirrors, want)
+	}
+	if got := m.Constraints["github.com/foo/bar"].Source; got != "" {
+		t.Fatalf("expected the constraint's source to be left alone, got %q", got)
+	}
+
+	out, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `mirror = "git.corp.local/github/"`) {
+		t.Fatalf("expected the mirror to be written back out, got:\n%s", out)
+	}
+
+	for _, in := range []string{
+		"[[source]]\n  prefix = \"github.com/\"\n",
+		"[[source]]\n  prefix = \"a/\"\n  mirror = \"b/\"\n\n[[source]]\n  prefix = \"a/\"\n  mirror = \"c/\"\n",
+	} {
+		if _, _, err = readManifest(strings.NewReader(in)); err == nil {
+			t.Errorf("expected an error for manifest:\n%s", in)
+		}
+	}
+}
+
+func TestReadManifestSignedTags(t *testing.T) {
+	in := `
+keyring = "keys/trusted.asc"
+
+[[constraint]]
+  name = "example.com/foo/bar"
+  version = "^1.0.0"
+  require-signed-tags = true
+
+[[constraint]]
+  name = "example.com/foo/baz"
+  source = "https://example.com/mirror/baz.git"
+  require-signed-tags = true
+`
+	m, warns, err := readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Fatalf("expected no warnings, got %v", warns)
+	}
+
+	want := map[string]bool{
+		"example.com/foo/bar":                true,
+		"https://example.com/mirror/baz.git": true,
+	}
+	if got := m.SignedTagSources(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected sources limited to signed tags:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+	raw := m.toRaw()
+	if raw.Keyring != "keys/trusted.asc" || !raw.Constraints[0].RequireSignedTags {
+		t.Fatalf("expected the keyring and signed tags to be written back out, got %+v", raw)
+	}
+
+	// Requiring signed tags is pointless without keys to trust.
+	in = "require-signed-tags = true\n"
+	if _, _, err = readManifest(strings.NewReader(in)); err == nil {
+		t.Errorf("expected an error for manifest:\n%s", in)
+	}
+}
+
+func TestReadManifestPinDigest(t *testing.T) {
+	const sum = "4f5c1e58a6c37b48f2d1e4b9bde3b5d1c1f83e6a04cab7a9e35e3fb0a1c0f2d9"
+	in := `
+[[constraint]]
+  name = "example.com/foo/bar"
+  pin-digest = "sha256:` + sum + `"
+
+[[override]]
+  name = "example.com/foo/baz"
+  pin-digest = "` + strings.ToUpper(sum) + `"
+`
+	m, warns, err := readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Fatalf("expected no warnings, got %v", warns)
+	}
+
+	want := map[gps.ProjectRoot]string{
+		"example.com/foo/bar": "sha256:" + sum,
+		"example.com/foo/baz": "sha256:" + sum,
+	}
+	if !reflect.DeepEqual(m.PinDigest, want) {
+		t.Fatalf("unexpected pinned digests:\n\t(GOT) %v\n\t(WNT) %v", m.PinDigest, want)
+	}
+	raw := m.toRaw()
+	if raw.Constraints[0].PinDigest != "sha256:"+sum || raw.Overrides[0].PinDigest != "sha256:"+sum {
+		t.Fatalf("expected the digests to be written back out, got %+v", raw)
+	}
+
+	for _, bad := range []string{"sha256:abc", "md5:" + sum, "sha256:" + sum[1:] + "x"} {
+		in = "[[constraint]]\n  name = \"example.com/foo/bar\"\n  pin-digest = \"" + bad + "\"\n"
+		if _, _, err = readManifest(strings.NewReader(in)); err == nil {
+			t.Errorf("expected an error for pin-digest %q", bad)
+		}
+	}
+}
+
+func TestReadManifestDigest(t *testing.T) {
+	const sum = "4f5c1e58a6c37b48f2d1e4b9bde3b5d1c1f83e6a04cab7a9e35e3fb0a1c0f2d9"
+	in := `
+[[constraint]]
+  name = "example.com/foo/bar"
+  revision = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+  digest = "sha256:` + sum + `"
+`
+	if errs, err := validateManifest(in); err != nil || len(errs) != 0 {
+		t.Fatalf("expected digest to be a valid key, got %v, %v", errs, err)
+	}
+	m, _, err := readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.PinDigest["example.com/foo/bar"]; got != "sha256:"+sum {
+		t.Fatalf("expected digest to pin the content like pin-digest, got %q", got)
+	}
+	raw := m.toRaw()
+	if raw.Constraints[0].Digest != "sha256:"+sum || raw.Constraints[0].PinDigest != "" {
+		t.Fatalf("expected the digest to be written back out as digest, got %+v", raw.Constraints[0])
+	}
+
+	in = "[[constraint]]\n  name = \"example.com/foo/bar\"\n  digest = \"sha256:bad\"\n"
+	if _, _, err = readManifest(strings.NewReader(in)); err == nil {
+		t.Error("expected an error for an invalid digest")
+	}
+
+	in = "[[constraint]]\n  name = \"example.com/foo/bar\"\n  digest = \"sha256:" + sum + "\"\n  pin-digest = \"sha256:" + sum + "\"\n"
+	if _, _, err = readManifest(strings.NewReader(in)); err == nil {
+		t.Error("expected an error for both digest and pin-digest")
+	}
+}
+
 func TestReadManifestErrors(t *testing.T) {
 	h := test.NewHelper(t)
 	defer h.Cleanup()
@@ -222,6 +718,51 @@ func TestValidateManifest(t *testing.T) {
 			`,
 			want: []error{errors.New("revision \"8d43f8c0b836\" should not be in abbreviated form")},
 		},
+		{
+			tomlString: `
+			[prune]
+			  build-ignored = true
+			`,
+			want: []error{},
+		},
+		{
+			tomlString: `
+			[prune]
+			  build-ignored = "yes"
+			  vendor = true
+			`,
+			want: []error{
+				errors.New("\"build-ignored\" in prune should be a boolean"),
+				errors.New("Invalid key \"vendor\" in \"prune\""),
+			},
+		},
+		{
+			tomlString: `
+			[hooks]
+			  post-ensure = "go generate ./..."
+			  pre-ensure = ["true"]
+			`,
+			want: []error{
+				errors.New("\"post-ensure\" in hooks should be a TOML array of strings"),
+				errors.New("Invalid key \"pre-ensure\" in \"hooks\""),
+			},
+		},
+		{
+			tomlString: `
+			source = ["github.com/"]
+			`,
+			want: []error{
+				errors.New("source should be a TOML array of tables"),
+			},
+		},
+		{
+			tomlString: `
+			source = "github.com/"
+			`,
+			want: []error{
+				errors.New("source should be a TOML array of tables"),
+			},
+		},
 	}
 
 	// contains for error
@@ -253,3 +794,32 @@ func TestValidateManifest(t *testing.T) {
 		}
 	}
 }
+
+func TestReadManifestHooks(t *testing.T) {
+	in := `
+[hooks]
+  post-ensure = ["go generate ./...", "make mocks"]
+`
+	m, warns, err := readManifest(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Fatalf("expected no warnings, got %v", warns)
+	}
+	if want := []string{"go generate ./...", "make mocks"}; !reflect.DeepEqual(m.PostEnsure, want) {
+		t.Fatalf("expected post-ensure hooks %v, got %v", want, m.PostEnsure)
+	}
+
+	out, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `post-ensure = ["go generate ./...","make mocks"]`) {
+		t.Fatalf("expected the hooks to be written back out, got:\n%s", out)
+	}
+
+	if _, _, err = readManifest(strings.NewReader("[hooks]\n  post-ensure = [\" \"]\n")); err == nil {
+		t.Error("expected an empty hook command to be rejected")
+	}
+}
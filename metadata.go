@@ -0,0 +1,54 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/go-yaml/yaml"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
+)
+
+// MetadataName is the name of the optional file, alongside the manifest, that
+// holds human-facing metadata about the project's dependencies.
+const MetadataName = ".dep.yaml"
+
+// DependencyMetadata is human-facing information about a dependency, such as
+// who is responsible for it. It is only ever reported, and has no bearing on
+// solving.
+type DependencyMetadata struct {
+	Owner       string `yaml:"owner" json:",omitempty"`
+	Description string `yaml:"description" json:",omitempty"`
+	Review      string `yaml:"review" json:",omitempty"`
+}
+
+// readMetadata reads a mapping of project roots to their DependencyMetadata,
+// such as:
+//
+//	github.com/pkg/errors:
+//	  owner: platform-team
+//	  description: Error wrapping
+//	  review: approved
+func readMetadata(r io.Reader) (map[gps.ProjectRoot]DependencyMetadata, error) {
+	buf := &bytes.Buffer{}
+	_, err := buf.ReadFrom(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read byte stream")
+	}
+
+	raw := make(map[string]DependencyMetadata)
+	err = yaml.Unmarshal(buf.Bytes(), &raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the dependency metadata as YAML")
+	}
+
+	md := make(map[gps.ProjectRoot]DependencyMetadata, len(raw))
+	for pr, m := range raw {
+		md[gps.ProjectRoot(pr)] = m
+	}
+	return md, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/Masterminds/semver"
+	"github.com/golang/dep/internal/gps"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// A Policy holds rules that a solution must satisfy before it may be written
+// out. A Policy's ValidateSolution method can be used as Ctx.ValidateSolution.
+type Policy struct {
+	// Forbidden lists projects that must not appear in a solution.
+	Forbidden []gps.ProjectRoot
+	// NoPrerelease rejects solutions that lock a semver prerelease version.
+	NoPrerelease bool
+	// NoBranches rejects solutions that lock any project to a branch.
+	NoBranches bool
+}
+
+type rawPolicy struct {
+	Forbidden    []string `toml:"forbidden,omitempty"`
+	NoPrerelease bool     `toml:"no-prerelease,omitempty"`
+	NoBranches   bool     `toml:"no-branches,omitempty"`
+}
+
+// LoadPolicy reads the policy file at path.
+func LoadPolicy(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open policy file")
+	}
+	defer f.Close()
+
+	p, err := readPolicy(f)
+	if err != nil {
+		return nil, errors.Errorf("error while parsing %s: %s", path, err)
+	}
+	return p, nil
+}
+
+func readPolicy(r io.Reader) (*Policy, error) {
+	buf := &bytes.Buffer{}
+	_, err := buf.ReadFrom(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read byte stream")
+	}
+
+	tree, err := toml.Load(buf.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the policy as TOML")
+	}
+	// A misspelt rule would otherwise be silently ignored, and let through
+	// what it was meant to reject.
+	var unknown []string
+	for key := range tree.ToMap() {
+		switch key {
+		case "forbidden", "no-prerelease", "no-branches":
+		default:
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, errors.Errorf("Invalid key(s) %q in the policy", unknown)
+	}
+
+	raw := rawPolicy{}
+	err = toml.Unmarshal(buf.Bytes(), &raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the policy as TOML")
+	}
+
+	p := &Policy{
+		NoPrerelease: raw.NoPrerelease,
+		NoBranches:   raw.NoBranches,
+	}
+	for _, pr := range raw.Forbidden {
+		p.Forbidden = append(p.Forbidden, gps.ProjectRoot(pr))
+	}
+	return p, nil
+}
+
+// ValidateSolution returns an error describing every way in which l violates
+// the policy, or nil if it doesn't.
+func (p *Policy) ValidateSolution(l *Lock) error {
+	forbidden := make(map[gps.ProjectRoot]bool, len(p.Forbidden))
+	for _, pr := range p.Forbidden {
+		forbidden[pr] = true
+	}
+
+	var buf bytes.Buffer
+	for _, lp := range l.Projects() {
+		pr := lp.Ident().ProjectRoot
+		if forbidden[pr] {
+			fmt.Fprintf(&buf, "%s is forbidden by policy\n", pr)
+		}
+
+		if p.NoBranches && lp.Version() != nil && lp.Version().Type() == gps.IsBranch {
+			fmt.Fprintf(&buf, "%s is locked to branch %s, which is forbidden by policy\n", pr, lp.Version())
+		}
+
+		if p.NoPrerelease && lp.Version() != nil && lp.Version().Type() == gps.IsSemver {
+			if sv, err := semver.NewVersion(lp.Version().String()); err == nil && sv.Prerelease() != "" {
+				fmt.Fprintf(&buf, "%s is locked to prerelease %s, which is forbidden by policy\n", pr, lp.Version())
+			}
+		}
+	}
+
+	if buf.Len() > 0 {
+		return errors.New(buf.String())
+	}
+	return nil
+}
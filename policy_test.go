@@ -0,0 +1,103 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/internal/gps"
+)
+
+func TestReadPolicy(t *testing.T) {
+	p, err := readPolicy(strings.NewReader("forbidden = [\"github.com/foo/gpl\"]\nno-prerelease = true\nno-branches = true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Policy{
+		Forbidden:    []gps.ProjectRoot{"github.com/foo/gpl"},
+		NoPrerelease: true,
+		NoBranches:   true,
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Fatalf("expected %#v, got %#v", want, p)
+	}
+
+	if _, err = readPolicy(strings.NewReader("forbidden = [\n")); err == nil {
+		t.Fatal("expected an error for a malformed policy")
+	}
+
+	_, err = readPolicy(strings.NewReader("no-prerelease = true\nno-branch = true\n"))
+	if err == nil || !strings.Contains(err.Error(), `"no-branch"`) {
+		t.Fatalf("expected an error naming the unknown key, got %v", err)
+	}
+}
+
+func TestPolicyValidateSolution(t *testing.T) {
+	lock := func(vs ...gps.Version) *Lock {
+		l := &Lock{}
+		for i, v := range vs {
+			pi := gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(fmt.Sprintf("github.com/foo/p%d", i))}
+			l.P = append(l.P, gps.NewLockedProject(pi, v, []string{"."}))
+		}
+		return l
+	}
+	rev := gps.Revision("ff2948a2ac8f538c4ecd55962e919d1e13e74baf")
+
+	for _, tc := range []struct {
+		name   string
+		policy Policy
+		lock   *Lock
+		reject bool
+	}{
+		{
+			name: "empty policy",
+			lock: lock(gps.NewVersion("v1.0.0-rc.1").Is(rev)),
+		},
+		{
+			name:   "forbidden project",
+			policy: Policy{Forbidden: []gps.ProjectRoot{"github.com/foo/p1"}},
+			lock:   lock(gps.NewVersion("v1.0.0").Is(rev), gps.NewBranch("master").Is(rev)),
+			reject: true,
+		},
+		{
+			name:   "forbidden project absent",
+			policy: Policy{Forbidden: []gps.ProjectRoot{"github.com/foo/p9"}},
+			lock:   lock(gps.NewVersion("v1.0.0").Is(rev)),
+		},
+		{
+			name:   "prerelease",
+			policy: Policy{NoPrerelease: true},
+			lock:   lock(gps.NewVersion("v1.0.0").Is(rev), gps.NewVersion("v1.1.0-beta.2").Is(rev)),
+			reject: true,
+		},
+		{
+			name:   "branch",
+			policy: Policy{NoBranches: true},
+			lock:   lock(gps.NewVersion("v1.0.0").Is(rev), gps.NewBranch("master").Is(rev)),
+			reject: true,
+		},
+		{
+			name:   "no branches",
+			policy: Policy{NoBranches: true},
+			lock:   lock(gps.NewVersion("v1.0.0").Is(rev), gps.NewVersion("footag").Is(rev), rev),
+		},
+		{
+			name:   "no prerelease",
+			policy: Policy{NoPrerelease: true},
+			lock:   lock(gps.NewVersion("v1.0.0").Is(rev), gps.NewBranch("beta-1").Is(rev), rev),
+		},
+	} {
+		err := tc.policy.ValidateSolution(tc.lock)
+		if tc.reject && err == nil {
+			t.Errorf("%s: expected the solution to be rejected", tc.name)
+		} else if !tc.reject && err != nil {
+			t.Errorf("%s: expected the solution to be accepted, got %s", tc.name, err)
+		}
+	}
+}
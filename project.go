@@ -6,11 +6,13 @@ package dep
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
 	"github.com/golang/dep/internal/fs"
 	"github.com/golang/dep/internal/gps"
+	"github.com/pkg/errors"
 )
 
 var errProjectNotFound = fmt.Errorf("could not find project %s, use dep init to initiate a manifest", ManifestName)
@@ -46,6 +48,9 @@ type Project struct {
 	ImportRoot gps.ProjectRoot
 	Manifest   *Manifest
 	Lock       *Lock
+	// Metadata holds the human-facing metadata about dependencies from the
+	// project's MetadataName file, if it has one.
+	Metadata map[gps.ProjectRoot]DependencyMetadata
 }
 
 // MakeParams is a simple helper to create a gps.SolveParameters without setting
@@ -58,6 +63,11 @@ func (p *Project) MakeParams() gps.SolveParameters {
 
 	if p.Manifest != nil {
 		params.Manifest = p.Manifest
+
+		params.ToChange = append(params.ToChange, p.staleFloatingProjects()...)
+		params.Exclude = p.Manifest.Exclude
+		params.Mirrors = p.Manifest.Mirrors
+		params.SkipTestImports = p.Manifest.SkipTestImports
 	}
 
 	if p.Lock != nil {
@@ -67,6 +77,49 @@ func (p *Project) MakeParams() gps.SolveParameters {
 	return params
 }
 
+// LockedFloatingProjects returns the floating projects of p that are in its
+// lock, and can so be marked for change. Those that aren't are solved afresh
+// anyway.
+func (p *Project) LockedFloatingProjects() []gps.ProjectRoot {
+	if p.Manifest == nil || p.Lock == nil {
+		return nil
+	}
+
+	locked := make(map[gps.ProjectRoot]bool, len(p.Lock.P))
+	for _, lp := range p.Lock.P {
+		locked[lp.Ident().ProjectRoot] = true
+	}
+
+	var prs []gps.ProjectRoot
+	for _, pr := range p.Manifest.FloatingProjects() {
+		if locked[pr] {
+			prs = append(prs, pr)
+		}
+	}
+	return prs
+}
+
+// staleFloatingProjects returns the locked floating projects of p whose
+// locked version no longer satisfies their constraint. Every command must
+// solve those again; moving the others forward is left to ensure.
+func (p *Project) staleFloatingProjects() []gps.ProjectRoot {
+	versions := make(map[gps.ProjectRoot]gps.Version)
+	if p.Lock != nil {
+		for _, lp := range p.Lock.P {
+			versions[lp.Ident().ProjectRoot] = lp.Version()
+		}
+	}
+
+	var stale []gps.ProjectRoot
+	for _, pr := range p.LockedFloatingProjects() {
+		pp, ok := p.Manifest.Constraints[pr]
+		if ok && pp.Constraint != nil && !pp.Constraint.Matches(versions[pr]) {
+			stale = append(stale, pr)
+		}
+	}
+	return stale
+}
+
 // BackupVendor looks for existing vendor directory and if it's not empty,
 // creates a backup of it to a new directory with the provided suffix.
 func BackupVendor(vpath, suffix string) (string, error) {
@@ -93,3 +146,87 @@ func BackupVendor(vpath, suffix string) (string, error) {
 
 	return "", nil
 }
+
+// SnapshotVendor copies the vendor directory and lock of the project at root,
+// as far as they exist, into a new "_dep-backup-{suffix}" directory in root,
+// and returns its path. RestoreSnapshot puts them back.
+func SnapshotVendor(root, suffix string) (string, error) {
+	backup := filepath.Join(root, "_dep-backup-"+suffix)
+	if _, err := os.Stat(backup); !os.IsNotExist(err) {
+		return "", errVendorBackupFailed
+	}
+	if err := os.Mkdir(backup, 0777); err != nil {
+		return "", err
+	}
+
+	vendorExists, err := fs.IsDir(filepath.Join(root, "vendor"))
+	if err != nil {
+		return "", err
+	}
+	if vendorExists {
+		if err := fs.CopyDir(filepath.Join(root, "vendor"), filepath.Join(backup, "vendor")); err != nil {
+			return "", err
+		}
+	}
+
+	lock, err := ioutil.ReadFile(filepath.Join(root, LockName))
+	if os.IsNotExist(err) {
+		return backup, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(backup, LockName), lock, 0666); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+// RestoreSnapshot replaces the vendor directory and lock of the project at
+// root with those in backup, a directory made by SnapshotVendor. If either
+// is missing from backup, because the project didn't have it at the time,
+// it is removed from the project.
+func RestoreSnapshot(root, backup string) error {
+	vendorExists, err := fs.IsDir(filepath.Join(backup, "vendor"))
+	if err != nil {
+		return err
+	}
+	lock, err := ioutil.ReadFile(filepath.Join(backup, LockName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !vendorExists && lock == nil {
+		return errors.Errorf("%s holds neither a vendor directory nor a %s to restore", backup, LockName)
+	}
+
+	// Copy the vendor directory next to its final location first, so that a
+	// failed copy leaves the current one in place.
+	vpath := filepath.Join(root, "vendor")
+	tmp, err := ioutil.TempDir(root, "_vendor-restore")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if vendorExists {
+		if err := fs.CopyDir(filepath.Join(backup, "vendor"), filepath.Join(tmp, "vendor")); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(vpath); err != nil {
+		return err
+	}
+	if vendorExists {
+		if err := fs.RenameWithFallback(filepath.Join(tmp, "vendor"), vpath); err != nil {
+			return err
+		}
+	}
+
+	lpath := filepath.Join(root, LockName)
+	if lock == nil {
+		if err := os.Remove(lpath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return ioutil.WriteFile(lpath, lock, 0666)
+}
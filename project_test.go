@@ -7,6 +7,7 @@ package dep
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"testing"
 
@@ -78,6 +79,49 @@ func TestProjectMakeParams(t *testing.T) {
 	if solveParam.Lock != p.Lock {
 		t.Error("makeParams() returned gps.SolveParameters with incorrect Lock")
 	}
+
+	if len(solveParam.ToChange) != 0 {
+		t.Errorf("makeParams() should not mark any projects for change, got %v", solveParam.ToChange)
+	}
+}
+
+func TestProjectMakeParamsFloating(t *testing.T) {
+	float := gps.ProjectRoot("github.com/foo/float")
+	p := Project{
+		AbsRoot:    "someroot",
+		ImportRoot: gps.ProjectRoot("Some project root"),
+		Manifest: &Manifest{
+			Constraints: gps.ProjectConstraints{
+				float:                  {Constraint: gps.NewBranch("master")},
+				"github.com/foo/fixed": {Constraint: gps.NewBranch("master")},
+			},
+			Floating: map[gps.ProjectRoot]bool{float: true},
+		},
+	}
+	lock := func(v gps.Version) *Lock {
+		return &Lock{P: []gps.LockedProject{
+			gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: float}, v, nil),
+		}}
+	}
+
+	for _, tc := range []struct {
+		name             string
+		lock             *Lock
+		toChange, locked []gps.ProjectRoot
+	}{
+		{"no lock", nil, nil, nil},
+		{"not locked", &Lock{}, nil, nil},
+		{"locked version still satisfies", lock(gps.NewBranch("master").Is("r1")), nil, []gps.ProjectRoot{float}},
+		{"locked version no longer satisfies", lock(gps.NewBranch("dev").Is("r1")), []gps.ProjectRoot{float}, []gps.ProjectRoot{float}},
+	} {
+		p.Lock = tc.lock
+		if got := p.MakeParams().ToChange; !reflect.DeepEqual(got, tc.toChange) {
+			t.Errorf("%s: makeParams() returned unexpected ToChange:\n\t(GOT) %v\n\t(WNT) %v", tc.name, got, tc.toChange)
+		}
+		if got := p.LockedFloatingProjects(); !reflect.DeepEqual(got, tc.locked) {
+			t.Errorf("%s: unexpected locked floating projects:\n\t(GOT) %v\n\t(WNT) %v", tc.name, got, tc.locked)
+		}
+	}
 }
 
 func TestSlashedGOPATH(t *testing.T) {
@@ -38,7 +38,7 @@ func NewTestProjectContext(h *test.Helper, projectName string) *TestProjectConte
 	// Set up a Source Manager
 	var err error
 	pc.Context = &Ctx{GOPATH: pc.tempDir, Loggers: discardLoggers}
-	pc.SourceManager, err = pc.Context.SourceManager()
+	pc.SourceManager, err = pc.Context.SourceManager(nil)
 	h.Must(errors.Wrap(err, "Unable to create a SourceManager"))
 
 	return pc
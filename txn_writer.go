@@ -97,6 +97,21 @@ var lockFileComment = []byte(`# This file is autogenerated, do not edit; changes
 
 `)
 
+// VendorPruning says how the projects written into vendor are pruned.
+type VendorPruning struct {
+	// Options determines which files are pruned from each project as it is
+	// written, and whether their modes are normalized.
+	Options gps.PruneOptions
+
+	// Keep, if not empty, lists the patterns of the files to keep in each
+	// project, as taken by gps.PruneUnkeptFiles.
+	Keep []string
+
+	// Protect lists the patterns of the files in each project that are never
+	// pruned, whatever Options and Keep say.
+	Protect []string
+}
+
 // SafeWriter transactionalizes writes of manifest, lock, and vendor dir, both
 // individually and in any combination, into a pseudo-atomic action with
 // transactional rollback.
@@ -106,8 +121,26 @@ var lockFileComment = []byte(`# This file is autogenerated, do not edit; changes
 type SafeWriter struct {
 	Manifest    *Manifest
 	lock        *Lock
+	oldLock     *Lock
 	lockDiff    *gps.LockDiff
 	writeVendor bool
+	prune       VendorPruning
+
+	// RewriteVendor, if set, is called with the new vendor tree once it has
+	// been written to a temporary directory and pruned, so that it can be
+	// changed before it is verified, digested and moved into place. It isn't
+	// called when vendor isn't being written.
+	RewriteVendor func(vendor string) error
+
+	// VerifyVendor, if set, is called with the new vendor tree once it has
+	// been written to a temporary directory, before anything is moved into
+	// place. If it returns an error, nothing is written. It isn't called when
+	// vendor isn't being written.
+	VerifyVendor func(vendor string) error
+
+	// Parallel limits how many projects are exported into vendor at once.
+	// 0 exports them one at a time.
+	Parallel int
 }
 
 // NewSafeWriter sets up a SafeWriter to write a set of config yaml, lock and vendor tree.
@@ -124,10 +157,15 @@ type SafeWriter struct {
 // - If oldLock is provided without newLock, error.
 //
 // - If vendor is VendorAlways without a newLock, error.
-func NewSafeWriter(manifest *Manifest, oldLock, newLock *Lock, vendor VendorBehavior) (*SafeWriter, error) {
+//
+// When the vendor directory is written, dependencies are pruned according to
+// prune.
+func NewSafeWriter(manifest *Manifest, oldLock, newLock *Lock, vendor VendorBehavior, prune VendorPruning) (*SafeWriter, error) {
 	sw := &SafeWriter{
 		Manifest: manifest,
 		lock:     newLock,
+		oldLock:  oldLock,
+		prune:    prune,
 	}
 	if oldLock != nil {
 		if newLock == nil {
@@ -341,8 +379,42 @@ func (sw *SafeWriter) Write(root string, sm gps.SourceManager, examples bool) er
 		}
 	}
 
+	var digests map[gps.ProjectRoot]string
+	if sw.writeVendor {
+		n := sw.Parallel
+		if n < 1 {
+			n = 1
+		}
+		err = gps.WriteDepTreeParallel(filepath.Join(td, "vendor"), sw.lock, sm, true, sw.prune.Options, sw.prune.Protect, n)
+		if err != nil {
+			return errors.Wrap(err, "error while writing out vendor tree")
+		}
+		if err = pruneUnkept(filepath.Join(td, "vendor"), sw.lock, sw.prune.Keep, sw.prune.Protect); err != nil {
+			return errors.Wrap(err, "error while pruning vendor tree")
+		}
+		if sw.RewriteVendor != nil {
+			if err = sw.RewriteVendor(filepath.Join(td, "vendor")); err != nil {
+				return err
+			}
+		}
+		if sw.VerifyVendor != nil {
+			if err = sw.VerifyVendor(filepath.Join(td, "vendor")); err != nil {
+				return err
+			}
+		}
+		if digests, err = vendorDigests(filepath.Join(td, "vendor"), sw.lock); err != nil {
+			return err
+		}
+	} else if sw.HasLock() {
+		digests = keptDigests(sw.oldLock, sw.lock)
+	}
+
 	if sw.HasLock() {
-		l, err := sw.lock.MarshalTOML()
+		// The digests are recorded in a copy, so as not to touch the lock
+		// that sw was given.
+		nl := *sw.lock
+		nl.Digests = digests
+		l, err := nl.MarshalTOML()
 		if err != nil {
 			return errors.Wrap(err, "failed to marshal lock to TOML")
 		}
@@ -352,13 +424,6 @@ func (sw *SafeWriter) Write(root string, sm gps.SourceManager, examples bool) er
 		}
 	}
 
-	if sw.writeVendor {
-		err = gps.WriteDepTree(filepath.Join(td, "vendor"), sw.lock, sm, true)
-		if err != nil {
-			return errors.Wrap(err, "error while writing out vendor tree")
-		}
-	}
-
 	// Ensure vendor/.git is preserved if present
 	if hasDotGit(vpath) {
 		err = fs.RenameWithFallback(filepath.Join(vpath, ".git"), filepath.Join(td, "vendor/.git"))
@@ -502,6 +567,71 @@ func (sw *SafeWriter) PrintPreparedActions(output *log.Logger) error {
 	return nil
 }
 
+// vendorDigests returns the content digest of the copy of each project of l
+// vendored under vendor, as DigestDir computes it.
+func vendorDigests(vendor string, l *Lock) (map[gps.ProjectRoot]string, error) {
+	digests := make(map[gps.ProjectRoot]string, len(l.P))
+	for _, lp := range l.P {
+		pr := lp.Ident().ProjectRoot
+		dir := filepath.Join(vendor, filepath.FromSlash(string(pr)))
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			continue
+		}
+		digest, err := DigestDir(dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to digest the vendored copy of %s", pr)
+		}
+		digests[pr] = digest
+	}
+	return digests, nil
+}
+
+// keptDigests returns the digests that oldLock records for the projects of
+// newLock that are locked as they were there, as their vendored copies are
+// left as they are when vendor isn't written. Without oldLock, the digests of
+// newLock are kept.
+func keptDigests(oldLock, newLock *Lock) map[gps.ProjectRoot]string {
+	if oldLock == nil {
+		return newLock.Digests
+	}
+
+	old := make(map[gps.ProjectRoot]gps.LockedProject, len(oldLock.P))
+	for _, lp := range oldLock.P {
+		old[lp.Ident().ProjectRoot] = lp
+	}
+	var digests map[gps.ProjectRoot]string
+	for _, lp := range newLock.P {
+		pr := lp.Ident().ProjectRoot
+		digest, has := oldLock.Digests[pr]
+		if olp, ok := old[pr]; !has || !ok || !olp.Eq(lp) {
+			continue
+		}
+		if digests == nil {
+			digests = make(map[gps.ProjectRoot]string)
+		}
+		digests[pr] = digest
+	}
+	return digests
+}
+
+// pruneUnkept prunes the files matching none of the keep or protect patterns
+// from each project of l written under vendorDir. The patterns of each project
+// are matched against its own files alone, leaving those of projects nested
+// within it to their own patterns. It does nothing if keep is empty.
+func pruneUnkept(vendorDir string, l *Lock, keep, protect []string) error {
+	if len(keep) == 0 {
+		return nil
+	}
+	keep = append(append([]string(nil), keep...), protect...)
+	for _, lp := range l.Projects() {
+		dir := filepath.Join(vendorDir, filepath.FromSlash(string(lp.Ident().ProjectRoot)))
+		if err := gps.PruneUnkeptFiles(dir, keep, nestedProjectDirs(vendorDir, l, lp)); err != nil {
+			return errors.Wrapf(err, "failed to prune %s", lp.Ident().ProjectRoot)
+		}
+	}
+	return nil
+}
+
 // PruneProject removes unused packages from a project.
 func PruneProject(p *Project, sm gps.SourceManager, logger *log.Logger) error {
 	td, err := ioutil.TempDir(os.TempDir(), "dep")
@@ -510,7 +640,11 @@ func PruneProject(p *Project, sm gps.SourceManager, logger *log.Logger) error {
 	}
 	defer os.RemoveAll(td)
 
-	if err := gps.WriteDepTree(td, p.Lock, sm, true); err != nil {
+	prune := p.Manifest.VendorPruning()
+	if err := gps.WriteDepTreeParallel(td, p.Lock, sm, true, prune.Options, prune.Protect, 1); err != nil {
+		return err
+	}
+	if err := pruneUnkept(td, p.Lock, prune.Keep, prune.Protect); err != nil {
 		return err
 	}
 
@@ -538,7 +672,11 @@ func PruneProject(p *Project, sm gps.SourceManager, logger *log.Logger) error {
 		}
 	}
 
-	if err := deleteDirs(toDelete); err != nil {
+	protected, err := protectedFiles(td, p.Lock, prune.Protect)
+	if err != nil {
+		return err
+	}
+	if err := deleteDirs(toDelete, protected); err != nil {
 		return err
 	}
 
@@ -607,17 +745,103 @@ func calculatePrune(vendorDir string, keep []string, logger *log.Logger) ([]stri
 	return toDelete, err
 }
 
-func deleteDirs(toDelete []string) error {
+// deleteDirs deletes the directories toDelete. Those holding any of the
+// protected files, at any depth, only lose their other files, and are kept if
+// that doesn't leave them empty.
+func deleteDirs(toDelete []string, protected map[string]bool) error {
 	// sort by length so we delete sub dirs first
 	sort.Sort(byLen(toDelete))
 	for _, path := range toDelete {
-		if err := os.RemoveAll(path); err != nil {
+		if !holdsProtected(path, protected) {
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
 			return err
 		}
+		for _, fi := range infos {
+			fp := filepath.Join(path, fi.Name())
+			if fi.IsDir() || protected[fp] {
+				continue
+			}
+			if err := os.Remove(fp); err != nil {
+				return err
+			}
+		}
+		if nonEmpty, err := fs.IsNonEmptyDir(path); err != nil {
+			return err
+		} else if !nonEmpty {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
+// protectedFiles returns the set of the files of each project of l written
+// under vendorDir that match one of the protect patterns, leaving the files of
+// projects nested within it to their own patterns.
+func protectedFiles(vendorDir string, l *Lock, protect []string) (map[string]bool, error) {
+	protected := make(map[string]bool)
+	if len(protect) == 0 {
+		return protected, nil
+	}
+	for _, lp := range l.Projects() {
+		dir := filepath.Join(vendorDir, filepath.FromSlash(string(lp.Ident().ProjectRoot)))
+		nested := nestedProjectDirs(vendorDir, l, lp)
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				for _, n := range nested {
+					if path == n {
+						return filepath.SkipDir
+					}
+				}
+				return nil
+			}
+			match, err := gps.MatchesKeepPattern(dir, path, protect)
+			if match {
+				protected[path] = true
+			}
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to find the protected files of %s", lp.Ident().ProjectRoot)
+		}
+	}
+	return protected, nil
+}
+
+// nestedProjectDirs returns the directories under vendorDir of the projects
+// of l that are nested within lp.
+func nestedProjectDirs(vendorDir string, l *Lock, lp gps.LockedProject) []string {
+	root := string(lp.Ident().ProjectRoot)
+	var dirs []string
+	for _, other := range l.Projects() {
+		if pr := string(other.Ident().ProjectRoot); strings.HasPrefix(pr, root+"/") {
+			dirs = append(dirs, filepath.Join(vendorDir, filepath.FromSlash(pr)))
+		}
+	}
+	return dirs
+}
+
+// holdsProtected reports whether any of the protected files is within dir.
+func holdsProtected(dir string, protected map[string]bool) bool {
+	for path := range protected {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
 // hasDotGit checks if a given path has .git file or directory in it.
 func hasDotGit(path string) bool {
 	gitfilepath := filepath.Join(path, ".git")
@@ -8,9 +8,11 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/golang/dep/internal/gps"
 	"github.com/golang/dep/internal/test"
 	"github.com/pkg/errors"
 )
@@ -25,7 +27,7 @@ func TestSafeWriter_BadInput_MissingRoot(t *testing.T) {
 	pc := NewTestProjectContext(h, safeWriterProject)
 	defer pc.Release()
 
-	sw, _ := NewSafeWriter(nil, nil, nil, VendorOnChanged)
+	sw, _ := NewSafeWriter(nil, nil, nil, VendorOnChanged, VendorPruning{})
 	err := sw.Write("", pc.SourceManager, true)
 
 	if err == nil {
@@ -43,7 +45,7 @@ func TestSafeWriter_BadInput_MissingSourceManager(t *testing.T) {
 	pc.CopyFile(LockName, safeWriterGoldenLock)
 	pc.Load()
 
-	sw, _ := NewSafeWriter(nil, nil, pc.Project.Lock, VendorAlways)
+	sw, _ := NewSafeWriter(nil, nil, pc.Project.Lock, VendorAlways, VendorPruning{})
 	err := sw.Write(pc.Project.AbsRoot, nil, true)
 
 	if err == nil {
@@ -59,7 +61,7 @@ func TestSafeWriter_BadInput_ForceVendorMissingLock(t *testing.T) {
 	pc := NewTestProjectContext(h, safeWriterProject)
 	defer pc.Release()
 
-	_, err := NewSafeWriter(nil, nil, nil, VendorAlways)
+	_, err := NewSafeWriter(nil, nil, nil, VendorAlways, VendorPruning{})
 	if err == nil {
 		t.Fatal("should have errored without a lock when forceVendor is true, but did not")
 	} else if !strings.Contains(err.Error(), "newLock") {
@@ -75,7 +77,7 @@ func TestSafeWriter_BadInput_OldLockOnly(t *testing.T) {
 	pc.CopyFile(LockName, safeWriterGoldenLock)
 	pc.Load()
 
-	_, err := NewSafeWriter(nil, pc.Project.Lock, nil, VendorAlways)
+	_, err := NewSafeWriter(nil, pc.Project.Lock, nil, VendorAlways, VendorPruning{})
 	if err == nil {
 		t.Fatal("should have errored with only an old lock, but did not")
 	} else if !strings.Contains(err.Error(), "oldLock") {
@@ -89,7 +91,7 @@ func TestSafeWriter_BadInput_NonexistentRoot(t *testing.T) {
 	pc := NewTestProjectContext(h, safeWriterProject)
 	defer pc.Release()
 
-	sw, _ := NewSafeWriter(nil, nil, nil, VendorOnChanged)
+	sw, _ := NewSafeWriter(nil, nil, nil, VendorOnChanged, VendorPruning{})
 
 	missingroot := filepath.Join(pc.Project.AbsRoot, "nonexistent")
 	err := sw.Write(missingroot, pc.SourceManager, true)
@@ -107,7 +109,7 @@ func TestSafeWriter_BadInput_RootIsFile(t *testing.T) {
 	pc := NewTestProjectContext(h, safeWriterProject)
 	defer pc.Release()
 
-	sw, _ := NewSafeWriter(nil, nil, nil, VendorOnChanged)
+	sw, _ := NewSafeWriter(nil, nil, nil, VendorOnChanged, VendorPruning{})
 
 	fileroot := pc.CopyFile("fileroot", "txn_writer/badinput_fileroot")
 	err := sw.Write(fileroot, pc.SourceManager, true)
@@ -131,7 +133,7 @@ func TestSafeWriter_Manifest(t *testing.T) {
 	pc.CopyFile(ManifestName, safeWriterGoldenManifest)
 	pc.Load()
 
-	sw, _ := NewSafeWriter(pc.Project.Manifest, nil, nil, VendorOnChanged)
+	sw, _ := NewSafeWriter(pc.Project.Manifest, nil, nil, VendorOnChanged, VendorPruning{})
 
 	// Verify prepared actions
 	if !sw.HasManifest() {
@@ -173,7 +175,7 @@ func TestSafeWriter_ManifestAndUnmodifiedLock(t *testing.T) {
 	pc.CopyFile(LockName, safeWriterGoldenLock)
 	pc.Load()
 
-	sw, _ := NewSafeWriter(pc.Project.Manifest, pc.Project.Lock, pc.Project.Lock, VendorOnChanged)
+	sw, _ := NewSafeWriter(pc.Project.Manifest, pc.Project.Lock, pc.Project.Lock, VendorOnChanged, VendorPruning{})
 
 	// Verify prepared actions
 	if !sw.HasManifest() {
@@ -215,7 +217,7 @@ func TestSafeWriter_ManifestAndUnmodifiedLockWithForceVendor(t *testing.T) {
 	pc.CopyFile(LockName, safeWriterGoldenLock)
 	pc.Load()
 
-	sw, _ := NewSafeWriter(pc.Project.Manifest, pc.Project.Lock, pc.Project.Lock, VendorAlways)
+	sw, _ := NewSafeWriter(pc.Project.Manifest, pc.Project.Lock, pc.Project.Lock, VendorAlways, VendorPruning{})
 
 	// Verify prepared actions
 	if !sw.HasManifest() {
@@ -262,7 +264,7 @@ func TestSafeWriter_ModifiedLock(t *testing.T) {
 	originalLock := new(Lock)
 	*originalLock = *pc.Project.Lock
 	originalLock.SolveMeta.InputsDigest = []byte{} // zero out the input hash to ensure non-equivalency
-	sw, _ := NewSafeWriter(nil, originalLock, pc.Project.Lock, VendorOnChanged)
+	sw, _ := NewSafeWriter(nil, originalLock, pc.Project.Lock, VendorOnChanged, VendorPruning{})
 
 	// Verify prepared actions
 	if sw.HasManifest() {
@@ -309,7 +311,7 @@ func TestSafeWriter_ModifiedLockSkipVendor(t *testing.T) {
 	originalLock := new(Lock)
 	*originalLock = *pc.Project.Lock
 	originalLock.SolveMeta.InputsDigest = []byte{} // zero out the input hash to ensure non-equivalency
-	sw, _ := NewSafeWriter(nil, originalLock, pc.Project.Lock, VendorNever)
+	sw, _ := NewSafeWriter(nil, originalLock, pc.Project.Lock, VendorNever, VendorPruning{})
 
 	// Verify prepared actions
 	if sw.HasManifest() {
@@ -338,6 +340,63 @@ func TestSafeWriter_ModifiedLockSkipVendor(t *testing.T) {
 	}
 }
 
+func TestSafeWriter_ModifiedLockSkipVendorNotVerified(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	pc := NewTestProjectContext(h, safeWriterProject)
+	defer pc.Release()
+	pc.CopyFile(LockName, safeWriterGoldenLock)
+	pc.Load()
+
+	originalLock := new(Lock)
+	*originalLock = *pc.Project.Lock
+	originalLock.SolveMeta.InputsDigest = []byte{}
+	sw, _ := NewSafeWriter(nil, originalLock, pc.Project.Lock, VendorNever, VendorPruning{})
+
+	// The vendor tree on disk isn't written, so it isn't sw's to verify.
+	sw.VerifyVendor = func(vendor string) error {
+		return errors.Errorf("unexpected verification of %s", vendor)
+	}
+	err := sw.Write(pc.Project.AbsRoot, pc.SourceManager, true)
+	h.Must(errors.Wrap(err, "SafeWriter.Write failed"))
+
+	if err := pc.LockShouldMatchGolden(safeWriterGoldenLock); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeptDigests(t *testing.T) {
+	id := func(pr string) gps.ProjectIdentifier {
+		return gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(pr)}
+	}
+	oldLock := &Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(id("a"), gps.NewVersion("v1.0.0").Is("r1"), []string{"."}),
+			gps.NewLockedProject(id("b"), gps.NewVersion("v1.0.0").Is("r2"), []string{"."}),
+			gps.NewLockedProject(id("c"), gps.NewVersion("v1.0.0").Is("r3"), []string{"."}),
+		},
+		Digests: map[gps.ProjectRoot]string{"a": "sha256:a", "b": "sha256:b"},
+	}
+	newLock := &Lock{
+		P: []gps.LockedProject{
+			gps.NewLockedProject(id("a"), gps.NewVersion("v1.0.0").Is("r1"), []string{"."}),
+			gps.NewLockedProject(id("b"), gps.NewVersion("v1.1.0").Is("r4"), []string{"."}),
+			gps.NewLockedProject(id("c"), gps.NewVersion("v1.0.0").Is("r3"), []string{"."}),
+		},
+	}
+
+	// Only the digest of a, which is locked as it was, still holds for its
+	// vendored copy; c never had one.
+	want := map[gps.ProjectRoot]string{"a": "sha256:a"}
+	if got := keptDigests(oldLock, newLock); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected digests:\n\t(GOT) %v\n\t(WNT) %v", got, want)
+	}
+	if got := keptDigests(nil, oldLock); !reflect.DeepEqual(got, oldLock.Digests) {
+		t.Errorf("expected the digests of the lock without an old one, got %v", got)
+	}
+}
+
 func TestSafeWriter_ForceVendorWhenVendorAlreadyExists(t *testing.T) {
 	test.NeedsExternalNetwork(t)
 	test.NeedsGit(t)
@@ -350,12 +409,12 @@ func TestSafeWriter_ForceVendorWhenVendorAlreadyExists(t *testing.T) {
 	pc.CopyFile(LockName, safeWriterGoldenLock)
 	pc.Load()
 
-	sw, _ := NewSafeWriter(nil, pc.Project.Lock, pc.Project.Lock, VendorAlways)
+	sw, _ := NewSafeWriter(nil, pc.Project.Lock, pc.Project.Lock, VendorAlways, VendorPruning{})
 	err := sw.Write(pc.Project.AbsRoot, pc.SourceManager, true)
 	h.Must(errors.Wrap(err, "SafeWriter.Write failed"))
 
 	// Verify prepared actions
-	sw, _ = NewSafeWriter(nil, nil, pc.Project.Lock, VendorAlways)
+	sw, _ = NewSafeWriter(nil, nil, pc.Project.Lock, VendorAlways, VendorPruning{})
 	if sw.HasManifest() {
 		t.Fatal("Did not expect the payload to contain the manifest")
 	}
@@ -399,7 +458,7 @@ func TestSafeWriter_NewLock(t *testing.T) {
 	defer lf.Close()
 	newLock, err := readLock(lf)
 	h.Must(err)
-	sw, _ := NewSafeWriter(nil, nil, newLock, VendorOnChanged)
+	sw, _ := NewSafeWriter(nil, nil, newLock, VendorOnChanged, VendorPruning{})
 
 	// Verify prepared actions
 	if sw.HasManifest() {
@@ -443,7 +502,7 @@ func TestSafeWriter_NewLockSkipVendor(t *testing.T) {
 	defer lf.Close()
 	newLock, err := readLock(lf)
 	h.Must(err)
-	sw, _ := NewSafeWriter(nil, nil, newLock, VendorNever)
+	sw, _ := NewSafeWriter(nil, nil, newLock, VendorNever, VendorPruning{})
 
 	// Verify prepared actions
 	if sw.HasManifest() {
@@ -489,7 +548,7 @@ func TestSafeWriter_DiffLocks(t *testing.T) {
 	updatedLock, err := readLock(ulf)
 	h.Must(err)
 
-	sw, _ := NewSafeWriter(nil, pc.Project.Lock, updatedLock, VendorOnChanged)
+	sw, _ := NewSafeWriter(nil, pc.Project.Lock, updatedLock, VendorOnChanged, VendorPruning{})
 
 	// Verify lock diff
 	diff := sw.lockDiff
@@ -534,7 +593,7 @@ func TestSafeWriter_VendorDotGitPreservedWithForceVendor(t *testing.T) {
 	pc.CopyFile(LockName, safeWriterGoldenLock)
 	pc.Load()
 
-	sw, _ := NewSafeWriter(pc.Project.Manifest, pc.Project.Lock, pc.Project.Lock, VendorAlways)
+	sw, _ := NewSafeWriter(pc.Project.Manifest, pc.Project.Lock, pc.Project.Lock, VendorAlways, VendorPruning{})
 
 	// Verify prepared actions
 	if !sw.HasManifest() {
@@ -567,3 +626,61 @@ func TestSafeWriter_VendorDotGitPreservedWithForceVendor(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestDeleteDirsProtected(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	for _, name := range []string{
+		"unused/unused.go",
+		"unused/api/api.go",
+		"unused/api/api.proto",
+		"unused/other/other.go",
+	} {
+		h.TempFile(filepath.Join("vendor", filepath.FromSlash(name)), "")
+	}
+	vendor := h.Path("vendor")
+	toDelete := []string{
+		filepath.Join(vendor, "unused"),
+		filepath.Join(vendor, "unused", "api"),
+		filepath.Join(vendor, "unused", "other"),
+	}
+	protected := map[string]bool{filepath.Join(vendor, "unused", "api", "api.proto"): true}
+
+	h.Must(deleteDirs(toDelete, protected))
+
+	h.MustExist(filepath.Join(vendor, "unused", "api", "api.proto"))
+	for _, name := range []string{"unused/unused.go", "unused/api/api.go", "unused/other"} {
+		h.MustNotExist(filepath.Join(vendor, filepath.FromSlash(name)))
+	}
+}
+
+func TestPruneUnkeptNested(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	for _, name := range []string{
+		"github.com/a/a/a.go",
+		"github.com/a/a/docs/doc.md",
+		"github.com/a/a/nested/nested.go",
+		"github.com/a/a/nested/docs/doc.md",
+	} {
+		h.TempFile(filepath.Join("vendor", filepath.FromSlash(name)), "")
+	}
+	vendor := h.Path("vendor")
+	l := &Lock{P: []gps.LockedProject{
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/a/a"}, gps.NewVersion("v1.0.0"), []string{"."}),
+		gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: "github.com/a/a/nested"}, gps.NewVersion("v1.0.0"), []string{"."}),
+	}}
+
+	// The patterns are matched against the files of each project from its own
+	// root, so the nested project keeps its Go files.
+	h.Must(pruneUnkept(vendor, l, []string{"*.go"}, nil))
+
+	for _, name := range []string{"github.com/a/a/a.go", "github.com/a/a/nested/nested.go"} {
+		h.MustExist(filepath.Join(vendor, filepath.FromSlash(name)))
+	}
+	for _, name := range []string{"github.com/a/a/docs", "github.com/a/a/nested/docs"} {
+		h.MustNotExist(filepath.Join(vendor, filepath.FromSlash(name)))
+	}
+}